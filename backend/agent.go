@@ -0,0 +1,54 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"time"
+
+	"github.com/VarthanV/load-tester/controllers"
+	"github.com/VarthanV/load-tester/pkg/cluster"
+	"github.com/gin-gonic/gin"
+	"github.com/sirupsen/logrus"
+)
+
+// Runs the binary as an agent that generates load on behalf of a controller
+func runAgent(args []string) {
+	flags := flag.NewFlagSet("agent", flag.ExitOnError)
+	host := flags.String("host", "127.0.0.1", "address the agent listens on, 0.0.0.0 to accept controllers on other hosts")
+	port := flags.String("port", "8070", "port the agent listens on")
+	token := flags.String("token", os.Getenv("AGENT_TOKEN"), "token shared with the controller, defaults to $AGENT_TOKEN")
+	controllerURL := flags.String("controller", "http://localhost:8060", "URL of the controller to register with")
+	advertise := flags.String("advertise", "", "URL the controller reaches the agent at, defaults to http://localhost:<port>")
+	flags.Parse(args)
+
+	if *token == "" {
+		logrus.Fatal("agents need the token of the controller, pass -token or set AGENT_TOKEN")
+	}
+
+	if *advertise == "" {
+		*advertise = fmt.Sprintf("http://localhost:%s", *port)
+	}
+
+	r := gin.Default()
+	ctrl := controllers.NewAgentController()
+
+	r.GET("/ping", func(ctx *gin.Context) {
+		ctx.String(http.StatusOK, "pong")
+	})
+
+	agentGroup := r.Group("/agent", controllers.RequireToken(*token))
+	agentGroup.POST("/runs", ctrl.StartRun)
+	agentGroup.GET("/runs/:id", ctrl.GetRun)
+	agentGroup.DELETE("/runs/:id", ctrl.DeleteRun)
+
+	go cluster.Register(context.Background(), *controllerURL, *advertise, *token, 10*time.Second)
+
+	err := r.Run(net.JoinHostPort(*host, *port))
+	if err != nil {
+		logrus.Fatal("error in running agent ", err)
+	}
+}
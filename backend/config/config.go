@@ -15,9 +15,24 @@ type DatabaseConfiguration struct {
 	DatabaseName string `mapstructure:"DATABASE_NAME"`
 }
 
+// Where the sample logs of tests are kept and for how long
+type SamplesConfiguration struct {
+	// Defaults to samples
+	Directory     string `mapstructure:"SAMPLES_DIRECTORY"`
+	MaxAgeInHours int    `mapstructure:"SAMPLES_MAX_AGE_IN_HOURS"`
+	MaxSizeInMB   int    `mapstructure:"SAMPLES_MAX_SIZE_IN_MB"`
+}
+
+// Distributed mode, agents are only accepted with the token
+type ClusterConfiguration struct {
+	AgentToken string `mapstructure:"AGENT_TOKEN"`
+}
+
 type Config struct {
 	Server   ServerConfiguration   `mapstructure:",squash"`
 	Database DatabaseConfiguration `mapstructure:",squash"`
+	Samples  SamplesConfiguration  `mapstructure:",squash"`
+	Cluster  ClusterConfiguration  `mapstructure:",squash"`
 }
 
 func Load() (*Config, error) {
@@ -35,7 +50,7 @@ func Load() (*Config, error) {
 		return nil, err
 	}
 
-	err = mapstructure.Decode(result, &config)
+	err = mapstructure.WeakDecode(result, &config)
 	if err != nil {
 		logrus.Error("error in decoding result ", err)
 		return nil, err
@@ -0,0 +1,212 @@
+package controllers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"sync"
+
+	"github.com/VarthanV/load-tester/models"
+	"github.com/VarthanV/load-tester/pkg/cluster"
+	"github.com/VarthanV/load-tester/pkg/liveupdate"
+	"github.com/VarthanV/load-tester/pkg/spec"
+	"github.com/VarthanV/load-tester/pkg/tester"
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/sirupsen/logrus"
+)
+
+// RequireToken: rejects requests without the token shared by the controller
+// and its agents, everything is rejected when no token is configured
+func RequireToken(token string) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		if !cluster.Authorized(ctx.Request, token) {
+			ctx.AbortWithError(http.StatusUnauthorized, errors.New("missing or invalid agent token"))
+			return
+		}
+		ctx.Next()
+	}
+}
+
+// Registers an agent or refreshes its heartbeat
+func (c *Controller) RegisterAgent(ctx *gin.Context) {
+	request := cluster.RegisterRequest{}
+	err := ctx.ShouldBindJSON(&request)
+	if err != nil || request.Address == "" {
+		logrus.Error("error in binding request ", err)
+		ctx.AbortWithError(http.StatusBadRequest, errors.New("invalid agent address"))
+		return
+	}
+
+	c.Coordinator.Registry.Register(request.Address)
+	ctx.Status(http.StatusOK)
+}
+
+func (c *Controller) ListAgents(ctx *gin.Context) {
+	ctx.JSON(http.StatusOK, c.Coordinator.Registry.Healthy())
+}
+
+func (c *Controller) runDistributed(testID uuid.UUID, s *spec.Spec) {
+	logrus.Info("Starting distributed test for id ", testID)
+
+	report, err := c.Coordinator.Run(context.Background(), testID, s,
+		s.Thresholds, s.Failures, s.Load.TargetUsers, s.Load.UsersToStartWith,
+		func(u *liveupdate.Update) {
+			c.Updates.Set(testID, u)
+		})
+	if errors.Is(err, cluster.ErrNoAgents) {
+		logrus.Warn("no agents registered, running test locally")
+		c.runLocal(context.Background(), testID, s)
+		return
+	}
+	if err != nil {
+		logrus.Error("error in running distributed test ", err)
+		if report == nil {
+			c.failTest(testID, err)
+			return
+		}
+	}
+
+	marshalled, err := json.Marshal(report)
+	if err != nil {
+		logrus.Error("unable to marshal report ", err)
+		return
+	}
+
+	err = c.DB.Model(&models.Test{}).Where(&models.Test{
+		UUID: testID,
+	}).Updates(&models.Test{
+		TotalRequests:     report.RequestedDone,
+		SucceededRequests: report.SucceededRequests,
+		FailedRequests:    report.FailedRequests,
+		Report:            marshalled,
+		Status:            models.StatusDone,
+	}).Error
+	if err != nil {
+		logrus.Error("unable to update ", err)
+	}
+
+	// Lost agents never report back all their requests, dropping the live
+	// update lets pollers pick up the stored report
+	c.Updates.Delete(testID)
+}
+
+// AgentController: serves the jobs the controller hands to an agent
+type AgentController struct {
+	Updates liveupdate.Updater
+
+	mu   sync.Mutex
+	runs map[uuid.UUID]*agentRun
+}
+
+type agentRun struct {
+	done   chan struct{}
+	report *tester.Report
+}
+
+func NewAgentController() *AgentController {
+	return &AgentController{
+		Updates: liveupdate.New(),
+		runs:    map[uuid.UUID]*agentRun{},
+	}
+}
+
+func (a *AgentController) StartRun(ctx *gin.Context) {
+	job := cluster.Job{}
+	err := ctx.ShouldBindJSON(&job)
+	if err != nil {
+		logrus.Error("error in binding job ", err)
+		ctx.AbortWithError(http.StatusBadRequest, err)
+		return
+	}
+
+	s := spec.Spec{}
+	err = json.Unmarshal(job.Test, &s)
+	if err != nil {
+		logrus.Error("error in decoding test ", err)
+		ctx.AbortWithError(http.StatusBadRequest, err)
+		return
+	}
+	s.Load.TargetUsers = job.TargetUsers
+	s.Load.UsersToStartWith = job.UsersToStartWith
+
+	driver, err := tester.New(a.Updates, s.Options()...)
+	if err != nil {
+		logrus.Error("error in creating load tester ", err)
+		ctx.AbortWithError(http.StatusBadRequest, err)
+		return
+	}
+
+	run := &agentRun{done: make(chan struct{})}
+	a.mu.Lock()
+	a.runs[job.TestID] = run
+	a.mu.Unlock()
+
+	go func() {
+		defer close(run.done)
+		logrus.Info("Starting job for id ", job.TestID)
+		driver.Run(context.Background(), job.TestID)
+		run.report = driver.Report()
+	}()
+
+	ctx.Status(http.StatusCreated)
+}
+
+func (a *AgentController) GetRun(ctx *gin.Context) {
+	testID, err := uuid.Parse(ctx.Param("id"))
+	if err != nil {
+		ctx.AbortWithError(http.StatusBadRequest, errors.New("invalid test id"))
+		return
+	}
+
+	a.mu.Lock()
+	run, ok := a.runs[testID]
+	a.mu.Unlock()
+	if !ok {
+		ctx.AbortWithError(http.StatusNotFound, errors.New("unknown test id"))
+		return
+	}
+
+	status := cluster.RunStatus{}
+	status.Update, _ = a.Updates.Get(testID)
+
+	select {
+	case <-run.done:
+		status.Done = true
+		status.Report = run.report
+	default:
+	}
+
+	ctx.JSON(http.StatusOK, status)
+}
+
+// Forgets a run once the controller collected its report
+func (a *AgentController) DeleteRun(ctx *gin.Context) {
+	testID, err := uuid.Parse(ctx.Param("id"))
+	if err != nil {
+		ctx.AbortWithError(http.StatusBadRequest, errors.New("invalid test id"))
+		return
+	}
+
+	a.mu.Lock()
+	run, ok := a.runs[testID]
+	a.mu.Unlock()
+	if !ok {
+		ctx.AbortWithError(http.StatusNotFound, errors.New("unknown test id"))
+		return
+	}
+
+	select {
+	case <-run.done:
+	default:
+		ctx.AbortWithError(http.StatusConflict, errors.New("run hasn't finished yet"))
+		return
+	}
+
+	a.mu.Lock()
+	delete(a.runs, testID)
+	a.mu.Unlock()
+	a.Updates.Delete(testID)
+	ctx.Status(http.StatusNoContent)
+}
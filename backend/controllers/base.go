@@ -1,8 +1,12 @@
 package controllers
 
 import (
+	"sync"
+
 	"github.com/VarthanV/load-tester/config"
+	"github.com/VarthanV/load-tester/pkg/cluster"
 	"github.com/VarthanV/load-tester/pkg/liveupdate"
+	"github.com/VarthanV/load-tester/pkg/samplestore"
 	"gorm.io/gorm"
 )
 
@@ -10,4 +14,10 @@ type Controller struct {
 	DB      *gorm.DB
 	Updates liveupdate.Updater
 	Cfg     *config.Config
+	// Runs distributed tests over the registered agents
+	Coordinator *cluster.Coordinator
+	// Sample logs of the tests that asked for them
+	Samples *samplestore.Store
+
+	recordings sync.Map
 }
@@ -0,0 +1,142 @@
+package controllers
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"strings"
+
+	"github.com/VarthanV/load-tester/models"
+	"github.com/VarthanV/load-tester/pkg/spec"
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/sirupsen/logrus"
+)
+
+// Creates a test from a definition file, the body is read as YAML unless
+// the content type or the format query says JSON
+func (c *Controller) CreateTestFromDefinition(ctx *gin.Context) {
+	data, err := io.ReadAll(ctx.Request.Body)
+	if err != nil {
+		logrus.Error("error in reading definition ", err)
+		ctx.AbortWithError(http.StatusBadRequest, err)
+		return
+	}
+
+	format := ctx.Query("format")
+	if format == "" {
+		format = spec.FormatYAML
+		if strings.Contains(ctx.ContentType(), "json") {
+			format = spec.FormatJSON
+		}
+	}
+
+	s, err := spec.Parse(data, format)
+	if err != nil {
+		abortWithValidationError(ctx, err)
+		return
+	}
+
+	c.startTest(ctx, s)
+}
+
+// Definition the test was run with, so the run can be reproduced, with its
+// secrets redacted
+func (c *Controller) GetDefinition(ctx *gin.Context) {
+	var (
+		test = models.Test{}
+	)
+	testID, err := uuid.Parse(ctx.Param("id"))
+	if err != nil {
+		ctx.AbortWithError(http.StatusBadRequest, errors.New("invalid test id"))
+		return
+	}
+
+	format := ctx.DefaultQuery("format", spec.FormatYAML)
+	if format != spec.FormatYAML && format != spec.FormatJSON {
+		ctx.AbortWithError(http.StatusBadRequest, errors.New("format has to be yaml or json"))
+		return
+	}
+
+	err = c.DB.Model(&models.Test{}).
+		Where(&models.Test{
+			UUID: testID,
+		}).Last(&test).Error
+	if err != nil {
+		logrus.Error("erorr in getting test ", err)
+		ctx.AbortWithError(http.StatusNotFound, err)
+		return
+	}
+
+	s, err := definitionOf(&test)
+	if err != nil {
+		logrus.Error("error in decoding definition ", err)
+		ctx.AbortWithError(http.StatusInternalServerError, err)
+		return
+	}
+
+	data, err := spec.Marshal(s.Redacted(), format)
+	if err != nil {
+		logrus.Error("error in marshalling definition ", err)
+		ctx.AbortWithError(http.StatusInternalServerError, err)
+		return
+	}
+
+	contentType := "application/yaml"
+	if format == spec.FormatJSON {
+		contentType = "application/json"
+	}
+	ctx.Data(http.StatusOK, contentType, data)
+}
+
+// Tests stored before definitions were kept get one built from their columns
+func definitionOf(t *models.Test) (*spec.Spec, error) {
+	if len(t.Definition) > 0 {
+		s := spec.Spec{}
+		err := json.Unmarshal(t.Definition, &s)
+		return &s, err
+	}
+
+	var body interface{}
+	if len(t.Body) > 0 {
+		err := json.Unmarshal(t.Body, &body)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	headers := map[string]string{}
+	for k := range t.Headers.Data() {
+		headers[k] = t.Headers.Data().Get(k)
+	}
+	if len(headers) == 0 {
+		headers = nil
+	}
+
+	return &spec.Spec{
+		Version: spec.Version,
+		Target: spec.Target{
+			Headers: headers,
+		},
+		Load: spec.LoadProfile{
+			TargetUsers:             t.TargetUsers,
+			UsersToStartWith:        t.UsersToStartWith,
+			ReachPeakAfterInMinutes: t.ReachPeakAfterInMinutes,
+		},
+		Requests: []spec.Request{{
+			Method: t.Method,
+			URL:    t.URL,
+			Body:   body,
+		}},
+	}, nil
+}
+
+func abortWithValidationError(ctx *gin.Context, err error) {
+	v := &spec.ValidationError{}
+	if errors.As(err, &v) {
+		ctx.AbortWithStatusJSON(http.StatusBadRequest, v)
+		return
+	}
+	ctx.AbortWithError(http.StatusBadRequest, err)
+}
@@ -0,0 +1,52 @@
+package controllers
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/VarthanV/load-tester/models"
+	"github.com/VarthanV/load-tester/pkg/spec"
+	"github.com/VarthanV/load-tester/pkg/tester"
+	"github.com/gin-gonic/gin"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+func TestDefinitionIsOnlyServedRedacted(t *testing.T) {
+	db, err := gorm.Open(sqlite.Open("file::memory:"), &gorm.Config{Logger: logger.Discard})
+	if err != nil {
+		t.Fatalf("unable to open db: %v", err)
+	}
+	db.AutoMigrate(&models.Test{})
+
+	definition, _ := json.Marshal(&spec.Spec{
+		Version:  spec.Version,
+		Load:     spec.LoadProfile{TargetUsers: 1},
+		Requests: []spec.Request{{URL: "http://example.com"}},
+		Auth:     &tester.AuthConfig{Type: tester.AuthTypeBearer, Token: "hunter2"},
+	})
+	test := &models.Test{Name: "secret", Definition: definition}
+	db.Create(test)
+
+	gin.SetMode(gin.TestMode)
+	c := &Controller{DB: db}
+	r := gin.New()
+	r.GET("/tests", c.ListAllTests)
+	r.GET("/tests/:id", c.GetTest)
+	r.GET("/tests/:id/definition", c.GetDefinition)
+
+	for _, path := range []string{"/tests", "/tests/" + test.UUID.String(), "/tests/" + test.UUID.String() + "/definition"} {
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, path, nil))
+		if w.Code != http.StatusOK {
+			t.Fatalf("expected %s to be served, got %d", path, w.Code)
+		}
+		if strings.Contains(w.Body.String(), "hunter2") {
+			t.Errorf("expected %s to leave out the token, got %s", path, w.Body.String())
+		}
+	}
+}
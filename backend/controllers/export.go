@@ -0,0 +1,174 @@
+package controllers
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"os"
+	"slices"
+	"strings"
+
+	"github.com/VarthanV/load-tester/models"
+	"github.com/VarthanV/load-tester/pkg/htmlreport"
+	"github.com/VarthanV/load-tester/pkg/tester"
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/sirupsen/logrus"
+)
+
+// Report of the test in the format of the format query, sent as a download
+func (c *Controller) ExportTest(ctx *gin.Context) {
+	format := ctx.Query("format")
+	if !slices.Contains(tester.ExportFormats(), format) {
+		ctx.AbortWithError(http.StatusBadRequest,
+			errors.New("format has to be one of "+strings.Join(tester.ExportFormats(), ", ")))
+		return
+	}
+
+	test, report, ok := c.loadReport(ctx)
+	if !ok {
+		return
+	}
+
+	var out bytes.Buffer
+	err := report.Export(&out, format, test.Name)
+	if err != nil {
+		logrus.Error("error in exporting report ", err)
+		ctx.AbortWithError(http.StatusInternalServerError, err)
+		return
+	}
+
+	contentType, extension := tester.ExportContentType(format)
+	ctx.Header("Content-Disposition", `attachment; filename="`+test.UUID.String()+"."+extension+`"`)
+	ctx.Data(http.StatusOK, contentType, out.Bytes())
+}
+
+// Report of the test as a single HTML page with its charts and definition
+func (c *Controller) GetHTMLReport(ctx *gin.Context) {
+	test, report, ok := c.loadReport(ctx)
+	if !ok {
+		return
+	}
+
+	definition, err := definitionOf(test)
+	if err != nil {
+		logrus.Error("error in decoding definition ", err)
+		ctx.AbortWithError(http.StatusInternalServerError, err)
+		return
+	}
+
+	var out bytes.Buffer
+	err = htmlreport.Render(&out, &htmlreport.Page{
+		ID:         test.UUID.String(),
+		Name:       test.Name,
+		StartedAt:  test.CreatedAt,
+		Report:     report,
+		Definition: definition,
+	})
+	if err != nil {
+		logrus.Error("error in rendering report ", err)
+		ctx.AbortWithError(http.StatusInternalServerError, err)
+		return
+	}
+
+	ctx.Header("Content-Disposition", `inline; filename="`+test.UUID.String()+`.html"`)
+	ctx.Data(http.StatusOK, "text/html; charset=utf-8", out.Bytes())
+}
+
+// Failing exchanges kept for the test by category, the category query
+// narrows them down to one
+func (c *Controller) GetFailures(ctx *gin.Context) {
+	_, report, ok := c.loadReport(ctx)
+	if !ok {
+		return
+	}
+
+	failures := report.Failures
+	if failures == nil {
+		failures = map[string][]*tester.FailedExchange{}
+	}
+	if category := ctx.Query("category"); category != "" {
+		exchanges := failures[category]
+		if exchanges == nil {
+			exchanges = []*tester.FailedExchange{}
+		}
+		failures = map[string][]*tester.FailedExchange{category: exchanges}
+	}
+	ctx.JSON(http.StatusOK, failures)
+}
+
+// Sample log of the test as it was written, gzipped NDJSON or CSV
+func (c *Controller) GetSamples(ctx *gin.Context) {
+	testID, err := uuid.Parse(ctx.Param("id"))
+	if err != nil {
+		ctx.AbortWithError(http.StatusBadRequest, errors.New("invalid test id"))
+		return
+	}
+	if c.Samples == nil {
+		ctx.AbortWithError(http.StatusNotFound, errors.New("samples aren't stored"))
+		return
+	}
+
+	f, format, err := c.Samples.Open(testID)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			ctx.AbortWithError(http.StatusNotFound, errors.New("the test has no samples, they may have been pruned"))
+			return
+		}
+		logrus.Error("error in opening samples ", err)
+		ctx.AbortWithError(http.StatusInternalServerError, err)
+		return
+	}
+	defer f.Close()
+
+	info, err := f.Stat()
+	if err != nil {
+		logrus.Error("error in reading samples ", err)
+		ctx.AbortWithError(http.StatusInternalServerError, err)
+		return
+	}
+
+	ctx.DataFromReader(http.StatusOK, info.Size(), "application/gzip", f, map[string]string{
+		"Content-Disposition": `attachment; filename="` + testID.String() + "." + format + `.gz"`,
+	})
+}
+
+// Test of the id param and its report, aborts when there's no such test or
+// it's still running
+func (c *Controller) loadReport(ctx *gin.Context) (*models.Test, *tester.Report, bool) {
+	testID, err := uuid.Parse(ctx.Param("id"))
+	if err != nil {
+		ctx.AbortWithError(http.StatusBadRequest, errors.New("invalid test id"))
+		return nil, nil, false
+	}
+
+	test := &models.Test{}
+	err = c.DB.Model(&models.Test{}).
+		Where(&models.Test{
+			UUID: testID,
+		}).Last(test).Error
+	if err != nil {
+		logrus.Error("erorr in getting test ", err)
+		ctx.AbortWithError(http.StatusNotFound, err)
+		return nil, nil, false
+	}
+
+	if test.Status == models.StatusFailed {
+		ctx.AbortWithError(http.StatusUnprocessableEntity, errors.New("the test failed to start: "+test.Error))
+		return nil, nil, false
+	}
+	if len(test.Report) == 0 {
+		ctx.AbortWithError(http.StatusConflict, errors.New("the test hasn't finished yet"))
+		return nil, nil, false
+	}
+
+	report := &tester.Report{}
+	err = json.Unmarshal(test.Report, report)
+	if err != nil {
+		logrus.Error("error in decoding report ", err)
+		ctx.AbortWithError(http.StatusInternalServerError, err)
+		return nil, nil, false
+	}
+	return test, report, true
+}
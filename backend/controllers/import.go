@@ -0,0 +1,41 @@
+package controllers
+
+import (
+	"errors"
+	"io"
+	"net/http"
+
+	"github.com/VarthanV/load-tester/pkg/importer"
+	"github.com/gin-gonic/gin"
+	"github.com/sirupsen/logrus"
+)
+
+// Converts the body into a test definition, the format is guessed from the
+// body when the format query is not given
+func (c *Controller) ImportTest(ctx *gin.Context) {
+	data, err := io.ReadAll(ctx.Request.Body)
+	if err != nil {
+		logrus.Error("error in reading import ", err)
+		ctx.AbortWithError(http.StatusBadRequest, err)
+		return
+	}
+
+	format := ctx.Query("format")
+	if format == "" {
+		format = importer.Detect("", data)
+		if format == "" {
+			ctx.AbortWithError(http.StatusBadRequest,
+				errors.New("unable to tell the format, set format to har, curl, postman or openapi"))
+			return
+		}
+	}
+
+	result, err := importer.Import(data, format)
+	if err != nil {
+		logrus.Error("error in importing ", err)
+		ctx.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	ctx.JSON(http.StatusOK, result)
+}
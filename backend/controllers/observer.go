@@ -0,0 +1,59 @@
+package controllers
+
+import (
+	"encoding/json"
+
+	"github.com/VarthanV/load-tester/models"
+	"github.com/VarthanV/load-tester/pkg/tester"
+	"github.com/google/uuid"
+	"github.com/sirupsen/logrus"
+	"gorm.io/gorm"
+)
+
+// dbObserver: keeps the counts and, once done, the report of the test row
+type dbObserver struct {
+	tester.ObserverFuncs
+	db *gorm.DB
+	id uuid.UUID
+}
+
+// An observer that stores the progress and report of the run on the test
+// with the id of the run
+func newDBObserver(db *gorm.DB) tester.Observer {
+	return &dbObserver{db: db}
+}
+
+func (o *dbObserver) OnTestStart(start *tester.TestStart) {
+	o.id = start.ID
+}
+
+func (o *dbObserver) OnIntervalSnapshot(s *tester.Snapshot) {
+	o.update(&models.Test{
+		TotalRequests:     s.TotalRequests,
+		SucceededRequests: s.SucceededRequests,
+		FailedRequests:    s.FailedRequests,
+	})
+}
+
+func (o *dbObserver) OnTestEnd(r *tester.Report) {
+	marshalledReport, err := json.Marshal(r)
+	if err != nil {
+		logrus.Error("unable to marshal report ", err)
+	}
+	o.update(&models.Test{
+		TotalRequests:     r.RequestedDone,
+		SucceededRequests: r.SucceededRequests,
+		FailedRequests:    r.FailedRequests,
+		Report:            marshalledReport,
+		Status:            models.StatusDone,
+	})
+}
+
+func (o *dbObserver) update(t *models.Test) {
+	err := o.db.Model(&models.Test{}).Where(&models.Test{
+		UUID: o.id,
+	}).Updates(t).Error
+	if err != nil {
+		logrus.Error("unable to update ", err)
+	}
+}
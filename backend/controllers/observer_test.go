@@ -0,0 +1,41 @@
+package controllers
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/VarthanV/load-tester/models"
+	"github.com/VarthanV/load-tester/pkg/tester"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+func TestDBObserver(t *testing.T) {
+	db, err := gorm.Open(sqlite.Open("file::memory:"), &gorm.Config{Logger: logger.Discard})
+	if err != nil {
+		t.Fatalf("unable to open db: %v", err)
+	}
+	db.AutoMigrate(&models.Test{})
+	test := &models.Test{Name: "observed"}
+	db.Create(test)
+
+	o := newDBObserver(db)
+	o.OnTestStart(&tester.TestStart{ID: test.UUID})
+	o.OnIntervalSnapshot(&tester.Snapshot{TotalRequests: 4, SucceededRequests: 3, FailedRequests: 1, Elapsed: time.Second})
+
+	stored := &models.Test{}
+	db.Where(&models.Test{UUID: test.UUID}).First(stored)
+	if stored.TotalRequests != 4 || stored.FailedRequests != 1 || stored.Report != nil {
+		t.Errorf("expected the counts of the snapshot, got %+v", stored)
+	}
+
+	o.OnTestEnd(&tester.Report{RequestedDone: 5, SucceededRequests: 4, FailedRequests: 1, ErrorRate: 0.2})
+	db.Where(&models.Test{UUID: test.UUID}).First(stored)
+	report := &tester.Report{}
+	json.Unmarshal(stored.Report, report)
+	if stored.TotalRequests != 5 || report.ErrorRate != 0.2 || stored.Status != models.StatusDone {
+		t.Errorf("expected the report to be stored, got %+v", stored)
+	}
+}
@@ -0,0 +1,202 @@
+package controllers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"regexp"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/VarthanV/load-tester/pkg/recorder"
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/sirupsen/logrus"
+)
+
+type StartRecordingRequest struct {
+	// Address the proxy listens on, 127.0.0.1 when empty. Any other address
+	// lets whoever can reach it send requests through the proxy
+	Host string `json:"host"`
+	// Port the proxy listens on, any free port when empty
+	Port int `json:"port"`
+	// Only urls matching the regular expression are recorded
+	Include string `json:"include"`
+	// Hosts HTTPS is tunnelled to, CONNECT to others is refused
+	TunnelHosts []string `json:"tunnel_hosts"`
+	// The recording is stopped and dropped after this long without requests,
+	// defaults to 10
+	IdleTimeoutInMinutes int `json:"idle_timeout_in_minutes"`
+	// and after this long in any case, defaults to 60
+	MaxDurationInMinutes int `json:"max_duration_in_minutes"`
+}
+
+type RecordingResponse struct {
+	ID           uuid.UUID `json:"id"`
+	ProxyAddress string    `json:"proxy_address"`
+	Exchanges    int       `json:"exchanges"`
+}
+
+type recording struct {
+	recorder *recorder.Recorder
+	server   *http.Server
+	address  string
+
+	once sync.Once
+	done chan struct{}
+}
+
+// Closes the listener and the tunnels still open
+func (r *recording) stop() {
+	r.once.Do(func() {
+		close(r.done)
+		err := r.server.Shutdown(context.Background())
+		if err != nil {
+			logrus.Error("error in stopping recording proxy ", err)
+		}
+		r.recorder.Close()
+	})
+}
+
+// Starts a recording proxy, requests made through it are turned into a test
+// definition when the recording stops
+func (c *Controller) StartRecording(ctx *gin.Context) {
+	request := StartRecordingRequest{}
+	err := ctx.ShouldBindJSON(&request)
+	if err != nil && !errors.Is(err, io.EOF) {
+		logrus.Error("error in binding request ", err)
+		ctx.AbortWithError(http.StatusBadRequest, err)
+		return
+	}
+
+	if request.IdleTimeoutInMinutes < 0 || request.MaxDurationInMinutes < 0 {
+		ctx.AbortWithError(http.StatusBadRequest, errors.New("timeouts can't be negative"))
+		return
+	}
+	idle := time.Duration(request.IdleTimeoutInMinutes) * time.Minute
+	if idle == 0 {
+		idle = 10 * time.Minute
+	}
+	lifetime := time.Duration(request.MaxDurationInMinutes) * time.Minute
+	if lifetime == 0 {
+		lifetime = time.Hour
+	}
+	host := request.Host
+	if host == "" {
+		host = "127.0.0.1"
+	}
+
+	rec := recorder.New()
+	rec.TunnelHosts = request.TunnelHosts
+	if request.Include != "" {
+		rec.Include, err = regexp.Compile(request.Include)
+		if err != nil {
+			ctx.AbortWithError(http.StatusBadRequest, fmt.Errorf("invalid include: %w", err))
+			return
+		}
+	}
+
+	listener, err := net.Listen("tcp", net.JoinHostPort(host, strconv.Itoa(request.Port)))
+	if err != nil {
+		logrus.Error("error in starting recording proxy ", err)
+		ctx.AbortWithError(http.StatusBadRequest, err)
+		return
+	}
+
+	r := &recording{
+		recorder: rec,
+		server:   &http.Server{Handler: rec},
+		address:  listener.Addr().String(),
+		done:     make(chan struct{}),
+	}
+	go func() {
+		err := r.server.Serve(listener)
+		if err != nil && !errors.Is(err, http.ErrServerClosed) {
+			logrus.Error("recording proxy stopped ", err)
+		}
+	}()
+
+	id := uuid.New()
+	c.recordings.Store(id, r)
+	go c.expireRecording(id, r, idle, lifetime)
+	ctx.JSON(http.StatusCreated, RecordingResponse{
+		ID:           id,
+		ProxyAddress: r.address,
+	})
+}
+
+func (c *Controller) GetRecording(ctx *gin.Context) {
+	id, r, ok := c.recording(ctx)
+	if !ok {
+		return
+	}
+
+	ctx.JSON(http.StatusOK, RecordingResponse{
+		ID:           id,
+		ProxyAddress: r.address,
+		Exchanges:    len(r.recorder.Exchanges()),
+	})
+}
+
+// Stops the proxy and returns the definition of the recorded session
+func (c *Controller) StopRecording(ctx *gin.Context) {
+	id, r, ok := c.recording(ctx)
+	if !ok {
+		return
+	}
+
+	c.recordings.Delete(id)
+	r.stop()
+
+	if len(r.recorder.Exchanges()) == 0 {
+		ctx.AbortWithStatusJSON(http.StatusBadRequest, gin.H{
+			"error":     "no requests were recorded",
+			"tunnelled": r.recorder.Tunnelled(),
+		})
+		return
+	}
+	ctx.JSON(http.StatusOK, r.recorder.Definition())
+}
+
+// Stops and drops a recording once it has been idle or running for too
+// long, so forgotten proxies don't stay up
+func (c *Controller) expireRecording(id uuid.UUID, r *recording, idle, lifetime time.Duration) {
+	deadline := time.Now().Add(lifetime)
+	for {
+		expiresAt := r.recorder.LastActive().Add(idle)
+		if deadline.Before(expiresAt) {
+			expiresAt = deadline
+		}
+		if !time.Now().Before(expiresAt) {
+			logrus.Info("stopping expired recording ", id)
+			c.recordings.Delete(id)
+			r.stop()
+			return
+		}
+
+		select {
+		case <-r.done:
+			return
+		case <-time.After(time.Until(expiresAt)):
+		}
+	}
+}
+
+func (c *Controller) recording(ctx *gin.Context) (uuid.UUID, *recording, bool) {
+	id, err := uuid.Parse(ctx.Param("id"))
+	if err != nil {
+		ctx.AbortWithError(http.StatusBadRequest, errors.New("invalid recording id"))
+		return id, nil, false
+	}
+
+	r, ok := c.recordings.Load(id)
+	if !ok {
+		ctx.AbortWithError(http.StatusNotFound, errors.New("unknown recording id"))
+		return id, nil, false
+	}
+	return id, r.(*recording), true
+}
@@ -0,0 +1,82 @@
+package controllers
+
+import (
+	"errors"
+	"io"
+	"net/http"
+	"strconv"
+
+	"github.com/VarthanV/load-tester/pkg/replay"
+	"github.com/VarthanV/load-tester/pkg/spec"
+	"github.com/VarthanV/load-tester/pkg/tester"
+	"github.com/gin-gonic/gin"
+	"github.com/sirupsen/logrus"
+)
+
+// Replays an uploaded access log, the log comes in the log field of a
+// multipart form along with base_url, speed, path_filter, format and
+// concurrency
+func (c *Controller) ReplayTest(ctx *gin.Context) {
+	file, err := ctx.FormFile("log")
+	if err != nil {
+		ctx.AbortWithError(http.StatusBadRequest, errors.New("log file is required"))
+		return
+	}
+
+	r := &spec.Replay{
+		BaseURL:    ctx.PostForm("base_url"),
+		PathFilter: ctx.PostForm("path_filter"),
+		Format:     ctx.PostForm("format"),
+		Speed:      1,
+	}
+	if speed := ctx.PostForm("speed"); speed != "" {
+		r.Speed, err = strconv.ParseFloat(speed, 64)
+		if err != nil {
+			ctx.AbortWithError(http.StatusBadRequest, errors.New("invalid speed"))
+			return
+		}
+	}
+	concurrency := tester.DefaultReplayConcurrency
+	if v := ctx.PostForm("concurrency"); v != "" {
+		concurrency, err = strconv.Atoi(v)
+		if err != nil {
+			ctx.AbortWithError(http.StatusBadRequest, errors.New("invalid concurrency"))
+			return
+		}
+	}
+	if r.Format == "" {
+		r.Format = replay.DetectFormat(file.Filename)
+	}
+
+	f, err := file.Open()
+	if err != nil {
+		logrus.Error("error in opening log ", err)
+		ctx.AbortWithError(http.StatusInternalServerError, err)
+		return
+	}
+	defer f.Close()
+
+	data, err := io.ReadAll(f)
+	if err != nil {
+		logrus.Error("error in reading log ", err)
+		ctx.AbortWithError(http.StatusInternalServerError, err)
+		return
+	}
+	r.Log = string(data)
+
+	// Stored as the definition of the test like any other, so the replay
+	// can be exported and run again
+	s := &spec.Spec{
+		Version: spec.Version,
+		Name:    "replay of " + file.Filename,
+		Load:    spec.LoadProfile{TargetUsers: concurrency},
+		Replay:  r,
+	}
+	err = s.Validate()
+	if err != nil {
+		abortWithValidationError(ctx, err)
+		return
+	}
+
+	c.startTest(ctx, s)
+}
@@ -1,29 +1,41 @@
 package controllers
 
 import (
+	"context"
 	"encoding/json"
 	"errors"
-	"log"
 	"net/http"
-	"time"
+	"strings"
 
 	"github.com/VarthanV/load-tester/models"
 	"github.com/VarthanV/load-tester/pkg/liveupdate"
+	"github.com/VarthanV/load-tester/pkg/samplestore"
+	"github.com/VarthanV/load-tester/pkg/spec"
 	"github.com/VarthanV/load-tester/pkg/tester"
 	"github.com/gin-gonic/gin"
 	"github.com/google/uuid"
 	"github.com/sirupsen/logrus"
+	"gorm.io/datatypes"
 )
 
 type CreateTestRequest struct {
-	URL                    string            `json:"url"`
-	Method                 string            `json:"method"`
-	Body                   interface{}       `json:"body"`
-	TargetUsers            int               `json:"target_users"`
-	ReachPeakAferInMinutes int               `json:"reach_peak_afer_in_minutes"`
-	Headers                map[string]string `json:"headers"`
-	UsersToStartWith       int               `json:"users_to_start_with"`
-	SuccessStatusCodes     []int             `json:"success_status_codes"`
+	URL                    string                     `json:"url"`
+	Method                 string                     `json:"method"`
+	Body                   interface{}                `json:"body"`
+	TargetUsers            int                        `json:"target_users"`
+	ReachPeakAferInMinutes int                        `json:"reach_peak_afer_in_minutes"`
+	Headers                map[string]string          `json:"headers"`
+	UsersToStartWith       int                        `json:"users_to_start_with"`
+	SuccessStatusCodes     []int                      `json:"success_status_codes"`
+	Auth                   *tester.AuthConfig         `json:"auth"`
+	Transport              *tester.TransportConfig    `json:"transport"`
+	Redirect               *tester.RedirectConfig     `json:"redirect"`
+	Retry                  *tester.RetryConfig        `json:"retry"`
+	ResponseBody           *tester.ResponseBodyConfig `json:"response_body"`
+	// Keep sampled failing exchanges, see GET /tests/:id/failures
+	Failures *tester.FailureCaptureConfig `json:"failures"`
+	// Split the test across the registered agents
+	Distributed bool `json:"distributed"`
 }
 
 type CreateTestResponse struct {
@@ -35,10 +47,38 @@ type GetUpdateResponse struct {
 	Test   *models.Test       `json:"test"`
 }
 
+// Definition the request stands for, POST /tests predates the definition
+// files and keeps taking the flat fields
+func (r *CreateTestRequest) definition() *spec.Spec {
+	return &spec.Spec{
+		Version: spec.Version,
+		Target: spec.Target{
+			Headers: r.Headers,
+		},
+		Load: spec.LoadProfile{
+			TargetUsers:             r.TargetUsers,
+			UsersToStartWith:        r.UsersToStartWith,
+			ReachPeakAfterInMinutes: r.ReachPeakAferInMinutes,
+			Distributed:             r.Distributed,
+		},
+		Requests: []spec.Request{{
+			Method:             r.Method,
+			URL:                r.URL,
+			Body:               r.Body,
+			SuccessStatusCodes: r.SuccessStatusCodes,
+		}},
+		Auth:         r.Auth,
+		Transport:    r.Transport,
+		Redirect:     r.Redirect,
+		Retry:        r.Retry,
+		ResponseBody: r.ResponseBody,
+		Failures:     r.Failures,
+	}
+}
+
 func (c *Controller) ExecuteTest(ctx *gin.Context) {
 	var (
 		request = CreateTestRequest{}
-		body    []byte
 	)
 
 	err := ctx.ShouldBindJSON(&request)
@@ -48,8 +88,29 @@ func (c *Controller) ExecuteTest(ctx *gin.Context) {
 		return
 	}
 
-	if request.Body != nil {
-		body, err = json.Marshal(request.Body)
+	s := request.definition()
+	err = s.Validate()
+	if err != nil {
+		abortWithValidationError(ctx, err)
+		return
+	}
+
+	c.startTest(ctx, s)
+}
+
+// Stores the test and starts running it in the background
+func (c *Controller) startTest(ctx *gin.Context, s *spec.Spec) {
+	var (
+		body []byte
+		err  error
+	)
+
+	first := spec.Request{}
+	if len(s.Requests) > 0 {
+		first = s.Requests[0]
+	}
+	if first.Body != nil {
+		body, err = json.Marshal(first.Body)
 		if err != nil {
 			logrus.Error("error in marshalling body ", err)
 			ctx.AbortWithError(http.StatusInternalServerError, err)
@@ -57,13 +118,51 @@ func (c *Controller) ExecuteTest(ctx *gin.Context) {
 		}
 	}
 
+	definition, err := json.Marshal(s)
+	if err != nil {
+		logrus.Error("error in marshalling definition ", err)
+		ctx.AbortWithError(http.StatusInternalServerError, err)
+		return
+	}
+
+	// The headers are listed with the test, the definition keeps the secrets
+	headers := http.Header{}
+	for k, v := range s.Target.Headers {
+		if tester.SecretHeader(k) {
+			v = tester.Redacted
+		}
+		headers.Set(k, v)
+	}
+
+	url := s.ResolveURL(first)
+	switch {
+	case s.GRPC != nil:
+		url = "grpc://" + s.GRPC.Target + "/" + strings.TrimPrefix(s.GRPC.Method, "/")
+	case s.WebSocket != nil:
+		url = s.WebSocket.URL
+	case s.Socket != nil:
+		url = s.Socket.Network + "://" + s.Socket.Address
+	case s.DNS != nil:
+		url = "dns://" + s.DNS.Server
+	case s.Cache != nil:
+		url = s.Cache.Protocol + "://" + s.Cache.Address
+	case s.Protocol != nil:
+		url = s.Protocol.Name + "://"
+	case s.Replay != nil:
+		url = s.Replay.BaseURL
+	}
+
 	t := &models.Test{
-		URL:                     request.URL,
-		Method:                  request.Method,
+		Name:                    s.Name,
+		URL:                     url,
+		Method:                  first.Method,
 		Body:                    body,
-		UsersToStartWith:        request.UsersToStartWith,
-		TargetUsers:             request.TargetUsers,
-		ReachPeakAfterInMinutes: request.ReachPeakAferInMinutes,
+		Headers:                 datatypes.NewJSONType(headers),
+		UsersToStartWith:        s.Load.UsersToStartWith,
+		TargetUsers:             s.Load.TargetUsers,
+		ReachPeakAfterInMinutes: s.Load.ReachPeakAfterInMinutes,
+		Definition:              definition,
+		Status:                  models.StatusInProgress,
 	}
 
 	err = c.
@@ -76,28 +175,58 @@ func (c *Controller) ExecuteTest(ctx *gin.Context) {
 		return
 	}
 
-	go func() {
-		driver, err := tester.New(
-			c.Updates,
-			tester.WithPeakConfig(
-				request.TargetUsers,
-				time.Duration(request.ReachPeakAferInMinutes*int(time.Minute)),
-				request.UsersToStartWith),
-			tester.WithRequestConfig(request.URL, nil, request.SuccessStatusCodes...),
-			tester.WithDB(c.DB),
-		)
+	if s.Load.Distributed {
+		go c.runDistributed(t.UUID, s)
+	} else {
+		go c.runLocal(ctx, t.UUID, s)
+	}
+
+	ctx.JSON(http.StatusCreated, CreateTestResponse{
+		ID: t.UUID,
+	})
+}
+
+func (c *Controller) runLocal(ctx context.Context, testID uuid.UUID, s *spec.Spec) {
+	opts := append(s.Options(), tester.WithObservers(newDBObserver(c.DB)))
+	var samples *samplestore.File
+	if s.Samples != nil && c.Samples != nil {
+		var err error
+		samples, err = c.Samples.Create(testID, s.Samples.LogFormat())
 		if err != nil {
-			log.Printf("Failed to create load tester: %v\n", err)
+			logrus.Error("unable to create sample log ", err)
+		} else {
+			opts = append(opts, tester.WithObservers(tester.NewSampleLogger(samples, s.Samples)))
 		}
+	}
 
-		logrus.Info("Starting for id ", t.UUID)
-		driver.Run(ctx, t.UUID)
+	driver, err := tester.New(c.Updates, opts...)
+	if err != nil {
+		logrus.Error("failed to create load tester ", err)
+		// Nothing was logged, an empty log would only take up room
+		if samples != nil {
+			samples.Discard()
+		}
+		c.failTest(testID, err)
+		return
+	}
 
-	}()
+	logrus.Info("Starting for id ", testID)
+	driver.Run(ctx, testID)
+}
 
-	ctx.JSON(http.StatusCreated, CreateTestResponse{
-		ID: t.UUID,
-	})
+// Marks a test that couldn't be started as failed, so pollers stop waiting
+// for its report
+func (c *Controller) failTest(testID uuid.UUID, cause error) {
+	err := c.DB.Model(&models.Test{}).Where(&models.Test{
+		UUID: testID,
+	}).Updates(&models.Test{
+		Status: models.StatusFailed,
+		Error:  cause.Error(),
+	}).Error
+	if err != nil {
+		logrus.Error("unable to mark test as failed ", err)
+	}
+	c.Updates.Delete(testID)
 }
 
 func (c *Controller) GetTest(ctx *gin.Context) {
@@ -143,8 +272,8 @@ func (c *Controller) GetUpdate(ctx *gin.Context) {
 	res.Update = update
 
 	if update != nil &&
-		update.TargetUsers ==
-			update.TotalNumberofRequestsDone ||
+		(update.Done || update.TargetUsers ==
+			update.TotalNumberofRequestsDone) ||
 		update == nil {
 		// No need for report to be held from here on reached end
 		// game
@@ -0,0 +1,57 @@
+package controllers
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+
+	"github.com/VarthanV/load-tester/models"
+	"github.com/VarthanV/load-tester/pkg/liveupdate"
+	"github.com/VarthanV/load-tester/pkg/samplestore"
+	"github.com/VarthanV/load-tester/pkg/spec"
+	"github.com/VarthanV/load-tester/pkg/tester"
+	"github.com/gin-gonic/gin"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+func TestTestsThatCantStartAreFailed(t *testing.T) {
+	db, err := gorm.Open(sqlite.Open("file::memory:"), &gorm.Config{Logger: logger.Discard})
+	if err != nil {
+		t.Fatalf("unable to open db: %v", err)
+	}
+	db.AutoMigrate(&models.Test{})
+	test := &models.Test{Name: "broken", Status: models.StatusInProgress}
+	db.Create(test)
+
+	samples := t.TempDir()
+	c := &Controller{DB: db, Updates: liveupdate.New(), Samples: &samplestore.Store{Dir: samples}}
+	c.runLocal(context.Background(), test.UUID, &spec.Spec{
+		Version:   spec.Version,
+		Load:      spec.LoadProfile{TargetUsers: 1},
+		Requests:  []spec.Request{{URL: "http://example.com"}},
+		Transport: &tester.TransportConfig{CABundleFile: "does-not-exist.pem"},
+		Samples:   &tester.SampleConfig{},
+	})
+
+	stored := &models.Test{}
+	db.Where(&models.Test{UUID: test.UUID}).First(stored)
+	if stored.Status != models.StatusFailed || stored.Error == "" {
+		t.Errorf("expected the test to be marked as failed, got %+v", stored)
+	}
+	if left, _ := os.ReadDir(samples); len(left) != 0 {
+		t.Errorf("expected no sample log to be left behind, got %v", left)
+	}
+
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.GET("/tests/:id/export", c.ExportTest)
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/tests/"+test.UUID.String()+"/export?format=csv", nil))
+	if w.Code != http.StatusUnprocessableEntity {
+		t.Errorf("expected the export to say the test failed, got %d", w.Code)
+	}
+}
@@ -0,0 +1,68 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/VarthanV/load-tester/pkg/importer"
+	"github.com/VarthanV/load-tester/pkg/spec"
+)
+
+// Converts a HAR file, curl commands, a Postman collection or an OpenAPI
+// document into a test definition
+func runImport(args []string) {
+	flags := flag.NewFlagSet("import", flag.ExitOnError)
+	format := flags.String("format", "", "har, curl, postman or openapi, guessed from the file when empty")
+	out := flags.String("out", "", "file to write the definition to, defaults to stdout")
+	output := flags.String("output", spec.FormatYAML, "yaml or json")
+	flags.Usage = func() {
+		fmt.Fprintln(os.Stderr, "usage: load-tester import [flags] <file>")
+		flags.PrintDefaults()
+	}
+	flags.Parse(args)
+
+	if flags.NArg() != 1 {
+		flags.Usage()
+		os.Exit(2)
+	}
+
+	data, err := os.ReadFile(flags.Arg(0))
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "error in reading input:", err)
+		os.Exit(2)
+	}
+
+	if *format == "" {
+		*format = importer.Detect(flags.Arg(0), data)
+		if *format == "" {
+			fmt.Fprintln(os.Stderr, "unable to tell the format of the input, set -format")
+			os.Exit(2)
+		}
+	}
+
+	result, err := importer.Import(data, *format)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "error in importing:", err)
+		os.Exit(1)
+	}
+	for _, w := range result.Warnings {
+		fmt.Fprintln(os.Stderr, "warning:", w)
+	}
+
+	definition, err := spec.Marshal(result.Definition, *output)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "error in writing definition:", err)
+		os.Exit(2)
+	}
+
+	if *out == "" {
+		os.Stdout.Write(definition)
+		return
+	}
+	err = os.WriteFile(*out, definition, 0644)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "error in writing definition:", err)
+		os.Exit(2)
+	}
+}
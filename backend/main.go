@@ -11,7 +11,9 @@ import (
 	"github.com/VarthanV/load-tester/config"
 	"github.com/VarthanV/load-tester/controllers"
 	"github.com/VarthanV/load-tester/models"
+	"github.com/VarthanV/load-tester/pkg/cluster"
 	"github.com/VarthanV/load-tester/pkg/liveupdate"
+	"github.com/VarthanV/load-tester/pkg/samplestore"
 	"github.com/gin-contrib/cors"
 	"github.com/gin-gonic/gin"
 	"github.com/sirupsen/logrus"
@@ -21,7 +23,33 @@ import (
 )
 
 func main() {
+	if len(os.Args) > 1 {
+		switch os.Args[1] {
+		case "agent":
+			runAgent(os.Args[2:])
+			return
+		case "run":
+			runCLI(os.Args[2:])
+			return
+		case "validate":
+			runValidate(os.Args[2:])
+			return
+		case "import":
+			runImport(os.Args[2:])
+			return
+		case "replay":
+			runReplay(os.Args[2:])
+			return
+		case "record":
+			runRecord(os.Args[2:])
+			return
+		}
+	}
+
+	runServer()
+}
 
+func runServer() {
 	r := gin.Default()
 
 	cfg, err := config.Load()
@@ -60,7 +88,28 @@ func main() {
 		MaxAge: 12 * time.Hour, // Cache duration
 	}
 
-	ctrl := controllers.Controller{DB: db, Updates: liveupdate.New()}
+	samplesDir := cfg.Samples.Directory
+	if samplesDir == "" {
+		samplesDir = "samples"
+	}
+
+	ctrl := controllers.Controller{
+		DB:      db,
+		Updates: liveupdate.New(),
+		Coordinator: &cluster.Coordinator{
+			Registry: cluster.NewRegistry(30 * time.Second),
+			Token:    cfg.Cluster.AgentToken,
+		},
+		Samples: &samplestore.Store{
+			Dir:      samplesDir,
+			MaxAge:   time.Duration(cfg.Samples.MaxAgeInHours) * time.Hour,
+			MaxBytes: int64(cfg.Samples.MaxSizeInMB) << 20,
+		},
+	}
+	err = ctrl.Samples.Prune()
+	if err != nil {
+		logrus.Error("unable to prune samples ", err)
+	}
 
 	r.Use(cors.New(corsConfig))
 	r.GET("/ping", func(ctx *gin.Context) {
@@ -70,11 +119,29 @@ func main() {
 	testsGroup := r.Group("/tests")
 
 	testsGroup.POST("", ctrl.ExecuteTest)
+	testsGroup.POST("/definitions", ctrl.CreateTestFromDefinition)
+	testsGroup.POST("/replays", ctrl.ReplayTest)
 
 	testsGroup.GET("/:id", ctrl.GetTest)
 	testsGroup.GET("/:id/updates", ctrl.GetUpdate)
+	testsGroup.GET("/:id/definition", ctrl.GetDefinition)
+	testsGroup.GET("/:id/export", ctrl.ExportTest)
+	testsGroup.GET("/:id/report.html", ctrl.GetHTMLReport)
+	testsGroup.GET("/:id/samples", ctrl.GetSamples)
+	testsGroup.GET("/:id/failures", ctrl.GetFailures)
 	testsGroup.GET("", ctrl.ListAllTests)
 
+	r.POST("/imports", ctrl.ImportTest)
+
+	recordingsGroup := r.Group("/recordings")
+	recordingsGroup.POST("", ctrl.StartRecording)
+	recordingsGroup.GET("/:id", ctrl.GetRecording)
+	recordingsGroup.POST("/:id/stop", ctrl.StopRecording)
+
+	agentsGroup := r.Group("/agents")
+	agentsGroup.POST("", controllers.RequireToken(cfg.Cluster.AgentToken), ctrl.RegisterAgent)
+	agentsGroup.GET("", ctrl.ListAgents)
+
 	r.Run(fmt.Sprintf(":%s", cfg.Server.Port))
 
 }
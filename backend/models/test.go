@@ -13,12 +13,15 @@ type Status string
 const (
 	StatusInProgress Status = "IN_PROGRESS"
 	StatusDone       Status = "DONE"
+	// The test couldn't be started, Error says why
+	StatusFailed Status = "FAILED"
 )
 
 type Test struct {
 	gorm.Model
 
 	UUID                    uuid.UUID                       `gorm:"uniqueIndex" json:"uuid,omitempty"`
+	Name                    string                          `json:"name,omitempty"`
 	URL                     string                          `json:"url,omitempty"`
 	Method                  string                          `json:"method,omitempty"`
 	Body                    datatypes.JSON                  `json:"body,omitempty"`
@@ -30,6 +33,12 @@ type Test struct {
 	SucceededRequests       int32                           `json:"succeeded_requests,omitempty"`
 	FailedRequests          int32                           `json:"failed_requests,omitempty"`
 	Report                  datatypes.JSON                  `json:"report,omitempty"`
+	Status                  Status                          `json:"status,omitempty"`
+	Error                   string                          `json:"error,omitempty"`
+	// Definition the test was created from, see pkg/spec. It holds the
+	// secrets of the test and is only served redacted, from
+	// GET /tests/:id/definition
+	Definition datatypes.JSON `json:"-"`
 }
 
 func (t *Test) BeforeCreate(tx *gorm.DB) error {
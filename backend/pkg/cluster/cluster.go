@@ -0,0 +1,149 @@
+package cluster
+
+import (
+	"bytes"
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/VarthanV/load-tester/pkg/liveupdate"
+	"github.com/VarthanV/load-tester/pkg/tester"
+	"github.com/google/uuid"
+	"github.com/sirupsen/logrus"
+)
+
+// Job: the share of a test an agent is asked to run
+type Job struct {
+	TestID           uuid.UUID `json:"test_id"`
+	TargetUsers      int       `json:"target_users"`
+	UsersToStartWith int       `json:"users_to_start_with"`
+	// The test as posted to the controller, the users above take precedence
+	// over the ones in here
+	Test json.RawMessage `json:"test"`
+}
+
+// RunStatus: what an agent reports back about a job while polled
+type RunStatus struct {
+	Done   bool               `json:"done"`
+	Update *liveupdate.Update `json:"update"`
+	Report *tester.Report     `json:"report"`
+}
+
+type RegisterRequest struct {
+	Address string `json:"address"`
+}
+
+type Agent struct {
+	Address  string    `json:"address"`
+	LastSeen time.Time `json:"last_seen"`
+}
+
+// Registry: agents that announced themselves to the controller, an agent
+// is considered gone when it hasn't sent a heartbeat within the ttl
+type Registry struct {
+	mu     sync.Mutex
+	ttl    time.Duration
+	agents map[string]*Agent
+}
+
+func NewRegistry(ttl time.Duration) *Registry {
+	return &Registry{
+		ttl:    ttl,
+		agents: map[string]*Agent{},
+	}
+}
+
+func (r *Registry) Register(address string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.agents[strings.TrimRight(address, "/")] = &Agent{
+		Address:  strings.TrimRight(address, "/"),
+		LastSeen: time.Now(),
+	}
+}
+
+// Healthy agents ordered by address
+func (r *Registry) Healthy() []Agent {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	agents := []Agent{}
+	for address, a := range r.agents {
+		if time.Since(a.LastSeen) > r.ttl {
+			delete(r.agents, address)
+			continue
+		}
+		agents = append(agents, *a)
+	}
+	sort.Slice(agents, func(i, j int) bool {
+		return agents[i].Address < agents[j].Address
+	})
+	return agents
+}
+
+// Authorize: adds the token shared by the controller and its agents to req
+func Authorize(req *http.Request, token string) {
+	req.Header.Set("Authorization", "Bearer "+token)
+}
+
+// Authorized: whether req carries the shared token, nothing is authorized
+// without a token
+func Authorized(req *http.Request, token string) bool {
+	if token == "" {
+		return false
+	}
+	got := strings.TrimPrefix(req.Header.Get("Authorization"), "Bearer ")
+	return subtle.ConstantTimeCompare([]byte(got), []byte(token)) == 1
+}
+
+// Register: announces the agent at address to the controller and keeps
+// sending heartbeats until the context is done
+func Register(ctx context.Context, controllerURL, address, token string, every time.Duration) {
+	body, _ := json.Marshal(RegisterRequest{Address: address})
+	ticker := time.NewTicker(every)
+	defer ticker.Stop()
+
+	for {
+		req, err := http.NewRequestWithContext(ctx, http.MethodPost,
+			strings.TrimRight(controllerURL, "/")+"/agents", bytes.NewReader(body))
+		if err == nil {
+			req.Header.Set("Content-Type", "application/json")
+			Authorize(req, token)
+			var res *http.Response
+			res, err = http.DefaultClient.Do(req)
+			if err == nil {
+				res.Body.Close()
+				if res.StatusCode != http.StatusOK {
+					err = fmt.Errorf("controller returned status %d", res.StatusCode)
+				}
+			}
+		}
+		if err != nil {
+			logrus.Error("error in registering with controller ", err)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// Splits n users as evenly as possible across the given number of agents
+func split(users, agents int) []int {
+	shares := make([]int, agents)
+	for i := range shares {
+		shares[i] = users / agents
+		if i < users%agents {
+			shares[i]++
+		}
+	}
+	return shares
+}
@@ -0,0 +1,290 @@
+package cluster
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/VarthanV/load-tester/pkg/liveupdate"
+	"github.com/VarthanV/load-tester/pkg/tester"
+	"github.com/google/uuid"
+	"github.com/sirupsen/logrus"
+)
+
+var ErrNoAgents = errors.New("no agents available")
+
+// Coordinator: splits a test across the healthy agents, polls them while
+// they run and merges what they report
+type Coordinator struct {
+	Registry *Registry
+	Client   *http.Client
+	// Shared with the agents, sent along with every job and poll
+	Token string
+	// How often agents are polled, defaults to a second
+	PollInterval time.Duration
+	// Consecutive failed polls after which an agent is given up on,
+	// defaults to 5
+	MaxPollFailures int
+}
+
+type agentRun struct {
+	agent    Agent
+	job      Job
+	update   *liveupdate.Update
+	report   *tester.Report
+	failures int
+	done     bool
+	lost     bool
+}
+
+func (c *Coordinator) client() *http.Client {
+	if c.Client != nil {
+		return c.Client
+	}
+	return &http.Client{Timeout: 10 * time.Second}
+}
+
+// Run: runs the test over the agents and returns the merged report, with the
+// thresholds evaluated on it and the failing exchanges cut down to what a
+// single run keeps. The combined live update of all the agents is handed to
+// onUpdate on every poll
+func (c *Coordinator) Run(ctx context.Context, testID uuid.UUID, test interface{},
+	thresholds []tester.Threshold, failures *tester.FailureCaptureConfig,
+	targetUsers, usersToStartWith int,
+	onUpdate func(*liveupdate.Update)) (*tester.Report, error) {
+
+	agents := c.Registry.Healthy()
+	if len(agents) == 0 {
+		return nil, ErrNoAgents
+	}
+	if len(agents) > targetUsers {
+		agents = agents[:targetUsers]
+	}
+
+	marshalled, err := json.Marshal(test)
+	if err != nil {
+		return nil, err
+	}
+
+	targetShares := split(targetUsers, len(agents))
+	startShares := split(usersToStartWith, len(agents))
+
+	runs := []*agentRun{}
+	for i, a := range agents {
+		run := &agentRun{
+			agent: a,
+			job: Job{
+				TestID:           testID,
+				TargetUsers:      targetShares[i],
+				UsersToStartWith: startShares[i],
+				Test:             marshalled,
+			},
+		}
+		err := c.start(ctx, run)
+		if err != nil {
+			logrus.Errorf("unable to start job on agent %s: %v", a.Address, err)
+			run.lost = true
+		}
+		runs = append(runs, run)
+	}
+
+	interval := c.PollInterval
+	if interval == 0 {
+		interval = time.Second
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for !finished(runs) {
+		select {
+		case <-ctx.Done():
+			return c.merge(runs, thresholds, failures), ctx.Err()
+		case <-ticker.C:
+		}
+
+		for _, run := range runs {
+			if run.done || run.lost {
+				continue
+			}
+			c.poll(ctx, run)
+		}
+
+		if onUpdate != nil {
+			onUpdate(combine(runs))
+		}
+	}
+
+	return c.merge(runs, thresholds, failures), nil
+}
+
+func finished(runs []*agentRun) bool {
+	for _, run := range runs {
+		if !run.done && !run.lost {
+			return false
+		}
+	}
+	return true
+}
+
+func (c *Coordinator) start(ctx context.Context, run *agentRun) error {
+	body, err := json.Marshal(run.job)
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost,
+		run.agent.Address+"/agent/runs", bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	Authorize(req, c.Token)
+
+	res, err := c.client().Do(req)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode != http.StatusCreated {
+		return fmt.Errorf("agent returned status %d", res.StatusCode)
+	}
+	return nil
+}
+
+func (c *Coordinator) poll(ctx context.Context, run *agentRun) {
+	maxFailures := c.MaxPollFailures
+	if maxFailures == 0 {
+		maxFailures = 5
+	}
+
+	status, err := c.status(ctx, run)
+	if err != nil {
+		run.failures++
+		logrus.Errorf("error in polling agent %s: %v", run.agent.Address, err)
+		if run.failures >= maxFailures {
+			logrus.Errorf("giving up on agent %s", run.agent.Address)
+			run.lost = true
+		}
+		return
+	}
+
+	run.failures = 0
+	if status.Update != nil {
+		run.update = status.Update
+	}
+	if status.Done {
+		run.done = true
+		run.report = status.Report
+		c.release(ctx, run)
+	}
+}
+
+// Lets the agent forget a run whose report was collected
+func (c *Coordinator) release(ctx context.Context, run *agentRun) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodDelete,
+		run.agent.Address+"/agent/runs/"+run.job.TestID.String(), nil)
+	if err != nil {
+		return
+	}
+	Authorize(req, c.Token)
+
+	res, err := c.client().Do(req)
+	if err != nil {
+		logrus.Errorf("unable to release run on agent %s: %v", run.agent.Address, err)
+		return
+	}
+	res.Body.Close()
+}
+
+func (c *Coordinator) status(ctx context.Context, run *agentRun) (*RunStatus, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet,
+		run.agent.Address+"/agent/runs/"+run.job.TestID.String(), nil)
+	if err != nil {
+		return nil, err
+	}
+	Authorize(req, c.Token)
+
+	res, err := c.client().Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("agent returned status %d", res.StatusCode)
+	}
+
+	status := RunStatus{}
+	err = json.NewDecoder(res.Body).Decode(&status)
+	if err != nil {
+		return nil, err
+	}
+	return &status, nil
+}
+
+// Sum of the latest live updates of all the agents
+func combine(runs []*agentRun) *liveupdate.Update {
+	u := &liveupdate.Update{}
+	for _, run := range runs {
+		u.TargetUsers += int32(run.job.TargetUsers)
+		if run.update == nil {
+			continue
+		}
+		u.TotalNumberofRequestsDone += run.update.TotalNumberofRequestsDone
+		u.SucceededRequests += run.update.SucceededRequests
+		u.FailedRequests += run.update.FailedRequests
+	}
+	return u
+}
+
+// Merges the reports of the agents, the thresholds are evaluated on the
+// merged report as the ones of the agents only cover their share, and every
+// agent kept its own sample of failing exchanges. The shares of lost agents
+// aren't run again, the report says how many users were lost instead
+func (c *Coordinator) merge(runs []*agentRun, thresholds []tester.Threshold,
+	failures *tester.FailureCaptureConfig) *tester.Report {
+	reports := []*tester.Report{}
+	agents := []tester.AgentReport{}
+	lostUsers := 0
+
+	for _, run := range runs {
+		a := tester.AgentReport{
+			Address:          run.agent.Address,
+			TargetUsers:      run.job.TargetUsers,
+			UsersToStartWith: run.job.UsersToStartWith,
+			Lost:             !run.done,
+		}
+		if a.Lost {
+			lostUsers += run.job.TargetUsers
+		}
+
+		switch {
+		case run.report != nil:
+			reports = append(reports, run.report)
+			a.RequestedDone = run.report.RequestedDone
+		case run.update != nil:
+			// Only the counters survive an agent that dropped out
+			reports = append(reports, &tester.Report{
+				RequestedDone:     run.update.TotalNumberofRequestsDone,
+				SucceededRequests: run.update.SucceededRequests,
+				FailedRequests:    run.update.FailedRequests,
+			})
+			a.RequestedDone = run.update.TotalNumberofRequestsDone
+		}
+		agents = append(agents, a)
+	}
+
+	merged := tester.MergeReports(reports...)
+	merged.Agents = agents
+	merged.LostUsers = lostUsers
+	merged.Failures = tester.LimitFailures(merged.Failures, failures)
+	if len(thresholds) > 0 {
+		merged.Thresholds = tester.EvaluateThresholds(merged, thresholds)
+	}
+	return merged
+}
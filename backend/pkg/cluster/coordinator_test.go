@@ -0,0 +1,211 @@
+package cluster_test
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/VarthanV/load-tester/controllers"
+	"github.com/VarthanV/load-tester/pkg/cluster"
+	"github.com/VarthanV/load-tester/pkg/liveupdate"
+	"github.com/VarthanV/load-tester/pkg/spec"
+	"github.com/VarthanV/load-tester/pkg/tester"
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+const token = "shared"
+
+func newAgent() *httptest.Server {
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	ctrl := controllers.NewAgentController()
+	agent := r.Group("/agent", controllers.RequireToken(token))
+	agent.POST("/runs", ctrl.StartRun)
+	agent.GET("/runs/:id", ctrl.GetRun)
+	agent.DELETE("/runs/:id", ctrl.DeleteRun)
+	return httptest.NewServer(r)
+}
+
+func TestCoordinatorRunsAcrossAgents(t *testing.T) {
+	var hits atomic.Int32
+	target := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		hits.Add(1)
+	}))
+	defer target.Close()
+
+	first, second := newAgent(), newAgent()
+	defer first.Close()
+	defer second.Close()
+
+	// Accepts the job and then stops answering polls
+	var polls atomic.Int32
+	dropping := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodPost {
+			w.WriteHeader(http.StatusCreated)
+			return
+		}
+		if polls.Add(1) == 1 {
+			w.Write([]byte(`{"done":false,"update":{"total_numberof_requests":1,"succeeded_requests":1}}`))
+			return
+		}
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer dropping.Close()
+
+	registry := cluster.NewRegistry(time.Minute)
+	for _, s := range []*httptest.Server{first, second, dropping} {
+		registry.Register(s.URL)
+	}
+
+	coordinator := &cluster.Coordinator{
+		Registry:        registry,
+		Token:           token,
+		PollInterval:    50 * time.Millisecond,
+		MaxPollFailures: 2,
+	}
+
+	updates := 0
+	id := uuid.New()
+	report, err := coordinator.Run(context.Background(), id,
+		&spec.Spec{Version: spec.Version, Requests: []spec.Request{{URL: target.URL}}}, nil, nil, 7, 7,
+		func(u *liveupdate.Update) {
+			updates++
+			if u.TargetUsers != 7 {
+				t.Errorf("expected combined target users to be 7, got %d", u.TargetUsers)
+			}
+		})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if updates == 0 {
+		t.Errorf("expected live updates while the agents ran")
+	}
+
+	// The dropped agent got a single request through before going away,
+	// only its last counters are part of the report
+	if report.RequestedDone != hits.Load()+1 || report.SucceededRequests != hits.Load()+1 {
+		t.Errorf("unexpected merged counters: %+v", report)
+	}
+
+	if len(report.Agents) != 3 {
+		t.Fatalf("expected 3 agents in the report, got %d", len(report.Agents))
+	}
+	lost, lostUsers, users := 0, 0, 0
+	for _, a := range report.Agents {
+		users += a.TargetUsers
+		if !a.Lost && a.RequestedDone != int32(a.TargetUsers) {
+			t.Errorf("expected %s to run all its %d users, got %d", a.Address, a.TargetUsers, a.RequestedDone)
+		}
+		if a.Lost {
+			lost++
+			lostUsers += a.TargetUsers
+			if a.Address != dropping.URL {
+				t.Errorf("expected %s to be lost, got %s", dropping.URL, a.Address)
+			}
+		}
+	}
+	if lost != 1 {
+		t.Errorf("expected 1 lost agent, got %d", lost)
+	}
+	if users != 7 {
+		t.Errorf("expected the 7 users to be split across the agents, got %d", users)
+	}
+	if report.LostUsers == 0 || report.LostUsers != lostUsers {
+		t.Errorf("expected the %d users of the lost agent to be reported, got %d", lostUsers, report.LostUsers)
+	}
+
+	// Agents forget the runs once their reports were collected
+	for _, agent := range []*httptest.Server{first, second} {
+		req, _ := http.NewRequest(http.MethodGet, agent.URL+"/agent/runs/"+id.String(), nil)
+		cluster.Authorize(req, token)
+		res, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		res.Body.Close()
+		if res.StatusCode != http.StatusNotFound {
+			t.Errorf("expected %s to have released the run, got status %d", agent.URL, res.StatusCode)
+		}
+	}
+}
+
+func TestCoordinatorEvaluatesThresholds(t *testing.T) {
+	target := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer target.Close()
+
+	first, second := newAgent(), newAgent()
+	defer first.Close()
+	defer second.Close()
+
+	registry := cluster.NewRegistry(time.Minute)
+	registry.Register(first.URL)
+	registry.Register(second.URL)
+	coordinator := &cluster.Coordinator{Registry: registry, Token: token, PollInterval: 50 * time.Millisecond}
+
+	zero, four := 0.0, 4.0
+	thresholds := []tester.Threshold{
+		{Metric: "failed_requests", Max: &zero},
+		{Metric: "requests", Min: &four},
+	}
+	s := &spec.Spec{
+		Version:    spec.Version,
+		Requests:   []spec.Request{{URL: target.URL}},
+		Thresholds: thresholds,
+	}
+	report, err := coordinator.Run(context.Background(), uuid.New(), s, s.Thresholds, nil, 4, 4, nil)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	// Each agent only made 2 of the 4 requests, the thresholds have to go by
+	// the merged report
+	if len(report.Thresholds) != 2 {
+		t.Fatalf("expected 2 threshold results, got %+v", report.Thresholds)
+	}
+	failed, requests := report.Thresholds[0], report.Thresholds[1]
+	if failed.Passed || failed.Value != 4 {
+		t.Errorf("expected the failed requests threshold to fail on 4, got %+v", failed)
+	}
+	if !requests.Passed || requests.Value != 4 {
+		t.Errorf("expected the requests threshold to pass on 4, got %+v", requests)
+	}
+}
+
+func TestCoordinatorWithoutAgents(t *testing.T) {
+	coordinator := &cluster.Coordinator{Registry: cluster.NewRegistry(time.Minute)}
+	_, err := coordinator.Run(context.Background(), uuid.New(), nil, nil, nil, 1, 1, nil)
+	if err != cluster.ErrNoAgents {
+		t.Errorf("expected ErrNoAgents, got %v", err)
+	}
+}
+
+func TestAgentRequiresToken(t *testing.T) {
+	var hits atomic.Int32
+	target := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		hits.Add(1)
+	}))
+	defer target.Close()
+
+	agent := newAgent()
+	defer agent.Close()
+
+	registry := cluster.NewRegistry(time.Minute)
+	registry.Register(agent.URL)
+	coordinator := &cluster.Coordinator{Registry: registry, Token: "guessed", PollInterval: 50 * time.Millisecond}
+
+	report, err := coordinator.Run(context.Background(), uuid.New(),
+		&spec.Spec{Version: spec.Version, Requests: []spec.Request{{URL: target.URL}}}, nil, nil, 1, 1, nil)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if hits.Load() != 0 || len(report.Agents) != 1 || !report.Agents[0].Lost {
+		t.Errorf("expected the agent to refuse the job, got %d requests and %+v", hits.Load(), report.Agents)
+	}
+}
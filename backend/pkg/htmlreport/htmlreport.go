@@ -0,0 +1,249 @@
+// Package htmlreport renders the report of a test as a single HTML file, the
+// styles, scripts and charts are inlined so it can be attached to tickets
+// and emails
+package htmlreport
+
+import (
+	_ "embed"
+	"fmt"
+	"html/template"
+	"io"
+	"math"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/VarthanV/load-tester/pkg/spec"
+	"github.com/VarthanV/load-tester/pkg/tester"
+)
+
+//go:embed report.html
+var reportHTML string
+
+var reportTemplate = template.Must(template.New("report").Funcs(template.FuncMap{
+	"ms":       ms,
+	"percent":  percent,
+	"bytes":    formatBytes,
+	"duration": formatSeconds,
+}).Parse(reportHTML))
+
+// Page: a report and what it's shown with
+type Page struct {
+	// Id of the stored test, empty for runs from the command line
+	ID        string
+	Name      string
+	StartedAt time.Time
+	Report    *tester.Report
+	// Definition the test ran with, the config summary shows it with the
+	// secrets redacted and is left out without it
+	Definition *spec.Spec
+}
+
+// row: a line of the percentile, endpoint, check and error tables
+type row struct {
+	Name     string
+	Count    int32
+	Failed   int32
+	Value    float64
+	Endpoint *tester.EndpointReport
+}
+
+type view struct {
+	*Page
+	Title      string
+	Duration   int
+	Charts     []template.HTML
+	Latencies  []row
+	Endpoints  []row
+	Errors     []row
+	Checks     []row
+	Config     string
+	TimeSeries []tester.TimeSeriesPoint
+}
+
+// Render: writes the page as HTML
+func Render(w io.Writer, p *Page) error {
+	r := p.Report
+	v := &view{
+		Page:       p,
+		Title:      p.Name,
+		TimeSeries: r.TimeSeries,
+		Latencies: []row{
+			{Name: "Average", Value: r.AverageResponseTime},
+			{Name: "P50", Value: r.P50Percentile},
+			{Name: "P90", Value: r.P90Percentile},
+			{Name: "P99", Value: r.P99Percentile},
+			{Name: "Peak", Value: r.PeakResponseTime},
+		},
+	}
+	if v.Title == "" {
+		v.Title = "Load test"
+	}
+	if v.TimeSeries == nil {
+		v.TimeSeries = []tester.TimeSeriesPoint{}
+	}
+	if n := len(r.TimeSeries); n > 0 {
+		v.Duration = r.TimeSeries[n-1].Second + 1
+		v.Charts = []template.HTML{
+			chart("latency", "Latency over time", "ms", r.TimeSeries, func(p tester.TimeSeriesPoint) float64 {
+				return p.AverageResponseTime * 1000
+			}),
+			chart("rps", "Requests per second", "", r.TimeSeries, func(p tester.TimeSeriesPoint) float64 {
+				return float64(p.Requests)
+			}),
+			chart("errors", "Errors per second", "", r.TimeSeries, func(p tester.TimeSeriesPoint) float64 {
+				return float64(p.FailedRequests)
+			}),
+		}
+	}
+
+	for name, e := range r.Endpoints {
+		v.Endpoints = append(v.Endpoints, row{Name: name, Endpoint: e})
+	}
+	sort.Slice(v.Endpoints, func(i, j int) bool { return v.Endpoints[i].Name < v.Endpoints[j].Name })
+
+	for category, count := range r.Errors {
+		v.Errors = append(v.Errors, row{Name: category, Count: count})
+	}
+	sort.Slice(v.Errors, func(i, j int) bool {
+		if v.Errors[i].Count != v.Errors[j].Count {
+			return v.Errors[i].Count > v.Errors[j].Count
+		}
+		return v.Errors[i].Name < v.Errors[j].Name
+	})
+
+	for name, c := range r.Checks {
+		v.Checks = append(v.Checks, row{Name: name, Count: c.Passes + c.Fails, Failed: c.Fails})
+	}
+	sort.Slice(v.Checks, func(i, j int) bool { return v.Checks[i].Name < v.Checks[j].Name })
+
+	if p.Definition != nil {
+		config, err := spec.Marshal(p.Definition.Redacted(), spec.FormatYAML)
+		if err != nil {
+			return err
+		}
+		v.Config = string(config)
+	}
+
+	return reportTemplate.Execute(w, v)
+}
+
+// Size of the charts in svg units, the plot area is inset by the margins
+const (
+	chartWidth  = 720
+	chartHeight = 220
+	marginLeft  = 56
+	marginRight = 12
+	marginTop   = 12
+	marginBelow = 28
+)
+
+// chart: a line of value over the seconds of the time series as inline svg,
+// the data attributes let the script map the pointer back to a second
+func chart(id, title, unit string, points []tester.TimeSeriesPoint, value func(tester.TimeSeriesPoint) float64) template.HTML {
+	first, last := points[0].Second, points[len(points)-1].Second
+	peak := 0.0
+	for _, p := range points {
+		peak = math.Max(peak, value(p))
+	}
+	top := niceCeil(peak)
+
+	plotWidth := float64(chartWidth - marginLeft - marginRight)
+	plotHeight := float64(chartHeight - marginTop - marginBelow)
+	x := func(second int) float64 {
+		if last == first {
+			return marginLeft + plotWidth/2
+		}
+		return marginLeft + float64(second-first)/float64(last-first)*plotWidth
+	}
+	y := func(v float64) float64 {
+		return marginTop + plotHeight - v/top*plotHeight
+	}
+
+	var b strings.Builder
+	fmt.Fprintf(&b, `<figure class="chart"><figcaption>%s</figcaption>`, template.HTMLEscapeString(title))
+	fmt.Fprintf(&b, `<svg id="chart-%s" viewBox="0 0 %d %d" data-series="%s" data-unit="%s" data-first="%d" data-last="%d" data-left="%d" data-right="%d" role="img">`,
+		id, chartWidth, chartHeight, id, unit, first, last, marginLeft, chartWidth-marginRight)
+
+	for i := 0; i <= 4; i++ {
+		v := top * float64(i) / 4
+		fmt.Fprintf(&b, `<line class="grid" x1="%d" x2="%d" y1="%.1f" y2="%.1f"/>`,
+			marginLeft, chartWidth-marginRight, y(v), y(v))
+		fmt.Fprintf(&b, `<text class="axis" x="%d" y="%.1f" text-anchor="end">%s</text>`,
+			marginLeft-6, y(v)+4, formatTick(v, unit))
+	}
+	for _, second := range []int{first, (first + last) / 2, last} {
+		fmt.Fprintf(&b, `<text class="axis" x="%.1f" y="%d" text-anchor="middle">%s</text>`,
+			x(second), chartHeight-8, formatSeconds(second))
+	}
+
+	coords := make([]string, 0, len(points))
+	for _, p := range points {
+		coords = append(coords, fmt.Sprintf("%.1f,%.1f", x(p.Second), y(value(p))))
+	}
+	fmt.Fprintf(&b, `<polyline class="line %s" points="%s"/>`, id, strings.Join(coords, " "))
+	if len(points) == 1 {
+		fmt.Fprintf(&b, `<circle class="dot %s" cx="%.1f" cy="%.1f" r="3"/>`, id, x(first), y(value(points[0])))
+	}
+	fmt.Fprintf(&b, `<line class="cursor" x1="-1" x2="-1" y1="%d" y2="%d"/></svg></figure>`,
+		marginTop, chartHeight-marginBelow)
+	return template.HTML(b.String())
+}
+
+// Smallest of 1, 2 or 5 times a power of ten that's at least v
+func niceCeil(v float64) float64 {
+	if v <= 0 {
+		return 1
+	}
+	magnitude := math.Pow(10, math.Floor(math.Log10(v)))
+	for _, m := range []float64{1, 2, 5, 10} {
+		if m*magnitude >= v {
+			return m * magnitude
+		}
+	}
+	return 10 * magnitude
+}
+
+func formatTick(v float64, unit string) string {
+	tick := fmt.Sprintf("%g", math.Round(v*100)/100)
+	if unit != "" {
+		tick += " " + unit
+	}
+	return tick
+}
+
+// Seconds as a duration like 1m30s
+func formatSeconds(seconds int) string {
+	return (time.Duration(seconds) * time.Second).String()
+}
+
+// Seconds as milliseconds
+func ms(seconds float64) string {
+	return fmt.Sprintf("%.2f ms", seconds*1000)
+}
+
+func percent(ratio float64) string {
+	return fmt.Sprintf("%.2f%%", ratio*100)
+}
+
+// Totals are int64 and the averages per endpoint float64
+func formatBytes(size interface{}) string {
+	var n float64
+	switch s := size.(type) {
+	case int64:
+		n = float64(s)
+	case float64:
+		n = s
+	}
+
+	units := []string{"B", "KB", "MB", "GB"}
+	i := 0
+	for n >= 1024 && i < len(units)-1 {
+		n /= 1024
+		i++
+	}
+	if i == 0 {
+		return fmt.Sprintf("%.0f %s", n, units[i])
+	}
+	return fmt.Sprintf("%.1f %s", n, units[i])
+}
@@ -0,0 +1,112 @@
+package htmlreport
+
+import (
+	"bytes"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/VarthanV/load-tester/pkg/spec"
+	"github.com/VarthanV/load-tester/pkg/tester"
+)
+
+func TestRender(t *testing.T) {
+	maxP99 := 0.5
+	page := &Page{
+		ID:        "4a1c5b0e-3a8a-4a4c-9b9e-7f0c2f1f4d21",
+		Name:      "checkout",
+		StartedAt: time.Date(2024, 5, 1, 10, 0, 0, 0, time.UTC),
+		Report: &tester.Report{
+			RequestedDone:  30,
+			FailedRequests: 3,
+			ErrorRate:      0.1,
+			P99Percentile:  0.75,
+			TimeSeries: []tester.TimeSeriesPoint{
+				{Second: 0, Requests: 10, AverageResponseTime: 0.2},
+				{Second: 1, Requests: 12, FailedRequests: 3, AverageResponseTime: 0.4},
+				{Second: 2, Requests: 8, AverageResponseTime: 0.3},
+			},
+			Endpoints: map[string]*tester.EndpointReport{
+				"<script>alert(1)</script>": {Requests: 30, FailedRequests: 3},
+			},
+			Errors: map[string]int32{"timeout": 3},
+			Checks: map[string]*tester.CheckReport{"status is 200": {Passes: 27, Fails: 3}},
+			Thresholds: []tester.ThresholdResult{
+				{Threshold: tester.Threshold{Metric: "p99", Max: &maxP99}, Value: 0.75},
+			},
+		},
+		Definition: &spec.Spec{
+			Version:  spec.Version,
+			Name:     "checkout",
+			Target:   spec.Target{BaseURL: "https://shop.example.com", Headers: map[string]string{"X-Api-Key": "hunter2"}},
+			Load:     spec.LoadProfile{TargetUsers: 10},
+			Requests: []spec.Request{{Name: "cart", Path: "/cart"}},
+			Auth:     &tester.AuthConfig{Type: tester.AuthTypeBasic, Username: "load", Password: "hunter2"},
+		},
+	}
+
+	var out bytes.Buffer
+	err := Render(&out, page)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	html := out.String()
+
+	for _, expected := range []string{
+		"<title>checkout · load test report</title>",
+		"started 2024-05-01 10:00:00 UTC",
+		"ran for 3s",
+		`<div class="verdict failed">Thresholds failed</div>`,
+		`<svg id="chart-latency"`,
+		`<svg id="chart-rps"`,
+		`<svg id="chart-errors"`,
+		"750.00 ms",
+		"10.00%",
+		"&lt;script&gt;alert(1)&lt;/script&gt;",
+		"https://shop.example.com",
+		"cart: GET /cart",
+		"base_url: https://shop.example.com",
+		`"second":1,"requests":12`,
+	} {
+		if !strings.Contains(html, expected) {
+			t.Errorf("expected the page to contain %q", expected)
+		}
+	}
+	if strings.Contains(html, "<script>alert(1)") {
+		t.Error("expected the endpoint name to be escaped")
+	}
+	if strings.Contains(html, "hunter2") || !strings.Contains(html, "X-Api-Key: &#39;[REDACTED]&#39;") {
+		t.Error("expected the secrets of the definition to be redacted")
+	}
+
+	// Everything is inlined so the file works offline
+	external := regexp.MustCompile(`(src|href)="?https?:`)
+	if external.MatchString(html) {
+		t.Errorf("expected no external resources, found %s", external.FindString(html))
+	}
+}
+
+func TestRenderWithoutTimeSeries(t *testing.T) {
+	var out bytes.Buffer
+	err := Render(&out, &Page{Report: &tester.Report{}})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	html := out.String()
+	if !strings.Contains(html, "No time series was recorded.") || strings.Contains(html, "<svg") {
+		t.Error("expected a note instead of the charts")
+	}
+	if strings.Contains(html, `class="verdict`) || strings.Contains(html, "<h2>Configuration") {
+		t.Error("expected no verdict or configuration without thresholds and a definition")
+	}
+}
+
+func TestNiceCeil(t *testing.T) {
+	tests := map[float64]float64{0: 1, 0.3: 0.5, 1: 1, 7: 10, 12: 20, 480: 500}
+	for v, expected := range tests {
+		if got := niceCeil(v); got != expected {
+			t.Errorf("niceCeil(%g) = %g, expected %g", v, got, expected)
+		}
+	}
+}
@@ -0,0 +1,281 @@
+package importer
+
+import (
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/VarthanV/load-tester/pkg/spec"
+	"github.com/VarthanV/load-tester/pkg/tester"
+)
+
+// Options that take no value and don't change the request
+var curlSwitches = map[string]bool{
+	"-s": true, "--silent": true, "-S": true, "--show-error": true,
+	"-L": true, "--location": true, "-v": true, "--verbose": true,
+	"-i": true, "--include": true, "--compressed": true, "-f": true,
+	"--fail": true, "-N": true, "--no-buffer": true, "-#": true,
+	"--progress-bar": true, "--http1.1": true, "--http2": true,
+}
+
+// Options that take a value and don't change the request
+var curlIgnored = map[string]bool{
+	"-o": true, "--output": true, "-m": true, "--max-time": true,
+	"--connect-timeout": true, "-w": true, "--write-out": true,
+	"--retry": true, "-x": true, "--proxy": true,
+}
+
+// Each curl command becomes a request, commands are separated by new lines,
+// ; or && the way they'd be pasted from a terminal
+func importCURL(data []byte, r *Result) error {
+	words, err := shellWords(string(data))
+	if err != nil {
+		return err
+	}
+
+	commands := [][]string{}
+	for _, w := range words {
+		switch {
+		case w == "curl":
+			commands = append(commands, []string{})
+		case w == "\n" || w == ";" || w == "&&":
+			continue
+		case len(commands) == 0:
+			return fmt.Errorf("expected curl command, got %q", w)
+		default:
+			commands[len(commands)-1] = append(commands[len(commands)-1], w)
+		}
+	}
+
+	for i, args := range commands {
+		request, err := parseCURL(args, r)
+		if err != nil {
+			return fmt.Errorf("command %d: %w", i+1, err)
+		}
+		r.Definition.Requests = append(r.Definition.Requests, *request)
+	}
+	return nil
+}
+
+func parseCURL(args []string, r *Result) (*spec.Request, error) {
+	var (
+		request = spec.Request{}
+		data    = []string{}
+		get     = false
+		head    = false
+	)
+
+	for i := 0; i < len(args); i++ {
+		arg := args[i]
+		value := func() (string, error) {
+			if i+1 >= len(args) {
+				return "", fmt.Errorf("%s needs a value", arg)
+			}
+			i++
+			return args[i], nil
+		}
+
+		// Combined short switches like -sSL
+		if len(arg) > 2 && arg[0] == '-' && arg[1] != '-' && allSwitches(arg[1:]) {
+			continue
+		}
+
+		var err error
+		switch {
+		case !strings.HasPrefix(arg, "-"):
+			request.URL = arg
+		case curlSwitches[arg]:
+		case curlIgnored[arg]:
+			_, err = value()
+		case arg == "-k" || arg == "--insecure":
+			if r.Definition.Transport == nil {
+				r.Definition.Transport = &tester.TransportConfig{}
+			}
+			r.Definition.Transport.InsecureSkipVerify = true
+		case arg == "--url":
+			request.URL, err = value()
+		case arg == "-X" || arg == "--request":
+			request.Method, err = value()
+		case arg == "-H" || arg == "--header":
+			var header string
+			header, err = value()
+			name, v, _ := strings.Cut(header, ":")
+			request.Headers = addHeader(request.Headers, strings.TrimSpace(name), strings.TrimSpace(v))
+		case arg == "-d" || arg == "--data" || arg == "--data-raw" ||
+			arg == "--data-binary" || arg == "--data-ascii":
+			var d string
+			d, err = value()
+			if strings.HasPrefix(d, "@") && arg != "--data-raw" {
+				r.warn("%s %s: bodies read from files are not imported", arg, d)
+				continue
+			}
+			data = append(data, d)
+		case arg == "--data-urlencode":
+			var d string
+			d, err = value()
+			name, v, found := strings.Cut(d, "=")
+			if found {
+				d = name + "=" + url.QueryEscape(v)
+			} else {
+				d = url.QueryEscape(d)
+			}
+			data = append(data, d)
+		case arg == "--json":
+			var d string
+			d, err = value()
+			data = append(data, d)
+			request.Headers = addHeader(request.Headers, "Content-Type", "application/json")
+			request.Headers = addHeader(request.Headers, "Accept", "application/json")
+		case arg == "-u" || arg == "--user":
+			var user string
+			user, err = value()
+			request.Headers = addHeader(request.Headers, "Authorization",
+				"Basic "+base64.StdEncoding.EncodeToString([]byte(user)))
+		case arg == "-A" || arg == "--user-agent":
+			var agent string
+			agent, err = value()
+			request.Headers = addHeader(request.Headers, "User-Agent", agent)
+		case arg == "-e" || arg == "--referer":
+			var referer string
+			referer, err = value()
+			request.Headers = addHeader(request.Headers, "Referer", referer)
+		case arg == "-b" || arg == "--cookie":
+			var cookie string
+			cookie, err = value()
+			request.Headers = addHeader(request.Headers, "Cookie", cookie)
+		case arg == "-G" || arg == "--get":
+			get = true
+		case arg == "-I" || arg == "--head":
+			head = true
+		default:
+			return nil, fmt.Errorf("unsupported curl option %s", arg)
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if request.URL == "" {
+		return nil, errors.New("no url given")
+	}
+	if !strings.Contains(request.URL, "://") {
+		request.URL = "http://" + request.URL
+	}
+
+	body := strings.Join(data, "&")
+	switch {
+	case get && body != "":
+		separator := "?"
+		if strings.Contains(request.URL, "?") {
+			separator = "&"
+		}
+		request.URL += separator + body
+	case body != "":
+		if request.Headers["Content-Type"] == "" {
+			// curl sends data as a form unless told otherwise
+			request.Headers = addHeader(request.Headers, "Content-Type", "application/x-www-form-urlencoded")
+		}
+		setBody(&request, request.Headers["Content-Type"], body)
+	}
+
+	switch {
+	case request.Method != "":
+	case head:
+		request.Method = http.MethodHead
+	case body != "" && !get:
+		request.Method = http.MethodPost
+	default:
+		request.Method = http.MethodGet
+	}
+	return &request, nil
+}
+
+func allSwitches(flags string) bool {
+	for _, f := range flags {
+		if !curlSwitches["-"+string(f)] {
+			return false
+		}
+	}
+	return true
+}
+
+// Splits command lines the way a POSIX shell would, unquoted new lines are
+// kept as words so commands can be told apart
+func shellWords(input string) ([]string, error) {
+	var (
+		words   = []string{}
+		current strings.Builder
+		inWord  = false
+		quote   rune
+	)
+
+	flush := func() {
+		if inWord {
+			words = append(words, current.String())
+			current.Reset()
+			inWord = false
+		}
+	}
+
+	runes := []rune(input)
+	for i := 0; i < len(runes); i++ {
+		c := runes[i]
+		switch {
+		case quote == '\'':
+			if c == '\'' {
+				quote = 0
+				continue
+			}
+			current.WriteRune(c)
+		case quote == '"':
+			switch {
+			case c == '"':
+				quote = 0
+			case c == '\\' && i+1 < len(runes) && strings.ContainsRune("\"\\$`\n", runes[i+1]):
+				i++
+				if runes[i] != '\n' {
+					current.WriteRune(runes[i])
+				}
+			default:
+				current.WriteRune(c)
+			}
+		case c == '\\':
+			// Line continuations join the lines of a command
+			if i+1 < len(runes) {
+				i++
+				if runes[i] == '\r' && i+1 < len(runes) && runes[i+1] == '\n' {
+					i++
+				}
+				if runes[i] != '\n' {
+					current.WriteRune(runes[i])
+					inWord = true
+				}
+			}
+		case c == '\'' || c == '"':
+			quote = c
+			inWord = true
+		case c == '\n' || c == ';':
+			flush()
+			words = append(words, string(c))
+		case c == ' ' || c == '\t' || c == '\r':
+			flush()
+		case c == '$' && i+1 < len(runes) && runes[i+1] == '\'' && !inWord:
+			// Chrome copies bodies as $'...', the escapes in them are rare
+			// enough to be taken literally
+			i++
+			quote = '\''
+			inWord = true
+		default:
+			current.WriteRune(c)
+			inWord = true
+		}
+	}
+	if quote != 0 {
+		return nil, fmt.Errorf("unterminated %c quote", quote)
+	}
+	flush()
+	return words, nil
+}
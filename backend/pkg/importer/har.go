@@ -0,0 +1,70 @@
+package importer
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/url"
+
+	"github.com/VarthanV/load-tester/pkg/spec"
+)
+
+type har struct {
+	Log struct {
+		Entries []harEntry `json:"entries"`
+	} `json:"log"`
+}
+
+type harEntry struct {
+	Request struct {
+		Method   string      `json:"method"`
+		URL      string      `json:"url"`
+		Headers  []harHeader `json:"headers"`
+		PostData *struct {
+			MimeType string `json:"mimeType"`
+			Text     string `json:"text"`
+		} `json:"postData"`
+	} `json:"request"`
+	Response struct {
+		Status int `json:"status"`
+	} `json:"response"`
+}
+
+type harHeader struct {
+	Name  string `json:"name"`
+	Value string `json:"value"`
+}
+
+// Every entry becomes a request in the order the browser made them, the
+// status it got back is what counts as success
+func importHAR(data []byte, r *Result) error {
+	h := har{}
+	err := json.Unmarshal(data, &h)
+	if err != nil {
+		return fmt.Errorf("invalid har: %w", err)
+	}
+
+	for i, e := range h.Log.Entries {
+		u, err := url.Parse(e.Request.URL)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") {
+			r.warn("entries[%d]: skipped %q, only http and https urls are imported", i, e.Request.URL)
+			continue
+		}
+
+		request := spec.Request{
+			Method: e.Request.Method,
+			URL:    e.Request.URL,
+		}
+		for _, header := range e.Request.Headers {
+			request.Headers = addHeader(request.Headers, header.Name, header.Value)
+		}
+		if e.Request.PostData != nil {
+			setBody(&request, e.Request.PostData.MimeType, e.Request.PostData.Text)
+		}
+		if e.Response.Status >= 100 && e.Response.Status <= 599 {
+			request.SuccessStatusCodes = []int{e.Response.Status}
+		}
+
+		r.Definition.Requests = append(r.Definition.Requests, request)
+	}
+	return nil
+}
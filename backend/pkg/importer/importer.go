@@ -0,0 +1,130 @@
+package importer
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"path/filepath"
+	"strings"
+
+	"github.com/VarthanV/load-tester/pkg/spec"
+)
+
+const (
+	// Browser HTTP archive
+	FormatHAR = "har"
+	// One or more curl command lines
+	FormatCURL = "curl"
+	// Postman collection v2.0 or v2.1
+	FormatPostman = "postman"
+	// OpenAPI 3 document, JSON or YAML
+	FormatOpenAPI = "openapi"
+)
+
+// Result: the imported definition and what couldn't be carried over
+type Result struct {
+	Definition *spec.Spec `json:"definition"`
+	Warnings   []string   `json:"warnings,omitempty"`
+}
+
+func (r *Result) warn(format string, args ...interface{}) {
+	r.Warnings = append(r.Warnings, fmt.Sprintf(format, args...))
+}
+
+// Import: converts data in the given format into a test definition, the
+// definition runs a single user and is meant to be edited before running
+func Import(data []byte, format string) (*Result, error) {
+	r := &Result{
+		Definition: &spec.Spec{
+			Version: spec.Version,
+			Load:    spec.LoadProfile{TargetUsers: 1},
+		},
+	}
+
+	var err error
+	switch format {
+	case FormatHAR:
+		err = importHAR(data, r)
+	case FormatCURL:
+		err = importCURL(data, r)
+	case FormatPostman:
+		err = importPostman(data, r)
+	case FormatOpenAPI:
+		err = importOpenAPI(data, r)
+	default:
+		return nil, fmt.Errorf("unknown import format %q, expected one of har, curl, postman or openapi", format)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if len(r.Definition.Requests) == 0 {
+		return nil, fmt.Errorf("no requests found in the %s input", format)
+	}
+	return r, nil
+}
+
+// Detect: guesses the format from the file name and content, returns an
+// empty string when nothing matches
+func Detect(name string, data []byte) string {
+	switch strings.ToLower(filepath.Ext(name)) {
+	case ".har":
+		return FormatHAR
+	case ".sh", ".curl":
+		return FormatCURL
+	}
+
+	trimmed := bytes.TrimSpace(data)
+	switch {
+	case bytes.HasPrefix(trimmed, []byte("curl ")):
+		return FormatCURL
+	case bytes.Contains(trimmed, []byte(`"openapi"`)) || bytes.HasPrefix(trimmed, []byte("openapi:")):
+		return FormatOpenAPI
+	case bytes.Contains(trimmed, []byte("getpostman.com")):
+		return FormatPostman
+	case bytes.Contains(trimmed, []byte(`"log"`)) && bytes.Contains(trimmed, []byte(`"entries"`)):
+		return FormatHAR
+	}
+	return ""
+}
+
+// Headers the transport sets on its own or that only make sense for the
+// original connection
+var skippedHeaders = map[string]bool{
+	"Host":              true,
+	"Content-Length":    true,
+	"Connection":        true,
+	"Accept-Encoding":   true,
+	"Transfer-Encoding": true,
+	"Keep-Alive":        true,
+	"Upgrade":           true,
+}
+
+func addHeader(headers map[string]string, name string, value string) map[string]string {
+	if strings.HasPrefix(name, ":") || skippedHeaders[http.CanonicalHeaderKey(name)] {
+		return headers
+	}
+	if headers == nil {
+		headers = map[string]string{}
+	}
+	headers[http.CanonicalHeaderKey(name)] = value
+	return headers
+}
+
+// Sets the body of the request, JSON bodies stay structured so they can be
+// edited in the definition and everything else is sent as is
+func setBody(r *spec.Request, contentType string, text string) {
+	if text == "" {
+		return
+	}
+
+	if strings.Contains(contentType, "json") || contentType == "" {
+		var body interface{}
+		if json.Unmarshal([]byte(text), &body) == nil && body != nil {
+			r.Body = body
+			return
+		}
+	}
+	r.RawBody = text
+}
@@ -0,0 +1,202 @@
+package importer
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/VarthanV/load-tester/pkg/spec"
+)
+
+func TestImportHAR(t *testing.T) {
+	r, err := Import([]byte(`{"log": {"entries": [
+		{"request": {"method": "POST", "url": "https://example.com/login",
+			"headers": [{"name": ":authority", "value": "example.com"},
+				{"name": "content-type", "value": "application/json"},
+				{"name": "Content-Length", "value": "14"}],
+			"postData": {"mimeType": "application/json", "text": "{\"user\":\"qa\"}"}},
+		 "response": {"status": 201}},
+		{"request": {"method": "GET", "url": "data:image/png;base64,AAAA"}, "response": {"status": 200}}
+	]}}`), FormatHAR)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	want := []spec.Request{{
+		Method:             "POST",
+		URL:                "https://example.com/login",
+		Headers:            map[string]string{"Content-Type": "application/json"},
+		Body:               map[string]interface{}{"user": "qa"},
+		SuccessStatusCodes: []int{201},
+	}}
+	if !reflect.DeepEqual(r.Definition.Requests, want) {
+		t.Errorf("unexpected requests %+v", r.Definition.Requests)
+	}
+	if len(r.Warnings) != 1 {
+		t.Errorf("expected a warning for the skipped data url, got %v", r.Warnings)
+	}
+}
+
+func TestImportCURL(t *testing.T) {
+	r, err := Import([]byte(`curl -sSL 'https://example.com/api/items' \
+  -H 'Accept: application/json' \
+  --data-raw '{"name":"load test"}' -u qa:secret
+curl example.com/search -G -d q=shoes -d page=2
+curl -X DELETE "https://example.com/api/items/1" -k`), FormatCURL)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	requests := r.Definition.Requests
+	if len(requests) != 3 {
+		t.Fatalf("expected 3 requests, got %+v", requests)
+	}
+	if requests[0].Method != "POST" || requests[0].RawBody != `{"name":"load test"}` ||
+		requests[0].Headers["Authorization"] != "Basic cWE6c2VjcmV0" ||
+		requests[0].Headers["Content-Type"] != "application/x-www-form-urlencoded" {
+		t.Errorf("unexpected first request %+v", requests[0])
+	}
+	if requests[1].Method != "GET" || requests[1].URL != "http://example.com/search?q=shoes&page=2" {
+		t.Errorf("unexpected second request %+v", requests[1])
+	}
+	if requests[2].Method != "DELETE" || r.Definition.Transport == nil || !r.Definition.Transport.InsecureSkipVerify {
+		t.Errorf("unexpected third request %+v", requests[2])
+	}
+
+	_, err = Import([]byte(`curl --frobnicate https://example.com`), FormatCURL)
+	if err == nil || !strings.Contains(err.Error(), "--frobnicate") {
+		t.Errorf("expected unsupported option to be named, got %v", err)
+	}
+}
+
+func TestImportPostman(t *testing.T) {
+	r, err := Import([]byte(`{
+		"info": {"name": "Shop", "schema": "https://schema.getpostman.com/json/collection/v2.1.0/collection.json"},
+		"variable": [{"key": "base", "value": "https://example.com"}],
+		"item": [{"name": "Auth", "item": [{"name": "Login", "request": {
+			"method": "POST",
+			"url": {"raw": "{{base}}/login"},
+			"header": [{"key": "X-Debug", "value": "1", "disabled": true}],
+			"body": {"mode": "urlencoded", "urlencoded": [{"key": "user", "value": "qa"}]}
+		}}]}, {"name": "Profile", "request": {
+			"method": "GET",
+			"url": "{{base}}/me",
+			"auth": {"type": "bearer", "bearer": [{"key": "token", "value": "{{token}}"}]}
+		}}]
+	}`), FormatPostman)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	requests := r.Definition.Requests
+	if r.Definition.Name != "Shop" || len(requests) != 2 {
+		t.Fatalf("unexpected definition %+v", r.Definition)
+	}
+	if requests[0].Name != "Auth/Login" || requests[0].URL != "https://example.com/login" ||
+		requests[0].RawBody != "user=qa" || requests[0].Headers["X-Debug"] != "" {
+		t.Errorf("unexpected first request %+v", requests[0])
+	}
+	if requests[1].Headers["Authorization"] != "Bearer {{token}}" {
+		t.Errorf("expected unknown variables to be left in place, got %+v", requests[1])
+	}
+	if len(r.Warnings) != 1 || !strings.Contains(r.Warnings[0], "token") {
+		t.Errorf("expected a warning for the missing variable, got %v", r.Warnings)
+	}
+}
+
+func TestImportOpenAPI(t *testing.T) {
+	r, err := Import([]byte(`
+openapi: 3.0.3
+info:
+  title: Pets
+servers:
+  - url: https://{env}.example.com/v1
+    variables:
+      env:
+        default: staging
+paths:
+  /pets/{id}:
+    parameters:
+      - $ref: '#/components/parameters/id'
+    get:
+      operationId: getPet
+      responses:
+        200:
+          description: ok
+  /pets:
+    post:
+      parameters:
+        - name: dry_run
+          in: query
+          required: true
+          schema:
+            type: boolean
+      requestBody:
+        content:
+          application/json:
+            schema:
+              $ref: '#/components/schemas/Pet'
+      responses:
+        "201":
+          description: created
+components:
+  parameters:
+    id:
+      name: id
+      in: path
+      required: true
+      schema:
+        type: integer
+        example: 42
+  schemas:
+    Pet:
+      type: object
+      properties:
+        name:
+          type: string
+          example: rex
+        tags:
+          type: array
+          items:
+            type: string
+`), FormatOpenAPI)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	d := r.Definition
+	if d.Target.BaseURL != "https://staging.example.com/v1" || len(d.Requests) != 2 {
+		t.Fatalf("unexpected definition %+v", d)
+	}
+
+	post, get := d.Requests[0], d.Requests[1]
+	if post.Path != "/pets?dry_run=true" || !reflect.DeepEqual(post.SuccessStatusCodes, []int{201}) {
+		t.Errorf("unexpected post request %+v", post)
+	}
+	wantBody := map[string]interface{}{"name": "rex", "tags": []interface{}{"string"}}
+	if !reflect.DeepEqual(post.Body, wantBody) {
+		t.Errorf("expected body built from the schema, got %#v", post.Body)
+	}
+	if get.Name != "getPet" || get.Path != "/pets/42" {
+		t.Errorf("unexpected get request %+v", get)
+	}
+
+	if err := d.Validate(); err != nil {
+		t.Errorf("expected imported definition to be valid, got %v", err)
+	}
+}
+
+func TestDetect(t *testing.T) {
+	tests := map[string]string{
+		"curl https://example.com":                                FormatCURL,
+		`{"openapi": "3.1.0"}`:                                    FormatOpenAPI,
+		`{"log": {"entries": []}}`:                                FormatHAR,
+		`{"info": {"schema": "https://schema.getpostman.com/x"}}`: FormatPostman,
+		"hello": "",
+	}
+	for data, want := range tests {
+		if got := Detect("input", []byte(data)); got != want {
+			t.Errorf("Detect(%q) = %q, want %q", data, got, want)
+		}
+	}
+}
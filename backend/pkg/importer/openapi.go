@@ -0,0 +1,354 @@
+package importer
+
+import (
+	"fmt"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/VarthanV/load-tester/pkg/spec"
+	"gopkg.in/yaml.v3"
+)
+
+// Order operations of a path are imported in
+var openAPIMethods = []string{"get", "post", "put", "patch", "delete", "head", "options"}
+
+// Nested schemas past this depth are left out of generated examples
+const maxExampleDepth = 6
+
+// The document is kept as decoded JSON, only a few fields are read and
+// $refs can point anywhere in it
+type openAPI struct {
+	doc map[string]interface{}
+	r   *Result
+}
+
+// Every operation becomes a request on the first server, parameters and
+// bodies are filled from examples, defaults or the schema
+func importOpenAPI(data []byte, r *Result) error {
+	var doc interface{}
+	err := yaml.Unmarshal(data, &doc)
+	if err != nil {
+		return fmt.Errorf("invalid openapi document: %w", err)
+	}
+	root, ok := stringKeys(doc).(map[string]interface{})
+	if !ok {
+		return fmt.Errorf("invalid openapi document: expected an object")
+	}
+	version, _ := root["openapi"].(string)
+	if !strings.HasPrefix(version, "3.") {
+		return fmt.Errorf("unsupported openapi version %q, expected 3.x", version)
+	}
+
+	o := &openAPI{doc: root, r: r}
+	if info, ok := root["info"].(map[string]interface{}); ok {
+		r.Definition.Name, _ = info["title"].(string)
+	}
+	r.Definition.Target.BaseURL = o.baseURL()
+
+	paths, _ := root["paths"].(map[string]interface{})
+	names := make([]string, 0, len(paths))
+	for path := range paths {
+		names = append(names, path)
+	}
+	sort.Strings(names)
+
+	for _, path := range names {
+		item, _ := o.deref(paths[path]).(map[string]interface{})
+		for _, method := range openAPIMethods {
+			operation, ok := item[method].(map[string]interface{})
+			if !ok {
+				continue
+			}
+			r.Definition.Requests = append(r.Definition.Requests,
+				o.request(path, strings.ToUpper(method), item, operation))
+		}
+	}
+	return nil
+}
+
+func (o *openAPI) baseURL() string {
+	servers, _ := o.doc["servers"].([]interface{})
+	if len(servers) == 0 {
+		o.r.warn("no servers in the document, set target.base_url in the definition")
+		return "http://localhost"
+	}
+
+	server, _ := servers[0].(map[string]interface{})
+	base, _ := server["url"].(string)
+	variables, _ := server["variables"].(map[string]interface{})
+	for name, v := range variables {
+		variable, _ := v.(map[string]interface{})
+		base = strings.ReplaceAll(base, "{"+name+"}", fmt.Sprint(variable["default"]))
+	}
+
+	if !strings.Contains(base, "://") {
+		o.r.warn("server url %q is relative, set target.base_url in the definition", base)
+		return "http://localhost" + "/" + strings.TrimPrefix(base, "/")
+	}
+	return base
+}
+
+func (o *openAPI) request(path string, method string, item map[string]interface{},
+	operation map[string]interface{}) spec.Request {
+	request := spec.Request{
+		Method: method,
+	}
+	request.Name, _ = operation["operationId"].(string)
+	if request.Name == "" {
+		request.Name = method + " " + path
+	}
+
+	query := url.Values{}
+	parameters := append(o.list(item["parameters"]), o.list(operation["parameters"])...)
+	for _, p := range parameters {
+		parameter, _ := o.deref(p).(map[string]interface{})
+		name, _ := parameter["name"].(string)
+		required, _ := parameter["required"].(bool)
+		value := fmt.Sprint(o.parameterExample(parameter))
+
+		switch parameter["in"] {
+		case "path":
+			path = strings.ReplaceAll(path, "{"+name+"}", url.PathEscape(value))
+		case "query":
+			if required {
+				query.Set(name, value)
+			}
+		case "header":
+			if required {
+				request.Headers = addHeader(request.Headers, name, value)
+			}
+		}
+	}
+
+	request.Path = path
+	if len(query) > 0 {
+		request.Path += "?" + query.Encode()
+	}
+
+	if body, ok := o.deref(operation["requestBody"]).(map[string]interface{}); ok {
+		o.setRequestBody(&request, body)
+	}
+
+	responses, _ := operation["responses"].(map[string]interface{})
+	for code := range responses {
+		status, err := strconv.Atoi(code)
+		if err == nil && status >= 200 && status < 300 {
+			request.SuccessStatusCodes = append(request.SuccessStatusCodes, status)
+		}
+	}
+	sort.Ints(request.SuccessStatusCodes)
+	return request
+}
+
+func (o *openAPI) setRequestBody(request *spec.Request, body map[string]interface{}) {
+	content, _ := body["content"].(map[string]interface{})
+	types := make([]string, 0, len(content))
+	for contentType := range content {
+		types = append(types, contentType)
+	}
+	sort.Strings(types)
+
+	for _, contentType := range types {
+		media, _ := content[contentType].(map[string]interface{})
+		example := o.mediaExample(media)
+
+		switch {
+		case strings.Contains(contentType, "json"):
+			request.Body = example
+		case contentType == "application/x-www-form-urlencoded":
+			form := url.Values{}
+			fields, _ := example.(map[string]interface{})
+			for k, v := range fields {
+				form.Set(k, fmt.Sprint(v))
+			}
+			request.RawBody = form.Encode()
+		case strings.HasPrefix(contentType, "text/"):
+			request.RawBody = fmt.Sprint(example)
+		default:
+			continue
+		}
+		request.Headers = addHeader(request.Headers, "Content-Type", contentType)
+		return
+	}
+
+	if len(types) > 0 {
+		o.r.warn("%s: %s bodies are not imported", request.Name, strings.Join(types, ", "))
+	}
+}
+
+func (o *openAPI) parameterExample(parameter map[string]interface{}) interface{} {
+	if example, ok := parameter["example"]; ok {
+		return example
+	}
+	if example, ok := firstExample(parameter["examples"]); ok {
+		return example
+	}
+	return o.schemaExample(parameter["schema"], 0)
+}
+
+func (o *openAPI) mediaExample(media map[string]interface{}) interface{} {
+	if example, ok := media["example"]; ok {
+		return example
+	}
+	if example, ok := firstExample(o.deref(media["examples"])); ok {
+		return o.deref(example)
+	}
+	return o.schemaExample(media["schema"], 0)
+}
+
+// Values of the examples map are example objects with a value
+func firstExample(examples interface{}) (interface{}, bool) {
+	m, ok := examples.(map[string]interface{})
+	if !ok || len(m) == 0 {
+		return nil, false
+	}
+	names := make([]string, 0, len(m))
+	for name := range m {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	example, _ := m[names[0]].(map[string]interface{})
+	value, ok := example["value"]
+	return value, ok
+}
+
+// Builds a value matching the schema, preferring the examples and defaults
+// the document gives
+func (o *openAPI) schemaExample(s interface{}, depth int) interface{} {
+	schema, ok := o.deref(s).(map[string]interface{})
+	if !ok || depth > maxExampleDepth {
+		return nil
+	}
+
+	for _, key := range []string{"example", "default"} {
+		if v, ok := schema[key]; ok {
+			return v
+		}
+	}
+	if enum, ok := schema["enum"].([]interface{}); ok && len(enum) > 0 {
+		return enum[0]
+	}
+	for _, key := range []string{"allOf", "oneOf", "anyOf"} {
+		options, ok := schema[key].([]interface{})
+		if !ok || len(options) == 0 {
+			continue
+		}
+		if key != "allOf" {
+			return o.schemaExample(options[0], depth+1)
+		}
+		merged := map[string]interface{}{}
+		for _, option := range options {
+			if fields, ok := o.schemaExample(option, depth+1).(map[string]interface{}); ok {
+				for k, v := range fields {
+					merged[k] = v
+				}
+			}
+		}
+		return merged
+	}
+
+	schemaType, _ := schema["type"].(string)
+	if schemaType == "" {
+		if _, ok := schema["properties"]; ok {
+			schemaType = "object"
+		}
+	}
+
+	switch schemaType {
+	case "object":
+		fields := map[string]interface{}{}
+		properties, _ := schema["properties"].(map[string]interface{})
+		for name, property := range properties {
+			fields[name] = o.schemaExample(property, depth+1)
+		}
+		return fields
+	case "array":
+		return []interface{}{o.schemaExample(schema["items"], depth+1)}
+	case "integer":
+		return 1
+	case "number":
+		return 1.5
+	case "boolean":
+		return true
+	case "string":
+		return stringExample(schema)
+	}
+	return nil
+}
+
+func stringExample(schema map[string]interface{}) string {
+	format, _ := schema["format"].(string)
+	switch format {
+	case "date-time":
+		return "2024-01-01T00:00:00Z"
+	case "date":
+		return "2024-01-01"
+	case "uuid":
+		return "00000000-0000-0000-0000-000000000000"
+	case "email":
+		return "user@example.com"
+	case "uri", "url":
+		return "http://example.com"
+	}
+	return "string"
+}
+
+func (o *openAPI) list(v interface{}) []interface{} {
+	l, _ := o.deref(v).([]interface{})
+	return l
+}
+
+// Follows local $refs like #/components/schemas/Pet, refs to other
+// documents are left unresolved
+func (o *openAPI) deref(v interface{}) interface{} {
+	for i := 0; i < maxExampleDepth; i++ {
+		m, ok := v.(map[string]interface{})
+		if !ok {
+			return v
+		}
+		ref, ok := m["$ref"].(string)
+		if !ok {
+			return v
+		}
+		if !strings.HasPrefix(ref, "#/") {
+			o.r.warn("reference %s is not imported, only references within the document are", ref)
+			return nil
+		}
+
+		var current interface{} = o.doc
+		for _, part := range strings.Split(strings.TrimPrefix(ref, "#/"), "/") {
+			part = strings.ReplaceAll(strings.ReplaceAll(part, "~1", "/"), "~0", "~")
+			fields, _ := current.(map[string]interface{})
+			current = fields[part]
+		}
+		v = current
+	}
+	return v
+}
+
+// YAML keys like response codes decode as numbers, the document is walked
+// with string keys only
+func stringKeys(v interface{}) interface{} {
+	switch v := v.(type) {
+	case map[string]interface{}:
+		for k, value := range v {
+			v[k] = stringKeys(value)
+		}
+		return v
+	case map[interface{}]interface{}:
+		m := make(map[string]interface{}, len(v))
+		for k, value := range v {
+			m[fmt.Sprint(k)] = stringKeys(value)
+		}
+		return m
+	case []interface{}:
+		for i, value := range v {
+			v[i] = stringKeys(value)
+		}
+		return v
+	}
+	return v
+}
@@ -0,0 +1,210 @@
+package importer
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"regexp"
+	"strings"
+
+	"github.com/VarthanV/load-tester/pkg/spec"
+)
+
+type postmanCollection struct {
+	Info struct {
+		Name string `json:"name"`
+	} `json:"info"`
+	Item     []postmanItem     `json:"item"`
+	Variable []postmanKeyValue `json:"variable"`
+}
+
+// postmanItem: a request or a folder of items
+type postmanItem struct {
+	Name    string          `json:"name"`
+	Item    []postmanItem   `json:"item"`
+	Request json.RawMessage `json:"request"`
+}
+
+type postmanRequest struct {
+	Method string            `json:"method"`
+	Header []postmanKeyValue `json:"header"`
+	URL    json.RawMessage   `json:"url"`
+	Body   *postmanBody      `json:"body"`
+	Auth   *postmanAuth      `json:"auth"`
+}
+
+type postmanBody struct {
+	Mode       string            `json:"mode"`
+	Raw        string            `json:"raw"`
+	URLEncoded []postmanKeyValue `json:"urlencoded"`
+	Options    struct {
+		Raw struct {
+			Language string `json:"language"`
+		} `json:"raw"`
+	} `json:"options"`
+}
+
+type postmanAuth struct {
+	Type   string            `json:"type"`
+	Bearer []postmanKeyValue `json:"bearer"`
+}
+
+type postmanKeyValue struct {
+	Key      string `json:"key"`
+	Value    string `json:"value"`
+	Disabled bool   `json:"disabled"`
+}
+
+var postmanVariable = regexp.MustCompile(`{{\s*([^{}\s]+)\s*}}`)
+
+// Folders are flattened in order, collection variables are substituted and
+// the ones without a value are left in place with a warning
+func importPostman(data []byte, r *Result) error {
+	c := postmanCollection{}
+	err := json.Unmarshal(data, &c)
+	if err != nil {
+		return fmt.Errorf("invalid postman collection: %w", err)
+	}
+
+	r.Definition.Name = c.Info.Name
+	variables := map[string]string{}
+	for _, v := range c.Variable {
+		variables[v.Key] = v.Value
+	}
+	missing := map[string]bool{}
+	substitute := func(s string) string {
+		return postmanVariable.ReplaceAllStringFunc(s, func(m string) string {
+			name := postmanVariable.FindStringSubmatch(m)[1]
+			value, ok := variables[name]
+			if !ok {
+				if !missing[name] {
+					missing[name] = true
+					r.warn("variable %s has no value in the collection, set it in the definition", name)
+				}
+				return m
+			}
+			return value
+		})
+	}
+
+	var walkItems func(items []postmanItem, folder string) error
+	walkItems = func(items []postmanItem, folder string) error {
+		for _, item := range items {
+			name := item.Name
+			if folder != "" {
+				name = folder + "/" + item.Name
+			}
+			if len(item.Item) > 0 {
+				err := walkItems(item.Item, name)
+				if err != nil {
+					return err
+				}
+				continue
+			}
+			if len(item.Request) == 0 {
+				continue
+			}
+
+			request, err := postmanToRequest(item.Request, r, name, substitute)
+			if err != nil {
+				return fmt.Errorf("item %s: %w", name, err)
+			}
+			r.Definition.Requests = append(r.Definition.Requests, *request)
+		}
+		return nil
+	}
+	return walkItems(c.Item, "")
+}
+
+func postmanToRequest(raw json.RawMessage, r *Result, name string,
+	substitute func(string) string) (*spec.Request, error) {
+	p := postmanRequest{}
+
+	// A request can be given as just its url
+	var rawURL string
+	if json.Unmarshal(raw, &rawURL) == nil {
+		p.URL, _ = json.Marshal(rawURL)
+	} else {
+		err := json.Unmarshal(raw, &p)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	u, err := postmanURL(p.URL)
+	if err != nil {
+		return nil, err
+	}
+
+	request := spec.Request{
+		Name:   name,
+		Method: p.Method,
+		URL:    substitute(u),
+	}
+	for _, h := range p.Header {
+		if h.Disabled {
+			continue
+		}
+		request.Headers = addHeader(request.Headers, h.Key, substitute(h.Value))
+	}
+
+	if p.Auth != nil {
+		switch p.Auth.Type {
+		case "bearer":
+			for _, kv := range p.Auth.Bearer {
+				if kv.Key == "token" {
+					request.Headers = addHeader(request.Headers, "Authorization", "Bearer "+substitute(kv.Value))
+				}
+			}
+		case "noauth":
+		default:
+			r.warn("%s: %s auth is not imported", name, p.Auth.Type)
+		}
+	}
+
+	if p.Body != nil {
+		switch p.Body.Mode {
+		case "raw":
+			contentType := request.Headers["Content-Type"]
+			if contentType == "" && p.Body.Options.Raw.Language == "json" {
+				contentType = "application/json"
+				request.Headers = addHeader(request.Headers, "Content-Type", contentType)
+			}
+			setBody(&request, contentType, substitute(p.Body.Raw))
+		case "urlencoded":
+			form := url.Values{}
+			for _, kv := range p.Body.URLEncoded {
+				if !kv.Disabled {
+					form.Add(kv.Key, substitute(kv.Value))
+				}
+			}
+			request.RawBody = form.Encode()
+			request.Headers = addHeader(request.Headers, "Content-Type", "application/x-www-form-urlencoded")
+		case "":
+		default:
+			r.warn("%s: %s bodies are not imported", name, p.Body.Mode)
+		}
+	}
+	return &request, nil
+}
+
+// Urls are either a string or an object with the raw url and its parts
+func postmanURL(raw json.RawMessage) (string, error) {
+	if len(raw) == 0 {
+		return "", fmt.Errorf("request has no url")
+	}
+
+	var s string
+	if json.Unmarshal(raw, &s) == nil {
+		return strings.TrimSpace(s), nil
+	}
+
+	u := struct {
+		Raw string `json:"raw"`
+	}{}
+	err := json.Unmarshal(raw, &u)
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(u.Raw), nil
+}
@@ -13,6 +13,18 @@ type Update struct {
 	SucceededRequests         int32 `json:"succeeded_requests"`
 	FailedRequests            int32 `json:"failed_requests"`
 	TargetUsers               int32 `json:"target_users"`
+	// The run is over and its report is stored
+	Done bool `json:"done"`
+
+	// Present for WebSocket tests
+	WebSocket *WebSocketUpdate `json:"websocket,omitempty"`
+}
+
+type WebSocketUpdate struct {
+	Connections           int32 `json:"connections"`
+	MessagesSent          int64 `json:"messages_sent"`
+	MessagesReceived      int64 `json:"messages_received"`
+	UnexpectedDisconnects int32 `json:"unexpected_disconnects"`
 }
 
 type Updater interface {
@@ -0,0 +1,359 @@
+package recorder
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/VarthanV/load-tester/pkg/importer"
+	"github.com/VarthanV/load-tester/pkg/spec"
+	"github.com/VarthanV/load-tester/pkg/tester"
+)
+
+// Values shorter than this are too likely to show up by chance
+const minDynamicLength = 6
+
+// Headers the tester sets on its own
+var skippedHeaders = map[string]bool{
+	"Host":            true,
+	"Content-Length":  true,
+	"Accept-Encoding": true,
+}
+
+var nonIdentifier = regexp.MustCompile(`[^A-Za-z0-9_]+`)
+
+// candidate: a value a response handed out that later requests may send
+// back, it becomes a variable once a request uses it
+type candidate struct {
+	value   string
+	step    int
+	name    string
+	extract tester.Extract
+	used    bool
+}
+
+type builder struct {
+	requests   []spec.Request
+	candidates map[string]*candidate
+	names      map[string]bool
+}
+
+// Definition: turns the recorded session into a test definition with the
+// values handed out by responses extracted into variables
+func (r *Recorder) Definition() *importer.Result {
+	result := Definition(r.Exchanges())
+	for _, host := range r.Tunnelled() {
+		result.Warnings = append(result.Warnings,
+			fmt.Sprintf("requests to %s went over HTTPS and were not recorded", host))
+	}
+	sort.Strings(result.Warnings)
+	return result
+}
+
+// Definition: builds a definition out of exchanges in the order they were made
+func Definition(exchanges []Exchange) *importer.Result {
+	b := &builder{
+		candidates: map[string]*candidate{},
+		names:      map[string]bool{},
+	}
+
+	for i, e := range exchanges {
+		request := spec.Request{
+			Method:             e.Method,
+			URL:                b.templateURL(e.URL),
+			SuccessStatusCodes: []int{e.Status},
+		}
+		for name, values := range e.RequestHeaders {
+			if skippedHeaders[http.CanonicalHeaderKey(name)] || len(values) == 0 {
+				continue
+			}
+			if request.Headers == nil {
+				request.Headers = map[string]string{}
+			}
+			request.Headers[name] = b.templateHeader(name, strings.Join(values, ", "))
+		}
+		b.setBody(&request, e.RequestHeaders.Get("Content-Type"), e.RequestBody)
+		b.requests = append(b.requests, request)
+
+		b.collect(i, e)
+	}
+
+	return &importer.Result{
+		Definition: &spec.Spec{
+			Version:  spec.Version,
+			Name:     "recorded session",
+			Load:     spec.LoadProfile{TargetUsers: 1},
+			Requests: b.requests,
+		},
+	}
+}
+
+// Picks the values of the response that look like ids, tokens or sessions
+func (b *builder) collect(step int, e Exchange) {
+	for _, cookie := range (&http.Response{Header: e.ResponseHeaders}).Cookies() {
+		b.offer(step, cookie.Value, cookie.Name, tester.Extract{
+			Header: "Set-Cookie",
+			Regex:  regexp.QuoteMeta(cookie.Name) + `=([^;]+)`,
+		})
+	}
+
+	body := decodedBody(e)
+	if !strings.Contains(e.ResponseHeaders.Get("Content-Type"), "json") && !json.Valid(body) {
+		return
+	}
+	var doc interface{}
+	d := json.NewDecoder(bytes.NewReader(body))
+	d.UseNumber()
+	if d.Decode(&doc) != nil {
+		return
+	}
+	walkJSON(doc, "", func(path string, key string, value interface{}) {
+		switch v := value.(type) {
+		case string:
+			if len(v) >= minDynamicLength && !strings.ContainsAny(v, " \n") {
+				b.offer(step, v, key, tester.Extract{JSONPath: path})
+			}
+		case json.Number:
+			// Small numbers are counts and flags far more often than ids
+			if n, err := v.Int64(); err == nil && n >= 100 {
+				b.offer(step, v.String(), key, tester.Extract{JSONPath: path})
+			}
+		}
+	})
+}
+
+// Later responses win, a request uses the value it got most recently
+func (b *builder) offer(step int, value string, name string, e tester.Extract) {
+	if value == "" {
+		return
+	}
+	if c, ok := b.candidates[value]; ok && c.used {
+		return
+	}
+	b.candidates[value] = &candidate{value: value, step: step, name: name, extract: e}
+}
+
+// Variable the value is sent back as, extracting it from its step the
+// first time
+func (b *builder) use(value string) (string, bool) {
+	c, ok := b.candidates[value]
+	if !ok {
+		return "", false
+	}
+	if !c.used {
+		c.used = true
+		c.name = b.uniqueName(c.name)
+		c.extract.Name = c.name
+		b.requests[c.step].Extract = append(b.requests[c.step].Extract, c.extract)
+	}
+	return "{{" + c.name + "}}", true
+}
+
+func (b *builder) uniqueName(base string) string {
+	base = strings.Trim(nonIdentifier.ReplaceAllString(base, "_"), "_")
+	if base == "" || (base[0] >= '0' && base[0] <= '9') {
+		base = "value_" + base
+	}
+	name := base
+	for i := 2; b.names[name]; i++ {
+		name = base + "_" + strconv.Itoa(i)
+	}
+	b.names[name] = true
+	return name
+}
+
+func (b *builder) templateURL(raw string) string {
+	u, err := url.Parse(raw)
+	if err != nil {
+		return raw
+	}
+
+	segments := strings.Split(u.EscapedPath(), "/")
+	for i, segment := range segments {
+		unescaped, err := url.PathUnescape(segment)
+		if err != nil {
+			continue
+		}
+		if v, ok := b.use(unescaped); ok {
+			segments[i] = v
+		}
+	}
+
+	pairs := []string{}
+	if u.RawQuery != "" {
+		pairs = strings.Split(u.RawQuery, "&")
+	}
+	for i, pair := range pairs {
+		key, value, found := strings.Cut(pair, "=")
+		unescaped, err := url.QueryUnescape(value)
+		if !found || err != nil {
+			continue
+		}
+		if v, ok := b.use(unescaped); ok {
+			pairs[i] = key + "=" + v
+		}
+	}
+
+	// Built by hand so the braces of the variables aren't escaped
+	templated := u.Scheme + "://" + u.Host + strings.Join(segments, "/")
+	if len(pairs) > 0 {
+		templated += "?" + strings.Join(pairs, "&")
+	}
+	return templated
+}
+
+func (b *builder) templateHeader(name string, value string) string {
+	if http.CanonicalHeaderKey(name) == "Cookie" {
+		pairs := strings.Split(value, ";")
+		for i, pair := range pairs {
+			key, v, found := strings.Cut(strings.TrimSpace(pair), "=")
+			if !found {
+				continue
+			}
+			if templated, ok := b.use(v); ok {
+				pairs[i] = key + "=" + templated
+			}
+		}
+		return strings.Join(pairs, "; ")
+	}
+
+	if templated, ok := b.use(value); ok {
+		return templated
+	}
+	// Tokens are usually sent with a scheme like Bearer in front
+	if scheme, token, found := strings.Cut(value, " "); found {
+		if templated, ok := b.use(token); ok {
+			return scheme + " " + templated
+		}
+	}
+	return value
+}
+
+// JSON bodies stay structured unless a variable goes into them, variables
+// can stand for numbers too so those bodies are kept as text
+func (b *builder) setBody(r *spec.Request, contentType string, body []byte) {
+	if len(body) == 0 {
+		return
+	}
+
+	if strings.Contains(contentType, "x-www-form-urlencoded") {
+		pairs := strings.Split(string(body), "&")
+		for i, pair := range pairs {
+			key, value, found := strings.Cut(pair, "=")
+			unescaped, err := url.QueryUnescape(value)
+			if !found || err != nil {
+				continue
+			}
+			if v, ok := b.use(unescaped); ok {
+				pairs[i] = key + "=" + v
+			}
+		}
+		r.RawBody = strings.Join(pairs, "&")
+		return
+	}
+
+	var doc interface{}
+	d := json.NewDecoder(bytes.NewReader(body))
+	d.UseNumber()
+	if d.Decode(&doc) != nil {
+		r.RawBody = string(body)
+		return
+	}
+
+	text := string(body)
+	templated := false
+	walkJSON(doc, "", func(_ string, _ string, value interface{}) {
+		var (
+			raw string
+			re  *regexp.Regexp
+		)
+		switch v := value.(type) {
+		case string:
+			raw = v
+			re = regexp.MustCompile(`"` + regexp.QuoteMeta(v) + `"`)
+		case json.Number:
+			raw = v.String()
+			re = regexp.MustCompile(`([:\[,]\s*)` + regexp.QuoteMeta(raw) + `(\s*[,}\]])`)
+		default:
+			return
+		}
+		variable, ok := b.use(raw)
+		if !ok {
+			return
+		}
+		templated = true
+		if _, isString := value.(string); isString {
+			text = re.ReplaceAllLiteralString(text, `"`+variable+`"`)
+		} else {
+			text = re.ReplaceAllString(text, "${1}"+variable+"${2}")
+		}
+	})
+
+	if templated {
+		r.RawBody = text
+		return
+	}
+	var plain interface{}
+	json.Unmarshal(body, &plain)
+	r.Body = plain
+}
+
+// Calls fn for every leaf with its dotted path and the key it's under
+func walkJSON(doc interface{}, path string, fn func(path string, key string, value interface{})) {
+	switch v := doc.(type) {
+	case map[string]interface{}:
+		keys := make([]string, 0, len(v))
+		for k := range v {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		for _, k := range keys {
+			child := k
+			if path != "" {
+				child = path + "." + k
+			}
+			if _, leaf := v[k].(map[string]interface{}); !leaf {
+				if _, list := v[k].([]interface{}); !list {
+					fn(child, k, v[k])
+					continue
+				}
+			}
+			walkJSON(v[k], child, fn)
+		}
+	case []interface{}:
+		for i, item := range v {
+			child := strconv.Itoa(i)
+			if path != "" {
+				child = path + "." + child
+			}
+			key := path[strings.LastIndex(path, ".")+1:]
+			switch item.(type) {
+			case map[string]interface{}, []interface{}:
+				walkJSON(item, child, fn)
+			default:
+				fn(child, key, item)
+			}
+		}
+	}
+}
+
+func decodedBody(e Exchange) []byte {
+	if e.ResponseHeaders.Get("Content-Encoding") != "gzip" {
+		return e.ResponseBody
+	}
+	gz, err := gzip.NewReader(bytes.NewReader(e.ResponseBody))
+	if err != nil {
+		return nil
+	}
+	defer gz.Close()
+	body, _ := io.ReadAll(gz)
+	return body
+}
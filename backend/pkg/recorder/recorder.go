@@ -0,0 +1,259 @@
+package recorder
+
+import (
+	"bytes"
+	"io"
+	"net"
+	"net/http"
+	"regexp"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// Bodies past this size are forwarded but only recorded up to it
+const maxRecordedBody = 1024 * 1024
+
+// Headers of one connection that aren't forwarded by a proxy
+var hopHeaders = []string{
+	"Connection", "Proxy-Connection", "Keep-Alive", "Proxy-Authenticate",
+	"Proxy-Authorization", "Te", "Trailer", "Transfer-Encoding", "Upgrade",
+}
+
+// Exchange: a request made through the proxy and its response
+type Exchange struct {
+	Method          string      `json:"method"`
+	URL             string      `json:"url"`
+	RequestHeaders  http.Header `json:"request_headers"`
+	RequestBody     []byte      `json:"request_body,omitempty"`
+	Status          int         `json:"status"`
+	ResponseHeaders http.Header `json:"response_headers"`
+	ResponseBody    []byte      `json:"response_body,omitempty"`
+}
+
+// Recorder: a forward proxy that records the plain HTTP requests made
+// through it, HTTPS is tunnelled as is and can't be recorded
+type Recorder struct {
+	// Only urls matching are recorded when set
+	Include *regexp.Regexp
+	// Hosts HTTPS is tunnelled to, with or without the port. CONNECT to any
+	// other host is refused so the proxy can't be used to reach anything
+	TunnelHosts []string
+	// Sends the requests on, defaults to http.DefaultTransport
+	Transport http.RoundTripper
+
+	lastActive atomic.Int64
+
+	mu        sync.Mutex
+	exchanges []Exchange
+	tunnelled map[string]bool
+	conns     map[net.Conn]bool
+}
+
+func New() *Recorder {
+	r := &Recorder{
+		tunnelled: map[string]bool{},
+		conns:     map[net.Conn]bool{},
+	}
+	r.touch()
+	return r
+}
+
+// When the last request came through the proxy, or when it was created
+func (r *Recorder) LastActive() time.Time {
+	return time.Unix(0, r.lastActive.Load())
+}
+
+func (r *Recorder) touch() {
+	r.lastActive.Store(time.Now().UnixNano())
+}
+
+// Close: closes the tunnels still open, shutting down the server doesn't
+// as they are hijacked
+func (r *Recorder) Close() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for conn := range r.conns {
+		conn.Close()
+	}
+	r.conns = map[net.Conn]bool{}
+	return nil
+}
+
+// Exchanges recorded so far in the order they finished
+func (r *Recorder) Exchanges() []Exchange {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return append([]Exchange(nil), r.exchanges...)
+}
+
+// Hosts that were tunnelled without being recorded
+func (r *Recorder) Tunnelled() []string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	hosts := []string{}
+	for host := range r.tunnelled {
+		hosts = append(hosts, host)
+	}
+	return hosts
+}
+
+func (r *Recorder) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	r.touch()
+	if req.Method == http.MethodConnect {
+		r.tunnel(w, req)
+		return
+	}
+	if !req.URL.IsAbs() {
+		http.Error(w, "the recorder only serves proxy requests", http.StatusBadRequest)
+		return
+	}
+
+	// Only what's recorded is read upfront, the rest is streamed on
+	requestBody, err := io.ReadAll(io.LimitReader(req.Body, maxRecordedBody))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	out := req.Clone(req.Context())
+	out.RequestURI = ""
+	out.Body = struct {
+		io.Reader
+		io.Closer
+	}{io.MultiReader(bytes.NewReader(requestBody), req.Body), req.Body}
+	removeHopHeaders(out.Header)
+
+	transport := r.Transport
+	if transport == nil {
+		transport = http.DefaultTransport
+	}
+	res, err := transport.RoundTrip(out)
+	if err != nil {
+		logrus.Error("error in forwarding request ", err)
+		http.Error(w, err.Error(), http.StatusBadGateway)
+		return
+	}
+	defer res.Body.Close()
+
+	removeHopHeaders(res.Header)
+	for k, v := range res.Header {
+		w.Header()[k] = v
+	}
+	w.WriteHeader(res.StatusCode)
+
+	recorded := &limitedBuffer{limit: maxRecordedBody}
+	_, err = io.Copy(w, io.TeeReader(res.Body, recorded))
+	if err != nil {
+		logrus.Error("error in copying response ", err)
+	}
+
+	if r.Include != nil && !r.Include.MatchString(req.URL.String()) {
+		return
+	}
+
+	headers := req.Header.Clone()
+	removeHopHeaders(headers)
+	r.mu.Lock()
+	r.exchanges = append(r.exchanges, Exchange{
+		Method:          req.Method,
+		URL:             req.URL.String(),
+		RequestHeaders:  headers,
+		RequestBody:     requestBody,
+		Status:          res.StatusCode,
+		ResponseHeaders: res.Header.Clone(),
+		ResponseBody:    recorded.Bytes(),
+	})
+	r.mu.Unlock()
+}
+
+func (r *Recorder) tunnel(w http.ResponseWriter, req *http.Request) {
+	if !r.tunnelAllowed(req.Host) {
+		logrus.Warn("refused to tunnel to ", req.Host)
+		http.Error(w, "tunnelling to "+req.Host+" is not allowed", http.StatusForbidden)
+		return
+	}
+
+	r.mu.Lock()
+	r.tunnelled[req.Host] = true
+	r.mu.Unlock()
+
+	upstream, err := net.DialTimeout("tcp", req.Host, 10*time.Second)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadGateway)
+		return
+	}
+
+	hijacker, ok := w.(http.Hijacker)
+	if !ok {
+		upstream.Close()
+		http.Error(w, "tunnelling is not supported", http.StatusInternalServerError)
+		return
+	}
+	client, _, err := hijacker.Hijack()
+	if err != nil {
+		upstream.Close()
+		return
+	}
+	client.Write([]byte("HTTP/1.1 200 Connection Established\r\n\r\n"))
+
+	r.mu.Lock()
+	r.conns[client] = true
+	r.conns[upstream] = true
+	r.mu.Unlock()
+	closeBoth := func() {
+		upstream.Close()
+		client.Close()
+		r.mu.Lock()
+		delete(r.conns, client)
+		delete(r.conns, upstream)
+		r.mu.Unlock()
+	}
+
+	go func() {
+		defer closeBoth()
+		io.Copy(upstream, client)
+	}()
+	go func() {
+		defer closeBoth()
+		io.Copy(client, upstream)
+	}()
+}
+
+func (r *Recorder) tunnelAllowed(hostport string) bool {
+	host, _, err := net.SplitHostPort(hostport)
+	if err != nil {
+		host = hostport
+	}
+	for _, allowed := range r.TunnelHosts {
+		if strings.EqualFold(allowed, hostport) || strings.EqualFold(allowed, host) {
+			return true
+		}
+	}
+	return false
+}
+
+func removeHopHeaders(h http.Header) {
+	for _, name := range hopHeaders {
+		h.Del(name)
+	}
+}
+
+type limitedBuffer struct {
+	bytes.Buffer
+	limit int
+}
+
+func (b *limitedBuffer) Write(p []byte) (int, error) {
+	if room := b.limit - b.Len(); room > 0 {
+		if len(p) > room {
+			b.Buffer.Write(p[:room])
+		} else {
+			b.Buffer.Write(p)
+		}
+	}
+	return len(p), nil
+}
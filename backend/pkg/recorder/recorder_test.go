@@ -0,0 +1,198 @@
+package recorder
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"regexp"
+	"strings"
+	"testing"
+
+	"github.com/VarthanV/load-tester/pkg/spec"
+)
+
+func TestRecordedSessionBecomesDefinition(t *testing.T) {
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/login":
+			http.SetCookie(w, &http.Cookie{Name: "session", Value: "c00kie42x"})
+			w.Header().Set("Content-Type", "application/json")
+			w.Write([]byte(`{"token": "tok_9f8e7d6c", "user": {"id": 4521, "name": "qa"}}`))
+		case "/users/4521":
+			w.Write([]byte(`{}`))
+		case "/orders":
+			body, _ := io.ReadAll(r.Body)
+			w.WriteHeader(http.StatusCreated)
+			w.Write(body)
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer backend.Close()
+
+	rec := New()
+	proxy := httptest.NewServer(rec)
+	defer proxy.Close()
+
+	proxyURL, _ := url.Parse(proxy.URL)
+	client := &http.Client{Transport: &http.Transport{Proxy: http.ProxyURL(proxyURL)}}
+
+	do := func(method string, path string, contentType string, body string, headers map[string]string) {
+		req, _ := http.NewRequest(method, backend.URL+path, strings.NewReader(body))
+		if contentType != "" {
+			req.Header.Set("Content-Type", contentType)
+		}
+		for k, v := range headers {
+			req.Header.Set(k, v)
+		}
+		res, err := client.Do(req)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		io.Copy(io.Discard, res.Body)
+		res.Body.Close()
+	}
+
+	do("POST", "/login", "application/x-www-form-urlencoded", "user=qa", nil)
+	do("GET", "/users/4521", "", "", map[string]string{
+		"Authorization": "Bearer tok_9f8e7d6c",
+		"Cookie":        "session=c00kie42x",
+	})
+	do("POST", "/orders", "application/json", `{"user_id": 4521, "item": "book"}`, nil)
+
+	result := rec.Definition()
+	requests := result.Definition.Requests
+	if len(requests) != 3 {
+		t.Fatalf("expected 3 requests, got %+v", requests)
+	}
+
+	names := map[string]bool{}
+	for _, e := range requests[0].Extract {
+		names[e.Name] = true
+	}
+	if !names["session"] || !names["token"] || !names["id"] || len(names) != 3 {
+		t.Errorf("expected session, token and id to be extracted, got %+v", requests[0].Extract)
+	}
+
+	if requests[1].URL != backend.URL+"/users/{{id}}" {
+		t.Errorf("expected id in the url, got %s", requests[1].URL)
+	}
+	if requests[1].Headers["Authorization"] != "Bearer {{token}}" || requests[1].Headers["Cookie"] != "session={{session}}" {
+		t.Errorf("expected token and session in the headers, got %+v", requests[1].Headers)
+	}
+	if requests[2].RawBody != `{"user_id": {{id}}, "item": "book"}` || requests[2].SuccessStatusCodes[0] != http.StatusCreated {
+		t.Errorf("unexpected order request %+v", requests[2])
+	}
+
+	if err := result.Definition.Validate(); err != nil {
+		t.Errorf("expected recorded definition to be valid, got %v", err)
+	}
+	data, err := spec.Marshal(result.Definition, spec.FormatYAML)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if _, err := spec.Parse(data, spec.FormatYAML); err != nil {
+		t.Errorf("expected exported definition to parse, got %v\n%s", err, data)
+	}
+}
+
+func TestIncludeFilter(t *testing.T) {
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer backend.Close()
+
+	rec := New()
+	rec.Include = regexp.MustCompile(`/api/`)
+	proxy := httptest.NewServer(rec)
+	defer proxy.Close()
+
+	proxyURL, _ := url.Parse(proxy.URL)
+	client := &http.Client{Transport: &http.Transport{Proxy: http.ProxyURL(proxyURL)}}
+	for _, path := range []string{"/app.js", "/api/items"} {
+		res, err := client.Get(backend.URL + path)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		res.Body.Close()
+	}
+
+	exchanges := rec.Exchanges()
+	if len(exchanges) != 1 || !strings.HasSuffix(exchanges[0].URL, "/api/items") {
+		t.Errorf("expected only the api request to be recorded, got %+v", exchanges)
+	}
+}
+
+func TestLargeBodiesAreRecordedUpToTheLimit(t *testing.T) {
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.Copy(w, r.Body)
+	}))
+	defer backend.Close()
+
+	rec := New()
+	proxy := httptest.NewServer(rec)
+	defer proxy.Close()
+
+	proxyURL, _ := url.Parse(proxy.URL)
+	client := &http.Client{Transport: &http.Transport{Proxy: http.ProxyURL(proxyURL)}}
+	body := strings.Repeat("x", maxRecordedBody+10)
+	res, err := client.Post(backend.URL+"/upload", "text/plain", strings.NewReader(body))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	echoed, _ := io.ReadAll(res.Body)
+	res.Body.Close()
+	if len(echoed) != len(body) {
+		t.Errorf("expected the whole body to be forwarded, got %d bytes", len(echoed))
+	}
+
+	exchanges := rec.Exchanges()
+	if len(exchanges) != 1 || len(exchanges[0].RequestBody) != maxRecordedBody ||
+		len(exchanges[0].ResponseBody) != maxRecordedBody {
+		t.Errorf("expected both bodies to be recorded up to the limit, got %d exchanges", len(exchanges))
+	}
+}
+
+func TestTunnelsOnlyToListedHosts(t *testing.T) {
+	listed := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer listed.Close()
+	other := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer other.Close()
+
+	rec := New()
+	rec.TunnelHosts = []string{listed.Listener.Addr().String()}
+	proxy := httptest.NewServer(rec)
+	defer proxy.Close()
+
+	proxyURL, _ := url.Parse(proxy.URL)
+	transport := listed.Client().Transport.(*http.Transport).Clone()
+	transport.Proxy = http.ProxyURL(proxyURL)
+	client := &http.Client{Transport: transport}
+
+	created := rec.LastActive()
+	res, err := client.Get(listed.URL)
+	if err != nil {
+		t.Fatalf("expected the listed host to be tunnelled to, got %v", err)
+	}
+	res.Body.Close()
+	if !rec.LastActive().After(created) {
+		t.Errorf("expected the tunnel to count as activity")
+	}
+
+	_, err = client.Get(other.URL)
+	if err == nil {
+		t.Errorf("expected tunnelling to a host that isn't listed to be refused")
+	}
+
+	rec.mu.Lock()
+	open := len(rec.conns)
+	rec.mu.Unlock()
+	if open != 2 {
+		t.Fatalf("expected the kept alive tunnel to be open, got %d connections", open)
+	}
+	rec.Close()
+	rec.mu.Lock()
+	defer rec.mu.Unlock()
+	if len(rec.conns) != 0 {
+		t.Errorf("expected close to drop the tunnels")
+	}
+}
@@ -0,0 +1,159 @@
+package replay
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/VarthanV/load-tester/pkg/tester"
+)
+
+const (
+	// NGINX combined log format, which is also the Apache combined format
+	FormatNGINX = "nginx"
+	// JSON lines with timestamp, method and path
+	FormatJSONLines = "jsonl"
+)
+
+// Lines longer than this are skipped instead of failing the whole log
+const maxLineSize = 1024 * 1024
+
+// $remote_addr - $remote_user [$time_local] "$request" $status ...
+var combined = regexp.MustCompile(`^\S+ \S+ \S+ \[([^\]]+)\] "([^"]*)"`)
+
+const combinedTime = "02/Jan/2006:15:04:05 -0700"
+
+// Log: the requests found in an access log ordered by time
+type Log struct {
+	Entries []tester.ReplayEntry
+	// Lines that couldn't be read as a request
+	Skipped int
+}
+
+// DetectFormat: JSON lines for .json and .jsonl files, NGINX for the rest
+func DetectFormat(name string) string {
+	switch strings.ToLower(filepath.Ext(name)) {
+	case ".json", ".jsonl", ".ndjson":
+		return FormatJSONLines
+	}
+	return FormatNGINX
+}
+
+// Parse: reads the requests of an access log, offsets of the entries are
+// relative to the earliest request
+func Parse(r io.Reader, format string) (*Log, error) {
+	var parseLine func(line string) (time.Time, string, string, bool)
+	switch format {
+	case FormatNGINX:
+		parseLine = parseCombined
+	case FormatJSONLines:
+		parseLine = parseJSONLine
+	default:
+		return nil, fmt.Errorf("unknown log format %q, expected nginx or jsonl", format)
+	}
+
+	type entry struct {
+		at     time.Time
+		method string
+		path   string
+	}
+
+	var (
+		l       = &Log{}
+		entries = []entry{}
+	)
+
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), maxLineSize)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" {
+			continue
+		}
+		at, method, path, ok := parseLine(line)
+		if !ok {
+			l.Skipped++
+			continue
+		}
+		entries = append(entries, entry{at: at, method: method, path: path})
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	if len(entries) == 0 {
+		return nil, fmt.Errorf("no requests found in the log, %d lines skipped", l.Skipped)
+	}
+
+	// Logs are written when requests finish, so they are only roughly in
+	// the order the requests came in
+	sort.SliceStable(entries, func(i, j int) bool {
+		return entries[i].at.Before(entries[j].at)
+	})
+
+	first := entries[0].at
+	for _, e := range entries {
+		l.Entries = append(l.Entries, tester.ReplayEntry{
+			Offset: e.at.Sub(first),
+			Method: e.method,
+			Path:   e.path,
+		})
+	}
+	return l, nil
+}
+
+func parseCombined(line string) (time.Time, string, string, bool) {
+	m := combined.FindStringSubmatch(line)
+	if m == nil {
+		return time.Time{}, "", "", false
+	}
+
+	at, err := time.Parse(combinedTime, m[1])
+	if err != nil {
+		return time.Time{}, "", "", false
+	}
+
+	// Malformed requests are logged as "-" or without a path
+	parts := strings.Fields(m[2])
+	if len(parts) < 2 || !strings.HasPrefix(parts[1], "/") {
+		return time.Time{}, "", "", false
+	}
+	return at, parts[0], parts[1], true
+}
+
+type jsonLine struct {
+	// RFC 3339 or seconds since the epoch
+	Timestamp interface{} `json:"timestamp"`
+	Method    string      `json:"method"`
+	Path      string      `json:"path"`
+}
+
+func parseJSONLine(line string) (time.Time, string, string, bool) {
+	l := jsonLine{}
+	if json.Unmarshal([]byte(line), &l) != nil || !strings.HasPrefix(l.Path, "/") {
+		return time.Time{}, "", "", false
+	}
+	if l.Method == "" {
+		l.Method = http.MethodGet
+	}
+
+	switch ts := l.Timestamp.(type) {
+	case string:
+		at, err := time.Parse(time.RFC3339Nano, ts)
+		if err != nil {
+			return time.Time{}, "", "", false
+		}
+		return at, l.Method, l.Path, true
+	case float64:
+		seconds, fraction := math.Modf(ts)
+		return time.Unix(int64(seconds), int64(fraction*float64(time.Second))), l.Method, l.Path, true
+	}
+	return time.Time{}, "", "", false
+}
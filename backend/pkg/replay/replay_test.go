@@ -0,0 +1,54 @@
+package replay
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/VarthanV/load-tester/pkg/tester"
+)
+
+func TestParseNGINX(t *testing.T) {
+	log := `10.0.0.1 - - [10/Oct/2024:13:55:37 +0000] "GET /api/items?page=2 HTTP/1.1" 200 612 "-" "curl/8.0"
+10.0.0.2 - bob [10/Oct/2024:13:55:36 +0000] "POST /login HTTP/1.1" 302 0 "-" "Mozilla/5.0"
+10.0.0.3 - - [10/Oct/2024:13:55:39 +0000] "-" 400 0 "-" "-"
+not a log line
+`
+	l, err := Parse(strings.NewReader(log), FormatNGINX)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	want := []tester.ReplayEntry{
+		{Offset: 0, Method: "POST", Path: "/login"},
+		{Offset: time.Second, Method: "GET", Path: "/api/items?page=2"},
+	}
+	if len(l.Entries) != len(want) {
+		t.Fatalf("expected %d entries, got %+v", len(want), l.Entries)
+	}
+	for i := range want {
+		if l.Entries[i] != want[i] {
+			t.Errorf("entry %d: expected %+v, got %+v", i, want[i], l.Entries[i])
+		}
+	}
+	if l.Skipped != 2 {
+		t.Errorf("expected 2 skipped lines, got %d", l.Skipped)
+	}
+}
+
+func TestParseJSONLines(t *testing.T) {
+	log := `{"timestamp": "2024-10-10T13:55:36.5Z", "method": "PUT", "path": "/items/1"}
+{"timestamp": 1728568536, "path": "/health"}
+`
+	l, err := Parse(strings.NewReader(log), FormatJSONLines)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if len(l.Entries) != 2 || l.Entries[0].Path != "/health" || l.Entries[0].Method != "GET" {
+		t.Fatalf("unexpected entries %+v", l.Entries)
+	}
+	if l.Entries[1].Offset != 500*time.Millisecond {
+		t.Errorf("expected offset of 500ms, got %s", l.Entries[1].Offset)
+	}
+}
@@ -0,0 +1,160 @@
+// Package samplestore keeps the sample logs of tests in a directory, a file
+// per test, and prunes them by age and total size
+package samplestore
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/sirupsen/logrus"
+)
+
+// Store: sample logs named <test id>.<format>.gz in Dir
+type Store struct {
+	Dir string
+	// Logs older than this are removed, 0 keeps them
+	MaxAge time.Duration
+	// Size of all the logs together, the oldest are removed when it's
+	// exceeded. A single log stops growing at the limit too, 0 is unlimited
+	MaxBytes int64
+
+	mu sync.Mutex
+	// Names of the logs still being written, which aren't pruned
+	writing map[string]bool
+}
+
+// Create: file the samples of the test are written to in format, the store
+// is pruned first to make room
+func (s *Store) Create(id uuid.UUID, format string) (*File, error) {
+	err := os.MkdirAll(s.Dir, 0755)
+	if err != nil {
+		return nil, err
+	}
+	err = s.Prune()
+	if err != nil {
+		logrus.Error("unable to prune samples ", err)
+	}
+
+	name := id.String() + "." + format + ".gz"
+	f, err := os.Create(filepath.Join(s.Dir, name))
+	if err != nil {
+		return nil, err
+	}
+	s.mu.Lock()
+	if s.writing == nil {
+		s.writing = map[string]bool{}
+	}
+	s.writing[name] = true
+	s.mu.Unlock()
+	return &File{f: f, limit: s.MaxBytes, store: s, name: name}, nil
+}
+
+func (s *Store) done(name string) {
+	s.mu.Lock()
+	delete(s.writing, name)
+	s.mu.Unlock()
+}
+
+// Open: the sample log of the test and its format, os.ErrNotExist when the
+// test has none
+func (s *Store) Open(id uuid.UUID) (*os.File, string, error) {
+	matches, err := filepath.Glob(filepath.Join(s.Dir, id.String()+".*.gz"))
+	if err != nil {
+		return nil, "", err
+	}
+	if len(matches) == 0 {
+		return nil, "", os.ErrNotExist
+	}
+
+	name := filepath.Base(matches[0])
+	format := strings.TrimSuffix(strings.TrimPrefix(name, id.String()+"."), ".gz")
+	f, err := os.Open(matches[0])
+	return f, format, err
+}
+
+// Prune: removes the logs past the max age, then the oldest ones until the
+// rest fit in the max size. Logs still being written count towards the size
+// but are left alone
+func (s *Store) Prune() error {
+	entries, err := os.ReadDir(s.Dir)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return nil
+		}
+		return err
+	}
+
+	logs := []os.FileInfo{}
+	for _, e := range entries {
+		if e.IsDir() || !strings.HasSuffix(e.Name(), ".gz") {
+			continue
+		}
+		info, err := e.Info()
+		if err != nil {
+			continue
+		}
+		logs = append(logs, info)
+	}
+	sort.Slice(logs, func(i, j int) bool { return logs[i].ModTime().Before(logs[j].ModTime()) })
+
+	total := int64(0)
+	for _, l := range logs {
+		total += l.Size()
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, l := range logs {
+		if s.writing[l.Name()] {
+			continue
+		}
+		expired := s.MaxAge > 0 && time.Since(l.ModTime()) > s.MaxAge
+		over := s.MaxBytes > 0 && total > s.MaxBytes
+		if !expired && !over {
+			continue
+		}
+		err := os.Remove(filepath.Join(s.Dir, l.Name()))
+		if err != nil {
+			return err
+		}
+		total -= l.Size()
+	}
+	return nil
+}
+
+// File: a sample log being written, full once the size limit is reached so
+// the logger can stop and still end the file properly
+type File struct {
+	f       *os.File
+	limit   int64
+	written int64
+	store   *Store
+	name    string
+}
+
+func (f *File) Write(p []byte) (int, error) {
+	n, err := f.f.Write(p)
+	f.written += int64(n)
+	return n, err
+}
+
+func (f *File) Full() bool {
+	return f.limit > 0 && f.written >= f.limit
+}
+
+func (f *File) Close() error {
+	defer f.store.done(f.name)
+	return f.f.Close()
+}
+
+// Discard: closes and removes a log that won't be written, e.g when the test
+// couldn't be started
+func (f *File) Discard() error {
+	f.Close()
+	return os.Remove(f.f.Name())
+}
@@ -0,0 +1,140 @@
+package samplestore
+
+import (
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+func TestCreateAndOpen(t *testing.T) {
+	s := &Store{Dir: filepath.Join(t.TempDir(), "samples")}
+	id := uuid.New()
+
+	f, err := s.Create(id, "csv")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	f.Write([]byte("compressed"))
+	f.Close()
+
+	r, format, err := s.Open(id)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	defer r.Close()
+	data, _ := io.ReadAll(r)
+	if format != "csv" || string(data) != "compressed" {
+		t.Errorf("expected the csv log, got %s %q", format, data)
+	}
+
+	_, _, err = s.Open(uuid.New())
+	if !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("expected not exist for a test without samples, got %v", err)
+	}
+}
+
+func TestPrune(t *testing.T) {
+	dir := t.TempDir()
+	s := &Store{Dir: dir, MaxAge: time.Hour, MaxBytes: 10}
+
+	write := func(name string, size int, age time.Duration) {
+		path := filepath.Join(dir, name)
+		os.WriteFile(path, make([]byte, size), 0644)
+		modified := time.Now().Add(-age)
+		os.Chtimes(path, modified, modified)
+	}
+	write("expired.ndjson.gz", 1, 2*time.Hour)
+	write("oldest.ndjson.gz", 4, 30*time.Minute)
+	write("older.csv.gz", 4, 20*time.Minute)
+	write("newest.ndjson.gz", 4, 10*time.Minute)
+	write("notes.txt", 100, 3*time.Hour)
+
+	err := s.Prune()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	left := []string{}
+	entries, _ := os.ReadDir(dir)
+	for _, e := range entries {
+		left = append(left, e.Name())
+	}
+	// The expired one goes regardless of size, the oldest one to fit in 10 bytes
+	expected := []string{"newest.ndjson.gz", "notes.txt", "older.csv.gz"}
+	if len(left) != len(expected) {
+		t.Fatalf("expected %v to be left, got %v", expected, left)
+	}
+	for i := range expected {
+		if left[i] != expected[i] {
+			t.Errorf("expected %v to be left, got %v", expected, left)
+		}
+	}
+}
+
+func TestPruneSkipsLogsBeingWritten(t *testing.T) {
+	dir := t.TempDir()
+	s := &Store{Dir: dir, MaxBytes: 4}
+	id := uuid.New()
+
+	f, err := s.Create(id, "ndjson")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	f.Write([]byte("12345678"))
+	err = s.Prune()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	_, _, err = s.Open(id)
+	if err != nil {
+		t.Fatalf("expected the log being written to be kept, got %v", err)
+	}
+
+	// Once it's done it's fair game
+	f.Close()
+	s.Prune()
+	_, _, err = s.Open(id)
+	if !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("expected the finished log to be pruned, got %v", err)
+	}
+}
+
+func TestDiscard(t *testing.T) {
+	s := &Store{Dir: t.TempDir()}
+	id := uuid.New()
+	f, err := s.Create(id, "csv")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	err = f.Discard()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	_, _, err = s.Open(id)
+	if !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("expected the discarded log to be removed, got %v", err)
+	}
+}
+
+func TestFileFull(t *testing.T) {
+	s := &Store{Dir: t.TempDir(), MaxBytes: 8}
+	f, err := s.Create(uuid.New(), "ndjson")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	defer f.Close()
+
+	f.Write([]byte("1234"))
+	if f.Full() {
+		t.Error("expected room for more")
+	}
+	f.Write([]byte("5678"))
+	if !f.Full() {
+		t.Error("expected the file to be full at the limit")
+	}
+}
@@ -0,0 +1,513 @@
+package spec
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/VarthanV/load-tester/pkg/replay"
+	"github.com/VarthanV/load-tester/pkg/tester"
+	"gopkg.in/yaml.v3"
+)
+
+// Version of the definition schema written by this build
+const Version = 1
+
+const (
+	FormatYAML = "yaml"
+	FormatJSON = "json"
+)
+
+// Spec: a test as written down in a YAML or JSON file
+type Spec struct {
+	// Version of the schema, required so older files keep working when the
+	// schema changes
+	Version  int         `json:"version"`
+	Name     string      `json:"name,omitempty"`
+	Target   Target      `json:"target"`
+	Load     LoadProfile `json:"load"`
+	Requests []Request   `json:"requests"`
+
+	Auth         *tester.AuthConfig         `json:"auth,omitempty"`
+	Transport    *tester.TransportConfig    `json:"transport,omitempty"`
+	Redirect     *tester.RedirectConfig     `json:"redirect,omitempty"`
+	Retry        *tester.RetryConfig        `json:"retry,omitempty"`
+	ResponseBody *tester.ResponseBodyConfig `json:"response_body,omitempty"`
+	Thresholds   []tester.Threshold         `json:"thresholds,omitempty"`
+	// Logs the requests to a gzipped file stored with the test, run takes
+	// the file with -samples
+	Samples *tester.SampleConfig `json:"samples,omitempty"`
+	// Keeps sampled failing exchanges in the report
+	Failures *tester.FailureCaptureConfig `json:"failures,omitempty"`
+
+	// Calls a gRPC method instead of making the requests
+	GRPC *tester.GRPCConfig `json:"grpc,omitempty"`
+	// Runs a WebSocket session per user instead of making the requests
+	WebSocket *tester.WebSocketConfig `json:"websocket,omitempty"`
+	// Writes a raw TCP or UDP payload instead of making the requests
+	Socket *tester.SocketConfig `json:"socket,omitempty"`
+	// Sends DNS queries to a resolver instead of making the requests
+	DNS *tester.DNSQueryConfig `json:"dns,omitempty"`
+	// Sends redis or memcached commands instead of making the requests
+	Cache *tester.CacheConfig `json:"cache,omitempty"`
+	// Runs a protocol registered with tester.Register instead of the requests
+	Protocol *tester.ProtocolConfig `json:"protocol,omitempty"`
+	// Replays an access log instead of making the requests
+	Replay *Replay `json:"replay,omitempty"`
+}
+
+// Target: what the requests are sent to
+type Target struct {
+	// Paths of the requests are resolved against the base url
+	BaseURL string `json:"base_url,omitempty"`
+	// Sent with every request, headers of a request take precedence
+	Headers map[string]string `json:"headers,omitempty"`
+}
+
+// LoadProfile: how many virtual users run the requests and how fast they ramp up
+type LoadProfile struct {
+	TargetUsers             int  `json:"target_users"`
+	UsersToStartWith        int  `json:"users_to_start_with,omitempty"`
+	ReachPeakAfterInMinutes int  `json:"reach_peak_after_in_minutes,omitempty"`
+	Distributed             bool `json:"distributed,omitempty"`
+}
+
+// Replay: an access log replayed against a base url keeping the recorded
+// timing, load.target_users caps the requests in flight
+type Replay struct {
+	BaseURL string `json:"base_url"`
+	// 2 replays twice as fast as recorded, defaults to 1
+	Speed float64 `json:"speed,omitempty"`
+	// Only paths matching the regular expression are replayed
+	PathFilter string `json:"path_filter,omitempty"`
+	// nginx or jsonl
+	Format string `json:"format"`
+	// The access log itself
+	Log string `json:"log"`
+}
+
+func (r *Replay) config() *tester.ReplayConfig {
+	return &tester.ReplayConfig{
+		BaseURL:    r.BaseURL,
+		Speed:      r.Speed,
+		PathFilter: r.PathFilter,
+	}
+}
+
+func (r *Replay) entries() ([]tester.ReplayEntry, error) {
+	l, err := replay.Parse(strings.NewReader(r.Log), r.Format)
+	if err != nil {
+		return nil, err
+	}
+	return l.Entries, nil
+}
+
+// Request: a step of the scenario, every virtual user makes the requests in
+// order on each iteration
+type Request struct {
+	Name   string `json:"name,omitempty"`
+	Method string `json:"method,omitempty"`
+	// Either an absolute url or a path on the target base url
+	URL     string            `json:"url,omitempty"`
+	Path    string            `json:"path,omitempty"`
+	Headers map[string]string `json:"headers,omitempty"`
+	// Sent as JSON, raw_body is sent as is for forms and other content types
+	Body    interface{} `json:"body,omitempty"`
+	RawBody string      `json:"raw_body,omitempty"`
+	// Defaults to 200
+	SuccessStatusCodes []int          `json:"success_status_codes,omitempty"`
+	Checks             []tester.Check `json:"checks,omitempty"`
+	// Values later requests use as {{name}} in their url, headers or body
+	Extract []tester.Extract `json:"extract,omitempty"`
+	// Sends a GraphQL operation as the body, responses with errors fail
+	GraphQL *tester.GraphQL `json:"graphql,omitempty"`
+	// Holds the response open and reads it as Server-Sent Events or lines
+	Stream *tester.StreamConfig `json:"stream,omitempty"`
+}
+
+// Load: reads and validates the spec at path, files ending in .json are read
+// as JSON and everything else as YAML. Files the spec points at, like
+// grpc.protoset_file, are read relative to it
+func Load(path string) (*Spec, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	format := FormatYAML
+	if strings.EqualFold(filepath.Ext(path), ".json") {
+		format = FormatJSON
+	}
+	return parse(data, format, filepath.Dir(path))
+}
+
+// Parse: decodes and validates a spec, problems with the spec are returned
+// as a *ValidationError. Specs that aren't loaded from disk can't point at
+// files
+func Parse(data []byte, format string) (*Spec, error) {
+	return parse(data, format, "")
+}
+
+func parse(data []byte, format string, dir string) (*Spec, error) {
+	var (
+		doc interface{}
+		err error
+	)
+	switch format {
+	case FormatJSON:
+		err = json.Unmarshal(data, &doc)
+	case FormatYAML:
+		err = yaml.Unmarshal(data, &doc)
+	default:
+		return nil, fmt.Errorf("unknown format %q, expected yaml or json", format)
+	}
+	if err != nil {
+		return nil, &ValidationError{Problems: []string{"invalid " + format + ": " + err.Error()}}
+	}
+
+	problems := unknownFields(doc)
+	if len(problems) > 0 {
+		return nil, &ValidationError{Problems: problems}
+	}
+
+	// The tester configs only carry json tags, YAML is brought into the same
+	// shape as JSON before decoding
+	asJSON, err := json.Marshal(doc)
+	if err != nil {
+		return nil, &ValidationError{Problems: []string{"invalid " + format + ": " + err.Error()}}
+	}
+
+	s := Spec{}
+	err = json.Unmarshal(asJSON, &s)
+	if err != nil {
+		return nil, &ValidationError{Problems: []string{typeProblem(err)}}
+	}
+
+	if dir != "" {
+		err = s.readFiles(dir)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	err = s.Validate()
+	if err != nil {
+		return nil, err
+	}
+	return &s, nil
+}
+
+// Reads the files the spec points at into the spec
+func (s *Spec) readFiles(dir string) error {
+	if s.GRPC != nil && s.GRPC.ProtosetFile != "" {
+		path := s.GRPC.ProtosetFile
+		if !filepath.IsAbs(path) {
+			path = filepath.Join(dir, path)
+		}
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return &ValidationError{Problems: []string{"grpc.protoset_file: " + err.Error()}}
+		}
+		s.GRPC.Protoset, s.GRPC.ProtosetFile = data, ""
+	}
+	return nil
+}
+
+// Marshal: writes the spec out in the given format
+func Marshal(s *Spec, format string) ([]byte, error) {
+	asJSON, err := json.MarshalIndent(s, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+
+	switch format {
+	case FormatJSON:
+		return append(asJSON, '\n'), nil
+	case FormatYAML:
+		// JSON is valid YAML, decoding it into a node keeps the order of the
+		// fields and only the flow style and quotes need to go
+		node := yaml.Node{}
+		err = yaml.Unmarshal(asJSON, &node)
+		if err != nil {
+			return nil, err
+		}
+		blockStyle(&node)
+
+		var out bytes.Buffer
+		enc := yaml.NewEncoder(&out)
+		enc.SetIndent(2)
+		err = enc.Encode(&node)
+		if err != nil {
+			return nil, err
+		}
+		return out.Bytes(), enc.Close()
+	}
+	return nil, fmt.Errorf("unknown format %q, expected yaml or json", format)
+}
+
+func blockStyle(n *yaml.Node) {
+	n.Style = 0
+	for _, c := range n.Content {
+		blockStyle(c)
+	}
+}
+
+// Redacted: a copy of the spec with its credentials, secret looking headers,
+// query parameters and body fields replaced, for showing the spec in
+// reports. Raw bodies, access logs and protosets are only summarized
+func (s *Spec) Redacted() *Spec {
+	r := *s
+	r.Target.BaseURL = tester.RedactURL(s.Target.BaseURL)
+	r.Target.Headers = redactHeaders(s.Target.Headers)
+
+	r.Requests = make([]Request, len(s.Requests))
+	for i, req := range s.Requests {
+		req.URL = tester.RedactURL(req.URL)
+		req.Path = tester.RedactURL(req.Path)
+		req.Headers = redactHeaders(req.Headers)
+		req.Body = redactValue(req.Body)
+		req.RawBody = summarize(req.RawBody, "body")
+		if req.GraphQL != nil {
+			graphQL := *req.GraphQL
+			graphQL.Variables, _ = redactValue(graphQL.Variables).(map[string]interface{})
+			req.GraphQL = &graphQL
+		}
+		r.Requests[i] = req
+	}
+
+	if s.Auth != nil {
+		r.Auth = redactAuth(s.Auth)
+	}
+	if s.Transport != nil {
+		transport := *s.Transport
+		transport.ProxyURL = tester.RedactURL(transport.ProxyURL)
+		r.Transport = &transport
+	}
+	if s.GRPC != nil {
+		grpc := *s.GRPC
+		grpc.Metadata = redactHeaders(grpc.Metadata)
+		grpc.Message = redactValue(grpc.Message)
+		if grpc.Messages != nil {
+			grpc.Messages, _ = redactValue(grpc.Messages).([]interface{})
+		}
+		if len(grpc.Protoset) > 0 {
+			grpc.Protoset, grpc.ProtosetFile = nil, summarize(string(grpc.Protoset), "protoset")
+		}
+		r.GRPC = &grpc
+	}
+	if s.WebSocket != nil {
+		ws := *s.WebSocket
+		ws.URL = tester.RedactURL(ws.URL)
+		ws.Headers = redactHeaders(ws.Headers)
+		ws.Messages = make([]tester.WebSocketMessage, len(s.WebSocket.Messages))
+		for i, m := range s.WebSocket.Messages {
+			m.Data = redactValue(m.Data)
+			m.Text = summarize(m.Text, "text")
+			ws.Messages[i] = m
+		}
+		r.WebSocket = &ws
+	}
+	if s.Cache != nil {
+		cache := *s.Cache
+		cache.Password = redact(cache.Password)
+		r.Cache = &cache
+	}
+	if s.Protocol != nil {
+		protocol := *s.Protocol
+		var config interface{}
+		if json.Unmarshal(protocol.Config, &config) == nil {
+			protocol.Config, _ = json.Marshal(redactValue(config))
+		} else {
+			protocol.Config = nil
+		}
+		r.Protocol = &protocol
+	}
+	if s.Replay != nil {
+		replay := *s.Replay
+		replay.Log = summarize(replay.Log, "access log")
+		r.Replay = &replay
+	}
+	return &r
+}
+
+// Values of fields that look secret are redacted, in nested objects too
+func redactValue(v interface{}) interface{} {
+	switch v := v.(type) {
+	case map[string]interface{}:
+		r := make(map[string]interface{}, len(v))
+		for k, field := range v {
+			if tester.SecretHeader(k) && field != nil {
+				r[k] = tester.Redacted
+				continue
+			}
+			r[k] = redactValue(field)
+		}
+		return r
+	case []interface{}:
+		r := make([]interface{}, len(v))
+		for i, item := range v {
+			r[i] = redactValue(item)
+		}
+		return r
+	}
+	return v
+}
+
+// Stands in for content that is only shown by its size
+func summarize(content string, what string) string {
+	if content == "" {
+		return ""
+	}
+	return fmt.Sprintf("[%s of %d bytes]", what, len(content))
+}
+
+func redactAuth(a *tester.AuthConfig) *tester.AuthConfig {
+	r := *a
+	r.Password = redact(a.Password)
+	r.Token = redact(a.Token)
+	if a.OAuth2 != nil {
+		oauth2 := *a.OAuth2
+		oauth2.ClientSecret = redact(oauth2.ClientSecret)
+		r.OAuth2 = &oauth2
+	}
+	if a.JWT != nil {
+		jwt := *a.JWT
+		jwt.SigningKey = redact(jwt.SigningKey)
+		r.JWT = &jwt
+	}
+	if a.HMAC != nil {
+		hmac := *a.HMAC
+		hmac.Secret = redact(hmac.Secret)
+		r.HMAC = &hmac
+	}
+	if a.SigV4 != nil {
+		sigv4 := *a.SigV4
+		sigv4.SecretAccessKey = redact(sigv4.SecretAccessKey)
+		sigv4.SessionToken = redact(sigv4.SessionToken)
+		r.SigV4 = &sigv4
+	}
+	return &r
+}
+
+func redactHeaders(headers map[string]string) map[string]string {
+	if headers == nil {
+		return nil
+	}
+	r := make(map[string]string, len(headers))
+	for k, v := range headers {
+		if tester.SecretHeader(k) {
+			v = redact(v)
+		}
+		r[k] = v
+	}
+	return r
+}
+
+// Secrets that aren't set stay empty
+func redact(secret string) string {
+	if secret == "" {
+		return ""
+	}
+	return tester.Redacted
+}
+
+// Options to configure the tester with for the spec
+func (s *Spec) Options() []tester.Option {
+	steps := make([]tester.Step, 0, len(s.Requests))
+	for _, r := range s.Requests {
+		steps = append(steps, s.step(r))
+	}
+
+	url := ""
+	if len(steps) > 0 {
+		url = steps[0].URL
+	}
+
+	opts := []tester.Option{
+		tester.WithPeakConfig(
+			s.Load.TargetUsers,
+			time.Duration(s.Load.ReachPeakAfterInMinutes)*time.Minute,
+			s.Load.UsersToStartWith),
+		tester.WithRequestConfig(url, nil),
+		tester.WithHeaders(s.Target.Headers),
+		tester.WithSteps(steps...),
+		tester.WithAuth(s.Auth),
+		tester.WithTransportConfig(s.Transport),
+		tester.WithRedirectConfig(s.Redirect),
+		tester.WithRetryConfig(s.Retry),
+		tester.WithResponseBodyConfig(s.ResponseBody),
+		tester.WithFailureCapture(s.Failures),
+		tester.WithThresholds(s.Thresholds...),
+		tester.WithGRPC(s.GRPC),
+		tester.WithWebSocket(s.WebSocket),
+		tester.WithSocket(s.Socket),
+		tester.WithDNSQueries(s.DNS),
+		tester.WithCache(s.Cache),
+	}
+	if s.Protocol != nil {
+		opts = append(opts, tester.WithProtocol(s.Protocol.Name, s.Protocol.Config))
+	}
+	if s.Replay != nil {
+		// Validated specs always have a log that parses
+		entries, _ := s.Replay.entries()
+		opts = append(opts, tester.WithReplay(s.Replay.config(), entries...))
+	}
+	return opts
+}
+
+func (s *Spec) step(r Request) tester.Step {
+	step := tester.Step{
+		Name:               r.Name,
+		Method:             r.Method,
+		URL:                s.ResolveURL(r),
+		SuccessStatusCodes: r.SuccessStatusCodes,
+		Checks:             r.Checks,
+		Extract:            r.Extract,
+		GraphQL:            r.GraphQL,
+		Stream:             r.Stream,
+	}
+	if len(step.SuccessStatusCodes) == 0 {
+		step.SuccessStatusCodes = []int{http.StatusOK}
+	}
+
+	if len(r.Headers) > 0 {
+		step.Headers = http.Header{}
+		for k, v := range r.Headers {
+			step.Headers.Set(k, v)
+		}
+	}
+
+	if r.Body != nil {
+		// Bodies are decoded from JSON or YAML, so they always marshal
+		step.Body, _ = json.Marshal(r.Body)
+	}
+	if r.RawBody != "" {
+		step.Body = []byte(r.RawBody)
+	}
+	return step
+}
+
+// ResolveURL: url the request is sent to, paths are joined onto the base url
+func (s *Spec) ResolveURL(r Request) string {
+	if r.URL != "" || r.Path == "" {
+		return r.URL
+	}
+
+	base, err := url.Parse(s.Target.BaseURL)
+	if err != nil {
+		return r.Path
+	}
+	path, err := url.Parse(r.Path)
+	if err != nil {
+		return r.Path
+	}
+	base.Path = strings.TrimSuffix(base.Path, "/") + "/" + strings.TrimPrefix(path.Path, "/")
+	base.RawQuery = path.RawQuery
+	return base.String()
+}
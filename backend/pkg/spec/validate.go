@@ -0,0 +1,409 @@
+package spec
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"reflect"
+	"slices"
+	"sort"
+	"strings"
+
+	"github.com/VarthanV/load-tester/pkg/tester"
+)
+
+var methods = []string{
+	http.MethodGet, http.MethodHead, http.MethodPost, http.MethodPut,
+	http.MethodPatch, http.MethodDelete, http.MethodOptions,
+}
+
+// ValidationError: everything wrong with a spec, each problem starts with
+// the path of the field it is about
+type ValidationError struct {
+	Problems []string `json:"problems"`
+}
+
+func (e *ValidationError) Error() string {
+	return "invalid test spec:\n  " + strings.Join(e.Problems, "\n  ")
+}
+
+func (e *ValidationError) add(path string, format string, args ...interface{}) {
+	e.Problems = append(e.Problems, path+": "+fmt.Sprintf(format, args...))
+}
+
+// Validate: checks the spec for everything that would stop it from running
+// or make it run differently than written
+func (s *Spec) Validate() error {
+	v := &ValidationError{}
+
+	switch {
+	case s.Version == 0:
+		v.add("version", "required, the current version is %d", Version)
+	case s.Version != Version:
+		v.add("version", "unsupported version %d, the current version is %d", s.Version, Version)
+	}
+
+	if s.Target.BaseURL != "" {
+		validateURL(v, "target.base_url", s.Target.BaseURL)
+	}
+
+	if s.Load.TargetUsers <= 0 {
+		v.add("load.target_users", "has to be greater than 0")
+	}
+	if s.Load.UsersToStartWith < 0 {
+		v.add("load.users_to_start_with", "can't be negative")
+	}
+	if s.Load.UsersToStartWith > s.Load.TargetUsers {
+		v.add("load.users_to_start_with", "can't be more than load.target_users")
+	}
+	if s.Load.ReachPeakAfterInMinutes < 0 {
+		v.add("load.reach_peak_after_in_minutes", "can't be negative")
+	}
+
+	if s.Transport != nil {
+		err := tester.ValidateTransport(s.Transport)
+		if err != nil {
+			v.add("transport", "%s", err)
+		}
+	}
+	if s.Auth != nil {
+		err := tester.ValidateAuth(s.Auth)
+		if err != nil {
+			v.add("auth", "%s", err)
+		}
+	}
+	if s.ResponseBody != nil {
+		err := tester.ValidateResponseBody(s.ResponseBody)
+		if err != nil {
+			v.add("response_body", "%s", err)
+		}
+	}
+	if s.Retry != nil {
+		err := tester.ValidateRetry(s.Retry)
+		if err != nil {
+			v.add("retry", "%s", err)
+		}
+	}
+	if s.Redirect != nil {
+		err := tester.ValidateRedirect(s.Redirect)
+		if err != nil {
+			v.add("redirect", "%s", err)
+		}
+	}
+
+	protocols := []string{}
+	if len(s.Requests) > 0 {
+		protocols = append(protocols, "requests")
+	}
+	if s.GRPC != nil {
+		protocols = append(protocols, "grpc")
+		validateGRPC(v, s.GRPC)
+	}
+	if s.WebSocket != nil {
+		protocols = append(protocols, "websocket")
+		validateWebSocket(v, s.WebSocket)
+	}
+	if s.Socket != nil {
+		protocols = append(protocols, "socket")
+		err := tester.ValidateSocket(s.Socket)
+		if err != nil {
+			v.add("socket", "%s", err)
+		}
+	}
+	if s.DNS != nil {
+		protocols = append(protocols, "dns")
+		err := tester.ValidateDNSQueries(s.DNS)
+		if err != nil {
+			v.add("dns", "%s", err)
+		}
+	}
+	if s.Cache != nil {
+		protocols = append(protocols, "cache")
+		err := tester.ValidateCache(s.Cache)
+		if err != nil {
+			v.add("cache", "%s", err)
+		}
+	}
+	if s.Protocol != nil {
+		protocols = append(protocols, "protocol")
+		switch {
+		case s.Protocol.Name == tester.ProtocolHTTP:
+			v.add("protocol.name", "http runs the requests, list them under requests instead")
+		case !slices.Contains(tester.Protocols(), s.Protocol.Name):
+			v.add("protocol.name", "has to be one of %s", strings.Join(tester.Protocols(), ", "))
+		}
+	}
+	if s.Replay != nil {
+		protocols = append(protocols, "replay")
+		validateReplay(v, s)
+	}
+	switch {
+	case len(protocols) == 0:
+		v.add("requests", "at least one request is required")
+	case len(protocols) > 1:
+		v.add(protocols[1], "can't be used together with %s", protocols[0])
+	}
+	for i, r := range s.Requests {
+		s.validateRequest(v, fmt.Sprintf("requests[%d]", i), r)
+	}
+
+	if s.Samples != nil {
+		err := tester.ValidateSamples(s.Samples)
+		if err != nil {
+			v.add("samples", "%s", err)
+		}
+		if s.Load.Distributed {
+			v.add("samples", "can't be logged for distributed tests")
+		}
+	}
+
+	if s.Failures != nil {
+		err := tester.ValidateFailureCapture(s.Failures)
+		if err != nil {
+			v.add("failures", "%s", err)
+		}
+	}
+
+	for i, t := range s.Thresholds {
+		err := tester.ValidateThresholds([]tester.Threshold{t})
+		if err != nil {
+			v.add(fmt.Sprintf("thresholds[%d]", i), "%s", err)
+		}
+	}
+
+	if len(v.Problems) > 0 {
+		return v
+	}
+	return nil
+}
+
+func (s *Spec) validateRequest(v *ValidationError, path string, r Request) {
+	switch {
+	case r.URL != "" && r.Path != "":
+		v.add(path, "set either url or path, not both")
+	case r.URL != "":
+		validateURL(v, path+".url", r.URL)
+	case r.Path != "":
+		if s.Target.BaseURL == "" {
+			v.add(path+".path", "needs target.base_url to be set")
+		}
+	default:
+		v.add(path, "url or path is required")
+	}
+
+	if r.Body != nil && r.RawBody != "" {
+		v.add(path, "set either body or raw_body, not both")
+	}
+
+	if r.GraphQL != nil {
+		err := tester.ValidateGraphQL(r.GraphQL)
+		if err != nil {
+			v.add(path+".graphql", "%s", err)
+		}
+		if r.Body != nil || r.RawBody != "" {
+			v.add(path, "the body of a graphql request is built from the operation")
+		}
+		if r.Method != "" && r.Method != http.MethodPost {
+			v.add(path+".method", "graphql operations are sent as POST")
+		}
+	}
+
+	if r.Stream != nil {
+		err := tester.ValidateStream(r.Stream)
+		if err != nil {
+			v.add(path+".stream", "%s", err)
+		}
+	}
+
+	if r.Method != "" && !slices.Contains(methods, r.Method) {
+		v.add(path+".method", "unknown method %q, expected one of %s", r.Method, strings.Join(methods, ", "))
+	}
+
+	for i, code := range r.SuccessStatusCodes {
+		if code < 100 || code > 599 {
+			v.add(fmt.Sprintf("%s.success_status_codes[%d]", path, i), "%d is not a status code", code)
+		}
+	}
+
+	for i, c := range r.Checks {
+		err := tester.ValidateCheck(c)
+		if err != nil {
+			v.add(fmt.Sprintf("%s.checks[%d]", path, i), "%s", err)
+		}
+	}
+
+	for i, e := range r.Extract {
+		err := tester.ValidateExtract(e)
+		if err != nil {
+			v.add(fmt.Sprintf("%s.extract[%d]", path, i), "%s", err)
+		}
+	}
+}
+
+func validateGRPC(v *ValidationError, g *tester.GRPCConfig) {
+	if g.Target == "" {
+		v.add("grpc.target", "required")
+	}
+	service, method, ok := strings.Cut(strings.TrimPrefix(g.Method, "/"), "/")
+	if !ok || service == "" || method == "" {
+		v.add("grpc.method", "has to look like package.Service/Method")
+	}
+	if g.Message != nil && len(g.Messages) > 0 {
+		v.add("grpc", "takes either message or messages")
+	}
+	if g.TimeoutInMilliseconds < 0 {
+		v.add("grpc.timeout_in_milliseconds", "can't be negative")
+	}
+	if g.ProtosetFile != "" {
+		v.add("grpc.protoset_file", "is only read from definition files on disk, send the protoset base64 encoded instead")
+	}
+}
+
+func validateWebSocket(v *ValidationError, w *tester.WebSocketConfig) {
+	u, err := url.Parse(w.URL)
+	switch {
+	case w.URL == "":
+		v.add("websocket.url", "required")
+	case err != nil || (u.Scheme != "ws" && u.Scheme != "wss") || u.Host == "":
+		v.add("websocket.url", "has to be a ws:// or wss:// url")
+	}
+	for i, m := range w.Messages {
+		path := fmt.Sprintf("websocket.messages[%d]", i)
+		if m.Data != nil && m.Text != "" {
+			v.add(path, "takes either data or text")
+		}
+		if m.DelayInMilliseconds < 0 {
+			v.add(path+".delay_in_milliseconds", "can't be negative")
+		}
+	}
+	if w.CorrelationField != "" && len(w.Messages) == 0 {
+		v.add("websocket.correlation_field", "needs messages to correlate")
+	}
+	if w.ListenForInMilliseconds < 0 {
+		v.add("websocket.listen_for_in_milliseconds", "can't be negative")
+	}
+}
+
+func validateReplay(v *ValidationError, s *Spec) {
+	entries, err := s.Replay.entries()
+	if err != nil {
+		v.add("replay.log", "%s", err)
+	} else {
+		err = tester.ValidateReplay(s.Replay.config(), entries)
+		if err != nil {
+			v.add("replay", "%s", err)
+		}
+	}
+	if s.Load.Distributed {
+		v.add("replay", "can't be run distributed")
+	}
+}
+
+func validateURL(v *ValidationError, path string, raw string) {
+	u, err := url.Parse(raw)
+	if err != nil || u.Host == "" || (u.Scheme != "http" && u.Scheme != "https") {
+		v.add(path, "%q is not an absolute http or https url", raw)
+	}
+}
+
+// Walks the decoded document alongside the Spec type and reports every
+// field the schema doesn't know, typos would otherwise be dropped silently
+func unknownFields(doc interface{}) []string {
+	problems := []string{}
+	walk(doc, reflect.TypeOf(Spec{}), "", &problems)
+	sort.Strings(problems)
+	return problems
+}
+
+func walk(doc interface{}, t reflect.Type, path string, problems *[]string) {
+	for t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+
+	switch t.Kind() {
+	case reflect.Struct:
+		fields, ok := doc.(map[string]interface{})
+		if !ok {
+			return
+		}
+		known := jsonFields(t)
+		for name, value := range fields {
+			field, ok := known[name]
+			if !ok {
+				*problems = append(*problems, fmt.Sprintf("%s: unknown field, expected one of %s",
+					join(path, name), strings.Join(sortedKeys(known), ", ")))
+				continue
+			}
+			walk(value, field, join(path, name), problems)
+		}
+	case reflect.Slice:
+		items, ok := doc.([]interface{})
+		if !ok {
+			return
+		}
+		for i, item := range items {
+			walk(item, t.Elem(), fmt.Sprintf("%s[%d]", path, i), problems)
+		}
+	case reflect.Map:
+		fields, ok := doc.(map[string]interface{})
+		if !ok {
+			return
+		}
+		for name, value := range fields {
+			walk(value, t.Elem(), join(path, name), problems)
+		}
+	}
+}
+
+// Names the fields of a struct are decoded from, embedded structs are
+// flattened the way encoding/json does
+func jsonFields(t reflect.Type) map[string]reflect.Type {
+	fields := map[string]reflect.Type{}
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		if !f.IsExported() {
+			continue
+		}
+		name, _, _ := strings.Cut(f.Tag.Get("json"), ",")
+		if name == "-" {
+			continue
+		}
+		if f.Anonymous && name == "" && f.Type.Kind() == reflect.Struct {
+			for n, ft := range jsonFields(f.Type) {
+				fields[n] = ft
+			}
+			continue
+		}
+		if name == "" {
+			name = f.Name
+		}
+		fields[name] = f.Type
+	}
+	return fields
+}
+
+func sortedKeys(m map[string]reflect.Type) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func join(path string, name string) string {
+	if path == "" {
+		return name
+	}
+	return path + "." + name
+}
+
+func typeProblem(err error) string {
+	var typeErr *json.UnmarshalTypeError
+	if errors.As(err, &typeErr) {
+		return fmt.Sprintf("%s: expected %s, got %s", typeErr.Field, typeErr.Type, typeErr.Value)
+	}
+	return err.Error()
+}
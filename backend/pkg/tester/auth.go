@@ -0,0 +1,596 @@
+package tester
+
+import (
+	"bytes"
+	"context"
+	"crypto"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+type AuthType string
+
+const (
+	AuthTypeBasic  AuthType = "basic"
+	AuthTypeBearer AuthType = "bearer"
+	AuthTypeOAuth2 AuthType = "oauth2"
+	AuthTypeJWT    AuthType = "jwt"
+	AuthTypeHMAC   AuthType = "hmac"
+	AuthTypeSigV4  AuthType = "sigv4"
+)
+
+// AuthConfig: how every request of the test authenticates against the target
+type AuthConfig struct {
+	Type AuthType `json:"type"`
+
+	// Used by basic auth
+	Username string `json:"username,omitempty"`
+	Password string `json:"password,omitempty"`
+
+	// Static token used by bearer auth
+	Token string `json:"token,omitempty"`
+
+	OAuth2 *OAuth2Config `json:"oauth2,omitempty"`
+	JWT    *JWTConfig    `json:"jwt,omitempty"`
+	HMAC   *HMACConfig   `json:"hmac,omitempty"`
+	SigV4  *SigV4Config  `json:"sigv4,omitempty"`
+}
+
+// OAuth2Config: client credentials grant, the token is fetched lazily and
+// refreshed before it expires
+type OAuth2Config struct {
+	TokenURL     string   `json:"token_url"`
+	ClientID     string   `json:"client_id"`
+	ClientSecret string   `json:"client_secret"`
+	Scopes       []string `json:"scopes,omitempty"`
+	// Refresh the token this many seconds before it expires, defaults to 30
+	// and is capped at half of the token lifetime
+	RefreshBeforeInSeconds int `json:"refresh_before_in_seconds,omitempty"`
+}
+
+// JWTConfig: a token is minted for every virtual user with the given key
+type JWTConfig struct {
+	// HS256 or RS256, defaults to HS256
+	Algorithm string `json:"algorithm,omitempty"`
+	// Shared secret for HS256 or a PEM encoded private key for RS256
+	SigningKey string `json:"signing_key"`
+	Issuer     string `json:"issuer,omitempty"`
+	Audience   string `json:"audience,omitempty"`
+	// fmt format for the subject claim, gets the virtual user number,
+	// defaults to vu-%d
+	SubjectFormat string                 `json:"subject_format,omitempty"`
+	TTLInSeconds  int                    `json:"ttl_in_seconds,omitempty"`
+	Claims        map[string]interface{} `json:"claims,omitempty"`
+}
+
+// HMACConfig: signs method, path, timestamp and body hash with a shared secret
+type HMACConfig struct {
+	KeyID  string `json:"key_id"`
+	Secret string `json:"secret"`
+	// Header carrying the signature, defaults to Authorization
+	Header string `json:"header,omitempty"`
+}
+
+// SigV4Config: AWS signature version 4 request signing
+type SigV4Config struct {
+	AccessKeyID     string `json:"access_key_id"`
+	SecretAccessKey string `json:"secret_access_key"`
+	SessionToken    string `json:"session_token,omitempty"`
+	Region          string `json:"region"`
+	Service         string `json:"service"`
+}
+
+// Metrics about getting hold of credentials, kept apart from the
+// request latency of the endpoint under test
+type AuthReport struct {
+	TokenAcquisitions        int32   `json:"token_acquisitions"`
+	FailedTokenAcquisitions  int32   `json:"failed_token_acquisitions"`
+	AverageTokenAcquisition  float64 `json:"average_token_acquisition"`
+	PeakTokenAcquisitionTime float64 `json:"peak_token_acquisition_time"`
+}
+
+type authenticator interface {
+	apply(ctx context.Context, req *http.Request, body []byte, vu int) error
+}
+
+type authStats struct {
+	mu       sync.Mutex
+	times    []float64
+	failures int32
+}
+
+func (s *authStats) record(start time.Time, err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err != nil {
+		s.failures++
+		return
+	}
+	s.times = append(s.times, time.Since(start).Seconds())
+}
+
+func (s *authStats) report() *AuthReport {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if len(s.times) == 0 && s.failures == 0 {
+		return nil
+	}
+
+	r := &AuthReport{
+		TokenAcquisitions:        int32(len(s.times)) + s.failures,
+		FailedTokenAcquisitions:  s.failures,
+		PeakTokenAcquisitionTime: max(s.times),
+	}
+	sum := 0.0
+	for _, t := range s.times {
+		sum += t
+	}
+	if len(s.times) > 0 {
+		r.AverageTokenAcquisition = sum / float64(len(s.times))
+	}
+	return r
+}
+
+// ValidateAuth: reports unknown auth types and missing credentials
+func ValidateAuth(c *AuthConfig) error {
+	_, err := newAuthenticator(c, nil, &authStats{})
+	return err
+}
+
+func newAuthenticator(c *AuthConfig, client *http.Client, stats *authStats) (authenticator, error) {
+	if c == nil || c.Type == "" {
+		return nil, nil
+	}
+
+	switch c.Type {
+	case AuthTypeBasic:
+		return &basicAuth{username: c.Username, password: c.Password}, nil
+	case AuthTypeBearer:
+		if c.Token == "" {
+			return nil, errors.New("bearer auth requires a token")
+		}
+		return &bearerAuth{token: c.Token}, nil
+	case AuthTypeOAuth2:
+		if c.OAuth2 == nil || c.OAuth2.TokenURL == "" {
+			return nil, errors.New("oauth2 auth requires a token url")
+		}
+		return &oauth2Auth{config: *c.OAuth2, client: client, stats: stats}, nil
+	case AuthTypeJWT:
+		if c.JWT == nil || c.JWT.SigningKey == "" {
+			return nil, errors.New("jwt auth requires a signing key")
+		}
+		return newJWTAuth(*c.JWT, stats)
+	case AuthTypeHMAC:
+		if c.HMAC == nil || c.HMAC.Secret == "" {
+			return nil, errors.New("hmac auth requires a secret")
+		}
+		return &hmacAuth{config: *c.HMAC}, nil
+	case AuthTypeSigV4:
+		if c.SigV4 == nil || c.SigV4.Region == "" || c.SigV4.Service == "" {
+			return nil, errors.New("sigv4 auth requires a region and service")
+		}
+		return &sigV4Auth{config: *c.SigV4, now: time.Now}, nil
+	}
+
+	return nil, fmt.Errorf("unknown auth type %q", c.Type)
+}
+
+type basicAuth struct {
+	username string
+	password string
+}
+
+func (a *basicAuth) apply(_ context.Context, req *http.Request, _ []byte, _ int) error {
+	req.SetBasicAuth(a.username, a.password)
+	return nil
+}
+
+type bearerAuth struct {
+	token string
+}
+
+func (a *bearerAuth) apply(_ context.Context, req *http.Request, _ []byte, _ int) error {
+	req.Header.Set("Authorization", "Bearer "+a.token)
+	return nil
+}
+
+type oauth2Auth struct {
+	config OAuth2Config
+	client *http.Client
+	stats  *authStats
+
+	mu        sync.Mutex
+	token     string
+	lifetime  time.Duration
+	expiresAt time.Time
+}
+
+type oauth2TokenResponse struct {
+	AccessToken string `json:"access_token"`
+	TokenType   string `json:"token_type"`
+	ExpiresIn   int    `json:"expires_in"`
+}
+
+func (a *oauth2Auth) apply(ctx context.Context, req *http.Request, _ []byte, _ int) error {
+	token, err := a.getToken(ctx)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Authorization", "Bearer "+token)
+	return nil
+}
+
+// Returns the cached token, all the virtual users wait on a single fetch
+// when it is about to expire
+func (a *oauth2Auth) getToken(ctx context.Context) (string, error) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	refreshBefore := 30 * time.Second
+	if a.config.RefreshBeforeInSeconds > 0 {
+		refreshBefore = time.Duration(a.config.RefreshBeforeInSeconds) * time.Second
+	}
+
+	refreshBefore = renewalMargin(refreshBefore, a.lifetime)
+	if a.token != "" && time.Now().Add(refreshBefore).Before(a.expiresAt) {
+		return a.token, nil
+	}
+
+	start := time.Now()
+	res, err := a.fetch(ctx)
+	a.stats.record(start, err)
+	if err != nil {
+		logrus.Error("error in fetching oauth2 token ", err)
+		return "", err
+	}
+
+	a.token = res.AccessToken
+	a.lifetime = time.Duration(res.ExpiresIn) * time.Second
+	if res.ExpiresIn == 0 {
+		// No expiry advertised, hold on to it for the whole test
+		a.lifetime = 24 * time.Hour
+	}
+	a.expiresAt = time.Now().Add(a.lifetime)
+	return a.token, nil
+}
+
+// Renews a token the given margin before it expires but not before half its
+// lifetime, else short lived tokens would be refetched on every request
+func renewalMargin(margin, lifetime time.Duration) time.Duration {
+	return min(margin, lifetime/2)
+}
+
+func (a *oauth2Auth) fetch(ctx context.Context) (*oauth2TokenResponse, error) {
+	form := url.Values{}
+	form.Set("grant_type", "client_credentials")
+	if len(a.config.Scopes) > 0 {
+		form.Set("scope", strings.Join(a.config.Scopes, " "))
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost,
+		a.config.TokenURL, strings.NewReader(form.Encode()))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.SetBasicAuth(url.QueryEscape(a.config.ClientID), url.QueryEscape(a.config.ClientSecret))
+
+	res, err := a.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("token endpoint returned status %d", res.StatusCode)
+	}
+
+	token := oauth2TokenResponse{}
+	err = json.NewDecoder(res.Body).Decode(&token)
+	if err != nil {
+		return nil, err
+	}
+	if token.AccessToken == "" {
+		return nil, errors.New("token endpoint returned no access token")
+	}
+	return &token, nil
+}
+
+type jwtAuth struct {
+	config JWTConfig
+	rsaKey *rsa.PrivateKey
+	stats  *authStats
+
+	mu     sync.Mutex
+	tokens map[int]*mintedToken
+}
+
+type mintedToken struct {
+	token     string
+	expiresAt time.Time
+}
+
+func newJWTAuth(c JWTConfig, stats *authStats) (*jwtAuth, error) {
+	a := &jwtAuth{config: c, stats: stats, tokens: map[int]*mintedToken{}}
+	if a.config.Algorithm == "" {
+		a.config.Algorithm = "HS256"
+	}
+	if a.config.SubjectFormat == "" {
+		a.config.SubjectFormat = "vu-%d"
+	}
+	if a.config.TTLInSeconds == 0 {
+		a.config.TTLInSeconds = 3600
+	}
+
+	switch a.config.Algorithm {
+	case "HS256":
+	case "RS256":
+		key, err := parseRSAPrivateKey([]byte(c.SigningKey))
+		if err != nil {
+			return nil, err
+		}
+		a.rsaKey = key
+	default:
+		return nil, fmt.Errorf("unsupported jwt algorithm %q", c.Algorithm)
+	}
+	return a, nil
+}
+
+func parseRSAPrivateKey(data []byte) (*rsa.PrivateKey, error) {
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, errors.New("signing key is not PEM encoded")
+	}
+	if key, err := x509.ParsePKCS1PrivateKey(block.Bytes); err == nil {
+		return key, nil
+	}
+	parsed, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return nil, err
+	}
+	key, ok := parsed.(*rsa.PrivateKey)
+	if !ok {
+		return nil, errors.New("signing key is not a RSA key")
+	}
+	return key, nil
+}
+
+func (a *jwtAuth) apply(_ context.Context, req *http.Request, _ []byte, vu int) error {
+	token, err := a.tokenFor(vu)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Authorization", "Bearer "+token)
+	return nil
+}
+
+func (a *jwtAuth) tokenFor(vu int) (string, error) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	if t, ok := a.tokens[vu]; ok && time.Now().Before(t.expiresAt) {
+		return t.token, nil
+	}
+
+	start := time.Now()
+	token, expiresAt, err := a.mint(vu)
+	a.stats.record(start, err)
+	if err != nil {
+		logrus.Error("error in minting jwt ", err)
+		return "", err
+	}
+	a.tokens[vu] = &mintedToken{token: token, expiresAt: expiresAt}
+	return token, nil
+}
+
+func (a *jwtAuth) mint(vu int) (string, time.Time, error) {
+	now := time.Now()
+	expiresAt := now.Add(time.Duration(a.config.TTLInSeconds) * time.Second)
+
+	jti := make([]byte, 16)
+	if _, err := rand.Read(jti); err != nil {
+		return "", expiresAt, err
+	}
+
+	claims := map[string]interface{}{}
+	for k, v := range a.config.Claims {
+		claims[k] = v
+	}
+	claims["sub"] = fmt.Sprintf(a.config.SubjectFormat, vu)
+	claims["iat"] = now.Unix()
+	claims["exp"] = expiresAt.Unix()
+	claims["jti"] = hex.EncodeToString(jti)
+	if a.config.Issuer != "" {
+		claims["iss"] = a.config.Issuer
+	}
+	if a.config.Audience != "" {
+		claims["aud"] = a.config.Audience
+	}
+
+	header, err := json.Marshal(map[string]string{"alg": a.config.Algorithm, "typ": "JWT"})
+	if err != nil {
+		return "", expiresAt, err
+	}
+	payload, err := json.Marshal(claims)
+	if err != nil {
+		return "", expiresAt, err
+	}
+
+	signingInput := base64.RawURLEncoding.EncodeToString(header) + "." +
+		base64.RawURLEncoding.EncodeToString(payload)
+
+	var signature []byte
+	switch a.config.Algorithm {
+	case "HS256":
+		mac := hmac.New(sha256.New, []byte(a.config.SigningKey))
+		mac.Write([]byte(signingInput))
+		signature = mac.Sum(nil)
+	case "RS256":
+		digest := sha256.Sum256([]byte(signingInput))
+		signature, err = rsa.SignPKCS1v15(rand.Reader, a.rsaKey, crypto.SHA256, digest[:])
+		if err != nil {
+			return "", expiresAt, err
+		}
+	}
+
+	// Give up the token a little before the target would reject it
+	ttl := time.Duration(a.config.TTLInSeconds) * time.Second
+	return signingInput + "." + base64.RawURLEncoding.EncodeToString(signature),
+		expiresAt.Add(-renewalMargin(5*time.Second, ttl)), nil
+}
+
+type hmacAuth struct {
+	config HMACConfig
+}
+
+// Signs "METHOD\nPATH?QUERY\nTIMESTAMP\nhex(sha256(body))" with HMAC-SHA256
+func (a *hmacAuth) apply(_ context.Context, req *http.Request, body []byte, _ int) error {
+	timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+	bodyHash := sha256.Sum256(body)
+
+	stringToSign := strings.Join([]string{
+		req.Method,
+		req.URL.RequestURI(),
+		timestamp,
+		hex.EncodeToString(bodyHash[:]),
+	}, "\n")
+
+	mac := hmac.New(sha256.New, []byte(a.config.Secret))
+	mac.Write([]byte(stringToSign))
+	signature := hex.EncodeToString(mac.Sum(nil))
+
+	header := a.config.Header
+	if header == "" {
+		header = "Authorization"
+	}
+	req.Header.Set("X-Timestamp", timestamp)
+	req.Header.Set(header, fmt.Sprintf("HMAC-SHA256 %s:%s", a.config.KeyID, signature))
+	return nil
+}
+
+type sigV4Auth struct {
+	config SigV4Config
+	now    func() time.Time
+}
+
+func (a *sigV4Auth) apply(_ context.Context, req *http.Request, body []byte, _ int) error {
+	now := a.now().UTC()
+	amzDate := now.Format("20060102T150405Z")
+	date := now.Format("20060102")
+
+	bodyHash := sha256.Sum256(body)
+	payloadHash := hex.EncodeToString(bodyHash[:])
+
+	req.Header.Set("X-Amz-Date", amzDate)
+	if a.config.SessionToken != "" {
+		req.Header.Set("X-Amz-Security-Token", a.config.SessionToken)
+	}
+	if a.config.Service == "s3" {
+		req.Header.Set("X-Amz-Content-Sha256", payloadHash)
+	}
+
+	host := req.Host
+	if host == "" {
+		host = req.URL.Host
+	}
+
+	headers := map[string]string{"host": host}
+	for k, v := range req.Header {
+		lk := strings.ToLower(k)
+		if lk == "authorization" || lk == "user-agent" {
+			continue
+		}
+		headers[lk] = strings.Join(v, ",")
+	}
+	names := make([]string, 0, len(headers))
+	for k := range headers {
+		names = append(names, k)
+	}
+	sort.Strings(names)
+
+	var canonicalHeaders bytes.Buffer
+	for _, k := range names {
+		canonicalHeaders.WriteString(k + ":" + strings.TrimSpace(headers[k]) + "\n")
+	}
+	signedHeaders := strings.Join(names, ";")
+
+	path := req.URL.EscapedPath()
+	if path == "" {
+		path = "/"
+	}
+
+	canonicalRequest := strings.Join([]string{
+		req.Method,
+		path,
+		canonicalQuery(req.URL.Query()),
+		canonicalHeaders.String(),
+		signedHeaders,
+		payloadHash,
+	}, "\n")
+
+	scope := strings.Join([]string{date, a.config.Region, a.config.Service, "aws4_request"}, "/")
+	canonicalHash := sha256.Sum256([]byte(canonicalRequest))
+	stringToSign := strings.Join([]string{
+		"AWS4-HMAC-SHA256",
+		amzDate,
+		scope,
+		hex.EncodeToString(canonicalHash[:]),
+	}, "\n")
+
+	key := hmacSHA256([]byte("AWS4"+a.config.SecretAccessKey), date)
+	key = hmacSHA256(key, a.config.Region)
+	key = hmacSHA256(key, a.config.Service)
+	key = hmacSHA256(key, "aws4_request")
+	signature := hex.EncodeToString(hmacSHA256(key, stringToSign))
+
+	req.Header.Set("Authorization", fmt.Sprintf(
+		"AWS4-HMAC-SHA256 Credential=%s/%s, SignedHeaders=%s, Signature=%s",
+		a.config.AccessKeyID, scope, signedHeaders, signature))
+	return nil
+}
+
+func canonicalQuery(values url.Values) string {
+	keys := make([]string, 0, len(values))
+	for k := range values {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	parts := []string{}
+	for _, k := range keys {
+		vs := append([]string{}, values[k]...)
+		sort.Strings(vs)
+		for _, v := range vs {
+			parts = append(parts, awsEscape(k)+"="+awsEscape(v))
+		}
+	}
+	return strings.Join(parts, "&")
+}
+
+func awsEscape(s string) string {
+	return strings.ReplaceAll(url.QueryEscape(s), "+", "%20")
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(data))
+	return mac.Sum(nil)
+}
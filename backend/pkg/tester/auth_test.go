@@ -0,0 +1,159 @@
+package tester
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestSigV4Auth(t *testing.T) {
+	// get-vanilla from the AWS signature v4 test suite
+	a := &sigV4Auth{
+		config: SigV4Config{
+			AccessKeyID:     "AKIDEXAMPLE",
+			SecretAccessKey: "wJalrXUtnFEMI/K7MDENG+bPxRfiCYEXAMPLEKEY",
+			Region:          "us-east-1",
+			Service:         "service",
+		},
+		now: func() time.Time {
+			return time.Date(2015, 8, 30, 12, 36, 0, 0, time.UTC)
+		},
+	}
+
+	req, _ := http.NewRequest(http.MethodGet, "https://example.amazonaws.com/", nil)
+	if err := a.apply(context.Background(), req, nil, 1); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	expected := "AWS4-HMAC-SHA256 Credential=AKIDEXAMPLE/20150830/us-east-1/service/aws4_request, " +
+		"SignedHeaders=host;x-amz-date, " +
+		"Signature=5fa00fa31553b73ebf1942676e86291e8372ff2a2260956d9b8aae1d763fbf31"
+	if got := req.Header.Get("Authorization"); got != expected {
+		t.Errorf("unexpected authorization header\n got: %s\nwant: %s", got, expected)
+	}
+}
+
+func TestJWTAuthMintsPerVirtualUser(t *testing.T) {
+	stats := &authStats{}
+	a, err := newJWTAuth(JWTConfig{SigningKey: "secret", Issuer: "load-tester"}, stats)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	first, _ := a.tokenFor(1)
+	again, _ := a.tokenFor(1)
+	other, _ := a.tokenFor(2)
+
+	if first != again {
+		t.Errorf("expected token to be reused for the same virtual user")
+	}
+	if first == other {
+		t.Errorf("expected different tokens for different virtual users")
+	}
+
+	parts := strings.Split(first, ".")
+	if len(parts) != 3 {
+		t.Fatalf("expected 3 jwt segments, got %d", len(parts))
+	}
+
+	mac := hmac.New(sha256.New, []byte("secret"))
+	mac.Write([]byte(parts[0] + "." + parts[1]))
+	if base64.RawURLEncoding.EncodeToString(mac.Sum(nil)) != parts[2] {
+		t.Errorf("jwt signature does not verify")
+	}
+
+	payload, _ := base64.RawURLEncoding.DecodeString(parts[1])
+	claims := map[string]interface{}{}
+	json.Unmarshal(payload, &claims)
+	if claims["sub"] != "vu-1" || claims["iss"] != "load-tester" {
+		t.Errorf("unexpected claims: %v", claims)
+	}
+
+	if r := stats.report(); r == nil || r.TokenAcquisitions != 2 {
+		t.Errorf("expected 2 token acquisitions, got %+v", r)
+	}
+}
+
+func TestOAuth2AuthRefreshesBeforeExpiry(t *testing.T) {
+	var fetches atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fetches.Add(1)
+		if r.FormValue("grant_type") != "client_credentials" {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		json.NewEncoder(w).Encode(oauth2TokenResponse{AccessToken: "token", ExpiresIn: 60})
+	}))
+	defer server.Close()
+
+	stats := &authStats{}
+	a := &oauth2Auth{
+		config: OAuth2Config{TokenURL: server.URL, ClientID: "id", ClientSecret: "secret"},
+		client: server.Client(),
+		stats:  stats,
+	}
+
+	for i := 0; i < 3; i++ {
+		req, _ := http.NewRequest(http.MethodGet, "http://example.com", nil)
+		if err := a.apply(context.Background(), req, nil, 1); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if req.Header.Get("Authorization") != "Bearer token" {
+			t.Errorf("unexpected authorization header %q", req.Header.Get("Authorization"))
+		}
+	}
+
+	if fetches.Load() != 1 {
+		t.Errorf("expected a single token fetch, got %d", fetches.Load())
+	}
+
+	// Within the refresh window the token is fetched again
+	a.expiresAt = time.Now().Add(20 * time.Second)
+	a.getToken(context.Background())
+	if fetches.Load() != 2 {
+		t.Errorf("expected token to be refreshed, got %d fetches", fetches.Load())
+	}
+}
+
+func TestShortLivedTokensAreReused(t *testing.T) {
+	for _, expiresIn := range []int{1, 2, 30, 60} {
+		var fetches atomic.Int32
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			fetches.Add(1)
+			json.NewEncoder(w).Encode(oauth2TokenResponse{AccessToken: "token", ExpiresIn: expiresIn})
+		}))
+
+		a := &oauth2Auth{
+			config: OAuth2Config{TokenURL: server.URL, RefreshBeforeInSeconds: 60},
+			client: server.Client(),
+			stats:  &authStats{},
+		}
+		for i := 0; i < 5; i++ {
+			if _, err := a.getToken(context.Background()); err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+		}
+		server.Close()
+
+		if fetches.Load() != 1 {
+			t.Errorf("expected a single fetch for expires_in %d, got %d", expiresIn, fetches.Load())
+		}
+	}
+
+	for _, ttl := range []int{1, 5} {
+		a, _ := newJWTAuth(JWTConfig{SigningKey: "secret", TTLInSeconds: ttl}, &authStats{})
+		first, _ := a.tokenFor(1)
+		again, _ := a.tokenFor(1)
+		if first != again {
+			t.Errorf("expected a %ds token to be reused", ttl)
+		}
+	}
+}
@@ -0,0 +1,519 @@
+package tester
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"math/rand"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// Redis serialization protocol
+	CacheRedis = "redis"
+	// memcached text protocol
+	CacheMemcached = "memcached"
+
+	// The server answered the command with an error
+	ErrorCacheServer = "cache_error"
+
+	defaultCacheTimeout   = 2 * time.Second
+	defaultCacheKeySpace  = 1000
+	defaultCacheValueSize = 64
+)
+
+var cacheCommands = map[string]bool{"GET": true, "SET": true, "INCR": true, "DEL": true}
+
+// CacheConfig: every iteration of a virtual user sends a command picked from
+// the mix on a connection the user keeps open
+type CacheConfig struct {
+	// redis or memcached
+	Protocol string `json:"protocol"`
+	// host:port of the server
+	Address string `json:"address"`
+	// Sent with AUTH when connecting to redis
+	Password string         `json:"password,omitempty"`
+	Commands []CacheCommand `json:"commands"`
+	// Upper bound of {{random}} in keys, defaults to 1000
+	KeySpace int `json:"key_space,omitempty"`
+	// Covers the connect, command and reply, defaults to 2 seconds
+	TimeoutInMilliseconds int `json:"timeout_in_milliseconds,omitempty"`
+}
+
+// CacheCommand: a command of the mix, keys can use {{vu}} and {{random}}
+type CacheCommand struct {
+	// GET, SET, INCR or DEL
+	Command string `json:"command"`
+	Key     string `json:"key"`
+	// Bytes stored by SET, defaults to 64
+	ValueSize    int `json:"value_size,omitempty"`
+	TTLInSeconds int `json:"ttl_in_seconds,omitempty"`
+	// Share of the mix relative to the other commands, defaults to 1
+	Weight int `json:"weight,omitempty"`
+}
+
+type CacheReport struct {
+	Commands map[string]*CacheCommandReport `json:"commands"`
+}
+
+type CacheCommandReport struct {
+	Calls  int64 `json:"calls"`
+	Errors int64 `json:"errors"`
+	// Failed calls over all the calls
+	ErrorRate float64 `json:"error_rate"`
+	// Keys that weren't there for GET, INCR on memcached and DEL
+	Misses int64 `json:"misses"`
+
+	AverageLatency   float64    `json:"average_latency"`
+	P50Latency       float64    `json:"p_50_latency"`
+	P90Latency       float64    `json:"p_90_latency"`
+	P99Latency       float64    `json:"p_99_latency"`
+	LatencyHistogram *Histogram `json:"latency_histogram,omitempty"`
+}
+
+// Option fn to send redis or memcached commands instead of making HTTP requests
+func WithCache(c *CacheConfig) Option {
+	return withBuiltin(ProtocolCache, c)
+}
+
+// ValidateCache: reports configs the commands can't be sent with
+func ValidateCache(c *CacheConfig) error {
+	if c.Protocol != CacheRedis && c.Protocol != CacheMemcached {
+		return fmt.Errorf("cache protocol has to be redis or memcached, got %q", c.Protocol)
+	}
+	if _, _, err := net.SplitHostPort(c.Address); err != nil {
+		return fmt.Errorf("cache address has to be host:port: %w", err)
+	}
+	if c.Password != "" && c.Protocol == CacheMemcached {
+		return errors.New("cache password is only supported for redis")
+	}
+	if len(c.Commands) == 0 {
+		return errors.New("cache needs at least one command")
+	}
+	for i, command := range c.Commands {
+		if !cacheCommands[strings.ToUpper(command.Command)] {
+			return fmt.Errorf("cache command %d: unknown command %q, expected GET, SET, INCR or DEL", i, command.Command)
+		}
+		if command.Key == "" || strings.ContainsAny(command.Key, " \r\n") {
+			return fmt.Errorf("cache command %d: key is required and can't have spaces", i)
+		}
+		if command.ValueSize < 0 || command.TTLInSeconds < 0 || command.Weight < 0 {
+			return fmt.Errorf("cache command %d: value size, ttl and weight can't be negative", i)
+		}
+	}
+	if c.KeySpace < 0 || c.TimeoutInMilliseconds < 0 {
+		return errors.New("cache key space and timeout can't be negative")
+	}
+	return nil
+}
+
+type cacheClient struct {
+	config   *CacheConfig
+	commands []CacheCommand
+	values   [][]byte
+	weights  int
+	keySpace int
+	timeout  time.Duration
+	stats    *cacheStats
+
+	mu sync.Mutex
+	// Every virtual user keeps its connection across iterations
+	conns map[int]*cacheConn
+}
+
+type cacheConn struct {
+	net.Conn
+	reader *bufio.Reader
+	read   *countingReader
+}
+
+func newCacheClient(c *CacheConfig, stats *cacheStats) (*cacheClient, error) {
+	err := ValidateCache(c)
+	if err != nil {
+		return nil, err
+	}
+
+	client := &cacheClient{
+		config:   c,
+		keySpace: defaultCacheKeySpace,
+		timeout:  defaultCacheTimeout,
+		stats:    stats,
+		conns:    map[int]*cacheConn{},
+	}
+	for _, command := range c.Commands {
+		command.Command = strings.ToUpper(command.Command)
+		if command.Weight == 0 {
+			command.Weight = 1
+		}
+		size := command.ValueSize
+		if size == 0 {
+			size = defaultCacheValueSize
+		}
+		client.commands = append(client.commands, command)
+		client.values = append(client.values, bytes.Repeat([]byte("x"), size))
+		client.weights += command.Weight
+	}
+	if c.KeySpace > 0 {
+		client.keySpace = c.KeySpace
+	}
+	if c.TimeoutInMilliseconds > 0 {
+		client.timeout = time.Duration(c.TimeoutInMilliseconds) * time.Millisecond
+	}
+	return client, nil
+}
+
+// Picks a command of the mix by weight
+func (c *cacheClient) pick() int {
+	n := rand.Intn(c.weights)
+	for i, command := range c.commands {
+		n -= command.Weight
+		if n < 0 {
+			return i
+		}
+	}
+	return len(c.commands) - 1
+}
+
+func (c *cacheClient) key(template string, vu int) string {
+	return placeholder.ReplaceAllStringFunc(template, func(p string) string {
+		switch placeholder.FindStringSubmatch(p)[1] {
+		case "vu":
+			return strconv.Itoa(vu)
+		case "random":
+			return strconv.Itoa(rand.Intn(c.keySpace))
+		}
+		return p
+	})
+}
+
+// Sends a command of the mix, the time taken is the command and its reply.
+// Connections are dropped on network errors and opened on the next call
+func (c *cacheClient) call(ctx context.Context, vu int) *RequestStat {
+	i := c.pick()
+	command := c.commands[i]
+	stat := &RequestStat{Endpoint: command.Command}
+
+	ctx, cancel := context.WithTimeout(ctx, c.timeout)
+	defer cancel()
+
+	conn, err := c.conn(ctx, vu)
+	if err != nil {
+		stat.ErrorCategory = cacheErrorCategory(err)
+		c.stats.record(command.Command, 0, false, false)
+		return stat
+	}
+	deadline, _ := ctx.Deadline()
+	conn.SetDeadline(deadline)
+
+	var request []byte
+	key := c.key(command.Key, vu)
+	if c.config.Protocol == CacheRedis {
+		request = redisRequest(command, key, c.values[i])
+	} else {
+		request = memcachedRequest(command, key, c.values[i])
+	}
+
+	read := conn.read.n
+	start := time.Now()
+	_, err = conn.Write(request)
+	var miss bool
+	if err == nil {
+		if c.config.Protocol == CacheRedis {
+			miss, err = readRedisReply(conn.reader)
+		} else {
+			miss, err = readMemcachedReply(conn.reader, command.Command)
+		}
+	}
+	stat.TimeTakenInSeconds = time.Since(start).Seconds()
+	stat.BytesSent = int64(len(request))
+	stat.BytesReceived = conn.read.n - read
+	stat.BytesReceivedUncompressed = stat.BytesReceived
+
+	stat.ErrorCategory = cacheErrorCategory(err)
+	switch {
+	case err == nil:
+		stat.IsSuccess = true
+	case stat.ErrorCategory != ErrorCacheServer:
+		c.drop(vu)
+	}
+	c.stats.record(command.Command, stat.TimeTakenInSeconds, stat.IsSuccess, miss)
+	return stat
+}
+
+func (c *cacheClient) conn(ctx context.Context, vu int) (*cacheConn, error) {
+	c.mu.Lock()
+	conn, ok := c.conns[vu]
+	c.mu.Unlock()
+	if ok {
+		return conn, nil
+	}
+
+	raw, err := (&net.Dialer{}).DialContext(ctx, "tcp", c.config.Address)
+	if err != nil {
+		return nil, err
+	}
+	conn = &cacheConn{Conn: raw, read: &countingReader{r: raw}}
+	conn.reader = bufio.NewReader(conn.read)
+	if c.config.Password != "" {
+		deadline, _ := ctx.Deadline()
+		conn.SetDeadline(deadline)
+		_, err = conn.Write(redisArray("AUTH", c.config.Password))
+		if err == nil {
+			_, err = readRedisReply(conn.reader)
+		}
+		if err != nil {
+			conn.Close()
+			return nil, err
+		}
+	}
+
+	c.mu.Lock()
+	c.conns[vu] = conn
+	c.mu.Unlock()
+	return conn, nil
+}
+
+func (c *cacheClient) drop(vu int) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if conn, ok := c.conns[vu]; ok {
+		conn.Close()
+		delete(c.conns, vu)
+	}
+}
+
+func (c *cacheClient) Prepare(ctx context.Context) error {
+	return nil
+}
+
+func (c *cacheClient) Execute(ctx context.Context, vu int, record func(*RequestStat)) {
+	record(c.call(ctx, vu))
+}
+
+func (c *cacheClient) Close() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for vu, conn := range c.conns {
+		conn.Close()
+		delete(c.conns, vu)
+	}
+	return nil
+}
+
+func (c *cacheClient) AddToReport(r *Report, elapsed time.Duration) {
+	r.Cache = c.stats.report()
+}
+
+// cacheServerError: an error reply, the connection stays usable
+type cacheServerError struct {
+	message string
+}
+
+func (e *cacheServerError) Error() string {
+	return e.message
+}
+
+func cacheErrorCategory(err error) string {
+	var serverErr *cacheServerError
+	if errors.As(err, &serverErr) {
+		return ErrorCacheServer
+	}
+	return categorizeError(err)
+}
+
+// https://redis.io/docs/latest/develop/reference/protocol-spec/
+func redisArray(args ...string) []byte {
+	var b bytes.Buffer
+	fmt.Fprintf(&b, "*%d\r\n", len(args))
+	for _, arg := range args {
+		fmt.Fprintf(&b, "$%d\r\n%s\r\n", len(arg), arg)
+	}
+	return b.Bytes()
+}
+
+func redisRequest(command CacheCommand, key string, value []byte) []byte {
+	switch command.Command {
+	case "SET":
+		if command.TTLInSeconds > 0 {
+			return redisArray("SET", key, string(value), "EX", strconv.Itoa(command.TTLInSeconds))
+		}
+		return redisArray("SET", key, string(value))
+	case "INCR":
+		return redisArray("INCR", key)
+	case "DEL":
+		return redisArray("DEL", key)
+	}
+	return redisArray("GET", key)
+}
+
+// Reads a reply, nil replies and DEL of a missing key are misses
+func readRedisReply(r *bufio.Reader) (bool, error) {
+	line, err := readLine(r)
+	if err != nil {
+		return false, err
+	}
+	if line == "" {
+		return false, fmt.Errorf("empty redis reply")
+	}
+	switch line[0] {
+	case '+':
+		return false, nil
+	case '-':
+		return false, &cacheServerError{message: line[1:]}
+	case ':':
+		return line == ":0", nil
+	case '$':
+		n, err := strconv.Atoi(line[1:])
+		if err != nil {
+			return false, fmt.Errorf("invalid redis bulk length %q", line)
+		}
+		if n < 0 {
+			return true, nil
+		}
+		_, err = io.CopyN(io.Discard, r, int64(n)+2)
+		return false, err
+	case '*':
+		n, err := strconv.Atoi(line[1:])
+		if err != nil {
+			return false, fmt.Errorf("invalid redis array length %q", line)
+		}
+		for i := 0; i < n; i++ {
+			_, err = readRedisReply(r)
+			var serverErr *cacheServerError
+			if err != nil && !errors.As(err, &serverErr) {
+				return false, err
+			}
+		}
+		return n < 0, nil
+	}
+	return false, fmt.Errorf("unknown redis reply %q", line)
+}
+
+// https://github.com/memcached/memcached/blob/master/doc/protocol.txt
+func memcachedRequest(command CacheCommand, key string, value []byte) []byte {
+	switch command.Command {
+	case "SET":
+		return append([]byte(fmt.Sprintf("set %s 0 %d %d\r\n", key, command.TTLInSeconds, len(value))),
+			append(value, '\r', '\n')...)
+	case "INCR":
+		return []byte("incr " + key + " 1\r\n")
+	case "DEL":
+		return []byte("delete " + key + "\r\n")
+	}
+	return []byte("get " + key + "\r\n")
+}
+
+func readMemcachedReply(r *bufio.Reader, command string) (bool, error) {
+	hit := false
+	for {
+		line, err := readLine(r)
+		if err != nil {
+			return false, err
+		}
+		switch {
+		case line == "ERROR", strings.HasPrefix(line, "CLIENT_ERROR"), strings.HasPrefix(line, "SERVER_ERROR"):
+			return false, &cacheServerError{message: line}
+		case line == "NOT_FOUND":
+			return true, nil
+		case command != "GET":
+			// STORED, DELETED or the value after INCR
+			return false, nil
+		case line == "END":
+			return !hit, nil
+		case strings.HasPrefix(line, "VALUE "):
+			fields := strings.Fields(line)
+			n, err := strconv.Atoi(fields[len(fields)-1])
+			if err != nil {
+				return false, fmt.Errorf("invalid memcached value %q", line)
+			}
+			_, err = io.CopyN(io.Discard, r, int64(n)+2)
+			if err != nil {
+				return false, err
+			}
+			hit = true
+		default:
+			return false, fmt.Errorf("unknown memcached reply %q", line)
+		}
+	}
+}
+
+func readLine(r *bufio.Reader) (string, error) {
+	line, err := r.ReadString('\n')
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSuffix(strings.TrimSuffix(line, "\n"), "\r"), nil
+}
+
+type cacheCommandStats struct {
+	calls   int64
+	errors  int64
+	misses  int64
+	latency *Histogram
+	total   float64
+}
+
+type cacheStats struct {
+	mu       sync.Mutex
+	commands map[string]*cacheCommandStats
+}
+
+func (s *cacheStats) record(command string, seconds float64, success bool, miss bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.commands == nil {
+		s.commands = map[string]*cacheCommandStats{}
+	}
+	c, ok := s.commands[command]
+	if !ok {
+		c = &cacheCommandStats{latency: NewHistogram()}
+		s.commands[command] = c
+	}
+	c.calls++
+	if !success {
+		c.errors++
+		return
+	}
+	if miss {
+		c.misses++
+	}
+	c.latency.Record(seconds)
+	c.total += seconds
+}
+
+func (s *cacheStats) report() *CacheReport {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	r := &CacheReport{Commands: map[string]*CacheCommandReport{}}
+	for command, c := range s.commands {
+		report := &CacheCommandReport{
+			Calls:            c.calls,
+			Errors:           c.errors,
+			Misses:           c.misses,
+			LatencyHistogram: c.latency,
+		}
+		if succeeded := c.calls - c.errors; succeeded > 0 {
+			report.AverageLatency = c.total / float64(succeeded)
+		}
+		report.setRates()
+		r.Commands[command] = report
+	}
+	return r
+}
+
+func (r *CacheCommandReport) setRates() {
+	if r.Calls > 0 {
+		r.ErrorRate = float64(r.Errors) / float64(r.Calls)
+	}
+	r.P50Latency = r.LatencyHistogram.Percentile(50)
+	r.P90Latency = r.LatencyHistogram.Percentile(90)
+	r.P99Latency = r.LatencyHistogram.Percentile(99)
+}
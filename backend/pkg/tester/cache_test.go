@@ -0,0 +1,262 @@
+package tester
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/google/uuid"
+)
+
+// store: the keys of the stand-in servers
+type store struct {
+	mu     sync.Mutex
+	values map[string]string
+}
+
+func (s *store) incr(key string) (int, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	n, err := strconv.Atoi(s.values[key])
+	if _, ok := s.values[key]; ok && err != nil {
+		return 0, false
+	}
+	s.values[key] = strconv.Itoa(n + 1)
+	return n + 1, true
+}
+
+func (s *store) get(key string) (string, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	v, ok := s.values[key]
+	return v, ok
+}
+
+func (s *store) set(key string, value string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.values[key] = value
+}
+
+func (s *store) del(key string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	_, ok := s.values[key]
+	delete(s.values, key)
+	return ok
+}
+
+// Speaks enough RESP for the commands of the tester, needs AUTH secret
+func startRedisServer(t *testing.T) (string, *store) {
+	s := &store{values: map[string]string{}}
+	address := startTCPServer(t, func(conn net.Conn) {
+		r := bufio.NewReader(conn)
+		authed := false
+		for {
+			line, err := readLine(r)
+			if err != nil {
+				return
+			}
+			n, _ := strconv.Atoi(strings.TrimPrefix(line, "*"))
+			args := make([]string, n)
+			for i := range args {
+				readLine(r)
+				args[i], _ = readLine(r)
+			}
+
+			reply := ""
+			switch {
+			case args[0] == "AUTH":
+				authed = args[1] == "secret"
+				reply = "+OK\r\n"
+				if !authed {
+					reply = "-WRONGPASS invalid password\r\n"
+				}
+			case !authed:
+				reply = "-NOAUTH Authentication required\r\n"
+			case args[0] == "GET":
+				v, ok := s.get(args[1])
+				reply = "$-1\r\n"
+				if ok {
+					reply = fmt.Sprintf("$%d\r\n%s\r\n", len(v), v)
+				}
+			case args[0] == "SET":
+				s.set(args[1], args[2])
+				reply = "+OK\r\n"
+			case args[0] == "INCR":
+				v, ok := s.incr(args[1])
+				reply = fmt.Sprintf(":%d\r\n", v)
+				if !ok {
+					reply = "-ERR value is not an integer or out of range\r\n"
+				}
+			case args[0] == "DEL":
+				reply = ":0\r\n"
+				if s.del(args[1]) {
+					reply = ":1\r\n"
+				}
+			}
+			conn.Write([]byte(reply))
+		}
+	})
+	return address, s
+}
+
+func startMemcachedServer(t *testing.T) (string, *store) {
+	s := &store{values: map[string]string{}}
+	address := startTCPServer(t, func(conn net.Conn) {
+		r := bufio.NewReader(conn)
+		for {
+			line, err := readLine(r)
+			if err != nil {
+				return
+			}
+			fields := strings.Fields(line)
+
+			reply := "ERROR\r\n"
+			switch fields[0] {
+			case "get":
+				reply = "END\r\n"
+				if v, ok := s.get(fields[1]); ok {
+					reply = fmt.Sprintf("VALUE %s 0 %d\r\n%s\r\nEND\r\n", fields[1], len(v), v)
+				}
+			case "set":
+				n, _ := strconv.Atoi(fields[4])
+				value := make([]byte, n+2)
+				io.ReadFull(r, value)
+				s.set(fields[1], string(value[:n]))
+				reply = "STORED\r\n"
+			case "incr":
+				reply = "NOT_FOUND\r\n"
+				if _, ok := s.get(fields[1]); ok {
+					v, ok := s.incr(fields[1])
+					reply = fmt.Sprintf("%d\r\n", v)
+					if !ok {
+						reply = "CLIENT_ERROR cannot increment or decrement non-numeric value\r\n"
+					}
+				}
+			case "delete":
+				reply = "NOT_FOUND\r\n"
+				if s.del(fields[1]) {
+					reply = "DELETED\r\n"
+				}
+			}
+			conn.Write([]byte(reply))
+		}
+	})
+	return address, s
+}
+
+func TestCacheRedis(t *testing.T) {
+	address, s := startRedisServer(t)
+
+	d, err := New(nil,
+		WithPeakConfig(3, 0, 3),
+		WithCache(&CacheConfig{
+			Protocol: CacheRedis,
+			Address:  address,
+			Password: "secret",
+			Commands: []CacheCommand{
+				{Command: "set", Key: "user:{{vu}}", ValueSize: 10, Weight: 1},
+			},
+		}),
+	)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	d.Run(context.Background(), uuid.New())
+
+	r := d.Report()
+	if r.SucceededRequests != 3 || r.Cache == nil || r.Cache.Commands["SET"] == nil {
+		t.Fatalf("expected 3 successful SET commands, got %+v", r)
+	}
+	if v, _ := s.get("user:2"); v != strings.Repeat("x", 10) {
+		t.Errorf("expected a 10 byte value to be set, got %q", v)
+	}
+	if set := r.Cache.Commands["SET"]; set.Calls != 3 || set.ErrorRate != 0 || set.P99Latency <= 0 {
+		t.Errorf("unexpected SET report %+v", set)
+	}
+}
+
+func TestCacheCommands(t *testing.T) {
+	redis, redisStore := startRedisServer(t)
+	memcached, memcachedStore := startMemcachedServer(t)
+	redisStore.set("counter", "1")
+	redisStore.set("name", "cache")
+	memcachedStore.set("counter", "1")
+	memcachedStore.set("name", "cache")
+
+	tests := []struct {
+		protocol string
+		address  string
+		password string
+		command  CacheCommand
+		category string
+		miss     bool
+	}{
+		{CacheRedis, redis, "secret", CacheCommand{Command: "GET", Key: "name"}, "", false},
+		{CacheRedis, redis, "secret", CacheCommand{Command: "GET", Key: "missing"}, "", true},
+		{CacheRedis, redis, "secret", CacheCommand{Command: "INCR", Key: "counter"}, "", false},
+		{CacheRedis, redis, "secret", CacheCommand{Command: "INCR", Key: "name"}, ErrorCacheServer, false},
+		{CacheRedis, redis, "secret", CacheCommand{Command: "DEL", Key: "missing"}, "", true},
+		{CacheRedis, redis, "", CacheCommand{Command: "GET", Key: "name"}, ErrorCacheServer, false},
+		{CacheRedis, redis, "wrong", CacheCommand{Command: "GET", Key: "name"}, ErrorCacheServer, false},
+		{CacheMemcached, memcached, "", CacheCommand{Command: "GET", Key: "name"}, "", false},
+		{CacheMemcached, memcached, "", CacheCommand{Command: "GET", Key: "missing"}, "", true},
+		{CacheMemcached, memcached, "", CacheCommand{Command: "SET", Key: "key{{random}}", TTLInSeconds: 60}, "", false},
+		{CacheMemcached, memcached, "", CacheCommand{Command: "INCR", Key: "counter"}, "", false},
+		{CacheMemcached, memcached, "", CacheCommand{Command: "INCR", Key: "missing"}, "", true},
+		{CacheMemcached, memcached, "", CacheCommand{Command: "INCR", Key: "name"}, ErrorCacheServer, false},
+		{CacheMemcached, memcached, "", CacheCommand{Command: "DEL", Key: "name"}, "", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.protocol+" "+tt.command.Command+" "+tt.command.Key, func(t *testing.T) {
+			stats := &cacheStats{}
+			c, err := newCacheClient(&CacheConfig{
+				Protocol: tt.protocol,
+				Address:  tt.address,
+				Password: tt.password,
+				Commands: []CacheCommand{tt.command},
+			}, stats)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			defer c.Close()
+
+			stat := c.call(context.Background(), 1)
+			if stat.IsSuccess != (tt.category == "") || stat.ErrorCategory != tt.category {
+				t.Errorf("expected error category %q, got %+v", tt.category, stat)
+			}
+			report := stats.report().Commands[tt.command.Command]
+			if (report.Misses == 1) != tt.miss {
+				t.Errorf("expected miss %v, got %+v", tt.miss, report)
+			}
+		})
+	}
+	if v, _ := redisStore.get("counter"); v != "2" {
+		t.Errorf("expected the redis counter to be incremented, got %q", v)
+	}
+}
+
+func TestValidateCache(t *testing.T) {
+	command := []CacheCommand{{Command: "GET", Key: "k"}}
+	configs := []CacheConfig{
+		{Protocol: "mongo", Address: "localhost:1", Commands: command},
+		{Protocol: CacheRedis, Address: "localhost", Commands: command},
+		{Protocol: CacheRedis, Address: "localhost:1"},
+		{Protocol: CacheMemcached, Address: "localhost:1", Password: "secret", Commands: command},
+		{Protocol: CacheRedis, Address: "localhost:1", Commands: []CacheCommand{{Command: "FLUSHALL", Key: "k"}}},
+		{Protocol: CacheRedis, Address: "localhost:1", Commands: []CacheCommand{{Command: "GET", Key: "a b"}}},
+		{Protocol: CacheRedis, Address: "localhost:1", Commands: []CacheCommand{{Command: "SET", Key: "k", ValueSize: -1}}},
+	}
+	for _, c := range configs {
+		if err := ValidateCache(&c); err == nil {
+			t.Errorf("expected an error for %+v", c)
+		}
+	}
+}
@@ -0,0 +1,459 @@
+package tester
+
+import (
+	"bufio"
+	"context"
+	"crypto/tls"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math/rand"
+	"net"
+	"os"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"golang.org/x/net/dns/dnsmessage"
+)
+
+const (
+	DNSOverUDP = "udp"
+	DNSOverTCP = "tcp"
+	DNSOverTLS = "dot"
+
+	defaultDNSTimeout = 2 * time.Second
+)
+
+var dnsTypes = map[string]dnsmessage.Type{
+	"A":     dnsmessage.TypeA,
+	"NS":    dnsmessage.TypeNS,
+	"CNAME": dnsmessage.TypeCNAME,
+	"SOA":   dnsmessage.TypeSOA,
+	"PTR":   dnsmessage.TypePTR,
+	"MX":    dnsmessage.TypeMX,
+	"TXT":   dnsmessage.TypeTXT,
+	"AAAA":  dnsmessage.TypeAAAA,
+	"SRV":   dnsmessage.TypeSRV,
+	"ANY":   dnsmessage.TypeALL,
+}
+
+var rcodeNames = map[dnsmessage.RCode]string{
+	dnsmessage.RCodeSuccess:        "NOERROR",
+	dnsmessage.RCodeFormatError:    "FORMERR",
+	dnsmessage.RCodeServerFailure:  "SERVFAIL",
+	dnsmessage.RCodeNameError:      "NXDOMAIN",
+	dnsmessage.RCodeNotImplemented: "NOTIMP",
+	dnsmessage.RCodeRefused:        "REFUSED",
+}
+
+// DNSQueryConfig: fires queries at a resolver instead of making HTTP
+// requests, every virtual user sends its queries one after the other
+type DNSQueryConfig struct {
+	// Resolver to query, the port defaults to 53 or 853 for dot
+	Server string `json:"server"`
+	// udp, tcp or dot, defaults to udp
+	Transport string `json:"transport,omitempty"`
+	// Names are fed to the queries in turn, names_file has one per line
+	Names     []string `json:"names,omitempty"`
+	NamesFile string   `json:"names_file,omitempty"`
+	// Record types like A or MX picked at random for every query, defaults to A
+	Types []string `json:"types,omitempty"`
+	// Queries every virtual user sends, defaults to 1
+	QueriesPerUser        int `json:"queries_per_user,omitempty"`
+	TimeoutInMilliseconds int `json:"timeout_in_milliseconds,omitempty"`
+	// Response codes like NOERROR or NXDOMAIN that count as success,
+	// defaults to NOERROR
+	SuccessRCodes      []string `json:"success_rcodes,omitempty"`
+	InsecureSkipVerify bool     `json:"insecure_skip_verify,omitempty"`
+}
+
+type DNSReport struct {
+	Queries          int64   `json:"queries"`
+	QueriesPerSecond float64 `json:"queries_per_second"`
+	Timeouts         int64   `json:"timeouts"`
+	// Answers by response code like NOERROR or SERVFAIL
+	RCodes map[string]int64 `json:"rcodes,omitempty"`
+	// Queries by record type
+	Types map[string]int64 `json:"types,omitempty"`
+}
+
+// Option fn to query a DNS server instead of making HTTP requests
+func WithDNSQueries(c *DNSQueryConfig) Option {
+	return withBuiltin(ProtocolDNS, c)
+}
+
+// feeder: hands out values in turn across all the virtual users
+type feeder struct {
+	values []string
+	next   atomic.Uint64
+}
+
+func (f *feeder) value() string {
+	return f.values[(f.next.Add(1)-1)%uint64(len(f.values))]
+}
+
+// Values of a file with one per line, empty lines and # comments are skipped
+func readLines(path string) ([]string, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	values := []string{}
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		values = append(values, line)
+	}
+	return values, scanner.Err()
+}
+
+// ValidateDNSQueries: reports configs the queries can't be sent with, the
+// names file is read when the tester is created
+func ValidateDNSQueries(c *DNSQueryConfig) error {
+	if c.Server == "" {
+		return errors.New("dns server is required")
+	}
+	switch c.Transport {
+	case "", DNSOverUDP, DNSOverTCP, DNSOverTLS:
+	default:
+		return fmt.Errorf("unknown dns transport %q, expected udp, tcp or dot", c.Transport)
+	}
+	if len(c.Names) == 0 && c.NamesFile == "" {
+		return errors.New("dns queries need names or a names_file")
+	}
+	for _, name := range c.Names {
+		if _, err := dnsmessage.NewName(fqdn(name)); err != nil {
+			return fmt.Errorf("invalid dns name %q", name)
+		}
+	}
+	for _, t := range c.Types {
+		if _, ok := dnsTypes[strings.ToUpper(t)]; !ok {
+			return fmt.Errorf("unknown dns record type %q", t)
+		}
+	}
+	for _, r := range c.SuccessRCodes {
+		if _, ok := rcodeOf(r); !ok {
+			return fmt.Errorf("unknown dns response code %q", r)
+		}
+	}
+	if c.QueriesPerUser < 0 || c.TimeoutInMilliseconds < 0 {
+		return errors.New("dns queries_per_user and timeout can't be negative")
+	}
+	return nil
+}
+
+func fqdn(name string) string {
+	if strings.HasSuffix(name, ".") {
+		return name
+	}
+	return name + "."
+}
+
+func rcodeOf(name string) (dnsmessage.RCode, bool) {
+	for code, n := range rcodeNames {
+		if strings.EqualFold(n, name) {
+			return code, true
+		}
+	}
+	return 0, false
+}
+
+func rcodeName(code dnsmessage.RCode) string {
+	if name, ok := rcodeNames[code]; ok {
+		return name
+	}
+	return fmt.Sprintf("RCODE%d", code)
+}
+
+type dnsClient struct {
+	config         *DNSQueryConfig
+	server         string
+	names          *feeder
+	types          []string
+	timeout        time.Duration
+	success        map[dnsmessage.RCode]bool
+	queriesPerUser int
+	stats          *dnsStats
+}
+
+func newDNSClient(c *DNSQueryConfig, stats *dnsStats) (*dnsClient, error) {
+	err := ValidateDNSQueries(c)
+	if err != nil {
+		return nil, err
+	}
+
+	names := append([]string(nil), c.Names...)
+	if c.NamesFile != "" {
+		lines, err := readLines(c.NamesFile)
+		if err != nil {
+			return nil, err
+		}
+		for _, name := range lines {
+			if _, err := dnsmessage.NewName(fqdn(name)); err != nil {
+				return nil, fmt.Errorf("invalid dns name %q in %s", name, c.NamesFile)
+			}
+		}
+		names = append(names, lines...)
+	}
+	if len(names) == 0 {
+		return nil, fmt.Errorf("no names in %s", c.NamesFile)
+	}
+
+	d := &dnsClient{
+		config:         c,
+		server:         c.Server,
+		names:          &feeder{values: names},
+		types:          []string{"A"},
+		timeout:        defaultDNSTimeout,
+		success:        map[dnsmessage.RCode]bool{},
+		queriesPerUser: 1,
+		stats:          stats,
+	}
+	if _, _, err := net.SplitHostPort(c.Server); err != nil {
+		port := "53"
+		if c.Transport == DNSOverTLS {
+			port = "853"
+		}
+		d.server = net.JoinHostPort(strings.Trim(c.Server, "[]"), port)
+	}
+	if len(c.Types) > 0 {
+		d.types = nil
+		for _, t := range c.Types {
+			d.types = append(d.types, strings.ToUpper(t))
+		}
+	}
+	if c.TimeoutInMilliseconds > 0 {
+		d.timeout = time.Duration(c.TimeoutInMilliseconds) * time.Millisecond
+	}
+	if c.QueriesPerUser > 0 {
+		d.queriesPerUser = c.QueriesPerUser
+	}
+	if len(c.SuccessRCodes) == 0 {
+		d.success[dnsmessage.RCodeSuccess] = true
+	}
+	for _, r := range c.SuccessRCodes {
+		code, _ := rcodeOf(r)
+		d.success[code] = true
+	}
+	return d, nil
+}
+
+// Sends a query for the next name, the time taken covers the connect on
+// tcp and dot as a resolver client would see it
+func (d *dnsClient) call(ctx context.Context, vu int) *RequestStat {
+	name := fqdn(d.names.value())
+	kind := d.types[rand.Intn(len(d.types))]
+	stat := &RequestStat{Endpoint: "dns " + kind}
+
+	id := uint16(rand.Intn(1 << 16))
+	query, err := buildQuery(id, name, dnsTypes[kind])
+	if err != nil {
+		stat.ErrorCategory = categorizeError(err)
+		return stat
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, d.timeout)
+	defer cancel()
+
+	start := time.Now()
+	response, sent, received, err := d.exchange(ctx, id, query)
+	stat.TimeTakenInSeconds = time.Since(start).Seconds()
+	stat.BytesSent = sent
+	stat.BytesReceived = received
+	stat.BytesReceivedUncompressed = received
+
+	if err != nil {
+		stat.ErrorCategory = categorizeError(err)
+		d.stats.record(kind, "", stat.ErrorCategory == ErrorTimeout)
+		return stat
+	}
+	rcode := rcodeName(response.RCode)
+	d.stats.record(kind, rcode, false)
+	stat.IsSuccess = d.success[response.RCode]
+	if !stat.IsSuccess {
+		stat.ErrorCategory = "dns_" + strings.ToLower(rcode)
+	}
+	return stat
+}
+
+func (d *dnsClient) Prepare(ctx context.Context) error {
+	return nil
+}
+
+// Sends the queries of the virtual user one after the other
+func (d *dnsClient) Execute(ctx context.Context, vu int, record func(*RequestStat)) {
+	for i := 0; i < d.queriesPerUser && ctx.Err() == nil; i++ {
+		record(d.call(ctx, vu))
+	}
+}
+
+func (d *dnsClient) Close() error {
+	return nil
+}
+
+func (d *dnsClient) AddToReport(r *Report, elapsed time.Duration) {
+	r.DNS = d.stats.report(elapsed)
+}
+
+func buildQuery(id uint16, name string, kind dnsmessage.Type) ([]byte, error) {
+	n, err := dnsmessage.NewName(name)
+	if err != nil {
+		return nil, err
+	}
+	b := dnsmessage.NewBuilder(nil, dnsmessage.Header{ID: id, RecursionDesired: true})
+	b.EnableCompression()
+	err = b.StartQuestions()
+	if err != nil {
+		return nil, err
+	}
+	err = b.Question(dnsmessage.Question{Name: n, Type: kind, Class: dnsmessage.ClassINET})
+	if err != nil {
+		return nil, err
+	}
+	return b.Finish()
+}
+
+func (d *dnsClient) exchange(ctx context.Context, id uint16, query []byte) (*dnsmessage.Header, int64, int64, error) {
+	network := "udp"
+	if d.config.Transport == DNSOverTCP || d.config.Transport == DNSOverTLS {
+		network = "tcp"
+	}
+
+	var (
+		conn net.Conn
+		err  error
+	)
+	if d.config.Transport == DNSOverTLS {
+		host, _, _ := net.SplitHostPort(d.server)
+		dialer := &tls.Dialer{Config: &tls.Config{
+			ServerName:         host,
+			InsecureSkipVerify: d.config.InsecureSkipVerify,
+		}}
+		conn, err = dialer.DialContext(ctx, network, d.server)
+	} else {
+		conn, err = (&net.Dialer{}).DialContext(ctx, network, d.server)
+	}
+	if err != nil {
+		return nil, 0, 0, err
+	}
+	defer conn.Close()
+	deadline, _ := ctx.Deadline()
+	conn.SetDeadline(deadline)
+
+	if network == "udp" {
+		return exchangeUDP(conn, id, query)
+	}
+	return exchangeStream(conn, id, query)
+}
+
+// Answers to other ids are stale replies of earlier queries and skipped
+func exchangeUDP(conn net.Conn, id uint16, query []byte) (*dnsmessage.Header, int64, int64, error) {
+	_, err := conn.Write(query)
+	if err != nil {
+		return nil, 0, 0, err
+	}
+	sent := int64(len(query))
+
+	received := int64(0)
+	buffer := make([]byte, maxDatagram)
+	for {
+		n, err := conn.Read(buffer)
+		if err != nil {
+			return nil, sent, received, err
+		}
+		received += int64(n)
+		h, err := parseHeader(buffer[:n])
+		if err == nil && h.ID == id {
+			return h, sent, received, nil
+		}
+	}
+}
+
+// Messages over tcp and dot are prefixed with their length
+func exchangeStream(conn net.Conn, id uint16, query []byte) (*dnsmessage.Header, int64, int64, error) {
+	framed := binary.BigEndian.AppendUint16(nil, uint16(len(query)))
+	framed = append(framed, query...)
+	_, err := conn.Write(framed)
+	if err != nil {
+		return nil, 0, 0, err
+	}
+	sent := int64(len(framed))
+
+	var length [2]byte
+	_, err = io.ReadFull(conn, length[:])
+	if err != nil {
+		return nil, sent, 0, err
+	}
+	message := make([]byte, binary.BigEndian.Uint16(length[:]))
+	_, err = io.ReadFull(conn, message)
+	received := int64(len(message) + 2)
+	if err != nil {
+		return nil, sent, received, err
+	}
+	h, err := parseHeader(message)
+	if err != nil {
+		return nil, sent, received, err
+	}
+	if h.ID != id {
+		return nil, sent, received, fmt.Errorf("dns answer id %d doesn't match the query id %d", h.ID, id)
+	}
+	return h, sent, received, nil
+}
+
+func parseHeader(message []byte) (*dnsmessage.Header, error) {
+	var p dnsmessage.Parser
+	h, err := p.Start(message)
+	if err != nil {
+		return nil, err
+	}
+	return &h, nil
+}
+
+type dnsStats struct {
+	mu       sync.Mutex
+	queries  int64
+	timeouts int64
+	rcodes   map[string]int64
+	types    map[string]int64
+}
+
+func (s *dnsStats) record(kind string, rcode string, timeout bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.rcodes == nil {
+		s.rcodes = map[string]int64{}
+		s.types = map[string]int64{}
+	}
+	s.queries++
+	s.types[kind]++
+	if rcode != "" {
+		s.rcodes[rcode]++
+	}
+	if timeout {
+		s.timeouts++
+	}
+}
+
+func (s *dnsStats) report(elapsed time.Duration) *DNSReport {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	r := &DNSReport{
+		Queries:  s.queries,
+		Timeouts: s.timeouts,
+		RCodes:   s.rcodes,
+		Types:    s.types,
+	}
+	if elapsed > 0 {
+		r.QueriesPerSecond = float64(s.queries) / elapsed.Seconds()
+	}
+	return r
+}
@@ -0,0 +1,190 @@
+package tester
+
+import (
+	"context"
+	"crypto/tls"
+	"encoding/binary"
+	"io"
+	"net"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/google/uuid"
+	"golang.org/x/net/dns/dnsmessage"
+)
+
+// Answers A queries with 127.0.0.1, missing.test. with NXDOMAIN and never
+// answers slow.test.
+func answer(query []byte) []byte {
+	var p dnsmessage.Parser
+	h, err := p.Start(query)
+	if err != nil {
+		return nil
+	}
+	q, err := p.Question()
+	if err != nil || q.Name.String() == "slow.test." {
+		return nil
+	}
+
+	header := dnsmessage.Header{ID: h.ID, Response: true, RecursionDesired: h.RecursionDesired}
+	if q.Name.String() == "missing.test." {
+		header.RCode = dnsmessage.RCodeNameError
+	}
+	b := dnsmessage.NewBuilder(nil, header)
+	b.StartQuestions()
+	b.Question(q)
+	b.StartAnswers()
+	if header.RCode == dnsmessage.RCodeSuccess && q.Type == dnsmessage.TypeA {
+		b.AResource(dnsmessage.ResourceHeader{Name: q.Name, Class: dnsmessage.ClassINET, TTL: 60},
+			dnsmessage.AResource{A: [4]byte{127, 0, 0, 1}})
+	}
+	message, _ := b.Finish()
+	return message
+}
+
+func startDNSServer(t *testing.T) string {
+	t.Helper()
+	udp, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("unable to listen: %v", err)
+	}
+	t.Cleanup(func() { udp.Close() })
+	go func() {
+		buffer := make([]byte, maxDatagram)
+		for {
+			n, addr, err := udp.ReadFrom(buffer)
+			if err != nil {
+				return
+			}
+			if message := answer(buffer[:n]); message != nil {
+				udp.WriteTo(message, addr)
+			}
+		}
+	}()
+	return udp.LocalAddr().String()
+}
+
+// Serves length prefixed queries on the listener, as tcp and dot do
+func serveDNSStream(t *testing.T, listener net.Listener) string {
+	t.Cleanup(func() { listener.Close() })
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer conn.Close()
+				var length [2]byte
+				if _, err := io.ReadFull(conn, length[:]); err != nil {
+					return
+				}
+				query := make([]byte, binary.BigEndian.Uint16(length[:]))
+				if _, err := io.ReadFull(conn, query); err != nil {
+					return
+				}
+				message := answer(query)
+				if message == nil {
+					io.Copy(io.Discard, conn)
+					return
+				}
+				conn.Write(append(binary.BigEndian.AppendUint16(nil, uint16(len(message))), message...))
+			}()
+		}
+	}()
+	return listener.Addr().String()
+}
+
+func TestDNSQueries(t *testing.T) {
+	server := startDNSServer(t)
+	names := filepath.Join(t.TempDir(), "names.txt")
+	os.WriteFile(names, []byte("# hosts\nexample.test\n\nmissing.test\n"), 0o644)
+
+	d, err := New(nil,
+		WithPeakConfig(2, 0, 2),
+		WithDNSQueries(&DNSQueryConfig{
+			Server:         server,
+			NamesFile:      names,
+			Types:          []string{"a", "AAAA"},
+			QueriesPerUser: 2,
+		}),
+	)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	d.Run(context.Background(), uuid.New())
+
+	r := d.Report()
+	if r.RequestedDone != 4 || r.SucceededRequests != 2 || r.Errors["dns_nxdomain"] != 2 {
+		t.Fatalf("expected half of 4 queries to be NXDOMAIN, got %+v", r)
+	}
+	if r.DNS == nil || r.DNS.Queries != 4 || r.DNS.RCodes["NOERROR"] != 2 || r.DNS.RCodes["NXDOMAIN"] != 2 {
+		t.Errorf("unexpected dns report %+v", r.DNS)
+	}
+	if r.DNS.Types["A"]+r.DNS.Types["AAAA"] != 4 || r.DNS.QueriesPerSecond <= 0 || r.PeakResponseTime <= 0 {
+		t.Errorf("unexpected dns report %+v", r.DNS)
+	}
+}
+
+func TestDNSTransports(t *testing.T) {
+	udp := startDNSServer(t)
+	listener, _ := net.Listen("tcp", "127.0.0.1:0")
+	tcp := serveDNSStream(t, listener)
+
+	// The certificate of an httptest TLS server is good for 127.0.0.1
+	tlsServer := httptest.NewTLSServer(nil)
+	tlsServer.Close()
+	listener, _ = tls.Listen("tcp", "127.0.0.1:0", tlsServer.TLS)
+	dot := serveDNSStream(t, listener)
+
+	tests := []struct {
+		name     string
+		config   DNSQueryConfig
+		category string
+	}{
+		{"udp", DNSQueryConfig{Server: udp, Names: []string{"example.test"}}, ""},
+		{"tcp", DNSQueryConfig{Server: tcp, Transport: DNSOverTCP, Names: []string{"example.test"}}, ""},
+		{"dot", DNSQueryConfig{Server: dot, Transport: DNSOverTLS, Names: []string{"example.test"},
+			InsecureSkipVerify: true}, ""},
+		{"dot unverified", DNSQueryConfig{Server: dot, Transport: DNSOverTLS, Names: []string{"example.test"}}, ErrorTLS},
+		{"nxdomain allowed", DNSQueryConfig{Server: tcp, Transport: DNSOverTCP, Names: []string{"missing.test"},
+			SuccessRCodes: []string{"NOERROR", "nxdomain"}}, ""},
+		{"udp timeout", DNSQueryConfig{Server: udp, Names: []string{"slow.test"}, TimeoutInMilliseconds: 50}, ErrorTimeout},
+		{"tcp timeout", DNSQueryConfig{Server: tcp, Transport: DNSOverTCP, Names: []string{"slow.test"},
+			TimeoutInMilliseconds: 50}, ErrorTimeout},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			stats := &dnsStats{}
+			c, err := newDNSClient(&tt.config, stats)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			stat := c.call(context.Background(), 1)
+			if stat.IsSuccess != (tt.category == "") || stat.ErrorCategory != tt.category {
+				t.Errorf("expected error category %q, got %+v", tt.category, stat)
+			}
+			if tt.category == ErrorTimeout && stats.report(0).Timeouts != 1 {
+				t.Errorf("expected the timeout to be counted, got %+v", stats.report(0))
+			}
+		})
+	}
+}
+
+func TestValidateDNSQueries(t *testing.T) {
+	configs := []DNSQueryConfig{
+		{Names: []string{"example.test"}},
+		{Server: "127.0.0.1"},
+		{Server: "127.0.0.1", Transport: "doh", Names: []string{"example.test"}},
+		{Server: "127.0.0.1", Names: []string{"example.test"}, Types: []string{"BOGUS"}},
+		{Server: "127.0.0.1", Names: []string{"example.test"}, SuccessRCodes: []string{"OK"}},
+		{Server: "127.0.0.1", Names: []string{"example.test"}, QueriesPerUser: -1},
+	}
+	for _, c := range configs {
+		if err := ValidateDNSQueries(&c); err == nil {
+			t.Errorf("expected an error for %+v", c)
+		}
+	}
+}
@@ -0,0 +1,240 @@
+package tester
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+const (
+	// One row per second of the time series and per endpoint
+	ExportCSV = "csv"
+	// Same rows as CSV, one JSON object per line
+	ExportJSONL = "jsonl"
+	// Thresholds and checks as test cases for CI servers
+	ExportJUnit = "junit"
+)
+
+// ExportFormats: the formats a report can be exported in
+func ExportFormats() []string {
+	return []string{ExportCSV, ExportJSONL, ExportJUnit}
+}
+
+// ExportContentType: content type and file extension of the export format
+func ExportContentType(format string) (string, string) {
+	switch format {
+	case ExportCSV:
+		return "text/csv", "csv"
+	case ExportJSONL:
+		return "application/x-ndjson", "jsonl"
+	case ExportJUnit:
+		return "application/xml", "xml"
+	}
+	return "application/octet-stream", format
+}
+
+// Columns of the CSV export, the type column says whether the row is a
+// second of the time series or an endpoint
+var exportColumns = []string{
+	"type", "second", "endpoint", "requests", "failed_requests",
+	"bytes_sent", "bytes_received", "average_response_time",
+	"average_bytes_sent", "average_bytes_received",
+	"p50_response_time", "p90_response_time", "p99_response_time",
+}
+
+// Export: writes the report in one of the export formats, name is the name
+// of the suite in JUnit XML
+func (r *Report) Export(w io.Writer, format, name string) error {
+	switch format {
+	case ExportCSV:
+		return r.exportCSV(w)
+	case ExportJSONL:
+		return r.exportJSONL(w)
+	case ExportJUnit:
+		return r.exportJUnit(w, name)
+	}
+	return fmt.Errorf("unknown export format %q, expected one of %s",
+		format, strings.Join(ExportFormats(), ", "))
+}
+
+func (r *Report) exportCSV(w io.Writer) error {
+	cw := csv.NewWriter(w)
+	cw.Write(exportColumns)
+
+	for _, p := range r.TimeSeries {
+		cw.Write([]string{
+			"time_series",
+			strconv.Itoa(p.Second),
+			"",
+			strconv.Itoa(int(p.Requests)),
+			strconv.Itoa(int(p.FailedRequests)),
+			strconv.FormatInt(p.BytesSent, 10),
+			strconv.FormatInt(p.BytesReceived, 10),
+			formatFloat(p.AverageResponseTime),
+			"",
+			"",
+			"",
+			"",
+			"",
+		})
+	}
+	for _, name := range r.endpointNames() {
+		e := r.Endpoints[name]
+		cw.Write([]string{
+			"endpoint",
+			"",
+			name,
+			strconv.Itoa(int(e.Requests)),
+			strconv.Itoa(int(e.FailedRequests)),
+			strconv.FormatInt(e.BytesSent, 10),
+			strconv.FormatInt(e.BytesReceived, 10),
+			formatFloat(e.AverageResponseTime),
+			formatFloat(e.AverageBytesSent),
+			formatFloat(e.AverageBytesReceived),
+			formatFloat(e.P50ResponseTime),
+			formatFloat(e.P90ResponseTime),
+			formatFloat(e.P99ResponseTime),
+		})
+	}
+
+	cw.Flush()
+	return cw.Error()
+}
+
+type timeSeriesLine struct {
+	Type string `json:"type"`
+	TimeSeriesPoint
+}
+
+type endpointLine struct {
+	Type     string `json:"type"`
+	Endpoint string `json:"endpoint"`
+	*EndpointReport
+	// Shadows the histogram of the endpoint, the lines only carry the
+	// percentiles
+	Histogram *Histogram `json:"histogram,omitempty"`
+}
+
+func (r *Report) exportJSONL(w io.Writer) error {
+	enc := json.NewEncoder(w)
+	for _, p := range r.TimeSeries {
+		err := enc.Encode(timeSeriesLine{Type: "time_series", TimeSeriesPoint: p})
+		if err != nil {
+			return err
+		}
+	}
+	for _, name := range r.endpointNames() {
+		err := enc.Encode(endpointLine{Type: "endpoint", Endpoint: name, EndpointReport: r.Endpoints[name]})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+type junitTestSuites struct {
+	XMLName xml.Name         `xml:"testsuites"`
+	Suites  []junitTestSuite `xml:"testsuite"`
+}
+
+type junitTestSuite struct {
+	Name     string          `xml:"name,attr"`
+	Tests    int             `xml:"tests,attr"`
+	Failures int             `xml:"failures,attr"`
+	Cases    []junitTestCase `xml:"testcase"`
+}
+
+type junitTestCase struct {
+	ClassName string        `xml:"classname,attr"`
+	Name      string        `xml:"name,attr"`
+	Failure   *junitFailure `xml:"failure,omitempty"`
+}
+
+type junitFailure struct {
+	Message string `xml:"message,attr"`
+}
+
+// Every threshold and check is a test case, a check fails when any of its
+// evaluations failed
+func (r *Report) exportJUnit(w io.Writer, name string) error {
+	if name == "" {
+		name = "load-tester"
+	}
+	suite := junitTestSuite{Name: name, Cases: []junitTestCase{}}
+
+	for _, t := range r.Thresholds {
+		c := junitTestCase{ClassName: "thresholds", Name: t.describe()}
+		if !t.Passed {
+			c.Failure = &junitFailure{Message: fmt.Sprintf("%s was %g", t.Metric, t.Value)}
+		}
+		suite.Cases = append(suite.Cases, c)
+	}
+
+	checks := []string{}
+	for check := range r.Checks {
+		checks = append(checks, check)
+	}
+	sort.Strings(checks)
+	for _, check := range checks {
+		result := r.Checks[check]
+		c := junitTestCase{ClassName: "checks", Name: check}
+		if result.Fails > 0 {
+			c.Failure = &junitFailure{Message: fmt.Sprintf("%d of %d failed",
+				result.Fails, result.Fails+result.Passes)}
+		}
+		suite.Cases = append(suite.Cases, c)
+	}
+
+	suite.Tests = len(suite.Cases)
+	for _, c := range suite.Cases {
+		if c.Failure != nil {
+			suite.Failures++
+		}
+	}
+
+	_, err := io.WriteString(w, xml.Header)
+	if err != nil {
+		return err
+	}
+	enc := xml.NewEncoder(w)
+	enc.Indent("", "  ")
+	err = enc.Encode(junitTestSuites{Suites: []junitTestSuite{suite}})
+	if err != nil {
+		return err
+	}
+	_, err = io.WriteString(w, "\n")
+	return err
+}
+
+// Metric and bounds, like p99 <= 0.5
+func (t *Threshold) describe() string {
+	bounds := []string{}
+	if t.Min != nil {
+		bounds = append(bounds, t.Metric+" >= "+formatFloat(*t.Min))
+	}
+	if t.Max != nil {
+		bounds = append(bounds, t.Metric+" <= "+formatFloat(*t.Max))
+	}
+	if len(bounds) == 0 {
+		return t.Metric
+	}
+	return strings.Join(bounds, " and ")
+}
+
+func (r *Report) endpointNames() []string {
+	names := []string{}
+	for name := range r.Endpoints {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func formatFloat(f float64) string {
+	return strconv.FormatFloat(f, 'f', -1, 64)
+}
@@ -0,0 +1,133 @@
+package tester
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"encoding/xml"
+	"strings"
+	"testing"
+)
+
+func exportedReport() *Report {
+	maxP99, minThroughput := 0.5, 10.0
+	return &Report{
+		TimeSeries: []TimeSeriesPoint{
+			{Second: 0, Requests: 10, FailedRequests: 1, BytesSent: 100, BytesReceived: 200, AverageResponseTime: 0.25},
+			{Second: 1, Requests: 12, AverageResponseTime: 0.5},
+		},
+		Endpoints: map[string]*EndpointReport{
+			"login": {Requests: 11, FailedRequests: 1, AverageResponseTime: 0.3},
+			"GET /api": {Requests: 11, BytesSent: 110, BytesReceived: 5632, AverageResponseTime: 0.4,
+				P50ResponseTime: 0.35, P90ResponseTime: 0.5, P99ResponseTime: 0.9,
+				AverageBytesSent: 10, AverageBytesReceived: 512, Histogram: NewHistogram()},
+		},
+		Checks: map[string]*CheckReport{
+			"status is 200": {Passes: 9, Fails: 1},
+			"has token":     {Passes: 10},
+		},
+		Thresholds: []ThresholdResult{
+			{Threshold: Threshold{Metric: "p99", Max: &maxP99}, Value: 0.7},
+			{Threshold: Threshold{Metric: "throughput", Min: &minThroughput}, Value: 11, Passed: true},
+		},
+	}
+}
+
+func TestExportCSV(t *testing.T) {
+	var out bytes.Buffer
+	err := exportedReport().Export(&out, ExportCSV, "")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	rows, err := csv.NewReader(&out).ReadAll()
+	if err != nil {
+		t.Fatalf("invalid csv: %v", err)
+	}
+	if len(rows) != 5 || strings.Join(rows[0], ",") != strings.Join(exportColumns, ",") {
+		t.Fatalf("expected the header, 2 seconds and 2 endpoints, got %v", rows)
+	}
+	if strings.Join(rows[1], ",") != "time_series,0,,10,1,100,200,0.25,,,,," {
+		t.Errorf("unexpected time series row %v", rows[1])
+	}
+	// Endpoints are sorted by name
+	if strings.Join(rows[3], ",") != "endpoint,,GET /api,11,0,110,5632,0.4,10,512,0.35,0.5,0.9" || rows[4][2] != "login" {
+		t.Errorf("unexpected endpoint rows %v %v", rows[3], rows[4])
+	}
+}
+
+func TestExportJSONL(t *testing.T) {
+	var out bytes.Buffer
+	err := exportedReport().Export(&out, ExportJSONL, "")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	lines := []map[string]interface{}{}
+	scanner := bufio.NewScanner(&out)
+	for scanner.Scan() {
+		line := map[string]interface{}{}
+		err := json.Unmarshal(scanner.Bytes(), &line)
+		if err != nil {
+			t.Fatalf("invalid line %q: %v", scanner.Text(), err)
+		}
+		lines = append(lines, line)
+	}
+	if len(lines) != 4 {
+		t.Fatalf("expected 4 lines, got %d", len(lines))
+	}
+	if lines[1]["type"] != "time_series" || lines[1]["second"] != 1.0 || lines[1]["requests"] != 12.0 {
+		t.Errorf("unexpected time series line %v", lines[1])
+	}
+	if lines[2]["type"] != "endpoint" || lines[2]["endpoint"] != "GET /api" || lines[2]["average_bytes_received"] != 512.0 {
+		t.Errorf("unexpected endpoint line %v", lines[2])
+	}
+	if _, ok := lines[2]["histogram"]; ok || lines[2]["p_99_response_time"] != 0.9 || lines[2]["bytes_received"] != 5632.0 {
+		t.Errorf("expected the percentiles and bytes without the histogram, got %v", lines[2])
+	}
+}
+
+func TestExportJUnit(t *testing.T) {
+	var out bytes.Buffer
+	err := exportedReport().Export(&out, ExportJUnit, "checkout")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	suites := junitTestSuites{}
+	err = xml.Unmarshal(out.Bytes(), &suites)
+	if err != nil {
+		t.Fatalf("invalid xml: %v\n%s", err, out.String())
+	}
+	suite := suites.Suites[0]
+	if suite.Name != "checkout" || suite.Tests != 4 || suite.Failures != 2 {
+		t.Fatalf("expected 4 cases with 2 failures, got %+v", suite)
+	}
+
+	expected := []struct {
+		class, name, failure string
+	}{
+		{"thresholds", "p99 <= 0.5", "p99 was 0.7"},
+		{"thresholds", "throughput >= 10", ""},
+		{"checks", "has token", ""},
+		{"checks", "status is 200", "1 of 10 failed"},
+	}
+	for i, e := range expected {
+		c := suite.Cases[i]
+		failure := ""
+		if c.Failure != nil {
+			failure = c.Failure.Message
+		}
+		if c.ClassName != e.class || c.Name != e.name || failure != e.failure {
+			t.Errorf("expected %+v, got %+v %q", e, c, failure)
+		}
+	}
+}
+
+func TestExportUnknownFormat(t *testing.T) {
+	err := exportedReport().Export(&bytes.Buffer{}, "xlsx", "")
+	if err == nil {
+		t.Error("expected an error for an unknown format")
+	}
+}
@@ -0,0 +1,194 @@
+package tester
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+var (
+	variableName = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+	placeholder  = regexp.MustCompile(`{{\s*([A-Za-z_][A-Za-z0-9_]*)\s*}}`)
+)
+
+// Extract: captures a value of the response into a variable, the later
+// steps of the iteration use it as {{name}}
+type Extract struct {
+	Name string `json:"name"`
+	// Dotted path into a JSON body like data.items.0.id
+	JSONPath string `json:"json_path,omitempty"`
+	// Header to read, the regex applies to its values when both are set
+	Header string `json:"header,omitempty"`
+	// Matched against the body or header, the first capture group is taken
+	// when there is one and the whole match otherwise
+	Regex string `json:"regex,omitempty"`
+
+	re *regexp.Regexp
+}
+
+// ValidateExtract: reports extracts without a name or a single source
+func ValidateExtract(e Extract) error {
+	if !variableName.MatchString(e.Name) {
+		return fmt.Errorf("extract name %q has to be a letter or _ followed by letters, digits or _", e.Name)
+	}
+	if e.JSONPath != "" && (e.Header != "" || e.Regex != "") {
+		return errors.New("extract " + e.Name + " takes either a json_path or a header and regex")
+	}
+	if e.JSONPath == "" && e.Header == "" && e.Regex == "" {
+		return errors.New("extract " + e.Name + " needs a json_path, header or regex")
+	}
+	if e.Regex != "" {
+		if _, err := regexp.Compile(e.Regex); err != nil {
+			return fmt.Errorf("extract %s has an invalid regex: %w", e.Name, err)
+		}
+	}
+	return nil
+}
+
+func (e *Extract) fromBody() bool {
+	return e.Header == ""
+}
+
+func (e *Extract) value(header http.Header, body []byte) (string, bool) {
+	switch {
+	case e.JSONPath != "":
+		return jsonPath(body, e.JSONPath)
+	case e.Header != "" && e.re == nil:
+		v := header.Get(e.Header)
+		return v, v != ""
+	case e.Header != "":
+		for _, v := range header.Values(e.Header) {
+			if m, ok := match(e.re, []byte(v)); ok {
+				return m, true
+			}
+		}
+		return "", false
+	}
+	return match(e.re, body)
+}
+
+func match(re *regexp.Regexp, data []byte) (string, bool) {
+	m := re.FindSubmatch(data)
+	switch {
+	case m == nil:
+		return "", false
+	case len(m) > 1:
+		return string(m[1]), true
+	}
+	return string(m[0]), true
+}
+
+func jsonPath(body []byte, path string) (string, bool) {
+	var doc interface{}
+	d := json.NewDecoder(bytes.NewReader(body))
+	d.UseNumber()
+	if d.Decode(&doc) != nil {
+		return "", false
+	}
+
+	for _, key := range strings.Split(path, ".") {
+		switch v := doc.(type) {
+		case map[string]interface{}:
+			doc = v[key]
+		case []interface{}:
+			i, err := strconv.Atoi(key)
+			if err != nil || i < 0 || i >= len(v) {
+				return "", false
+			}
+			doc = v[i]
+		default:
+			return "", false
+		}
+	}
+
+	switch v := doc.(type) {
+	case nil:
+		return "", false
+	case string:
+		return v, true
+	case json.Number:
+		return v.String(), true
+	case bool:
+		return strconv.FormatBool(v), true
+	}
+	marshalled, _ := json.Marshal(doc)
+	return string(marshalled), true
+}
+
+// Compiles the regexes once so the steps don't on every request
+func (s *Step) compile() error {
+	if s.Stream != nil {
+		err := ValidateStream(s.Stream)
+		if err != nil {
+			return err
+		}
+	}
+	if s.GraphQL != nil {
+		err := s.compileGraphQL()
+		if err != nil {
+			return err
+		}
+	}
+	for i := range s.Extract {
+		err := ValidateExtract(s.Extract[i])
+		if err != nil {
+			return err
+		}
+		if s.Extract[i].Regex != "" {
+			s.Extract[i].re = regexp.MustCompile(s.Extract[i].Regex)
+		}
+	}
+	return nil
+}
+
+// Runs the extracts of the step, variables that aren't found keep the
+// value of an earlier step
+func (s *Step) extract(stat *RequestStat, vars map[string]string) {
+	for i := range s.Extract {
+		e := &s.Extract[i]
+		if v, ok := e.value(stat.header, stat.body); ok {
+			vars[e.Name] = v
+		}
+	}
+}
+
+// Copy of the step with the variables filled in, the name stays the same
+// so the metrics don't split up by value
+func (s *Step) render(vars map[string]string) *Step {
+	if len(vars) == 0 {
+		return s
+	}
+
+	fill := func(text string) string {
+		return placeholder.ReplaceAllStringFunc(text, func(m string) string {
+			if v, ok := vars[placeholder.FindStringSubmatch(m)[1]]; ok {
+				return v
+			}
+			return m
+		})
+	}
+
+	rendered := *s
+	rendered.Name = s.endpoint()
+	rendered.URL = fill(s.URL)
+	if len(s.Body) > 0 {
+		rendered.Body = []byte(fill(string(s.Body)))
+	}
+	if len(s.queryBody) > 0 {
+		rendered.queryBody = []byte(fill(string(s.queryBody)))
+	}
+	if len(s.Headers) > 0 {
+		rendered.Headers = http.Header{}
+		for k, values := range s.Headers {
+			for _, v := range values {
+				rendered.Headers.Add(k, fill(v))
+			}
+		}
+	}
+	return &rendered
+}
@@ -0,0 +1,294 @@
+package tester
+
+import (
+	"errors"
+	"math/rand/v2"
+	"net/http"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Redacted: replaces the values of secrets in captured exchanges and in the
+// definitions shown in reports
+const Redacted = "[REDACTED]"
+
+// Headers redacted whatever their name looks like
+var secretHeaders = []string{
+	"Authorization", "Proxy-Authorization", "Cookie", "Set-Cookie",
+}
+
+// Parts of header and query parameter names that look secret, e.g X-Api-Key
+// or access_token
+var secretHeaderParts = []string{
+	"auth", "token", "secret", "key", "password", "session", "signature",
+}
+
+// FailureCaptureConfig: keeps some of the failing HTTP exchanges of a run to
+// see why the requests failed
+type FailureCaptureConfig struct {
+	// Exchanges kept per error category, sampled over the whole run,
+	// defaults to 5
+	PerCategory int `json:"per_category,omitempty"`
+	// Request and response bodies are cut off after this many bytes,
+	// defaults to 4096
+	MaxBodyBytes int `json:"max_body_bytes,omitempty"`
+	// Headers redacted on top of the ones that look secret
+	RedactHeaders []string `json:"redact_headers,omitempty"`
+}
+
+// Option fn to keep failing exchanges in the report
+func WithFailureCapture(failures *FailureCaptureConfig) Option {
+	return func(c *Spec) {
+		c.FailureCapture = failures
+	}
+}
+
+// ValidateFailureCapture: reports negative limits
+func ValidateFailureCapture(c *FailureCaptureConfig) error {
+	if c.PerCategory < 0 {
+		return errors.New("per_category can't be negative")
+	}
+	if c.MaxBodyBytes < 0 {
+		return errors.New("max_body_bytes can't be negative")
+	}
+	return nil
+}
+
+func (c *FailureCaptureConfig) perCategory() int {
+	if c.PerCategory == 0 {
+		return 5
+	}
+	return c.PerCategory
+}
+
+// FailedExchange: a failing request and the response to it, if any
+type FailedExchange struct {
+	Timestamp time.Time         `json:"timestamp"`
+	VU        int               `json:"vu"`
+	Endpoint  string            `json:"endpoint"`
+	Error     string            `json:"error,omitempty"`
+	Request   CapturedRequest   `json:"request"`
+	Response  *CapturedResponse `json:"response,omitempty"`
+}
+
+type CapturedRequest struct {
+	Method        string      `json:"method"`
+	URL           string      `json:"url"`
+	Headers       http.Header `json:"headers"`
+	Body          string      `json:"body,omitempty"`
+	BodyTruncated bool        `json:"body_truncated,omitempty"`
+}
+
+type CapturedResponse struct {
+	Status        int         `json:"status"`
+	Headers       http.Header `json:"headers"`
+	Body          string      `json:"body,omitempty"`
+	BodyTruncated bool        `json:"body_truncated,omitempty"`
+}
+
+// failureCapture: a reservoir of exchanges per category, so the ones kept
+// are spread over the run instead of being the first to fail
+type failureCapture struct {
+	perCategory  int
+	maxBodyBytes int
+	redact       []string
+
+	mu        sync.Mutex
+	seen      map[string]int
+	exchanges map[string][]*FailedExchange
+}
+
+func newFailureCapture(c *FailureCaptureConfig) *failureCapture {
+	if c == nil {
+		return nil
+	}
+	f := &failureCapture{
+		perCategory:  c.perCategory(),
+		maxBodyBytes: c.MaxBodyBytes,
+		seen:         map[string]int{},
+		exchanges:    map[string][]*FailedExchange{},
+	}
+	if f.maxBodyBytes == 0 {
+		f.maxBodyBytes = 4096
+	}
+	for _, h := range c.RedactHeaders {
+		f.redact = append(f.redact, http.CanonicalHeaderKey(h))
+	}
+	return f
+}
+
+// Category the failure is kept under, the error category when the request
+// errored and the status code otherwise
+func failureCategory(s *RequestStat) string {
+	if s.ErrorCategory != "" {
+		return s.ErrorCategory
+	}
+	if s.StatusCode != 0 {
+		return "status_" + strconv.Itoa(s.StatusCode)
+	}
+	return ErrorOther
+}
+
+// Keeps the exchange of the failed request, res is nil when the request
+// errored before a response
+func (f *failureCapture) record(req *http.Request, body []byte, res *http.Response, s *RequestStat, vu int) {
+	category := failureCategory(s)
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.seen[category]++
+	kept := f.exchanges[category]
+	slot := len(kept)
+	if slot >= f.perCategory {
+		slot = rand.IntN(f.seen[category])
+		if slot >= f.perCategory {
+			return
+		}
+	}
+
+	e := &FailedExchange{
+		Timestamp: s.StartedAt,
+		VU:        vu,
+		Endpoint:  s.Endpoint,
+		Error:     s.errorMessage,
+		Request: CapturedRequest{
+			Method:  req.Method,
+			URL:     redactURL(req.URL),
+			Headers: f.redactHeaders(req.Header),
+		},
+	}
+	if e.Timestamp.IsZero() {
+		e.Timestamp = time.Now()
+	}
+	e.Request.Body, e.Request.BodyTruncated = f.truncate(body)
+	if res != nil {
+		e.Response = &CapturedResponse{
+			Status:  res.StatusCode,
+			Headers: f.redactHeaders(res.Header),
+		}
+		e.Response.Body, e.Response.BodyTruncated = f.truncate(s.body)
+	}
+
+	if slot == len(kept) {
+		f.exchanges[category] = append(kept, e)
+	} else {
+		kept[slot] = e
+	}
+}
+
+func (f *failureCapture) truncate(body []byte) (string, bool) {
+	if len(body) > f.maxBodyBytes {
+		return string(body[:f.maxBodyBytes]), true
+	}
+	return string(body), false
+}
+
+func (f *failureCapture) redactHeaders(h http.Header) http.Header {
+	out := h.Clone()
+	if out == nil {
+		return http.Header{}
+	}
+	for name := range out {
+		if f.secret(name) {
+			out[name] = []string{Redacted}
+		}
+	}
+	return out
+}
+
+func (f *failureCapture) secret(name string) bool {
+	return SecretHeader(name) || slices.Contains(f.redact, http.CanonicalHeaderKey(name))
+}
+
+// SecretHeader: whether the header carries credentials, like Authorization
+// or a name with token or key in it
+func SecretHeader(name string) bool {
+	return slices.Contains(secretHeaders, http.CanonicalHeaderKey(name)) || secretName(name)
+}
+
+func secretName(name string) bool {
+	lower := strings.ToLower(name)
+	for _, part := range secretHeaderParts {
+		if strings.Contains(lower, part) {
+			return true
+		}
+	}
+	return false
+}
+
+// RedactURL: the url with the values of query parameters that look secret
+// and the password of the user info redacted, urls that don't parse are kept
+func RedactURL(raw string) string {
+	u, err := url.Parse(raw)
+	if err != nil {
+		return raw
+	}
+	return redactURL(u)
+}
+
+// Same as RedactURL for a parsed url, which is left as it is
+func redactURL(u *url.URL) string {
+	out := *u
+	if out.RawQuery != "" {
+		params := strings.Split(out.RawQuery, "&")
+		for i, param := range params {
+			raw, _, ok := strings.Cut(param, "=")
+			name, err := url.QueryUnescape(raw)
+			if err != nil {
+				name = raw
+			}
+			if ok && secretName(name) {
+				params[i] = raw + "=" + Redacted
+			}
+		}
+		out.RawQuery = strings.Join(params, "&")
+	}
+	return out.Redacted()
+}
+
+func (f *failureCapture) report() map[string][]*FailedExchange {
+	if f == nil {
+		return nil
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if len(f.exchanges) == 0 {
+		return nil
+	}
+	return f.exchanges
+}
+
+func mergeFailures(merged, r map[string][]*FailedExchange) map[string][]*FailedExchange {
+	for category, exchanges := range r {
+		if merged == nil {
+			merged = map[string][]*FailedExchange{}
+		}
+		merged[category] = append(merged[category], exchanges...)
+	}
+	return merged
+}
+
+// LimitFailures: cuts every category of merged failures down to the
+// exchanges a single run keeps, the ones kept are picked at random so every
+// run the failures came from gets its share
+func LimitFailures(failures map[string][]*FailedExchange, c *FailureCaptureConfig) map[string][]*FailedExchange {
+	if c == nil {
+		return failures
+	}
+	limit := c.perCategory()
+	for category, exchanges := range failures {
+		if len(exchanges) <= limit {
+			continue
+		}
+		kept := slices.Clone(exchanges)
+		rand.Shuffle(len(kept), func(i, j int) { kept[i], kept[j] = kept[j], kept[i] })
+		kept = kept[:limit]
+		slices.SortFunc(kept, func(a, b *FailedExchange) int { return a.Timestamp.Compare(b.Timestamp) })
+		failures[category] = kept
+	}
+	return failures
+}
@@ -0,0 +1,143 @@
+package tester
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"regexp"
+)
+
+// Responses that came back with a non-empty errors array
+const ErrorGraphQL = "graphql_error"
+
+var sha256Hex = regexp.MustCompile(`^[0-9a-f]{64}$`)
+
+// GraphQL: an operation sent as a JSON POST, responses with errors fail even
+// when their status code is a success
+type GraphQL struct {
+	Query         string                 `json:"query,omitempty"`
+	Variables     map[string]interface{} `json:"variables,omitempty"`
+	OperationName string                 `json:"operation_name,omitempty"`
+	// Sends the sha256 hash of the query as an automatic persisted query, the
+	// query follows when the server doesn't know the hash yet
+	Persisted bool `json:"persisted,omitempty"`
+	// Hash of a query the server already has, sent without the query
+	Hash string `json:"hash,omitempty"`
+}
+
+type graphQLResponse struct {
+	Errors []struct {
+		Message    string `json:"message"`
+		Extensions struct {
+			Code string `json:"code"`
+		} `json:"extensions"`
+	} `json:"errors"`
+}
+
+// ValidateGraphQL: reports operations without a query or with a bad hash
+func ValidateGraphQL(g *GraphQL) error {
+	switch {
+	case g.Query == "" && g.Hash == "":
+		return errors.New("graphql needs a query or the hash of a persisted query")
+	case g.Hash != "" && !sha256Hex.MatchString(g.Hash):
+		return errors.New("graphql hash has to be a lowercase hex sha256")
+	case g.Hash != "" && g.Query != "" && g.Hash != queryHash(g.Query):
+		return errors.New("graphql hash doesn't match the query")
+	}
+	return nil
+}
+
+func queryHash(query string) string {
+	sum := sha256.Sum256([]byte(query))
+	return hex.EncodeToString(sum[:])
+}
+
+// Builds the request of the operation, persisted queries go out with the
+// hash alone and keep the body with the query for when the server misses it
+func (s *Step) compileGraphQL() error {
+	g := s.GraphQL
+	err := ValidateGraphQL(g)
+	if err != nil {
+		return err
+	}
+
+	payload := map[string]interface{}{}
+	if len(g.Variables) > 0 {
+		payload["variables"] = g.Variables
+	}
+	if g.OperationName != "" {
+		payload["operationName"] = g.OperationName
+	}
+	if g.Persisted || g.Hash != "" {
+		hash := g.Hash
+		if hash == "" {
+			hash = queryHash(g.Query)
+		}
+		payload["extensions"] = map[string]interface{}{
+			"persistedQuery": map[string]interface{}{"version": 1, "sha256Hash": hash},
+		}
+		s.Body, err = json.Marshal(payload)
+		if err != nil {
+			return err
+		}
+	}
+	if g.Query != "" {
+		payload["query"] = g.Query
+		full, err := json.Marshal(payload)
+		if err != nil {
+			return err
+		}
+		if s.Body == nil {
+			s.Body = full
+		} else {
+			s.queryBody = full
+		}
+	}
+
+	if s.Method == "" {
+		s.Method = http.MethodPost
+	}
+	if s.Headers.Get("Content-Type") == "" {
+		if s.Headers == nil {
+			s.Headers = http.Header{}
+		}
+		s.Headers.Set("Content-Type", "application/json")
+	}
+	// Metrics are reported per operation
+	if s.Name == "" && g.OperationName != "" {
+		s.Name = g.OperationName
+	}
+	return nil
+}
+
+// Fails responses that carry errors
+func (s *Step) checkGraphQL(stat *RequestStat) {
+	if !stat.IsSuccess {
+		return
+	}
+	var res graphQLResponse
+	if json.Unmarshal(stat.body, &res) == nil && len(res.Errors) == 0 {
+		return
+	}
+	stat.IsSuccess = false
+	stat.ErrorCategory = ErrorGraphQL
+}
+
+// The server answered a persisted query it doesn't have the query of
+func (s *Step) persistedQueryNotFound(stat *RequestStat) bool {
+	if s.GraphQL == nil || s.queryBody == nil {
+		return false
+	}
+	var res graphQLResponse
+	if json.Unmarshal(stat.body, &res) != nil {
+		return false
+	}
+	for _, e := range res.Errors {
+		if e.Message == "PersistedQueryNotFound" || e.Extensions.Code == "PERSISTED_QUERY_NOT_FOUND" {
+			return true
+		}
+	}
+	return false
+}
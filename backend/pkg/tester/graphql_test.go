@@ -0,0 +1,116 @@
+package tester
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/google/uuid"
+)
+
+func TestGraphQLOperations(t *testing.T) {
+	var (
+		mu          sync.Mutex
+		queries     = map[string]string{}
+		withQueries int
+	)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req struct {
+			Query      string `json:"query"`
+			Extensions struct {
+				PersistedQuery struct {
+					Hash string `json:"sha256Hash"`
+				} `json:"persistedQuery"`
+			} `json:"extensions"`
+		}
+		json.NewDecoder(r.Body).Decode(&req)
+
+		mu.Lock()
+		defer mu.Unlock()
+		query := req.Query
+		if hash := req.Extensions.PersistedQuery.Hash; hash != "" {
+			if query == "" {
+				query = queries[hash]
+			} else {
+				queries[hash] = query
+			}
+		}
+		if req.Query != "" {
+			withQueries++
+		}
+
+		switch {
+		case query == "":
+			w.Write([]byte(`{"errors": [{"message": "PersistedQueryNotFound"}]}`))
+		case strings.Contains(query, "broken"):
+			w.Write([]byte(`{"data": null, "errors": [{"message": "boom"}]}`))
+		default:
+			w.Write([]byte(`{"data": {"user": {"id": "42"}}}`))
+		}
+	}))
+	defer srv.Close()
+
+	d, err := New(nil,
+		WithPeakConfig(1, 0, 1),
+		WithSteps(
+			Step{URL: srv.URL, GraphQL: &GraphQL{
+				Query:         "query GetUser { user { id } }",
+				OperationName: "GetUser",
+				Persisted:     true,
+			}},
+			Step{URL: srv.URL, GraphQL: &GraphQL{
+				Query:         "query GetUser { user { id } }",
+				OperationName: "GetUser",
+				Persisted:     true,
+			}},
+			Step{URL: srv.URL, GraphQL: &GraphQL{
+				Query:         "query Broken { broken }",
+				OperationName: "Broken",
+			}},
+		),
+	)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	d.Run(context.Background(), uuid.New())
+
+	r := d.Report()
+	if e := r.Endpoints["GetUser"]; e == nil || e.Requests != 2 || e.FailedRequests != 0 {
+		t.Errorf("expected 2 successful GetUser operations, got %+v", e)
+	}
+	if e := r.Endpoints["Broken"]; e == nil || e.Requests != 1 || e.FailedRequests != 1 {
+		t.Errorf("expected the Broken operation to fail, got %+v", e)
+	}
+	if r.Errors[ErrorGraphQL] != 1 {
+		t.Errorf("expected 1 graphql error, got %v", r.Errors)
+	}
+	// The query goes out once to register the hash, then for the plain query
+	if withQueries != 2 {
+		t.Errorf("expected the query to be sent twice, got %d", withQueries)
+	}
+}
+
+func TestValidateGraphQL(t *testing.T) {
+	hash := queryHash("{ ok }")
+	tests := []struct {
+		graphql GraphQL
+		valid   bool
+	}{
+		{GraphQL{Query: "{ ok }"}, true},
+		{GraphQL{Hash: hash}, true},
+		{GraphQL{Query: "{ ok }", Hash: hash}, true},
+		{GraphQL{}, false},
+		{GraphQL{Hash: "abc"}, false},
+		{GraphQL{Query: "{ other }", Hash: hash}, false},
+	}
+	for _, tt := range tests {
+		err := ValidateGraphQL(&tt.graphql)
+		if (err == nil) != tt.valid {
+			t.Errorf("expected valid %v for %+v, got %v", tt.valid, tt.graphql, err)
+		}
+	}
+}
@@ -0,0 +1,365 @@
+package tester
+
+import (
+	"context"
+	"crypto/tls"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+	"unicode"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/metadata"
+	reflectionpb "google.golang.org/grpc/reflection/grpc_reflection_v1"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protodesc"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/reflect/protoregistry"
+	"google.golang.org/protobuf/types/descriptorpb"
+	"google.golang.org/protobuf/types/dynamicpb"
+)
+
+// Time given to server reflection when the tester is created
+const reflectionTimeout = 10 * time.Second
+
+// GRPCConfig: calls a gRPC method instead of making HTTP requests, the
+// schema comes from a protoset file or server reflection
+type GRPCConfig struct {
+	// host:port of the server
+	Target string `json:"target"`
+	// Fully qualified method like helloworld.Greeter/SayHello
+	Method string `json:"method"`
+	// Request message as JSON, client and bidi streaming calls send
+	// Messages instead
+	Message  interface{}       `json:"message,omitempty"`
+	Messages []interface{}     `json:"messages,omitempty"`
+	Metadata map[string]string `json:"metadata,omitempty"`
+	// File descriptor set written by protoc --descriptor_set_out
+	// --include_imports, base64 encoded in JSON and YAML. Server reflection
+	// is used without one
+	Protoset []byte `json:"protoset,omitempty"`
+	// Path of the protoset, only definition files read from disk can point
+	// at one and it's read into Protoset when they're loaded
+	ProtosetFile string `json:"protoset_file,omitempty"`
+
+	TLS                   bool `json:"tls,omitempty"`
+	InsecureSkipVerify    bool `json:"insecure_skip_verify,omitempty"`
+	TimeoutInMilliseconds int  `json:"timeout_in_milliseconds,omitempty"`
+	// Status codes like OK or NOT_FOUND that count as success, defaults to OK
+	SuccessCodes []string `json:"success_codes,omitempty"`
+}
+
+// Option fn to call a gRPC method instead of making HTTP requests
+func WithGRPC(c *GRPCConfig) Option {
+	return withBuiltin(ProtocolGRPC, c)
+}
+
+type grpcClient struct {
+	conn       *grpc.ClientConn
+	method     protoreflect.MethodDescriptor
+	fullMethod string
+	messages   []proto.Message
+	metadata   metadata.MD
+	timeout    time.Duration
+	success    map[codes.Code]bool
+}
+
+func newGRPCClient(c *GRPCConfig) (*grpcClient, error) {
+	if c.Target == "" {
+		return nil, errors.New("grpc target is required")
+	}
+	service, method, ok := strings.Cut(strings.TrimPrefix(c.Method, "/"), "/")
+	if !ok || service == "" || method == "" {
+		return nil, fmt.Errorf("grpc method %q has to look like package.Service/Method", c.Method)
+	}
+
+	creds := insecure.NewCredentials()
+	if c.TLS {
+		creds = credentials.NewTLS(&tls.Config{InsecureSkipVerify: c.InsecureSkipVerify})
+	}
+	conn, err := grpc.NewClient(c.Target, grpc.WithTransportCredentials(creds))
+	if err != nil {
+		return nil, err
+	}
+
+	g := &grpcClient{
+		conn:       conn,
+		fullMethod: "/" + service + "/" + method,
+		metadata:   metadata.New(c.Metadata),
+		timeout:    time.Duration(c.TimeoutInMilliseconds) * time.Millisecond,
+		success:    map[codes.Code]bool{},
+	}
+
+	files, err := g.files(c, service)
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+	g.method, err = findMethod(files, service, method)
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+
+	err = g.buildMessages(c)
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+
+	if len(c.SuccessCodes) == 0 {
+		g.success[codes.OK] = true
+	}
+	for _, name := range c.SuccessCodes {
+		var code codes.Code
+		err := code.UnmarshalJSON([]byte(`"` + strings.ToUpper(name) + `"`))
+		if err != nil {
+			conn.Close()
+			return nil, fmt.Errorf("unknown grpc status code %q", name)
+		}
+		g.success[code] = true
+	}
+	return g, nil
+}
+
+func (g *grpcClient) files(c *GRPCConfig, service string) (*protoregistry.Files, error) {
+	if c.ProtosetFile != "" && len(c.Protoset) == 0 {
+		return nil, errors.New("protoset_file has to be read into protoset")
+	}
+	if len(c.Protoset) > 0 {
+		set := &descriptorpb.FileDescriptorSet{}
+		err := proto.Unmarshal(c.Protoset, set)
+		if err != nil {
+			return nil, fmt.Errorf("invalid protoset: %w", err)
+		}
+		return protodesc.NewFiles(set)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), reflectionTimeout)
+	defer cancel()
+	return reflectFiles(ctx, g.conn, service)
+}
+
+// Asks the server for the file of the service and the files it imports
+func reflectFiles(ctx context.Context, conn *grpc.ClientConn, service string) (*protoregistry.Files, error) {
+	stream, err := reflectionpb.NewServerReflectionClient(conn).ServerReflectionInfo(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("server reflection failed, use a protoset: %w", err)
+	}
+	defer stream.CloseSend()
+
+	set := &descriptorpb.FileDescriptorSet{}
+	seen := map[string]bool{}
+	request := &reflectionpb.ServerReflectionRequest{
+		MessageRequest: &reflectionpb.ServerReflectionRequest_FileContainingSymbol{
+			FileContainingSymbol: service,
+		},
+	}
+	pending := []*reflectionpb.ServerReflectionRequest{request}
+
+	for len(pending) > 0 {
+		err := stream.Send(pending[0])
+		pending = pending[1:]
+		if err != nil {
+			return nil, fmt.Errorf("server reflection failed, use a protoset: %w", err)
+		}
+		res, err := stream.Recv()
+		if err != nil {
+			return nil, fmt.Errorf("server reflection failed, use a protoset: %w", err)
+		}
+		if e := res.GetErrorResponse(); e != nil {
+			return nil, fmt.Errorf("server reflection failed: %s", e.GetErrorMessage())
+		}
+
+		for _, raw := range res.GetFileDescriptorResponse().GetFileDescriptorProto() {
+			file := &descriptorpb.FileDescriptorProto{}
+			err := proto.Unmarshal(raw, file)
+			if err != nil {
+				return nil, err
+			}
+			if seen[file.GetName()] {
+				continue
+			}
+			seen[file.GetName()] = true
+			set.File = append(set.File, file)
+
+			for _, dep := range file.GetDependency() {
+				if seen[dep] {
+					continue
+				}
+				// Well known types are compiled in, no need to ask for them
+				if known, err := protoregistry.GlobalFiles.FindFileByPath(dep); err == nil {
+					seen[dep] = true
+					set.File = append(set.File, protodesc.ToFileDescriptorProto(known))
+					continue
+				}
+				pending = append(pending, &reflectionpb.ServerReflectionRequest{
+					MessageRequest: &reflectionpb.ServerReflectionRequest_FileByFilename{
+						FileByFilename: dep,
+					},
+				})
+			}
+		}
+	}
+	return protodesc.NewFiles(set)
+}
+
+func findMethod(files *protoregistry.Files, service string, method string) (protoreflect.MethodDescriptor, error) {
+	d, err := files.FindDescriptorByName(protoreflect.FullName(service))
+	if err != nil {
+		return nil, fmt.Errorf("grpc service %s not found", service)
+	}
+	s, ok := d.(protoreflect.ServiceDescriptor)
+	if !ok {
+		return nil, fmt.Errorf("%s is not a grpc service", service)
+	}
+	m := s.Methods().ByName(protoreflect.Name(method))
+	if m == nil {
+		return nil, fmt.Errorf("grpc method %s not found on %s", method, service)
+	}
+	return m, nil
+}
+
+// Messages are parsed once, marshalling them for every call only reads them
+func (g *grpcClient) buildMessages(c *GRPCConfig) error {
+	messages := c.Messages
+	if len(messages) == 0 {
+		messages = []interface{}{c.Message}
+	}
+	if !g.method.IsStreamingClient() && len(messages) > 1 {
+		return fmt.Errorf("grpc method %s takes a single message", g.method.FullName())
+	}
+
+	for i, m := range messages {
+		message := dynamicpb.NewMessage(g.method.Input())
+		if m != nil {
+			asJSON, err := json.Marshal(m)
+			if err != nil {
+				return err
+			}
+			err = protojson.Unmarshal(asJSON, message)
+			if err != nil {
+				return fmt.Errorf("grpc message %d doesn't match %s: %w", i, g.method.Input().FullName(), err)
+			}
+		}
+		g.messages = append(g.messages, message)
+	}
+	return nil
+}
+
+func (g *grpcClient) call(ctx context.Context, vu int) *RequestStat {
+	stat := &RequestStat{Endpoint: g.fullMethod}
+
+	ctx = metadata.NewOutgoingContext(ctx, g.metadata)
+	if g.timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, g.timeout)
+		defer cancel()
+	}
+
+	for _, m := range g.messages {
+		stat.BytesSent += int64(proto.Size(m))
+	}
+
+	start := time.Now()
+	var err error
+	if g.method.IsStreamingClient() || g.method.IsStreamingServer() {
+		err = g.stream(ctx, stat)
+	} else {
+		response := dynamicpb.NewMessage(g.method.Output())
+		err = g.conn.Invoke(ctx, g.fullMethod, g.messages[0], response)
+		stat.BytesReceived = int64(proto.Size(response))
+	}
+	stat.TimeTakenInSeconds = time.Since(start).Seconds()
+	stat.BytesReceivedUncompressed = stat.BytesReceived
+
+	code := status.Code(err)
+	stat.GRPCStatus = grpcCodeName(code)
+	stat.IsSuccess = g.success[code]
+	if !stat.IsSuccess {
+		stat.ErrorCategory = grpcErrorCategory(code)
+	}
+	return stat
+}
+
+func (g *grpcClient) stream(ctx context.Context, stat *RequestStat) error {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	stream, err := g.conn.NewStream(ctx, &grpc.StreamDesc{
+		ClientStreams: g.method.IsStreamingClient(),
+		ServerStreams: g.method.IsStreamingServer(),
+	}, g.fullMethod)
+	if err != nil {
+		return err
+	}
+
+	for _, m := range g.messages {
+		err = stream.SendMsg(m)
+		if err != nil {
+			break
+		}
+	}
+	err = stream.CloseSend()
+	if err != nil {
+		return err
+	}
+
+	for {
+		response := dynamicpb.NewMessage(g.method.Output())
+		err = stream.RecvMsg(response)
+		if errors.Is(err, io.EOF) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		stat.BytesReceived += int64(proto.Size(response))
+	}
+}
+
+func (g *grpcClient) Prepare(ctx context.Context) error {
+	return nil
+}
+
+func (g *grpcClient) Execute(ctx context.Context, vu int, record func(*RequestStat)) {
+	record(g.call(ctx, vu))
+}
+
+func (g *grpcClient) Close() error {
+	return g.conn.Close()
+}
+
+// Name of the code as in the gRPC spec, e.g NOT_FOUND
+func grpcCodeName(code codes.Code) string {
+	name := []rune{}
+	previous := ' '
+	for _, r := range code.String() {
+		if unicode.IsUpper(r) && unicode.IsLower(previous) {
+			name = append(name, '_')
+		}
+		name = append(name, unicode.ToUpper(r))
+		previous = r
+	}
+	return string(name)
+}
+
+// Transport failures fall into the usual categories, other codes are
+// reported under their own name
+func grpcErrorCategory(code codes.Code) string {
+	switch code {
+	case codes.DeadlineExceeded:
+		return ErrorTimeout
+	case codes.Unavailable:
+		return ErrorConnectionRefused
+	}
+	return "grpc_" + strings.ToLower(grpcCodeName(code))
+}
@@ -0,0 +1,305 @@
+package tester
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net"
+	"testing"
+
+	"github.com/google/uuid"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/reflection"
+	reflectionpb "google.golang.org/grpc/reflection/grpc_reflection_v1"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protodesc"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/types/descriptorpb"
+	"google.golang.org/protobuf/types/dynamicpb"
+)
+
+// Schema of the stub server, written out by hand so the test doesn't need protoc
+func stubFile() *descriptorpb.FileDescriptorProto {
+	field := func(name string, number int32, kind descriptorpb.FieldDescriptorProto_Type) *descriptorpb.FieldDescriptorProto {
+		return &descriptorpb.FieldDescriptorProto{
+			Name:     proto.String(name),
+			JsonName: proto.String(name),
+			Number:   proto.Int32(number),
+			Label:    descriptorpb.FieldDescriptorProto_LABEL_OPTIONAL.Enum(),
+			Type:     kind.Enum(),
+		}
+	}
+	method := func(name string, clientStreaming bool, serverStreaming bool) *descriptorpb.MethodDescriptorProto {
+		return &descriptorpb.MethodDescriptorProto{
+			Name:            proto.String(name),
+			InputType:       proto.String(".stub.EchoRequest"),
+			OutputType:      proto.String(".stub.EchoReply"),
+			ClientStreaming: proto.Bool(clientStreaming),
+			ServerStreaming: proto.Bool(serverStreaming),
+		}
+	}
+
+	return &descriptorpb.FileDescriptorProto{
+		Name:    proto.String("stub.proto"),
+		Package: proto.String("stub"),
+		Syntax:  proto.String("proto3"),
+		MessageType: []*descriptorpb.DescriptorProto{
+			{
+				Name: proto.String("EchoRequest"),
+				Field: []*descriptorpb.FieldDescriptorProto{
+					field("text", 1, descriptorpb.FieldDescriptorProto_TYPE_STRING),
+					field("repeat", 2, descriptorpb.FieldDescriptorProto_TYPE_INT32),
+				},
+			},
+			{
+				Name: proto.String("EchoReply"),
+				Field: []*descriptorpb.FieldDescriptorProto{
+					field("text", 1, descriptorpb.FieldDescriptorProto_TYPE_STRING),
+				},
+			},
+		},
+		Service: []*descriptorpb.ServiceDescriptorProto{{
+			Name: proto.String("Echo"),
+			Method: []*descriptorpb.MethodDescriptorProto{
+				method("Say", false, false),
+				method("Repeat", false, true),
+				method("Collect", true, false),
+			},
+		}},
+	}
+}
+
+// Starts the stub Echo service with server reflection on a local port
+func startStubServer(t *testing.T) string {
+	t.Helper()
+
+	files, err := protodesc.NewFiles(&descriptorpb.FileDescriptorSet{
+		File: []*descriptorpb.FileDescriptorProto{stubFile()},
+	})
+	if err != nil {
+		t.Fatalf("invalid stub schema: %v", err)
+	}
+	d, _ := files.FindDescriptorByName("stub.Echo")
+	service := d.(protoreflect.ServiceDescriptor)
+	request := service.Methods().ByName("Say").Input()
+	reply := service.Methods().ByName("Say").Output()
+
+	respond := func(text string) *dynamicpb.Message {
+		m := dynamicpb.NewMessage(reply)
+		m.Set(reply.Fields().ByName("text"), protoreflect.ValueOfString(text))
+		return m
+	}
+	text := func(m *dynamicpb.Message) string {
+		return m.Get(request.Fields().ByName("text")).String()
+	}
+
+	srv := grpc.NewServer()
+	srv.RegisterService(&grpc.ServiceDesc{
+		ServiceName: "stub.Echo",
+		HandlerType: (*interface{})(nil),
+		Methods: []grpc.MethodDesc{{
+			MethodName: "Say",
+			Handler: func(_ interface{}, ctx context.Context, dec func(interface{}) error, _ grpc.UnaryServerInterceptor) (interface{}, error) {
+				m := dynamicpb.NewMessage(request)
+				if err := dec(m); err != nil {
+					return nil, err
+				}
+				md, _ := metadata.FromIncomingContext(ctx)
+				if len(md.Get("x-token")) == 0 {
+					return nil, status.Error(codes.Unauthenticated, "missing token")
+				}
+				if text(m) == "missing" {
+					return nil, status.Error(codes.NotFound, "no such text")
+				}
+				return respond(text(m)), nil
+			},
+		}},
+		Streams: []grpc.StreamDesc{
+			{
+				StreamName:    "Repeat",
+				ServerStreams: true,
+				Handler: func(_ interface{}, stream grpc.ServerStream) error {
+					m := dynamicpb.NewMessage(request)
+					if err := stream.RecvMsg(m); err != nil {
+						return err
+					}
+					repeat := m.Get(request.Fields().ByName("repeat")).Int()
+					for i := int64(0); i < repeat; i++ {
+						if err := stream.SendMsg(respond(text(m))); err != nil {
+							return err
+						}
+					}
+					return nil
+				},
+			},
+			{
+				StreamName:    "Collect",
+				ClientStreams: true,
+				Handler: func(_ interface{}, stream grpc.ServerStream) error {
+					joined := ""
+					for {
+						m := dynamicpb.NewMessage(request)
+						err := stream.RecvMsg(m)
+						if errors.Is(err, io.EOF) {
+							return stream.SendMsg(respond(joined))
+						}
+						if err != nil {
+							return err
+						}
+						joined += text(m)
+					}
+				},
+			},
+		},
+	}, struct{}{})
+	reflectionpb.RegisterServerReflectionServer(srv, reflection.NewServerV1(reflection.ServerOptions{
+		Services:           srv,
+		DescriptorResolver: files,
+	}))
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("unable to listen: %v", err)
+	}
+	go srv.Serve(listener)
+	t.Cleanup(srv.Stop)
+	return listener.Addr().String()
+}
+
+func TestGRPCUnaryWithReflection(t *testing.T) {
+	target := startStubServer(t)
+
+	d, err := New(nil,
+		WithPeakConfig(2, 0, 2),
+		WithGRPC(&GRPCConfig{
+			Target:   target,
+			Method:   "stub.Echo/Say",
+			Message:  map[string]interface{}{"text": "hello"},
+			Metadata: map[string]string{"x-token": "secret"},
+		}),
+	)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	d.Run(context.Background(), uuid.New())
+
+	r := d.Report()
+	if r.SucceededRequests != 2 || r.FailedRequests != 0 {
+		t.Fatalf("expected 2 successful calls, got %+v", r)
+	}
+	if r.GRPCStatusCodes["OK"] != 2 {
+		t.Errorf("expected 2 OK status codes, got %v", r.GRPCStatusCodes)
+	}
+	if r.Endpoints["/stub.Echo/Say"] == nil || r.BytesReceived == 0 {
+		t.Errorf("expected metrics for the method, got %v and %d bytes", r.Endpoints, r.BytesReceived)
+	}
+}
+
+func TestGRPCStatusCodes(t *testing.T) {
+	target := startStubServer(t)
+
+	tests := []struct {
+		config     GRPCConfig
+		success    bool
+		statusCode string
+	}{
+		{GRPCConfig{Method: "stub.Echo/Say", Message: map[string]interface{}{"text": "hi"}}, false, "UNAUTHENTICATED"},
+		{GRPCConfig{Method: "stub.Echo/Say", Message: map[string]interface{}{"text": "missing"},
+			Metadata: map[string]string{"x-token": "secret"}}, false, "NOT_FOUND"},
+		{GRPCConfig{Method: "stub.Echo/Say", Message: map[string]interface{}{"text": "missing"},
+			Metadata: map[string]string{"x-token": "secret"}, SuccessCodes: []string{"ok", "not_found"}}, true, "NOT_FOUND"},
+	}
+
+	for _, tt := range tests {
+		tt.config.Target = target
+		g, err := newGRPCClient(&tt.config)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		stat := g.call(context.Background(), 1)
+		g.Close()
+
+		if stat.IsSuccess != tt.success || stat.GRPCStatus != tt.statusCode {
+			t.Errorf("expected success %v with %s, got %+v", tt.success, tt.statusCode, stat)
+		}
+	}
+}
+
+func TestGRPCStreamingWithProtoset(t *testing.T) {
+	target := startStubServer(t)
+
+	set, _ := proto.Marshal(&descriptorpb.FileDescriptorSet{
+		File: []*descriptorpb.FileDescriptorProto{stubFile()},
+	})
+
+	serverStream, err := newGRPCClient(&GRPCConfig{
+		Target:   target,
+		Method:   "stub.Echo/Repeat",
+		Protoset: set,
+		Message:  map[string]interface{}{"text": "abc", "repeat": 3},
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	defer serverStream.Close()
+
+	stat := serverStream.call(context.Background(), 1)
+	if !stat.IsSuccess || stat.BytesReceived != 3*int64(proto.Size(stubReply(t, "abc"))) {
+		t.Errorf("expected 3 replies, got %+v", stat)
+	}
+
+	clientStream, err := newGRPCClient(&GRPCConfig{
+		Target:   target,
+		Method:   "stub.Echo/Collect",
+		Protoset: set,
+		Messages: []interface{}{
+			map[string]interface{}{"text": "ab"},
+			map[string]interface{}{"text": "cd"},
+		},
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	defer clientStream.Close()
+
+	stat = clientStream.call(context.Background(), 1)
+	if !stat.IsSuccess || stat.BytesReceived != int64(proto.Size(stubReply(t, "abcd"))) {
+		t.Errorf("expected the joined reply, got %+v", stat)
+	}
+}
+
+func TestGRPCConfigErrors(t *testing.T) {
+	target := startStubServer(t)
+
+	configs := []GRPCConfig{
+		{Target: target, Method: "stub.Echo"},
+		{Target: target, Method: "stub.Echo/Missing"},
+		{Target: target, Method: "stub.Missing/Say"},
+		{Target: target, Method: "stub.Echo/Say", Message: map[string]interface{}{"unknown": 1}},
+		{Target: target, Method: "stub.Echo/Say", Messages: []interface{}{nil, nil}},
+		{Target: target, Method: "stub.Echo/Say", SuccessCodes: []string{"FINE"}},
+	}
+	for _, c := range configs {
+		if _, err := newGRPCClient(&c); err == nil {
+			t.Errorf("expected an error for %+v", c)
+		}
+	}
+}
+
+func stubReply(t *testing.T, text string) proto.Message {
+	t.Helper()
+	files, _ := protodesc.NewFiles(&descriptorpb.FileDescriptorSet{
+		File: []*descriptorpb.FileDescriptorProto{stubFile()},
+	})
+	d, err := files.FindDescriptorByName("stub.EchoReply")
+	if err != nil {
+		t.Fatal(err)
+	}
+	reply := d.(protoreflect.MessageDescriptor)
+	m := dynamicpb.NewMessage(reply)
+	m.Set(reply.Fields().ByName("text"), protoreflect.ValueOfString(text))
+	return m
+}
@@ -0,0 +1,83 @@
+package tester
+
+import (
+	"math"
+	"sort"
+)
+
+// Every bucket is 1% wider than the previous one which keeps percentiles
+// within 1% of the real value
+const histogramGrowth = 1.01
+
+// Histogram: response times bucketed on a log scale starting at one
+// microsecond, unlike the raw response times it can be merged across runs
+type Histogram struct {
+	Counts map[int]int64 `json:"counts"`
+}
+
+func NewHistogram() *Histogram {
+	return &Histogram{Counts: map[int]int64{}}
+}
+
+func histogramBucket(seconds float64) int {
+	us := seconds * 1e6
+	if us < 1 {
+		return 0
+	}
+	return int(math.Log(us)/math.Log(histogramGrowth)) + 1
+}
+
+// Midpoint of the bucket in seconds
+func histogramValue(bucket int) float64 {
+	if bucket == 0 {
+		return 0
+	}
+	return math.Pow(histogramGrowth, float64(bucket-1)+0.5) / 1e6
+}
+
+func (h *Histogram) Record(seconds float64) {
+	h.Counts[histogramBucket(seconds)]++
+}
+
+func (h *Histogram) Merge(other *Histogram) {
+	if other == nil {
+		return
+	}
+	for b, c := range other.Counts {
+		h.Counts[b] += c
+	}
+}
+
+func (h *Histogram) Count() int64 {
+	total := int64(0)
+	for _, c := range h.Counts {
+		total += c
+	}
+	return total
+}
+
+func (h *Histogram) Percentile(percent float64) float64 {
+	total := h.Count()
+	if total == 0 {
+		return 0
+	}
+
+	buckets := make([]int, 0, len(h.Counts))
+	for b := range h.Counts {
+		buckets = append(buckets, b)
+	}
+	sort.Ints(buckets)
+
+	rank := int64(math.Ceil(percent / 100 * float64(total)))
+	if rank < 1 {
+		rank = 1
+	}
+	seen := int64(0)
+	for _, b := range buckets {
+		seen += h.Counts[b]
+		if seen >= rank {
+			return histogramValue(b)
+		}
+	}
+	return histogramValue(buckets[len(buckets)-1])
+}
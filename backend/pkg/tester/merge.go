@@ -0,0 +1,362 @@
+package tester
+
+import (
+	"math"
+	"sort"
+)
+
+// MergeReports: combines reports of runs that hit the same target at the same
+// time, e.g the shares of a distributed test. Counters are summed, averages
+// are weighted by the number of requests and percentiles come from the merged
+// histograms
+func MergeReports(reports ...*Report) *Report {
+	merged := &Report{Histogram: NewHistogram()}
+
+	responseTime := 0.0
+	timedRequests := int32(0)
+	seconds := map[int]*TimeSeriesPoint{}
+
+	for _, r := range reports {
+		if r == nil {
+			continue
+		}
+
+		// Reports that only carry counters don't count towards the average
+		if r.AverageResponseTime > 0 {
+			responseTime += r.AverageResponseTime * float64(r.RequestedDone)
+			timedRequests += r.RequestedDone
+		}
+		merged.PeakResponseTime = math.Max(merged.PeakResponseTime, r.PeakResponseTime)
+		merged.Throughput += r.Throughput
+		merged.SucceededRequests += r.SucceededRequests
+		merged.FailedRequests += r.FailedRequests
+		merged.RequestedDone += r.RequestedDone
+		merged.Redirects += r.Redirects
+		merged.BytesSent += r.BytesSent
+		merged.BytesReceived += r.BytesReceived
+		merged.BytesReceivedUncompressed += r.BytesReceivedUncompressed
+		merged.SentMBPerSecond += r.SentMBPerSecond
+		merged.ReceivedMBPerSecond += r.ReceivedMBPerSecond
+		merged.Histogram.Merge(r.Histogram)
+
+		merged.Auth = mergeAuthReports(merged.Auth, r.Auth)
+		merged.Retries = mergeRetryReports(merged.Retries, r.Retries)
+		merged.WebSocket = mergeWebSocketReports(merged.WebSocket, r.WebSocket)
+		merged.Stream = mergeStreamReports(merged.Stream, r.Stream)
+		merged.Socket = mergeSocketReports(merged.Socket, r.Socket)
+		merged.DNS = mergeDNSReports(merged.DNS, r.DNS)
+		merged.Cache = mergeCacheReports(merged.Cache, r.Cache)
+		merged.Failures = mergeFailures(merged.Failures, r.Failures)
+
+		for category, count := range r.Errors {
+			if merged.Errors == nil {
+				merged.Errors = map[string]int32{}
+			}
+			merged.Errors[category] += count
+		}
+
+		for code, count := range r.GRPCStatusCodes {
+			if merged.GRPCStatusCodes == nil {
+				merged.GRPCStatusCodes = map[string]int32{}
+			}
+			merged.GRPCStatusCodes[code] += count
+		}
+
+		for name, c := range r.Checks {
+			if merged.Checks == nil {
+				merged.Checks = map[string]*CheckReport{}
+			}
+			m, ok := merged.Checks[name]
+			if !ok {
+				m = &CheckReport{}
+				merged.Checks[name] = m
+			}
+			m.Passes += c.Passes
+			m.Fails += c.Fails
+		}
+
+		for ip, a := range r.Addresses {
+			if merged.Addresses == nil {
+				merged.Addresses = map[string]*AddressReport{}
+			}
+			merged.Addresses[ip] = mergeAddressReports(merged.Addresses[ip], a)
+		}
+
+		for endpoint, e := range r.Endpoints {
+			if merged.Endpoints == nil {
+				merged.Endpoints = map[string]*EndpointReport{}
+			}
+			merged.Endpoints[endpoint] = mergeEndpointReports(merged.Endpoints[endpoint], e)
+		}
+
+		for _, p := range r.TimeSeries {
+			s, ok := seconds[p.Second]
+			if !ok {
+				s = &TimeSeriesPoint{Second: p.Second}
+				seconds[p.Second] = s
+			}
+			s.AverageResponseTime = weightedAverage(s.AverageResponseTime, s.Requests,
+				p.AverageResponseTime, p.Requests)
+			s.Requests += p.Requests
+			s.FailedRequests += p.FailedRequests
+			s.BytesSent += p.BytesSent
+			s.BytesReceived += p.BytesReceived
+		}
+	}
+
+	if timedRequests > 0 {
+		merged.AverageResponseTime = responseTime / float64(timedRequests)
+	}
+	if merged.RequestedDone > 0 {
+		merged.ErrorRate = float64(merged.FailedRequests) / float64(merged.RequestedDone)
+	}
+
+	merged.P50Percentile = merged.Histogram.Percentile(50)
+	merged.P90Percentile = merged.Histogram.Percentile(90)
+	merged.P99Percentile = merged.Histogram.Percentile(99)
+
+	for _, p := range seconds {
+		merged.TimeSeries = append(merged.TimeSeries, *p)
+	}
+	sort.Slice(merged.TimeSeries, func(i, j int) bool {
+		return merged.TimeSeries[i].Second < merged.TimeSeries[j].Second
+	})
+
+	return merged
+}
+
+func weightedAverage(a float64, aCount int32, b float64, bCount int32) float64 {
+	if aCount+bCount == 0 {
+		return 0
+	}
+	return (a*float64(aCount) + b*float64(bCount)) / float64(aCount+bCount)
+}
+
+func mergeAuthReports(a, b *AuthReport) *AuthReport {
+	if a == nil || b == nil {
+		if a == nil {
+			return b
+		}
+		return a
+	}
+	return &AuthReport{
+		TokenAcquisitions:       a.TokenAcquisitions + b.TokenAcquisitions,
+		FailedTokenAcquisitions: a.FailedTokenAcquisitions + b.FailedTokenAcquisitions,
+		AverageTokenAcquisition: weightedAverage(
+			a.AverageTokenAcquisition, a.TokenAcquisitions-a.FailedTokenAcquisitions,
+			b.AverageTokenAcquisition, b.TokenAcquisitions-b.FailedTokenAcquisitions),
+		PeakTokenAcquisitionTime: math.Max(a.PeakTokenAcquisitionTime, b.PeakTokenAcquisitionTime),
+	}
+}
+
+func mergeRetryReports(a, b *RetryReport) *RetryReport {
+	if a == nil || b == nil {
+		if a == nil {
+			return b
+		}
+		return a
+	}
+	return &RetryReport{
+		Retries:             a.Retries + b.Retries,
+		SucceededRetries:    a.SucceededRetries + b.SucceededRetries,
+		FailedRetries:       a.FailedRetries + b.FailedRetries,
+		RecoveredRequests:   a.RecoveredRequests + b.RecoveredRequests,
+		AverageResponseTime: weightedAverage(a.AverageResponseTime, a.Retries, b.AverageResponseTime, b.Retries),
+	}
+}
+
+func mergeWebSocketReports(a, b *WebSocketReport) *WebSocketReport {
+	if a == nil || b == nil {
+		if a == nil {
+			return b
+		}
+		return a
+	}
+	merged := &WebSocketReport{
+		Connections:       a.Connections + b.Connections,
+		FailedConnections: a.FailedConnections + b.FailedConnections,
+		AverageConnectTime: weightedAverage(
+			a.AverageConnectTime, a.Connections-a.FailedConnections,
+			b.AverageConnectTime, b.Connections-b.FailedConnections),
+		PeakConnectTime:           math.Max(a.PeakConnectTime, b.PeakConnectTime),
+		MessagesSent:              a.MessagesSent + b.MessagesSent,
+		MessagesReceived:          a.MessagesReceived + b.MessagesReceived,
+		MessagesSentPerSecond:     a.MessagesSentPerSecond + b.MessagesSentPerSecond,
+		MessagesReceivedPerSecond: a.MessagesReceivedPerSecond + b.MessagesReceivedPerSecond,
+		RoundTrips:                a.RoundTrips + b.RoundTrips,
+		MissingReplies:            a.MissingReplies + b.MissingReplies,
+		UnexpectedDisconnects:     a.UnexpectedDisconnects + b.UnexpectedDisconnects,
+		RoundTripHistogram:        NewHistogram(),
+	}
+	if merged.RoundTrips > 0 {
+		merged.AverageRoundTrip = (a.AverageRoundTrip*float64(a.RoundTrips) +
+			b.AverageRoundTrip*float64(b.RoundTrips)) / float64(merged.RoundTrips)
+	}
+	merged.RoundTripHistogram.Merge(a.RoundTripHistogram)
+	merged.RoundTripHistogram.Merge(b.RoundTripHistogram)
+	merged.P50RoundTrip = merged.RoundTripHistogram.Percentile(50)
+	merged.P90RoundTrip = merged.RoundTripHistogram.Percentile(90)
+	merged.P99RoundTrip = merged.RoundTripHistogram.Percentile(99)
+	return merged
+}
+
+func mergeStreamReports(a, b *StreamReport) *StreamReport {
+	if a == nil || b == nil {
+		if a == nil {
+			return b
+		}
+		return a
+	}
+	interEvents := func(r *StreamReport) int32 {
+		return int32(r.Events) - (r.Streams - r.EmptyStreams)
+	}
+	merged := &StreamReport{
+		Streams:         a.Streams + b.Streams,
+		Events:          a.Events + b.Events,
+		EventsPerSecond: a.EventsPerSecond + b.EventsPerSecond,
+		EmptyStreams:    a.EmptyStreams + b.EmptyStreams,
+		AverageTimeToFirstEvent: weightedAverage(
+			a.AverageTimeToFirstEvent, a.Streams-a.EmptyStreams,
+			b.AverageTimeToFirstEvent, b.Streams-b.EmptyStreams),
+		AverageInterEventLatency: weightedAverage(
+			a.AverageInterEventLatency, interEvents(a),
+			b.AverageInterEventLatency, interEvents(b)),
+		PeakInterEventLatency:      math.Max(a.PeakInterEventLatency, b.PeakInterEventLatency),
+		AverageStreamDuration:      weightedAverage(a.AverageStreamDuration, a.Streams, b.AverageStreamDuration, b.Streams),
+		PeakStreamDuration:         math.Max(a.PeakStreamDuration, b.PeakStreamDuration),
+		TimeToFirstEventHistogram:  NewHistogram(),
+		InterEventLatencyHistogram: NewHistogram(),
+	}
+	merged.TimeToFirstEventHistogram.Merge(a.TimeToFirstEventHistogram)
+	merged.TimeToFirstEventHistogram.Merge(b.TimeToFirstEventHistogram)
+	merged.InterEventLatencyHistogram.Merge(a.InterEventLatencyHistogram)
+	merged.InterEventLatencyHistogram.Merge(b.InterEventLatencyHistogram)
+	merged.setPercentiles()
+	return merged
+}
+
+func mergeSocketReports(a, b *SocketReport) *SocketReport {
+	if a == nil || b == nil {
+		if a == nil {
+			return b
+		}
+		return a
+	}
+	merged := &SocketReport{
+		Connections:       a.Connections + b.Connections,
+		FailedConnections: a.FailedConnections + b.FailedConnections,
+		AverageConnectTime: weightedAverage(
+			a.AverageConnectTime, a.Connections-a.FailedConnections,
+			b.AverageConnectTime, b.Connections-b.FailedConnections),
+		PeakConnectTime:    math.Max(a.PeakConnectTime, b.PeakConnectTime),
+		RoundTrips:         a.RoundTrips + b.RoundTrips,
+		RoundTripHistogram: NewHistogram(),
+	}
+	if merged.RoundTrips > 0 {
+		merged.AverageRoundTrip = (a.AverageRoundTrip*float64(a.RoundTrips) +
+			b.AverageRoundTrip*float64(b.RoundTrips)) / float64(merged.RoundTrips)
+	}
+	merged.RoundTripHistogram.Merge(a.RoundTripHistogram)
+	merged.RoundTripHistogram.Merge(b.RoundTripHistogram)
+	merged.P50RoundTrip = merged.RoundTripHistogram.Percentile(50)
+	merged.P90RoundTrip = merged.RoundTripHistogram.Percentile(90)
+	merged.P99RoundTrip = merged.RoundTripHistogram.Percentile(99)
+	return merged
+}
+
+func mergeDNSReports(a, b *DNSReport) *DNSReport {
+	if a == nil || b == nil {
+		if a == nil {
+			return b
+		}
+		return a
+	}
+	merged := &DNSReport{
+		Queries:          a.Queries + b.Queries,
+		QueriesPerSecond: a.QueriesPerSecond + b.QueriesPerSecond,
+		Timeouts:         a.Timeouts + b.Timeouts,
+	}
+	for _, r := range []*DNSReport{a, b} {
+		for code, count := range r.RCodes {
+			if merged.RCodes == nil {
+				merged.RCodes = map[string]int64{}
+			}
+			merged.RCodes[code] += count
+		}
+		for kind, count := range r.Types {
+			if merged.Types == nil {
+				merged.Types = map[string]int64{}
+			}
+			merged.Types[kind] += count
+		}
+	}
+	return merged
+}
+
+func mergeCacheReports(a, b *CacheReport) *CacheReport {
+	if a == nil || b == nil {
+		if a == nil {
+			return b
+		}
+		return a
+	}
+	merged := &CacheReport{Commands: map[string]*CacheCommandReport{}}
+	for _, r := range []*CacheReport{a, b} {
+		for command, c := range r.Commands {
+			m, ok := merged.Commands[command]
+			if !ok {
+				m = &CacheCommandReport{LatencyHistogram: NewHistogram()}
+				merged.Commands[command] = m
+			}
+			succeeded, other := m.Calls-m.Errors, c.Calls-c.Errors
+			if succeeded+other > 0 {
+				m.AverageLatency = (m.AverageLatency*float64(succeeded) +
+					c.AverageLatency*float64(other)) / float64(succeeded+other)
+			}
+			m.Calls += c.Calls
+			m.Errors += c.Errors
+			m.Misses += c.Misses
+			m.LatencyHistogram.Merge(c.LatencyHistogram)
+		}
+	}
+	for _, m := range merged.Commands {
+		m.setRates()
+	}
+	return merged
+}
+
+func mergeAddressReports(a, b *AddressReport) *AddressReport {
+	if a == nil {
+		copied := *b
+		return &copied
+	}
+	return &AddressReport{
+		Connections:         a.Connections + b.Connections,
+		FailedConnections:   a.FailedConnections + b.FailedConnections,
+		AverageConnectTime:  weightedAverage(a.AverageConnectTime, a.Connections, b.AverageConnectTime, b.Connections),
+		Requests:            a.Requests + b.Requests,
+		FailedRequests:      a.FailedRequests + b.FailedRequests,
+		AverageResponseTime: weightedAverage(a.AverageResponseTime, a.Requests, b.AverageResponseTime, b.Requests),
+	}
+}
+
+func mergeEndpointReports(a, b *EndpointReport) *EndpointReport {
+	if a == nil {
+		copied := *b
+		return &copied
+	}
+	merged := &EndpointReport{
+		Requests:             a.Requests + b.Requests,
+		FailedRequests:       a.FailedRequests + b.FailedRequests,
+		BytesSent:            a.BytesSent + b.BytesSent,
+		BytesReceived:        a.BytesReceived + b.BytesReceived,
+		AverageResponseTime:  weightedAverage(a.AverageResponseTime, a.Requests, b.AverageResponseTime, b.Requests),
+		AverageBytesSent:     weightedAverage(a.AverageBytesSent, a.Requests, b.AverageBytesSent, b.Requests),
+		AverageBytesReceived: weightedAverage(a.AverageBytesReceived, a.Requests, b.AverageBytesReceived, b.Requests),
+		Histogram:            NewHistogram(),
+	}
+	merged.Histogram.Merge(a.Histogram)
+	merged.Histogram.Merge(b.Histogram)
+	merged.setPercentiles()
+	return merged
+}
@@ -0,0 +1,66 @@
+package tester
+
+import (
+	"math"
+	"testing"
+)
+
+func TestMergeReports(t *testing.T) {
+	a := &Report{
+		AverageResponseTime: 1,
+		PeakResponseTime:    2,
+		RequestedDone:       2,
+		SucceededRequests:   2,
+		Histogram:           NewHistogram(),
+		Endpoints:           map[string]*EndpointReport{"GET /": {Requests: 2, BytesSent: 10, AverageResponseTime: 1, Histogram: NewHistogram()}},
+		TimeSeries:          []TimeSeriesPoint{{Second: 0, Requests: 2}},
+	}
+	a.Histogram.Record(0.5)
+	a.Histogram.Record(1.5)
+	a.Endpoints["GET /"].Histogram.Merge(a.Histogram)
+
+	b := &Report{
+		AverageResponseTime: 4,
+		PeakResponseTime:    4,
+		RequestedDone:       2,
+		SucceededRequests:   1,
+		FailedRequests:      1,
+		Histogram:           NewHistogram(),
+		Endpoints:           map[string]*EndpointReport{"GET /": {Requests: 2, BytesSent: 20, AverageResponseTime: 4, Histogram: NewHistogram()}},
+		TimeSeries:          []TimeSeriesPoint{{Second: 0, Requests: 1}, {Second: 1, Requests: 1}},
+	}
+	b.Histogram.Record(4)
+	b.Histogram.Record(4)
+	b.Endpoints["GET /"].Histogram.Merge(b.Histogram)
+
+	// An agent that dropped out and only left its counters behind
+	lost := &Report{RequestedDone: 4, FailedRequests: 4}
+
+	r := MergeReports(a, b, lost)
+
+	if r.RequestedDone != 8 || r.FailedRequests != 5 || r.SucceededRequests != 3 {
+		t.Errorf("unexpected counters: %+v", r)
+	}
+	if r.AverageResponseTime != 2.5 {
+		t.Errorf("expected average response time 2.5, got %f", r.AverageResponseTime)
+	}
+	if r.PeakResponseTime != 4 {
+		t.Errorf("expected peak response time 4, got %f", r.PeakResponseTime)
+	}
+	if r.ErrorRate != 5.0/8 {
+		t.Errorf("expected error rate %f, got %f", 5.0/8, r.ErrorRate)
+	}
+	if math.Abs(r.P50Percentile-1.5) > 0.015 || math.Abs(r.P99Percentile-4) > 0.04 {
+		t.Errorf("unexpected percentiles p50 %f p99 %f", r.P50Percentile, r.P99Percentile)
+	}
+	e := r.Endpoints["GET /"]
+	if e.Requests != 4 || e.AverageResponseTime != 2.5 || e.BytesSent != 30 {
+		t.Errorf("unexpected endpoint report: %+v", e)
+	}
+	if math.Abs(e.P50ResponseTime-1.5) > 0.015 || math.Abs(e.P99ResponseTime-4) > 0.04 {
+		t.Errorf("unexpected endpoint percentiles p50 %f p99 %f", e.P50ResponseTime, e.P99ResponseTime)
+	}
+	if len(r.TimeSeries) != 2 || r.TimeSeries[0].Requests != 3 || r.TimeSeries[1].Requests != 1 {
+		t.Errorf("unexpected time series: %+v", r.TimeSeries)
+	}
+}
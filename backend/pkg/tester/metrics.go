@@ -0,0 +1,231 @@
+package tester
+
+import (
+	"bytes"
+	"compress/gzip"
+	"io"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+)
+
+const bytesInMB = 1024 * 1024
+
+// A second of the test, seconds are counted from the start of the run
+type TimeSeriesPoint struct {
+	Second              int     `json:"second"`
+	Requests            int32   `json:"requests"`
+	FailedRequests      int32   `json:"failed_requests"`
+	BytesSent           int64   `json:"bytes_sent"`
+	BytesReceived       int64   `json:"bytes_received"`
+	AverageResponseTime float64 `json:"average_response_time"`
+}
+
+type EndpointReport struct {
+	Requests             int32   `json:"requests"`
+	FailedRequests       int32   `json:"failed_requests"`
+	BytesSent            int64   `json:"bytes_sent"`
+	BytesReceived        int64   `json:"bytes_received"`
+	AverageResponseTime  float64 `json:"average_response_time"`
+	P50ResponseTime      float64 `json:"p_50_response_time"`
+	P90ResponseTime      float64 `json:"p_90_response_time"`
+	P99ResponseTime      float64 `json:"p_99_response_time"`
+	AverageBytesSent     float64 `json:"average_bytes_sent"`
+	AverageBytesReceived float64 `json:"average_bytes_received"`
+	// Response times of the endpoint, merged across the agents of a
+	// distributed run
+	Histogram *Histogram `json:"histogram,omitempty"`
+}
+
+func (e *EndpointReport) setPercentiles() {
+	e.P50ResponseTime = e.Histogram.Percentile(50)
+	e.P90ResponseTime = e.Histogram.Percentile(90)
+	e.P99ResponseTime = e.Histogram.Percentile(99)
+}
+
+type bucket struct {
+	requests      int32
+	failed        int32
+	bytesSent     int64
+	bytesReceived int64
+	responseTime  float64
+	// Only kept for endpoints
+	responseTimes *Histogram
+}
+
+func (b *bucket) add(s *RequestStat) {
+	b.requests++
+	if !s.IsSuccess {
+		b.failed++
+	}
+	b.bytesSent += s.BytesSent
+	b.bytesReceived += s.BytesReceived
+	b.responseTime += s.TimeTakenInSeconds
+	if b.responseTimes != nil {
+		b.responseTimes.Record(s.TimeTakenInSeconds)
+	}
+}
+
+// metrics: aggregates request stats per second of the run and per endpoint
+type metrics struct {
+	mu        sync.Mutex
+	startedAt time.Time
+	seconds   map[int]*bucket
+	endpoints map[string]*bucket
+}
+
+func newMetrics() *metrics {
+	return &metrics{
+		startedAt: time.Now(),
+		seconds:   map[int]*bucket{},
+		endpoints: map[string]*bucket{},
+	}
+}
+
+func (m *metrics) start() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.startedAt = time.Now()
+}
+
+func (m *metrics) elapsed() time.Duration {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return time.Since(m.startedAt)
+}
+
+func (m *metrics) record(s *RequestStat) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	second := int(time.Since(m.startedAt).Seconds())
+	b, ok := m.seconds[second]
+	if !ok {
+		b = &bucket{}
+		m.seconds[second] = b
+	}
+	b.add(s)
+
+	if s.Endpoint == "" {
+		return
+	}
+	e, ok := m.endpoints[s.Endpoint]
+	if !ok {
+		e = &bucket{responseTimes: NewHistogram()}
+		m.endpoints[s.Endpoint] = e
+	}
+	e.add(s)
+}
+
+func (m *metrics) timeSeries() []TimeSeriesPoint {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	points := make([]TimeSeriesPoint, 0, len(m.seconds))
+	for second, b := range m.seconds {
+		p := TimeSeriesPoint{
+			Second:         second,
+			Requests:       b.requests,
+			FailedRequests: b.failed,
+			BytesSent:      b.bytesSent,
+			BytesReceived:  b.bytesReceived,
+		}
+		if b.requests > 0 {
+			p.AverageResponseTime = b.responseTime / float64(b.requests)
+		}
+		points = append(points, p)
+	}
+	sort.Slice(points, func(i, j int) bool {
+		return points[i].Second < points[j].Second
+	})
+	return points
+}
+
+func (m *metrics) endpointReports() map[string]*EndpointReport {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	reports := map[string]*EndpointReport{}
+	for endpoint, b := range m.endpoints {
+		if b.requests == 0 {
+			continue
+		}
+		r := &EndpointReport{
+			Requests:             b.requests,
+			FailedRequests:       b.failed,
+			BytesSent:            b.bytesSent,
+			BytesReceived:        b.bytesReceived,
+			AverageResponseTime:  b.responseTime / float64(b.requests),
+			AverageBytesSent:     float64(b.bytesSent) / float64(b.requests),
+			AverageBytesReceived: float64(b.bytesReceived) / float64(b.requests),
+			Histogram:            b.responseTimes,
+		}
+		r.setPercentiles()
+		reports[endpoint] = r
+	}
+	return reports
+}
+
+// Size of the request line, HTTP/2 frames the same data with HPACK so the
+// sizes there are an upper bound
+func requestLineSize(req *http.Request) int64 {
+	// METHOD SP URI SP HTTP/1.1 CRLF
+	return int64(len(req.Method) + len(req.URL.RequestURI()) + len(" HTTP/1.1\r\n") + 1)
+}
+
+func responseHeaderSize(res *http.Response) int64 {
+	// PROTO SP STATUS CRLF, then the headers and the blank line
+	size := len(res.Proto) + 1 + len(res.Status) + 2
+	for k, vs := range res.Header {
+		for _, v := range vs {
+			size += len(k) + len(": ") + len(v) + 2
+		}
+	}
+	return int64(size + 2)
+}
+
+type countingReader struct {
+	r io.Reader
+	n int64
+}
+
+func (c *countingReader) Read(p []byte) (int, error) {
+	n, err := c.r.Read(p)
+	c.n += int64(n)
+	return n, err
+}
+
+// Reads the body as per the config and returns the bytes as received on the
+// wire and after decoding gzip, the decoded body is copied into keep when asked
+// or when bodies are read whole
+func readBody(c *ResponseBodyConfig, res *http.Response, keep *[]byte, keepBody bool) (int64, int64, error) {
+	wire := &countingReader{r: res.Body}
+
+	var body io.Reader = wire
+	if res.Header.Get("Content-Encoding") == "gzip" && !res.Uncompressed {
+		gz, err := gzip.NewReader(wire)
+		if err != nil {
+			return wire.n, wire.n, err
+		}
+		defer gz.Close()
+		body = gz
+	}
+
+	if c != nil && c.Mode == BodyRead {
+		b, err := io.ReadAll(body)
+		*keep = b
+		return wire.n, int64(len(b)), err
+	}
+
+	var kept bytes.Buffer
+	if keepBody {
+		body = io.TeeReader(body, &kept)
+	}
+
+	decoded, err := consumeBody(c, body)
+	if keepBody {
+		*keep = kept.Bytes()
+	}
+	return wire.n, decoded, err
+}
@@ -0,0 +1,68 @@
+package tester
+
+import (
+	"compress/gzip"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestBandwidthMetrics(t *testing.T) {
+	payload := strings.Repeat("load tester ", 1000)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Accept-Encoding") != "gzip" {
+			w.Write([]byte(payload))
+			return
+		}
+		w.Header().Set("Content-Encoding", "gzip")
+		gz := gzip.NewWriter(w)
+		gz.Write([]byte(payload))
+		gz.Close()
+	}))
+	defer server.Close()
+
+	d, err := New(nil,
+		WithPeakConfig(1, 0, 1),
+		WithRequestConfig(server.URL, map[string]string{"key": "value"}),
+	)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	for i := 0; i < 2; i++ {
+		d.doRequestAndReturnStatsDriver(context.Background(), 1)
+	}
+
+	r := d.computeReport()
+	if r.BytesSent <= int64(2*len(`{"key":"value"}`)) {
+		t.Errorf("expected headers and body to be counted as sent, got %d", r.BytesSent)
+	}
+	if r.BytesReceivedUncompressed <= int64(2*len(payload)) {
+		t.Errorf("expected at least the decoded payload to be received, got %d", r.BytesReceivedUncompressed)
+	}
+	if r.BytesReceived >= r.BytesReceivedUncompressed {
+		t.Errorf("expected compressed bytes %d to be less than uncompressed %d",
+			r.BytesReceived, r.BytesReceivedUncompressed)
+	}
+
+	endpoint, ok := r.Endpoints["GET "+server.URL]
+	if !ok || endpoint.Requests != 2 {
+		t.Fatalf("unexpected endpoints: %v", r.Endpoints)
+	}
+	if endpoint.AverageBytesReceived != float64(r.BytesReceived)/2 || endpoint.BytesReceived != r.BytesReceived {
+		t.Errorf("unexpected bytes received %d, average %f", endpoint.BytesReceived, endpoint.AverageBytesReceived)
+	}
+	if endpoint.P50ResponseTime <= 0 || endpoint.P99ResponseTime < endpoint.P50ResponseTime {
+		t.Errorf("unexpected percentiles p50 %f p99 %f", endpoint.P50ResponseTime, endpoint.P99ResponseTime)
+	}
+
+	total := int32(0)
+	for _, p := range r.TimeSeries {
+		total += p.Requests
+	}
+	if total != 2 {
+		t.Errorf("expected 2 requests in the time series, got %d", total)
+	}
+}
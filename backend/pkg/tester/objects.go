@@ -1,5 +1,10 @@
 package tester
 
+import (
+	"net/http"
+	"time"
+)
+
 type Report struct {
 	// sum of response time for all requests/total number of requests
 	AverageResponseTime float64 `json:"average_response_time"`
@@ -23,9 +28,123 @@ type Report struct {
 	FailedRequests int32 `json:"failed_requests"`
 
 	RequestedDone int32 `json:"requested_done"`
+
+	// Token fetches and minting, present only when the test uses auth
+	Auth *AuthReport `json:"auth,omitempty"`
+
+	// Per backend address metrics, present only when DNS overrides are used
+	Addresses map[string]*AddressReport `json:"addresses,omitempty"`
+
+	// Redirect hops taken or, when not following, redirect responses seen
+	Redirects int32 `json:"redirects"`
+
+	// Request and response sizes, headers included. Received bytes are as
+	// on the wire, the uncompressed count is after decoding gzip bodies
+	BytesSent                 int64   `json:"bytes_sent"`
+	BytesReceived             int64   `json:"bytes_received"`
+	BytesReceivedUncompressed int64   `json:"bytes_received_uncompressed"`
+	SentMBPerSecond           float64 `json:"sent_mb_per_second"`
+	ReceivedMBPerSecond       float64 `json:"received_mb_per_second"`
+
+	Endpoints  map[string]*EndpointReport `json:"endpoints,omitempty"`
+	TimeSeries []TimeSeriesPoint          `json:"time_series,omitempty"`
+
+	// Request errors by category
+	Errors map[string]int32 `json:"errors,omitempty"`
+
+	// Sampled failing exchanges by error category or status like
+	// status_500, present when failures are captured
+	Failures map[string][]*FailedExchange `json:"failures,omitempty"`
+
+	// Event timings of streaming requests, present when steps stream
+	Stream *StreamReport `json:"stream,omitempty"`
+
+	// Connections, messages and round trips, present for WebSocket tests
+	WebSocket *WebSocketReport `json:"websocket,omitempty"`
+
+	// Connections and round trips, present for TCP and UDP tests
+	Socket *SocketReport `json:"socket,omitempty"`
+
+	// Queries, timeouts and response codes, present for DNS tests
+	DNS *DNSReport `json:"dns,omitempty"`
+
+	// Latency and error rates per command, present for redis and memcached tests
+	Cache *CacheReport `json:"cache,omitempty"`
+
+	// Calls by status code like OK or UNAVAILABLE, present for gRPC tests
+	GRPCStatusCodes map[string]int32 `json:"grpc_status_codes,omitempty"`
+
+	// Retries of failed requests, present only when retries happened
+	Retries *RetryReport `json:"retries,omitempty"`
+
+	// Response times on a log scale, used to merge reports
+	Histogram *Histogram `json:"histogram,omitempty"`
+
+	// Recorded against achieved timing of a replay
+	Replay *ReplayReport `json:"replay,omitempty"`
+
+	// Passes and fails of the checks by name
+	Checks map[string]*CheckReport `json:"checks,omitempty"`
+
+	// Verdicts of the thresholds configured for the test
+	Thresholds []ThresholdResult `json:"thresholds,omitempty"`
+
+	// Agents that ran a share of the test, present for distributed tests
+	Agents []AgentReport `json:"agents,omitempty"`
+	// Users of the agents that were lost, the run fell short of its target
+	// users by as many
+	LostUsers int `json:"lost_users,omitempty"`
+}
+
+type AgentReport struct {
+	Address          string `json:"address"`
+	TargetUsers      int    `json:"target_users"`
+	UsersToStartWith int    `json:"users_to_start_with"`
+	RequestedDone    int32  `json:"requested_done"`
+	// The agent stopped responding before finishing its share, only the
+	// request counts it last reported are part of the report
+	Lost bool `json:"lost"`
 }
 
 type RequestStat struct {
+	// When the request was sent, set on completion to the time it took
+	// before for protocols that don't set it
+	StartedAt          time.Time
 	TimeTakenInSeconds float64
 	IsSuccess          bool
+	// Virtual user that made the request, for replays the concurrency slot
+	// it was sent from, 1 up to the target users
+	VU int
+	// Number of the retry, 0 for the first attempt. Retries only reach the
+	// observers, the report counts them apart from the first attempts
+	Retry int
+	// ip:port of the connection the request went over
+	RemoteAddress string
+	StatusCode    int
+	// Status code name of a gRPC call
+	GRPCStatus string
+	// Set when the request failed with an error instead of a response
+	ErrorCategory string
+	// Name of the step or METHOD URL of the request
+	Endpoint                  string
+	BytesSent                 int64
+	BytesReceived             int64
+	BytesReceivedUncompressed int64
+	// Time spent on the phases of HTTP requests
+	Phases *Phases
+
+	// Error the request failed with, logged with samples
+	errorMessage string
+	// Response headers and the body when a check needs it
+	header http.Header
+	body   []byte
+	// Events read off a streaming response
+	stream *streamResult
+}
+
+// Sets the start of requests whose protocol didn't, from the time they took
+func (s *RequestStat) setStartedAt() {
+	if s.StartedAt.IsZero() {
+		s.StartedAt = time.Now().Add(-time.Duration(s.TimeTakenInSeconds * float64(time.Second)))
+	}
 }
@@ -0,0 +1,142 @@
+package tester
+
+import (
+	"time"
+
+	"github.com/VarthanV/load-tester/pkg/liveupdate"
+	"github.com/google/uuid"
+)
+
+// Stage: where a run is at
+type Stage string
+
+const (
+	// Users are being added until the target is reached
+	StageRampUp Stage = "ramp_up"
+	// Every user was added, the run is over once they are done
+	StagePeak Stage = "peak"
+	// Recorded traffic is being replayed
+	StageReplay Stage = "replay"
+	// The run was cancelled, the users in flight are finishing up
+	StageStopping Stage = "stopping"
+)
+
+// How often observers get a snapshot of the run
+const snapshotInterval = time.Second
+
+// TestStart: what a run starts with
+type TestStart struct {
+	ID uuid.UUID
+	// Users the run ramps up to, or the entries of a replay
+	TargetUsers int32
+	Spec        *Spec
+}
+
+// Snapshot: the counts of a run so far
+type Snapshot struct {
+	ID                uuid.UUID
+	Stage             Stage
+	Elapsed           time.Duration
+	TotalRequests     int32
+	SucceededRequests int32
+	FailedRequests    int32
+	TargetUsers       int32
+	// Present for WebSocket tests
+	WebSocket *liveupdate.WebSocketUpdate
+}
+
+// Observer: gets told about a run as it happens, e.g to publish progress,
+// persist results or export them. OnRequestComplete is called from the
+// goroutines of the virtual users and OnStageChange and OnIntervalSnapshot,
+// every second, from goroutines of their own, so observers have to be safe to
+// call concurrently and should return quickly. OnTestEnd comes last
+type Observer interface {
+	OnTestStart(start *TestStart)
+	OnStageChange(stage Stage)
+	OnRequestComplete(stat *RequestStat)
+	OnIntervalSnapshot(snapshot *Snapshot)
+	OnTestEnd(report *Report)
+}
+
+// ObserverFuncs: an observer out of plain functions, the ones left nil are
+// skipped. Embed it to implement only some of the hooks
+type ObserverFuncs struct {
+	TestStart        func(start *TestStart)
+	StageChange      func(stage Stage)
+	RequestComplete  func(stat *RequestStat)
+	IntervalSnapshot func(snapshot *Snapshot)
+	TestEnd          func(report *Report)
+}
+
+func (o ObserverFuncs) OnTestStart(start *TestStart) {
+	if o.TestStart != nil {
+		o.TestStart(start)
+	}
+}
+
+func (o ObserverFuncs) OnStageChange(stage Stage) {
+	if o.StageChange != nil {
+		o.StageChange(stage)
+	}
+}
+
+func (o ObserverFuncs) OnRequestComplete(stat *RequestStat) {
+	if o.RequestComplete != nil {
+		o.RequestComplete(stat)
+	}
+}
+
+func (o ObserverFuncs) OnIntervalSnapshot(snapshot *Snapshot) {
+	if o.IntervalSnapshot != nil {
+		o.IntervalSnapshot(snapshot)
+	}
+}
+
+func (o ObserverFuncs) OnTestEnd(report *Report) {
+	if o.TestEnd != nil {
+		o.TestEnd(report)
+	}
+}
+
+// liveUpdateObserver: publishes the snapshots to the live update store the
+// API and the command line read the progress from
+type liveUpdateObserver struct {
+	ObserverFuncs
+	updater liveupdate.Updater
+	last    liveupdate.Update
+	id      uuid.UUID
+}
+
+// NewLiveUpdateObserver: an observer that keeps the live update of the run
+// in updater, marked done once the report is computed
+func NewLiveUpdateObserver(updater liveupdate.Updater) Observer {
+	return &liveUpdateObserver{updater: updater}
+}
+
+func (l *liveUpdateObserver) OnTestStart(start *TestStart) {
+	l.id = start.ID
+	l.last = liveupdate.Update{TargetUsers: start.TargetUsers}
+	u := l.last
+	l.updater.Set(l.id, &u)
+}
+
+func (l *liveUpdateObserver) OnIntervalSnapshot(s *Snapshot) {
+	l.last = liveupdate.Update{
+		TotalNumberofRequestsDone: s.TotalRequests,
+		SucceededRequests:         s.SucceededRequests,
+		FailedRequests:            s.FailedRequests,
+		TargetUsers:               s.TargetUsers,
+		WebSocket:                 s.WebSocket,
+	}
+	u := l.last
+	l.updater.Set(l.id, &u)
+}
+
+func (l *liveUpdateObserver) OnTestEnd(r *Report) {
+	u := l.last
+	u.TotalNumberofRequestsDone = r.RequestedDone
+	u.SucceededRequests = r.SucceededRequests
+	u.FailedRequests = r.FailedRequests
+	u.Done = true
+	l.updater.Set(l.id, &u)
+}
@@ -0,0 +1,105 @@
+package tester
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+
+	"github.com/VarthanV/load-tester/pkg/liveupdate"
+	"github.com/google/uuid"
+)
+
+// recorder: notes the hooks in the order they were called
+type recorder struct {
+	mu        sync.Mutex
+	calls     []string
+	stages    []Stage
+	snapshots []*Snapshot
+	requests  int
+}
+
+func (r *recorder) note(call string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if len(r.calls) == 0 || r.calls[len(r.calls)-1] != call {
+		r.calls = append(r.calls, call)
+	}
+}
+
+func (r *recorder) observer() Observer {
+	return ObserverFuncs{
+		TestStart: func(start *TestStart) { r.note("start") },
+		StageChange: func(stage Stage) {
+			r.note("stage")
+			r.mu.Lock()
+			r.stages = append(r.stages, stage)
+			r.mu.Unlock()
+		},
+		RequestComplete: func(stat *RequestStat) {
+			r.note("request")
+			r.mu.Lock()
+			r.requests++
+			r.mu.Unlock()
+		},
+		IntervalSnapshot: func(s *Snapshot) {
+			r.note("snapshot")
+			r.mu.Lock()
+			r.snapshots = append(r.snapshots, s)
+			r.mu.Unlock()
+		},
+		TestEnd: func(report *Report) { r.note("end") },
+	}
+}
+
+func TestObserverHooks(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer srv.Close()
+
+	rec := &recorder{}
+	d, err := New(nil,
+		WithPeakConfig(3, 0, 1),
+		WithRequestConfig(srv.URL, nil),
+		WithObservers(rec.observer()),
+	)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	d.Run(context.Background(), uuid.New())
+
+	// The other users are added on the first tick, snapshots and requests
+	// interleave in between
+	if rec.calls[0] != "start" || rec.calls[1] != "stage" || rec.calls[len(rec.calls)-1] != "end" {
+		t.Errorf("unexpected order of hooks %v", rec.calls)
+	}
+	if len(rec.stages) != 2 || rec.stages[0] != StageRampUp || rec.stages[1] != StagePeak {
+		t.Errorf("expected ramp up then peak, got %v", rec.stages)
+	}
+	if rec.requests != 3 {
+		t.Errorf("expected 3 requests, got %d", rec.requests)
+	}
+	last := rec.snapshots[len(rec.snapshots)-1]
+	if last.TotalRequests != 3 || last.SucceededRequests != 3 || last.TargetUsers != 3 || last.Stage != StagePeak {
+		t.Errorf("unexpected last snapshot %+v", last)
+	}
+}
+
+func TestLiveUpdateObserver(t *testing.T) {
+	updates := liveupdate.New()
+	o := NewLiveUpdateObserver(updates)
+	id := uuid.New()
+
+	o.OnTestStart(&TestStart{ID: id, TargetUsers: 5})
+	u, err := updates.Get(id)
+	if err != nil || u.TargetUsers != 5 || u.Done {
+		t.Fatalf("expected the target to be published on start, got %+v %v", u, err)
+	}
+
+	o.OnIntervalSnapshot(&Snapshot{ID: id, TotalRequests: 2, SucceededRequests: 1, FailedRequests: 1, TargetUsers: 5})
+	o.OnTestEnd(&Report{RequestedDone: 3, SucceededRequests: 2, FailedRequests: 1})
+	u, _ = updates.Get(id)
+	if !u.Done || u.TotalNumberofRequestsDone != 3 || u.SucceededRequests != 2 || u.TargetUsers != 5 {
+		t.Errorf("expected the final counts once done, got %+v", u)
+	}
+}
@@ -0,0 +1,263 @@
+package tester
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"io"
+	"math/rand/v2"
+	"net"
+	"net/http"
+	"os"
+	"slices"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+)
+
+const (
+	// Read the whole body into memory and keep it for the checks, extracts
+	// and failure capture
+	BodyRead = "read"
+	// Drain the body without holding on to it, keeps the connection reusable
+	BodyDiscard = "discard"
+	// Read up to CapBytes and close, the connection may not be reused
+	BodyCap = "cap"
+)
+
+const (
+	ErrorTimeout           = "timeout"
+	ErrorConnectionRefused = "connection_refused"
+	ErrorConnectionReset   = "connection_reset"
+	ErrorDNS               = "dns"
+	ErrorTLS               = "tls"
+	ErrorOther             = "other"
+	// Matches every error category when used in the retry config
+	ErrorAny = "any"
+)
+
+// RedirectConfig: whether redirects are followed on behalf of the virtual user
+type RedirectConfig struct {
+	// Measure the redirect response itself instead of following it
+	DontFollow bool `json:"dont_follow,omitempty"`
+	// Maximum redirects followed for a request, defaults to 10
+	MaxRedirects int `json:"max_redirects,omitempty"`
+}
+
+// RetryConfig: which failed requests are retried and how long to wait in
+// between, retries are reported apart from the first attempts
+type RetryConfig struct {
+	MaxRetries int `json:"max_retries"`
+	// Response status codes that trigger a retry
+	StatusCodes []int `json:"status_codes,omitempty"`
+	// Error categories that trigger a retry, e.g timeout, connection_refused,
+	// connection_reset, dns, tls, other or any
+	Errors []string `json:"errors,omitempty"`
+	// Exponential backoff between retries, default to 100ms and 5s
+	InitialBackoffInMilliseconds int `json:"initial_backoff_in_milliseconds,omitempty"`
+	MaxBackoffInMilliseconds     int `json:"max_backoff_in_milliseconds,omitempty"`
+}
+
+// ResponseBodyConfig: what happens to the response body once the headers
+// are in
+type ResponseBodyConfig struct {
+	// read, discard or cap, defaults to discard
+	Mode     string `json:"mode,omitempty"`
+	CapBytes int64  `json:"cap_bytes,omitempty"`
+}
+
+type RetryReport struct {
+	Retries          int32 `json:"retries"`
+	SucceededRetries int32 `json:"succeeded_retries"`
+	FailedRetries    int32 `json:"failed_retries"`
+	// Requests that failed on the first attempt and succeeded on a retry
+	RecoveredRequests   int32   `json:"recovered_requests"`
+	AverageResponseTime float64 `json:"average_response_time"`
+}
+
+type retryStats struct {
+	mu           sync.Mutex
+	succeeded    int32
+	failed       int32
+	recovered    int32
+	responseTime float64
+}
+
+func (s *retryStats) record(stat *RequestStat) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.responseTime += stat.TimeTakenInSeconds
+	if stat.IsSuccess {
+		s.succeeded++
+	} else {
+		s.failed++
+	}
+}
+
+func (s *retryStats) recordRecovered() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.recovered++
+}
+
+func (s *retryStats) report() *RetryReport {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	retries := s.succeeded + s.failed
+	if retries == 0 {
+		return nil
+	}
+	return &RetryReport{
+		Retries:             retries,
+		SucceededRetries:    s.succeeded,
+		FailedRetries:       s.failed,
+		RecoveredRequests:   s.recovered,
+		AverageResponseTime: s.responseTime / float64(retries),
+	}
+}
+
+// ValidateResponseBody: reports unknown modes and caps that aren't positive
+func ValidateResponseBody(c *ResponseBodyConfig) error {
+	if c == nil {
+		return nil
+	}
+	switch c.Mode {
+	case "", BodyRead, BodyDiscard:
+	case BodyCap:
+		if c.CapBytes <= 0 {
+			return errors.New("cap_bytes must be positive when capping response bodies")
+		}
+	default:
+		return fmt.Errorf("unknown response body mode %q", c.Mode)
+	}
+	return nil
+}
+
+// ValidateRedirect: reports a negative max_redirects
+func ValidateRedirect(c *RedirectConfig) error {
+	if c != nil && c.MaxRedirects < 0 {
+		return errors.New("max_redirects can't be negative")
+	}
+	return nil
+}
+
+// ValidateRetry: reports negative limits, unknown status codes and error
+// categories
+func ValidateRetry(c *RetryConfig) error {
+	if c == nil {
+		return nil
+	}
+	if c.MaxRetries < 0 {
+		return errors.New("max_retries can't be negative")
+	}
+	for _, code := range c.StatusCodes {
+		if code < 100 || code > 599 {
+			return fmt.Errorf("%d is not a status code", code)
+		}
+	}
+	categories := []string{
+		ErrorTimeout, ErrorConnectionRefused, ErrorConnectionReset,
+		ErrorDNS, ErrorTLS, ErrorOther, ErrorAny,
+	}
+	for _, e := range c.Errors {
+		if !slices.Contains(categories, e) {
+			return fmt.Errorf("unknown error category %q, expected one of %s", e, strings.Join(categories, ", "))
+		}
+	}
+	if c.InitialBackoffInMilliseconds < 0 || c.MaxBackoffInMilliseconds < 0 {
+		return errors.New("backoffs can't be negative")
+	}
+	return nil
+}
+
+// Builds the CheckRedirect fn of the http client, every redirect hop is
+// counted through the given fn
+func checkRedirect(c *RedirectConfig, onRedirect func()) func(*http.Request, []*http.Request) error {
+	maxRedirects := 10
+	if c != nil && c.MaxRedirects > 0 {
+		maxRedirects = c.MaxRedirects
+	}
+
+	return func(req *http.Request, via []*http.Request) error {
+		if c != nil && c.DontFollow {
+			return http.ErrUseLastResponse
+		}
+		if len(via) > maxRedirects {
+			return fmt.Errorf("stopped after %d redirects", maxRedirects)
+		}
+		onRedirect()
+		return nil
+	}
+}
+
+// Drains or caps the response body as per the config and returns the number
+// of bytes read, bodies that are read whole are kept by readBody
+func consumeBody(c *ResponseBodyConfig, body io.Reader) (int64, error) {
+	mode := BodyDiscard
+	if c != nil && c.Mode != "" {
+		mode = c.Mode
+	}
+
+	if mode == BodyCap {
+		return io.Copy(io.Discard, io.LimitReader(body, c.CapBytes))
+	}
+	return io.Copy(io.Discard, body)
+}
+
+// Buckets a request error so it can be reported and retried on
+func categorizeError(err error) string {
+	if err == nil {
+		return ""
+	}
+
+	var (
+		netErr       net.Error
+		dnsErr       *net.DNSError
+		tlsErr       *tls.CertificateVerificationError
+		tlsRecordErr tls.RecordHeaderError
+	)
+
+	switch {
+	case errors.Is(err, context.DeadlineExceeded), errors.Is(err, os.ErrDeadlineExceeded):
+		return ErrorTimeout
+	case errors.As(err, &dnsErr):
+		return ErrorDNS
+	case errors.Is(err, syscall.ECONNREFUSED):
+		return ErrorConnectionRefused
+	case errors.Is(err, syscall.ECONNRESET), errors.Is(err, io.EOF),
+		errors.Is(err, io.ErrUnexpectedEOF), errors.Is(err, syscall.EPIPE):
+		return ErrorConnectionReset
+	case errors.As(err, &tlsErr), errors.As(err, &tlsRecordErr):
+		return ErrorTLS
+	case errors.As(err, &netErr) && netErr.Timeout():
+		return ErrorTimeout
+	}
+	return ErrorOther
+}
+
+func (c *RetryConfig) shouldRetry(stat *RequestStat) bool {
+	if stat.IsSuccess {
+		return false
+	}
+	if stat.ErrorCategory != "" {
+		return slices.Contains(c.Errors, ErrorAny) ||
+			slices.Contains(c.Errors, stat.ErrorCategory)
+	}
+	return slices.Contains(c.StatusCodes, stat.StatusCode)
+}
+
+func (c *RetryConfig) backoff(retry int) time.Duration {
+	initial := milliseconds(c.InitialBackoffInMilliseconds, 100*time.Millisecond)
+	maxBackoff := milliseconds(c.MaxBackoffInMilliseconds, 5*time.Second)
+
+	backoff := initial << (retry - 1)
+	if backoff > maxBackoff || backoff <= 0 {
+		backoff = maxBackoff
+	}
+	// Jitter the second half so the virtual users don't retry in lockstep
+	half := backoff / 2
+	return half + rand.N(half+1)
+}
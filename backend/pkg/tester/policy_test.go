@@ -0,0 +1,155 @@
+package tester
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"syscall"
+	"testing"
+)
+
+func TestRetriesAreReportedApart(t *testing.T) {
+	var hits atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if hits.Add(1) < 3 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		w.Write([]byte("ok"))
+	}))
+	defer server.Close()
+
+	var mu sync.Mutex
+	retries := []int{}
+	observer := ObserverFuncs{RequestComplete: func(s *RequestStat) {
+		mu.Lock()
+		defer mu.Unlock()
+		retries = append(retries, s.Retry)
+	}}
+
+	d, err := New(nil,
+		WithPeakConfig(1, 0, 1),
+		WithSteps(Step{
+			Name:   "flaky",
+			URL:    server.URL,
+			Checks: []Check{{Type: CheckBodyContains, Value: "ok"}},
+		}),
+		WithObservers(observer),
+		WithRetryConfig(&RetryConfig{
+			MaxRetries:                   3,
+			StatusCodes:                  []int{http.StatusServiceUnavailable},
+			InitialBackoffInMilliseconds: 1,
+		}),
+	)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	d.doRequestAndReturnStatsDriver(context.Background(), 1)
+
+	if d.requestsFailed.Load() != 1 || d.requestsSucceeded.Load() != 0 {
+		t.Errorf("expected the first attempt to be reported as failed")
+	}
+
+	r := d.retryStats.report()
+	if r == nil || r.Retries != 2 || r.FailedRetries != 1 || r.RecoveredRequests != 1 {
+		t.Errorf("unexpected retry report: %+v", r)
+	}
+
+	// Every attempt reaches the observers, the checks only see the last one
+	if !slices.Equal(retries, []int{0, 1, 2}) {
+		t.Errorf("expected the first attempt and 2 retries to be observed, got %v", retries)
+	}
+	checks := d.checkStats.report()
+	if len(checks) != 1 {
+		t.Fatalf("expected a single check, got %v", checks)
+	}
+	for name, c := range checks {
+		if c.Passes != 1 || c.Fails != 0 {
+			t.Errorf("expected check %s to pass on the recovered attempt, got %+v", name, c)
+		}
+	}
+}
+
+func TestRedirectsAreCounted(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/start" {
+			http.Redirect(w, r, "/end", http.StatusFound)
+			return
+		}
+		w.Write([]byte("done"))
+	}))
+	defer server.Close()
+
+	for _, dontFollow := range []bool{false, true} {
+		d, err := New(nil,
+			WithPeakConfig(1, 0, 1),
+			WithRequestConfig(server.URL+"/start", nil, http.StatusFound),
+			WithRedirectConfig(&RedirectConfig{DontFollow: dontFollow}),
+		)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+
+		stat, err := d.doRequestAndReturnStats(context.Background(), &d.Steps[0], 1)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+
+		if d.redirects.Load() != 1 {
+			t.Errorf("dont follow %v: expected 1 redirect, got %d", dontFollow, d.redirects.Load())
+		}
+		if dontFollow && stat.StatusCode != http.StatusFound {
+			t.Errorf("expected the redirect response to be measured, got %d", stat.StatusCode)
+		}
+		if !dontFollow && stat.StatusCode != http.StatusOK {
+			t.Errorf("expected the redirect to be followed, got %d", stat.StatusCode)
+		}
+	}
+}
+
+func TestConsumeBody(t *testing.T) {
+	body := strings.Repeat("a", 100)
+
+	n, _ := consumeBody(&ResponseBodyConfig{Mode: BodyCap, CapBytes: 10}, strings.NewReader(body))
+	if n != 10 {
+		t.Errorf("expected 10 bytes with cap, got %d", n)
+	}
+
+	n, _ = consumeBody(nil, strings.NewReader(body))
+	if n != 100 {
+		t.Errorf("expected 100 bytes with discard, got %d", n)
+	}
+}
+
+func TestReadBodyKeepsWholeBodies(t *testing.T) {
+	body := strings.Repeat("a", 100)
+	res := &http.Response{Header: http.Header{}, Body: io.NopCloser(strings.NewReader(body))}
+
+	var kept []byte
+	wire, decoded, err := readBody(&ResponseBodyConfig{Mode: BodyRead}, res, &kept, false)
+	if err != nil || wire != 100 || decoded != 100 || string(kept) != body {
+		t.Errorf("expected the whole body to be kept, got %d %d %q %v", wire, decoded, kept, err)
+	}
+}
+
+func TestCategorizeError(t *testing.T) {
+	cases := map[error]string{
+		context.DeadlineExceeded:    ErrorTimeout,
+		syscall.ECONNREFUSED:        ErrorConnectionRefused,
+		syscall.ECONNRESET:          ErrorConnectionReset,
+		errors.New("what happened"): ErrorOther,
+	}
+
+	for err, expected := range cases {
+		if got := categorizeError(err); got != expected {
+			t.Errorf("%v: expected %s, got %s", err, expected, got)
+		}
+	}
+}
@@ -0,0 +1,250 @@
+package tester
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/VarthanV/load-tester/pkg/liveupdate"
+)
+
+// Protocol: what a virtual user does on every iteration. The scheduler ramps
+// up the users and calls Execute for each iteration, metrics, reports and
+// persistence are taken care of for whatever is handed to record
+type Protocol interface {
+	// Prepare: called once before the first iteration with the context of
+	// the run, e.g to connect or fetch what every iteration needs
+	Prepare(ctx context.Context) error
+	// Execute: runs one iteration for the virtual user, every request it
+	// makes is handed to record. Called from the goroutine of the user, so
+	// it runs concurrently for different users
+	Execute(ctx context.Context, vu int, record func(*RequestStat))
+	// Close: called once the run is done
+	Close() error
+}
+
+// ReportingProtocol: a protocol that adds its own section to the report,
+// elapsed is how long the run took
+type ReportingProtocol interface {
+	Protocol
+	AddToReport(r *Report, elapsed time.Duration)
+}
+
+// liveReporter: a protocol with numbers of its own in the live updates
+type liveReporter interface {
+	liveUpdate() *liveupdate.WebSocketUpdate
+}
+
+// Names the built in protocols are registered under
+const (
+	// Runs the steps of the scenario, the protocol used when no other is
+	// configured. It takes no config of its own
+	ProtocolHTTP      = "http"
+	ProtocolGRPC      = "grpc"
+	ProtocolWebSocket = "websocket"
+	ProtocolSocket    = "socket"
+	ProtocolDNS       = "dns"
+	ProtocolCache     = "cache"
+)
+
+// driverProtocol: a protocol that works off the driver itself, bound once
+// the driver is set up
+type driverProtocol interface {
+	bind(d *driver)
+}
+
+// Factory: creates a protocol from its config as found in the spec
+type Factory func(config json.RawMessage) (Protocol, error)
+
+var registry = struct {
+	mu        sync.RWMutex
+	factories map[string]Factory
+}{factories: map[string]Factory{}}
+
+// Register: makes a protocol available by name, usually from the init of the
+// package that implements it. Panics when the name is taken
+func Register(name string, factory Factory) {
+	registry.mu.Lock()
+	defer registry.mu.Unlock()
+	if factory == nil {
+		panic("tester: register of a nil protocol factory for " + name)
+	}
+	if _, ok := registry.factories[name]; ok {
+		panic("tester: protocol registered twice: " + name)
+	}
+	registry.factories[name] = factory
+}
+
+// Protocols: names of the registered protocols, sorted
+func Protocols() []string {
+	registry.mu.RLock()
+	defer registry.mu.RUnlock()
+	names := make([]string, 0, len(registry.factories))
+	for name := range registry.factories {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// NewProtocol: creates the protocol registered under name
+func NewProtocol(name string, config json.RawMessage) (Protocol, error) {
+	registry.mu.RLock()
+	factory, ok := registry.factories[name]
+	registry.mu.RUnlock()
+	if !ok {
+		return nil, fmt.Errorf("unknown protocol %q, registered are %v", name, Protocols())
+	}
+	return factory(config)
+}
+
+// ProtocolConfig: a registered protocol and its config
+type ProtocolConfig struct {
+	Name   string          `json:"name"`
+	Config json.RawMessage `json:"config,omitempty"`
+
+	// Set when the config of a built in protocol couldn't be encoded
+	err error
+}
+
+// Option fn to run a registered protocol instead of making HTTP requests
+func WithProtocol(name string, raw json.RawMessage) Option {
+	return func(c *Spec) {
+		c.Protocol = &ProtocolConfig{Name: name, Config: raw}
+	}
+}
+
+// Option fn to run a protocol that is already set up instead of making HTTP
+// requests
+func WithExecutor(p Protocol) Option {
+	return func(c *Spec) {
+		c.executor = p
+	}
+}
+
+// Option fn behind the options of the built in protocols, the config is
+// handed to the registry like the config of any other protocol. A nil
+// config leaves the protocol as is
+func withBuiltin[T any](name string, config *T) Option {
+	return func(c *Spec) {
+		if config == nil {
+			return
+		}
+		raw, err := json.Marshal(config)
+		c.Protocol = &ProtocolConfig{Name: name, Config: raw, err: err}
+	}
+}
+
+// Decodes the config of a built in protocol, unknown fields are an error
+// like they are in the spec
+func decodeConfig[T any](config json.RawMessage) (*T, error) {
+	c := new(T)
+	if len(config) == 0 {
+		return c, nil
+	}
+	d := json.NewDecoder(bytes.NewReader(config))
+	d.DisallowUnknownFields()
+	err := d.Decode(c)
+	if err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+func init() {
+	Register(ProtocolHTTP, func(config json.RawMessage) (Protocol, error) {
+		_, err := decodeConfig[struct{}](config)
+		if err != nil {
+			return nil, err
+		}
+		return &httpProtocol{}, nil
+	})
+	Register(ProtocolGRPC, func(config json.RawMessage) (Protocol, error) {
+		c, err := decodeConfig[GRPCConfig](config)
+		if err != nil {
+			return nil, err
+		}
+		return newGRPCClient(c)
+	})
+	Register(ProtocolWebSocket, func(config json.RawMessage) (Protocol, error) {
+		c, err := decodeConfig[WebSocketConfig](config)
+		if err != nil {
+			return nil, err
+		}
+		return newWebSocketClient(c, &webSocketStats{})
+	})
+	Register(ProtocolSocket, func(config json.RawMessage) (Protocol, error) {
+		c, err := decodeConfig[SocketConfig](config)
+		if err != nil {
+			return nil, err
+		}
+		return newSocketClient(c, &socketStats{})
+	})
+	Register(ProtocolDNS, func(config json.RawMessage) (Protocol, error) {
+		c, err := decodeConfig[DNSQueryConfig](config)
+		if err != nil {
+			return nil, err
+		}
+		return newDNSClient(c, &dnsStats{})
+	})
+	Register(ProtocolCache, func(config json.RawMessage) (Protocol, error) {
+		c, err := decodeConfig[CacheConfig](config)
+		if err != nil {
+			return nil, err
+		}
+		return newCacheClient(c, &cacheStats{})
+	})
+}
+
+// Picks the protocol of the config from the registry, HTTP when none is set
+func (c *Spec) protocol() (Protocol, error) {
+	if c.executor != nil {
+		return c.executor, nil
+	}
+	p := c.Protocol
+	if p == nil {
+		p = &ProtocolConfig{Name: ProtocolHTTP}
+	}
+	if p.err != nil {
+		return nil, fmt.Errorf("unable to encode the config of %s: %w", p.Name, p.err)
+	}
+	return NewProtocol(p.Name, p.Config)
+}
+
+// httpProtocol: runs the steps of the scenario over HTTP with the client of
+// the driver it's bound to
+type httpProtocol struct {
+	d *driver
+}
+
+func (h *httpProtocol) bind(d *driver) {
+	h.d = d
+}
+
+func (h *httpProtocol) Prepare(ctx context.Context) error {
+	return nil
+}
+
+func (h *httpProtocol) Execute(ctx context.Context, vu int, record func(*RequestStat)) {
+	// Variables extracted by the steps only live for the iteration
+	vars := map[string]string{}
+	for i := range h.d.Steps {
+		if ctx.Err() != nil {
+			return
+		}
+		h.d.runStep(ctx, &h.d.Steps[i], vu, vars, record)
+	}
+}
+
+func (h *httpProtocol) Close() error {
+	h.d.httpClient.CloseIdleConnections()
+	return nil
+}
+
+func (h *httpProtocol) AddToReport(r *Report, elapsed time.Duration) {
+	r.Stream = h.d.streamStats.report(elapsed)
+}
@@ -0,0 +1,155 @@
+package tester
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"slices"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// echoProtocol: an in-house protocol as a team would register it
+type echoProtocol struct {
+	Requests int `json:"requests"`
+	prepared atomic.Bool
+	closed   atomic.Bool
+	executed atomic.Int32
+}
+
+func (e *echoProtocol) Prepare(ctx context.Context) error {
+	e.prepared.Store(true)
+	return nil
+}
+
+func (e *echoProtocol) Execute(ctx context.Context, vu int, record func(*RequestStat)) {
+	e.executed.Add(1)
+	for i := 0; i < e.Requests; i++ {
+		record(&RequestStat{
+			Endpoint:           "echo",
+			IsSuccess:          i%2 == 0,
+			TimeTakenInSeconds: 0.01,
+			BytesSent:          4,
+		})
+	}
+}
+
+func (e *echoProtocol) Close() error {
+	e.closed.Store(true)
+	return nil
+}
+
+func (e *echoProtocol) AddToReport(r *Report, elapsed time.Duration) {
+	r.Errors = map[string]int32{"echo": e.executed.Load()}
+}
+
+var registered *echoProtocol
+
+func init() {
+	Register("echo", func(config json.RawMessage) (Protocol, error) {
+		registered = &echoProtocol{}
+		err := json.Unmarshal(config, registered)
+		if err != nil {
+			return nil, err
+		}
+		return registered, nil
+	})
+}
+
+func TestRegisteredProtocol(t *testing.T) {
+	if !slices.Contains(Protocols(), "echo") || !slices.Contains(Protocols(), ProtocolGRPC) ||
+		!slices.Contains(Protocols(), ProtocolHTTP) {
+		t.Fatalf("expected echo and the built in protocols to be registered, got %v", Protocols())
+	}
+
+	d, err := New(nil, WithPeakConfig(3, 0, 3), WithProtocol("echo", json.RawMessage(`{"requests": 2}`)))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	d.Run(context.Background(), uuid.New())
+
+	r := d.Report()
+	if r.RequestedDone != 6 || r.SucceededRequests != 3 || r.BytesSent != 24 {
+		t.Errorf("expected the 6 recorded requests in the report, got %+v", r)
+	}
+	if r.Endpoints["echo"] == nil || r.Errors["echo"] != 3 {
+		t.Errorf("expected the protocol to add to the report, got %+v", r)
+	}
+	if !registered.prepared.Load() || !registered.closed.Load() {
+		t.Errorf("expected the protocol to be prepared and closed")
+	}
+}
+
+type failingProtocol struct {
+	echoProtocol
+}
+
+func (f *failingProtocol) Prepare(ctx context.Context) error {
+	return errors.New("unreachable")
+}
+
+func TestExecutor(t *testing.T) {
+	failing := &failingProtocol{}
+	d, err := New(nil, WithPeakConfig(1, 0, 1), WithExecutor(failing))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	d.Run(context.Background(), uuid.New())
+
+	if failing.executed.Load() != 0 || !failing.closed.Load() {
+		t.Errorf("expected a protocol that fails to prepare to only be closed")
+	}
+	if r := d.Report(); r.RequestedDone != 0 {
+		t.Errorf("expected no requests, got %+v", r)
+	}
+}
+
+func TestNewProtocol(t *testing.T) {
+	_, err := NewProtocol("carrier-pigeon", nil)
+	if err == nil {
+		t.Errorf("expected an error for an unknown protocol")
+	}
+	_, err = NewProtocol("dns", json.RawMessage(`{"server": "127.0.0.1", "names": ["a.test"], "nmaes": []}`))
+	if err == nil {
+		t.Errorf("expected an error for an unknown field")
+	}
+	p, err := NewProtocol("dns", json.RawMessage(`{"server": "127.0.0.1", "names": ["a.test"]}`))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if _, ok := p.(ReportingProtocol); !ok {
+		t.Errorf("expected dns to add to the report")
+	}
+}
+
+func TestBuiltinProtocolsGoThroughTheRegistry(t *testing.T) {
+	c := Spec{}
+	WithDNSQueries(&DNSQueryConfig{Server: "127.0.0.1", Names: []string{"a.test"}})(&c)
+	WithCache(nil)(&c)
+	if c.Protocol == nil || c.Protocol.Name != ProtocolDNS {
+		t.Fatalf("expected the dns option to pick the registered protocol, got %+v", c.Protocol)
+	}
+	p, err := c.protocol()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if _, ok := p.(*dnsClient); !ok {
+		t.Errorf("expected the dns client, got %T", p)
+	}
+
+	// Without a protocol the steps are run over HTTP, bound to the driver
+	d, err := New(nil, WithRequestConfig("http://127.0.0.1", nil))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if h, ok := d.protocol.(*httpProtocol); !ok || h.d != d {
+		t.Errorf("expected the http protocol bound to the driver, got %T", d.protocol)
+	}
+	_, err = NewProtocol(ProtocolHTTP, json.RawMessage(`{"url": "http://127.0.0.1"}`))
+	if err == nil {
+		t.Errorf("expected http to take no config")
+	}
+}
@@ -0,0 +1,224 @@
+package tester
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/url"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// Requests allowed in flight when replaying without target users
+const DefaultReplayConcurrency = 100
+
+// ReplayConfig: replays recorded requests against a base url keeping their
+// relative timing, target users caps the requests in flight
+type ReplayConfig struct {
+	BaseURL string `json:"base_url"`
+	// 2 replays twice as fast as recorded, defaults to 1
+	Speed float64 `json:"speed,omitempty"`
+	// Only paths matching the regular expression are replayed
+	PathFilter string `json:"path_filter,omitempty"`
+	// Defaults to any status below 400, recorded traffic has redirects and
+	// not modified responses that are fine
+	SuccessStatusCodes []int `json:"success_status_codes,omitempty"`
+}
+
+// ReplayEntry: a recorded request, offset is the time since the first
+// request of the recording
+type ReplayEntry struct {
+	Offset time.Duration
+	Method string
+	// Path with the query
+	Path string
+}
+
+// ReplayReport: how closely the replay kept to the recorded timing
+type ReplayReport struct {
+	Entries  int     `json:"entries"`
+	Replayed int     `json:"replayed"`
+	Filtered int     `json:"filtered"`
+	Speed    float64 `json:"speed"`
+	// Requests per second as recorded after applying the speed and as sent
+	IntendedRate              float64 `json:"intended_rate"`
+	AchievedRate              float64 `json:"achieved_rate"`
+	IntendedDurationInSeconds float64 `json:"intended_duration_in_seconds"`
+	ActualDurationInSeconds   float64 `json:"actual_duration_in_seconds"`
+	// How late requests were sent compared to their schedule
+	AverageLagInSeconds float64 `json:"average_lag_in_seconds"`
+	MaxLagInSeconds     float64 `json:"max_lag_in_seconds"`
+}
+
+// Option fn to replay recorded requests instead of ramping up users
+func WithReplay(c *ReplayConfig, entries ...ReplayEntry) Option {
+	return func(cfg *Spec) {
+		cfg.Replay = c
+		cfg.ReplayEntries = append(cfg.ReplayEntries, entries...)
+	}
+}
+
+// ValidateReplay: reports bad base urls and filters, and replays the filter
+// leaves nothing of
+func ValidateReplay(c *ReplayConfig, entries []ReplayEntry) error {
+	_, err := newReplay(c, entries)
+	return err
+}
+
+type replay struct {
+	speed    float64
+	entries  []ReplayEntry
+	steps    []Step
+	filtered int
+
+	mu       sync.Mutex
+	sent     int
+	lag      time.Duration
+	maxLag   time.Duration
+	lastSent time.Duration
+}
+
+func newReplay(c *ReplayConfig, entries []ReplayEntry) (*replay, error) {
+	base, err := url.Parse(c.BaseURL)
+	if err != nil || base.Host == "" || (base.Scheme != "http" && base.Scheme != "https") {
+		return nil, fmt.Errorf("replay base url %q is not an absolute http or https url", c.BaseURL)
+	}
+	if c.Speed < 0 {
+		return nil, errors.New("replay speed can't be negative")
+	}
+
+	var filter *regexp.Regexp
+	if c.PathFilter != "" {
+		filter, err = regexp.Compile(c.PathFilter)
+		if err != nil {
+			return nil, fmt.Errorf("invalid replay path filter: %w", err)
+		}
+	}
+
+	r := &replay{speed: c.Speed}
+	if r.speed == 0 {
+		r.speed = 1
+	}
+	codes := c.SuccessStatusCodes
+	if len(codes) == 0 {
+		for code := 100; code < 400; code++ {
+			codes = append(codes, code)
+		}
+	}
+
+	baseURL := strings.TrimSuffix(base.String(), "/")
+	for _, e := range entries {
+		if filter != nil && !filter.MatchString(e.Path) {
+			r.filtered++
+			continue
+		}
+		r.entries = append(r.entries, e)
+		r.steps = append(r.steps, Step{
+			Method:             e.Method,
+			URL:                baseURL + "/" + strings.TrimPrefix(e.Path, "/"),
+			SuccessStatusCodes: codes,
+		})
+	}
+	if len(r.entries) == 0 {
+		return nil, errors.New("no requests to replay")
+	}
+	return r, nil
+}
+
+// Time the entry is due at since the start of the replay
+func (r *replay) due(e ReplayEntry) time.Duration {
+	return time.Duration(float64(e.Offset) / r.speed)
+}
+
+func (r *replay) recordSent(lag time.Duration, sentAt time.Duration) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.sent++
+	r.lag += lag
+	if lag > r.maxLag {
+		r.maxLag = lag
+	}
+	r.lastSent = sentAt
+}
+
+func (r *replay) report() *ReplayReport {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	report := &ReplayReport{
+		Entries:                   len(r.entries) + r.filtered,
+		Replayed:                  r.sent,
+		Filtered:                  r.filtered,
+		Speed:                     r.speed,
+		IntendedDurationInSeconds: r.due(r.entries[len(r.entries)-1]).Seconds(),
+		ActualDurationInSeconds:   r.lastSent.Seconds(),
+		MaxLagInSeconds:           r.maxLag.Seconds(),
+	}
+	if r.sent > 0 {
+		report.AverageLagInSeconds = r.lag.Seconds() / float64(r.sent)
+	}
+	// The first request starts the clock, rates are over the gaps after it
+	if report.IntendedDurationInSeconds > 0 {
+		report.IntendedRate = float64(len(r.entries)-1) / report.IntendedDurationInSeconds
+	}
+	if report.ActualDurationInSeconds > 0 {
+		report.AchievedRate = float64(r.sent-1) / report.ActualDurationInSeconds
+	}
+	return report
+}
+
+// Sends every entry when it's due, a request waiting on a free slot is sent
+// late and the lag shows up in the report
+func (d *driver) runReplay(ctx context.Context) {
+	var wg sync.WaitGroup
+
+	concurrency := d.TargetUsers
+	if concurrency <= 0 {
+		concurrency = DefaultReplayConcurrency
+	}
+	slots := make(chan int, concurrency)
+	for vu := 1; vu <= concurrency; vu++ {
+		slots <- vu
+	}
+
+	start := time.Now()
+	timer := time.NewTimer(time.Hour)
+	timer.Stop()
+
+replay:
+	for i, e := range d.replay.entries {
+		due := d.replay.due(e)
+		if wait := due - time.Since(start); wait > 0 {
+			timer.Reset(wait)
+			select {
+			case <-timer.C:
+			case <-ctx.Done():
+				break replay
+			}
+		}
+
+		var vu int
+		select {
+		case vu = <-slots:
+		case <-ctx.Done():
+			break replay
+		}
+
+		sentAt := time.Since(start)
+		d.replay.recordSent(sentAt-due, sentAt)
+
+		wg.Add(1)
+		go func(step *Step, vu int) {
+			defer wg.Done()
+			defer func() { slots <- vu }()
+			d.runStep(ctx, step, vu, nil, d.record)
+		}(&d.replay.steps[i], vu)
+	}
+
+	wg.Wait()
+	logrus.Info("Replayed requests:", d.totalNumberOfRequestsDone.Load())
+}
@@ -0,0 +1,79 @@
+package tester
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+func TestReplayKeepsTimingAndFilters(t *testing.T) {
+	var (
+		mu    sync.Mutex
+		paths = []string{}
+		vus   = []int{}
+	)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		paths = append(paths, r.Method+" "+r.URL.RequestURI())
+		mu.Unlock()
+	}))
+	defer server.Close()
+
+	d, err := New(nil,
+		WithPeakConfig(2, 0, 0),
+		WithReplay(&ReplayConfig{BaseURL: server.URL + "/", Speed: 10, PathFilter: "^/api"},
+			ReplayEntry{Offset: 0, Method: "GET", Path: "/api/a?x=1"},
+			ReplayEntry{Offset: time.Second, Method: "GET", Path: "/static/app.js"},
+			ReplayEntry{Offset: 2 * time.Second, Method: "POST", Path: "/api/b"},
+		),
+		WithObservers(ObserverFuncs{RequestComplete: func(s *RequestStat) {
+			mu.Lock()
+			vus = append(vus, s.VU)
+			mu.Unlock()
+		}}),
+	)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	start := time.Now()
+	d.Run(context.Background(), uuid.New())
+	if elapsed := time.Since(start); elapsed < 200*time.Millisecond {
+		t.Errorf("expected the replay to take the recorded time over the speed, took %s", elapsed)
+	}
+
+	if len(paths) != 2 || paths[0] != "GET /api/a?x=1" || paths[1] != "POST /api/b" {
+		t.Errorf("unexpected requests %v", paths)
+	}
+
+	// Requests carry the slot they were sent from as their user
+	for _, vu := range vus {
+		if vu < 1 || vu > 2 {
+			t.Errorf("expected the vu to be a slot from 1 to 2, got %v", vus)
+		}
+	}
+
+	if d.Report().SucceededRequests != 2 {
+		t.Errorf("expected replayed requests to succeed, got %+v", d.Report())
+	}
+
+	r := d.Report().Replay
+	if r == nil || r.Entries != 3 || r.Replayed != 2 || r.Filtered != 1 {
+		t.Fatalf("unexpected replay report %+v", r)
+	}
+	if r.IntendedRate != 5 || r.AchievedRate <= 0 || r.AchievedRate > 5 {
+		t.Errorf("expected intended rate of 5 and a close achieved rate, got %+v", r)
+	}
+}
+
+func TestReplayNeedsBaseURL(t *testing.T) {
+	_, err := New(nil, WithReplay(&ReplayConfig{BaseURL: "/api"}, ReplayEntry{Path: "/"}))
+	if err == nil {
+		t.Errorf("expected an error for a relative base url")
+	}
+}
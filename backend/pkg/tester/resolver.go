@@ -0,0 +1,219 @@
+package tester
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"sync"
+	"time"
+)
+
+const (
+	// Resolve a host the first time it is dialed and reuse the addresses
+	ResolveOnce = "once"
+	// Resolve a host on every new connection
+	ResolvePerConnection = "per_connection"
+)
+
+// DNSConfig: controls which addresses the tester connects to for a host
+type DNSConfig struct {
+	// Host to addresses, like curl --resolve, e.g
+	// {"api.example.com": ["10.0.0.1", "10.0.0.2"]}
+	Overrides map[string][]string `json:"overrides,omitempty"`
+	// Spread new connections round robin across all the addresses of a
+	// host instead of always using the first reachable one
+	RoundRobin bool `json:"round_robin,omitempty"`
+	// "once" or "per_connection", defaults to once
+	Resolve string `json:"resolve,omitempty"`
+}
+
+// Metrics for a single backend address the tester connected to
+type AddressReport struct {
+	Connections         int32   `json:"connections"`
+	FailedConnections   int32   `json:"failed_connections"`
+	AverageConnectTime  float64 `json:"average_connect_time"`
+	Requests            int32   `json:"requests"`
+	FailedRequests      int32   `json:"failed_requests"`
+	AverageResponseTime float64 `json:"average_response_time"`
+}
+
+type addressStats struct {
+	connections       int32
+	failedConnections int32
+	connectTime       float64
+	requests          int32
+	failedRequests    int32
+	responseTime      float64
+}
+
+type resolvingDialer struct {
+	dialer   *net.Dialer
+	resolver *net.Resolver
+	config   DNSConfig
+
+	mu    sync.Mutex
+	cache map[string][]string
+	next  map[string]int
+	stats map[string]*addressStats
+}
+
+func newResolvingDialer(dialer *net.Dialer, c DNSConfig) (*resolvingDialer, error) {
+	switch c.Resolve {
+	case "", ResolveOnce, ResolvePerConnection:
+	default:
+		return nil, fmt.Errorf("unknown resolve mode %q", c.Resolve)
+	}
+
+	for host, addrs := range c.Overrides {
+		for _, a := range addrs {
+			if net.ParseIP(a) == nil {
+				return nil, fmt.Errorf("override for %s is not an ip address: %s", host, a)
+			}
+		}
+	}
+
+	return &resolvingDialer{
+		dialer:   dialer,
+		resolver: net.DefaultResolver,
+		config:   c,
+		cache:    map[string][]string{},
+		next:     map[string]int{},
+		stats:    map[string]*addressStats{},
+	}, nil
+}
+
+func (r *resolvingDialer) lookup(ctx context.Context, host string) ([]string, error) {
+	if addrs, ok := r.config.Overrides[host]; ok && len(addrs) > 0 {
+		return addrs, nil
+	}
+	if net.ParseIP(host) != nil {
+		return []string{host}, nil
+	}
+
+	if r.config.Resolve != ResolvePerConnection {
+		r.mu.Lock()
+		addrs, ok := r.cache[host]
+		r.mu.Unlock()
+		if ok {
+			return addrs, nil
+		}
+	}
+
+	addrs, err := r.resolver.LookupHost(ctx, host)
+	if err != nil {
+		return nil, err
+	}
+	if len(addrs) == 0 {
+		return nil, fmt.Errorf("no addresses found for %s", host)
+	}
+
+	if r.config.Resolve != ResolvePerConnection {
+		r.mu.Lock()
+		r.cache[host] = addrs
+		r.mu.Unlock()
+	}
+	return addrs, nil
+}
+
+// Orders the addresses to try, round robin rotates the starting point on
+// every call
+func (r *resolvingDialer) order(host string, addrs []string) []string {
+	if !r.config.RoundRobin || len(addrs) == 1 {
+		return addrs
+	}
+
+	r.mu.Lock()
+	start := r.next[host] % len(addrs)
+	r.next[host] = start + 1
+	r.mu.Unlock()
+
+	return append(append([]string{}, addrs[start:]...), addrs[:start]...)
+}
+
+func (r *resolvingDialer) DialContext(ctx context.Context, network, addr string) (net.Conn, error) {
+	host, port, err := net.SplitHostPort(addr)
+	if err != nil {
+		return nil, err
+	}
+
+	addrs, err := r.lookup(ctx, host)
+	if err != nil {
+		return nil, err
+	}
+
+	var dialErr error
+	for _, ip := range r.order(host, addrs) {
+		start := time.Now()
+		conn, err := r.dialer.DialContext(ctx, network, net.JoinHostPort(ip, port))
+		r.recordConnection(ip, time.Since(start), err)
+		if err == nil {
+			return conn, nil
+		}
+		dialErr = errors.Join(dialErr, err)
+	}
+	return nil, dialErr
+}
+
+func (r *resolvingDialer) statsFor(ip string) *addressStats {
+	s, ok := r.stats[ip]
+	if !ok {
+		s = &addressStats{}
+		r.stats[ip] = s
+	}
+	return s
+}
+
+func (r *resolvingDialer) recordConnection(ip string, elapsed time.Duration, err error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	s := r.statsFor(ip)
+	if err != nil {
+		s.failedConnections++
+		return
+	}
+	s.connections++
+	s.connectTime += elapsed.Seconds()
+}
+
+// Attributes a finished request to the address of the connection it used
+func (r *resolvingDialer) recordRequest(remoteAddr string, stat *RequestStat) {
+	ip, _, err := net.SplitHostPort(remoteAddr)
+	if err != nil {
+		return
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	s := r.statsFor(ip)
+	s.requests++
+	s.responseTime += stat.TimeTakenInSeconds
+	if !stat.IsSuccess {
+		s.failedRequests++
+	}
+}
+
+func (r *resolvingDialer) report() map[string]*AddressReport {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	reports := map[string]*AddressReport{}
+	for ip, s := range r.stats {
+		a := &AddressReport{
+			Connections:       s.connections,
+			FailedConnections: s.failedConnections,
+			Requests:          s.requests,
+			FailedRequests:    s.failedRequests,
+		}
+		if s.connections > 0 {
+			a.AverageConnectTime = s.connectTime / float64(s.connections)
+		}
+		if s.requests > 0 {
+			a.AverageResponseTime = s.responseTime / float64(s.requests)
+		}
+		reports[ip] = a
+	}
+	return reports
+}
@@ -0,0 +1,61 @@
+package tester
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestResolvingDialerRoundRobin(t *testing.T) {
+	listener, err := net.Listen("tcp", "0.0.0.0:0")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	server := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	server.Listener = listener
+	server.Start()
+	defer server.Close()
+
+	_, port, _ := net.SplitHostPort(listener.Addr().String())
+
+	d, err := New(nil,
+		WithPeakConfig(1, 0, 1),
+		WithRequestConfig("http://backend.test:"+port, nil),
+		WithTransportConfig(&TransportConfig{
+			DisableKeepAlives: true,
+			DNS: &DNSConfig{
+				Overrides:  map[string][]string{"backend.test": {"127.0.0.1", "127.0.0.2"}},
+				RoundRobin: true,
+			},
+		}),
+	)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	for i := 0; i < 4; i++ {
+		d.doRequestAndReturnStatsDriver(context.Background(), 1)
+	}
+
+	addresses := d.resolver.report()
+	for _, ip := range []string{"127.0.0.1", "127.0.0.2"} {
+		a, ok := addresses[ip]
+		if !ok {
+			t.Fatalf("expected metrics for %s, got %v", ip, addresses)
+		}
+		if a.Connections != 2 || a.Requests != 2 {
+			t.Errorf("%s: expected 2 connections and requests, got %+v", ip, a)
+		}
+	}
+}
+
+func TestResolvingDialerRejectsInvalidOverride(t *testing.T) {
+	_, err := newResolvingDialer(&net.Dialer{}, DNSConfig{
+		Overrides: map[string][]string{"backend.test": {"not-an-ip"}},
+	})
+	if err == nil {
+		t.Fatalf("expected an error for an invalid override")
+	}
+}
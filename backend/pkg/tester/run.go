@@ -0,0 +1,36 @@
+package tester
+
+import (
+	"context"
+	"errors"
+	"net/http"
+
+	"github.com/google/uuid"
+)
+
+// Run: runs the spec until every user is done or ctx is cancelled and returns
+// the report. Nothing is stored, observers get told about the run as it
+// happens. Errors are for specs that can't be run, a run with failed requests
+// still returns its report and the thresholds say whether it passed
+func Run(ctx context.Context, s Spec, observers ...Observer) (*Report, error) {
+	if s.TargetUsers <= 0 && s.Replay == nil {
+		return nil, errors.New("target users has to be at least 1")
+	}
+	if len(s.SuccessStatusCodes) == 0 {
+		s.SuccessStatusCodes = []int{http.StatusOK}
+	}
+	if s.Headers == nil {
+		s.Headers = http.Header{}
+	}
+	s.observers = append(s.observers, observers...)
+
+	d, err := newDriver(nil, s)
+	if err != nil {
+		return nil, err
+	}
+	err = d.run(ctx, uuid.New())
+	if err != nil {
+		return nil, err
+	}
+	return d.report, nil
+}
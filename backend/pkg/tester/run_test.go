@@ -0,0 +1,64 @@
+package tester
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+)
+
+func TestRun(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/missing" {
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer srv.Close()
+
+	var (
+		completed atomic.Int32
+		ended     *Report
+		maxErrors = 0.1
+	)
+	report, err := Run(context.Background(), Spec{
+		TargetUsers:      2,
+		UsersToStartWith: 2,
+		Steps: []Step{
+			{URL: srv.URL + "/ok"},
+			{URL: srv.URL + "/missing"},
+		},
+		Thresholds: []Threshold{{Metric: "error_rate", Max: &maxErrors}},
+	}, ObserverFuncs{
+		RequestComplete: func(stat *RequestStat) { completed.Add(1) },
+		TestEnd:         func(report *Report) { ended = report },
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if report.RequestedDone != 4 || report.SucceededRequests != 2 {
+		t.Errorf("expected 2 of 4 requests to succeed, got %+v", report)
+	}
+	if completed.Load() != 4 || ended != report {
+		t.Errorf("expected the observer to see 4 requests and the report, got %d", completed.Load())
+	}
+	if len(report.Thresholds) != 1 || report.Thresholds[0].Passed {
+		t.Errorf("expected the error rate threshold to fail, got %+v", report.Thresholds)
+	}
+}
+
+func TestRunErrors(t *testing.T) {
+	specs := []Spec{
+		{Steps: []Step{{URL: "http://localhost"}}},
+		{TargetUsers: 1, Thresholds: []Threshold{{Metric: "nope"}}},
+		{TargetUsers: 1, Protocol: &ProtocolConfig{Name: "carrier-pigeon"}},
+		{TargetUsers: 1, executor: &failingProtocol{}},
+	}
+	for _, s := range specs {
+		report, err := Run(context.Background(), s)
+		if err == nil || report != nil {
+			t.Errorf("expected an error for %+v, got %+v", s, report)
+		}
+	}
+}
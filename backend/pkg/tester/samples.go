@@ -0,0 +1,269 @@
+package tester
+
+import (
+	"bytes"
+	"compress/gzip"
+	"crypto/tls"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"io"
+	"math/rand/v2"
+	"net/http/httptrace"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	// A JSON object per request
+	SamplesNDJSON = "ndjson"
+	// A row per request under a header
+	SamplesCSV = "csv"
+)
+
+// SampleConfig: which requests are logged and how, see NewSampleLogger
+type SampleConfig struct {
+	// ndjson or csv, defaults to ndjson
+	Format string `json:"format,omitempty"`
+	// Fraction of the requests logged between 0 and 1, defaults to 1 for
+	// every request
+	Rate float64 `json:"rate,omitempty"`
+}
+
+// ValidateSamples: reports unknown formats and rates outside of 0 to 1
+func ValidateSamples(c *SampleConfig) error {
+	if c.Format != "" && c.Format != SamplesNDJSON && c.Format != SamplesCSV {
+		return errors.New("unknown format " + strconv.Quote(c.Format) + ", expected ndjson or csv")
+	}
+	if c.Rate < 0 || c.Rate > 1 {
+		return errors.New("rate has to be between 0 and 1")
+	}
+	return nil
+}
+
+// LogFormat: the format or its default
+func (c *SampleConfig) LogFormat() string {
+	if c.Format == "" {
+		return SamplesNDJSON
+	}
+	return c.Format
+}
+
+func (c *SampleConfig) rate() float64 {
+	if c.Rate == 0 {
+		return 1
+	}
+	return c.Rate
+}
+
+// Phases: where the time of an HTTP request went in seconds, phases that
+// didn't happen like the DNS lookup on a reused connection are 0
+type Phases struct {
+	DNSLookup    float64 `json:"dns_lookup"`
+	Connect      float64 `json:"connect"`
+	TLSHandshake float64 `json:"tls_handshake"`
+	// From the request being written until the first byte of the response
+	Waiting float64 `json:"waiting"`
+}
+
+// phaseTracer: times the phases of a request off its client trace, the
+// hooks are called from the transport's goroutines
+type phaseTracer struct {
+	mu                                     sync.Mutex
+	dnsStart, connectStart, tlsStart, sent time.Time
+	phases                                 Phases
+}
+
+func (p *phaseTracer) hook(t *httptrace.ClientTrace) {
+	since := func(start *time.Time, phase *float64) {
+		p.mu.Lock()
+		defer p.mu.Unlock()
+		if !start.IsZero() {
+			*phase = time.Since(*start).Seconds()
+		}
+	}
+	mark := func(start *time.Time) {
+		p.mu.Lock()
+		defer p.mu.Unlock()
+		*start = time.Now()
+	}
+
+	t.DNSStart = func(httptrace.DNSStartInfo) { mark(&p.dnsStart) }
+	t.DNSDone = func(httptrace.DNSDoneInfo) { since(&p.dnsStart, &p.phases.DNSLookup) }
+	t.ConnectStart = func(string, string) { mark(&p.connectStart) }
+	t.ConnectDone = func(_, _ string, err error) {
+		if err == nil {
+			since(&p.connectStart, &p.phases.Connect)
+		}
+	}
+	t.TLSHandshakeStart = func() { mark(&p.tlsStart) }
+	t.TLSHandshakeDone = func(_ tls.ConnectionState, err error) {
+		if err == nil {
+			since(&p.tlsStart, &p.phases.TLSHandshake)
+		}
+	}
+	t.WroteRequest = func(httptrace.WroteRequestInfo) { mark(&p.sent) }
+	t.GotFirstResponseByte = func() { since(&p.sent, &p.phases.Waiting) }
+}
+
+func (p *phaseTracer) result() *Phases {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	phases := p.phases
+	return &phases
+}
+
+// Sample: a request as it's logged
+type Sample struct {
+	Timestamp  time.Time `json:"timestamp"`
+	VU         int       `json:"vu"`
+	Endpoint   string    `json:"endpoint"`
+	Retry      int       `json:"retry,omitempty"`
+	Status     int       `json:"status,omitempty"`
+	GRPCStatus string    `json:"grpc_status,omitempty"`
+	Success    bool      `json:"success"`
+	// Seconds, the time to the first event for streams
+	Latency       float64 `json:"latency"`
+	Phases        *Phases `json:"phases,omitempty"`
+	BytesSent     int64   `json:"bytes_sent"`
+	BytesReceived int64   `json:"bytes_received"`
+	ErrorCategory string  `json:"error_category,omitempty"`
+	Error         string  `json:"error,omitempty"`
+}
+
+func newSample(s *RequestStat) *Sample {
+	return &Sample{
+		Timestamp:     s.StartedAt,
+		VU:            s.VU,
+		Endpoint:      s.Endpoint,
+		Retry:         s.Retry,
+		Status:        s.StatusCode,
+		GRPCStatus:    s.GRPCStatus,
+		Success:       s.IsSuccess,
+		Latency:       s.TimeTakenInSeconds,
+		Phases:        s.Phases,
+		BytesSent:     s.BytesSent,
+		BytesReceived: s.BytesReceived,
+		ErrorCategory: s.ErrorCategory,
+		Error:         s.errorMessage,
+	}
+}
+
+var sampleColumns = []string{
+	"timestamp", "vu", "endpoint", "retry", "status", "grpc_status", "success", "latency",
+	"dns_lookup", "connect", "tls_handshake", "waiting",
+	"bytes_sent", "bytes_received", "error_category", "error",
+}
+
+func (s *Sample) row() []string {
+	status := ""
+	if s.Status != 0 {
+		status = strconv.Itoa(s.Status)
+	}
+	row := []string{
+		s.Timestamp.UTC().Format(time.RFC3339Nano),
+		strconv.Itoa(s.VU),
+		s.Endpoint,
+		strconv.Itoa(s.Retry),
+		status,
+		s.GRPCStatus,
+		strconv.FormatBool(s.Success),
+		formatFloat(s.Latency),
+	}
+	if s.Phases != nil {
+		row = append(row,
+			formatFloat(s.Phases.DNSLookup),
+			formatFloat(s.Phases.Connect),
+			formatFloat(s.Phases.TLSHandshake),
+			formatFloat(s.Phases.Waiting))
+	} else {
+		row = append(row, "", "", "", "")
+	}
+	return append(row,
+		strconv.FormatInt(s.BytesSent, 10),
+		strconv.FormatInt(s.BytesReceived, 10),
+		s.ErrorCategory,
+		s.Error)
+}
+
+// sampleLogger: writes the sampled requests gzipped, requests are logged in
+// the order they complete
+type sampleLogger struct {
+	ObserverFuncs
+	mu     sync.Mutex
+	out    io.WriteCloser
+	gz     *gzip.Writer
+	csv    bool
+	rate   float64
+	failed bool
+}
+
+// errSamplesFull: out said it's full, see NewSampleLogger
+var errSamplesFull = errors.New("sample log is full")
+
+// NewSampleLogger: an observer that logs the requests of the run to out as
+// gzipped NDJSON or CSV, out is closed once the run is over. Logging stops
+// at the first write error or once out has a Full method that says so
+func NewSampleLogger(out io.WriteCloser, c *SampleConfig) Observer {
+	if c == nil {
+		c = &SampleConfig{}
+	}
+	l := &sampleLogger{out: out, gz: gzip.NewWriter(out), rate: c.rate()}
+	if c.LogFormat() == SamplesCSV {
+		l.csv = true
+		l.fail(writeCSV(l.gz, sampleColumns))
+	}
+	return l
+}
+
+func writeCSV(w io.Writer, row []string) error {
+	c := csv.NewWriter(w)
+	c.Write(row)
+	c.Flush()
+	return c.Error()
+}
+
+func (l *sampleLogger) OnRequestComplete(s *RequestStat) {
+	if l.rate < 1 && rand.Float64() >= l.rate {
+		return
+	}
+	// Encoded before taking the lock so the users only wait on each other
+	// for the write
+	var line bytes.Buffer
+	sample := newSample(s)
+	if l.csv {
+		writeCSV(&line, sample.row())
+	} else {
+		json.NewEncoder(&line).Encode(sample)
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.failed {
+		return
+	}
+	if f, ok := l.out.(interface{ Full() bool }); ok && f.Full() {
+		l.fail(errSamplesFull)
+		return
+	}
+	_, err := l.gz.Write(line.Bytes())
+	l.fail(err)
+}
+
+func (l *sampleLogger) OnTestEnd(*Report) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.fail(l.gz.Close())
+	l.fail(l.out.Close())
+}
+
+func (l *sampleLogger) fail(err error) {
+	if err == nil || l.failed {
+		return
+	}
+	l.failed = true
+	logrus.Error("samples of the rest of the run aren't logged ", err)
+}
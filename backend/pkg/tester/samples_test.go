@@ -0,0 +1,164 @@
+package tester
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/google/uuid"
+)
+
+// sampleBuffer: a sample log in memory
+type sampleBuffer struct {
+	bytes.Buffer
+	closed bool
+	full   bool
+}
+
+func (b *sampleBuffer) Close() error {
+	b.closed = true
+	return nil
+}
+
+func (b *sampleBuffer) Full() bool {
+	return b.full
+}
+
+func (b *sampleBuffer) decompressed(t *testing.T) []byte {
+	gz, err := gzip.NewReader(&b.Buffer)
+	if err != nil {
+		t.Fatalf("invalid gzip: %v", err)
+	}
+	data, err := io.ReadAll(gz)
+	if err != nil {
+		t.Fatalf("invalid gzip: %v", err)
+	}
+	return data
+}
+
+func runSampled(t *testing.T, out *sampleBuffer, c *SampleConfig, url string) {
+	d, err := New(nil,
+		WithPeakConfig(2, 0, 2),
+		WithSteps(
+			Step{Name: "ok", URL: url + "/ok"},
+			Step{Name: "missing", URL: url + "/missing"},
+		),
+		WithObservers(NewSampleLogger(out, c)),
+	)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	d.Run(context.Background(), uuid.New())
+	if !out.closed {
+		t.Error("expected the log to be closed")
+	}
+}
+
+func sampleServer() *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/missing" {
+			w.WriteHeader(http.StatusNotFound)
+		}
+		w.Write([]byte("hello"))
+	}))
+}
+
+func TestSampleLoggerNDJSON(t *testing.T) {
+	srv := sampleServer()
+	defer srv.Close()
+
+	out := &sampleBuffer{}
+	runSampled(t, out, nil, srv.URL)
+
+	samples := []Sample{}
+	scanner := bufio.NewScanner(bytes.NewReader(out.decompressed(t)))
+	for scanner.Scan() {
+		s := Sample{}
+		err := json.Unmarshal(scanner.Bytes(), &s)
+		if err != nil {
+			t.Fatalf("invalid line %q: %v", scanner.Text(), err)
+		}
+		samples = append(samples, s)
+	}
+	if len(samples) != 4 {
+		t.Fatalf("expected a sample per request, got %d", len(samples))
+	}
+
+	vus := map[int]bool{}
+	for _, s := range samples {
+		vus[s.VU] = true
+		if s.Timestamp.IsZero() || s.Latency <= 0 || s.Phases == nil || s.BytesSent == 0 || s.BytesReceived == 0 {
+			t.Errorf("expected the timing, phases and sizes of the request, got %+v", s)
+		}
+		if (s.Endpoint == "ok") != (s.Status == http.StatusOK && s.Success) {
+			t.Errorf("unexpected status of %s: %d %v", s.Endpoint, s.Status, s.Success)
+		}
+	}
+	if len(vus) != 2 || vus[0] {
+		t.Errorf("expected the requests of users 1 and 2, got %v", vus)
+	}
+}
+
+func TestSampleLoggerCSV(t *testing.T) {
+	srv := sampleServer()
+	defer srv.Close()
+
+	out := &sampleBuffer{}
+	runSampled(t, out, &SampleConfig{Format: SamplesCSV}, srv.URL)
+
+	rows, err := csv.NewReader(bytes.NewReader(out.decompressed(t))).ReadAll()
+	if err != nil {
+		t.Fatalf("invalid csv: %v", err)
+	}
+	if len(rows) != 5 || len(rows[1]) != len(sampleColumns) || rows[0][0] != "timestamp" {
+		t.Fatalf("expected the header and 4 rows, got %v", rows)
+	}
+}
+
+func TestSampleLoggerRate(t *testing.T) {
+	srv := sampleServer()
+	defer srv.Close()
+
+	out := &sampleBuffer{}
+	runSampled(t, out, &SampleConfig{Rate: 0.000001}, srv.URL)
+	if data := out.decompressed(t); len(data) != 0 {
+		t.Errorf("expected nothing to be sampled, got %s", data)
+	}
+}
+
+func TestSampleLoggerErrors(t *testing.T) {
+	out := &sampleBuffer{}
+	l := NewSampleLogger(out, nil)
+	l.OnRequestComplete(&RequestStat{Endpoint: "GET /", ErrorCategory: ErrorConnectionRefused, errorMessage: "dial tcp: connection refused"})
+	out.full = true
+	l.OnRequestComplete(&RequestStat{Endpoint: "GET /"})
+	l.OnTestEnd(&Report{})
+
+	s := Sample{}
+	data := out.decompressed(t)
+	err := json.Unmarshal(data, &s)
+	if err != nil {
+		t.Fatalf("expected a single sample, got %s", data)
+	}
+	if s.ErrorCategory != ErrorConnectionRefused || s.Error != "dial tcp: connection refused" || s.Phases != nil {
+		t.Errorf("unexpected sample %+v", s)
+	}
+}
+
+func TestValidateSamples(t *testing.T) {
+	for _, c := range []SampleConfig{{Format: "parquet"}, {Rate: 1.5}, {Rate: -0.1}} {
+		if ValidateSamples(&c) == nil {
+			t.Errorf("expected an error for %+v", c)
+		}
+	}
+	if err := ValidateSamples(&SampleConfig{Format: SamplesCSV, Rate: 0.1}); err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+}
@@ -0,0 +1,338 @@
+package tester
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"regexp"
+	"strconv"
+	"sync"
+	"time"
+)
+
+const (
+	EncodingText   = "text"
+	EncodingHex    = "hex"
+	EncodingBase64 = "base64"
+
+	// The peer closed the connection before the response matched
+	ErrorSocketClosed = "socket_closed"
+
+	defaultSocketTimeout = 5 * time.Second
+	// Largest UDP datagram
+	maxDatagram = 64 * 1024
+)
+
+// SocketConfig: every iteration of a virtual user opens a TCP connection or
+// UDP socket, writes the payload and waits for a response when one is expected
+type SocketConfig struct {
+	// tcp or udp
+	Network string `json:"network"`
+	// host:port to connect or send to
+	Address string `json:"address"`
+	// Bytes written, text payloads can use {{vu}}
+	Payload string `json:"payload"`
+	// text, hex or base64, defaults to text. Applies to the delimiter too
+	Encoding string `json:"encoding,omitempty"`
+	// Fire and forget when not set
+	Response *SocketResponse `json:"response,omitempty"`
+	// Covers the connect, write and response, defaults to 5 seconds
+	TimeoutInMilliseconds int `json:"timeout_in_milliseconds,omitempty"`
+}
+
+// SocketResponse: when the response is complete, set one of them
+type SocketResponse struct {
+	// Response ends with the delimiter, e.g "\n" or "0d0a" in hex
+	Delimiter string `json:"delimiter,omitempty"`
+	// Response is this many bytes
+	Length int `json:"length,omitempty"`
+	// Response is complete once what was read matches
+	Regex string `json:"regex,omitempty"`
+}
+
+type SocketReport struct {
+	Connections        int32   `json:"connections"`
+	FailedConnections  int32   `json:"failed_connections"`
+	AverageConnectTime float64 `json:"average_connect_time"`
+	PeakConnectTime    float64 `json:"peak_connect_time"`
+
+	// Payloads written until the response matched
+	RoundTrips         int64      `json:"round_trips"`
+	AverageRoundTrip   float64    `json:"average_round_trip"`
+	P50RoundTrip       float64    `json:"p_50_round_trip"`
+	P90RoundTrip       float64    `json:"p_90_round_trip"`
+	P99RoundTrip       float64    `json:"p_99_round_trip"`
+	RoundTripHistogram *Histogram `json:"round_trip_histogram,omitempty"`
+}
+
+// Option fn to send raw TCP or UDP payloads instead of making HTTP requests
+func WithSocket(c *SocketConfig) Option {
+	return withBuiltin(ProtocolSocket, c)
+}
+
+// ValidateSocket: reports configs that can't be sent or matched
+func ValidateSocket(c *SocketConfig) error {
+	if c.Network != "tcp" && c.Network != "udp" {
+		return fmt.Errorf("socket network has to be tcp or udp, got %q", c.Network)
+	}
+	if _, _, err := net.SplitHostPort(c.Address); err != nil {
+		return fmt.Errorf("socket address has to be host:port: %w", err)
+	}
+	if _, err := decodePayload(c.Payload, c.Encoding); err != nil {
+		return err
+	}
+	if c.TimeoutInMilliseconds < 0 {
+		return errors.New("socket timeout can't be negative")
+	}
+
+	r := c.Response
+	if r == nil {
+		return nil
+	}
+	set := 0
+	for _, ok := range []bool{r.Delimiter != "", r.Length != 0, r.Regex != ""} {
+		if ok {
+			set++
+		}
+	}
+	if set != 1 {
+		return errors.New("socket response needs one of delimiter, length or regex")
+	}
+	if r.Length < 0 {
+		return errors.New("socket response length can't be negative")
+	}
+	if r.Delimiter != "" {
+		if _, err := decodePayload(r.Delimiter, c.Encoding); err != nil {
+			return fmt.Errorf("socket response delimiter: %w", err)
+		}
+	}
+	if r.Regex != "" {
+		if _, err := regexp.Compile(r.Regex); err != nil {
+			return fmt.Errorf("socket response regex: %w", err)
+		}
+	}
+	return nil
+}
+
+func decodePayload(payload string, encoding string) ([]byte, error) {
+	switch encoding {
+	case "", EncodingText:
+		return []byte(payload), nil
+	case EncodingHex:
+		decoded, err := hex.DecodeString(payload)
+		if err != nil {
+			return nil, fmt.Errorf("invalid hex payload: %w", err)
+		}
+		return decoded, nil
+	case EncodingBase64:
+		decoded, err := base64.StdEncoding.DecodeString(payload)
+		if err != nil {
+			return nil, fmt.Errorf("invalid base64 payload: %w", err)
+		}
+		return decoded, nil
+	}
+	return nil, fmt.Errorf("unknown encoding %q, expected text, hex or base64", encoding)
+}
+
+type socketClient struct {
+	config    *SocketConfig
+	payload   []byte
+	templated bool
+	delimiter []byte
+	re        *regexp.Regexp
+	timeout   time.Duration
+	stats     *socketStats
+}
+
+func newSocketClient(c *SocketConfig, stats *socketStats) (*socketClient, error) {
+	err := ValidateSocket(c)
+	if err != nil {
+		return nil, err
+	}
+
+	s := &socketClient{
+		config:  c,
+		timeout: defaultSocketTimeout,
+		stats:   stats,
+	}
+	s.payload, _ = decodePayload(c.Payload, c.Encoding)
+	s.templated = (c.Encoding == "" || c.Encoding == EncodingText) && placeholder.Match(s.payload)
+	if c.TimeoutInMilliseconds > 0 {
+		s.timeout = time.Duration(c.TimeoutInMilliseconds) * time.Millisecond
+	}
+	if r := c.Response; r != nil {
+		s.delimiter, _ = decodePayload(r.Delimiter, c.Encoding)
+		if r.Regex != "" {
+			s.re = regexp.MustCompile(r.Regex)
+		}
+	}
+	return s, nil
+}
+
+func (s *socketClient) payloadFor(vu int) []byte {
+	if !s.templated {
+		return s.payload
+	}
+	return placeholder.ReplaceAllFunc(s.payload, func(p []byte) []byte {
+		if string(placeholder.FindSubmatch(p)[1]) == "vu" {
+			return []byte(strconv.Itoa(vu))
+		}
+		return p
+	})
+}
+
+// Connects, writes the payload and reads the response, the time taken is
+// the round trip or the write when no response is expected
+func (s *socketClient) call(ctx context.Context, vu int) *RequestStat {
+	stat := &RequestStat{Endpoint: s.config.Network + "://" + s.config.Address}
+
+	ctx, cancel := context.WithTimeout(ctx, s.timeout)
+	defer cancel()
+
+	start := time.Now()
+	conn, err := (&net.Dialer{}).DialContext(ctx, s.config.Network, s.config.Address)
+	s.stats.recordConnect(time.Since(start).Seconds(), err)
+	if err != nil {
+		stat.TimeTakenInSeconds = time.Since(start).Seconds()
+		stat.ErrorCategory = categorizeError(err)
+		return stat
+	}
+	defer conn.Close()
+	deadline, _ := ctx.Deadline()
+	conn.SetDeadline(deadline)
+	stat.RemoteAddress = conn.RemoteAddr().String()
+
+	payload := s.payloadFor(vu)
+	sent := time.Now()
+	n, err := conn.Write(payload)
+	stat.BytesSent = int64(n)
+	if err == nil && s.config.Response != nil {
+		var received int64
+		received, err = s.readResponse(conn)
+		stat.BytesReceived = received
+	}
+	stat.TimeTakenInSeconds = time.Since(sent).Seconds()
+	stat.BytesReceivedUncompressed = stat.BytesReceived
+
+	switch {
+	case errors.Is(err, io.EOF):
+		stat.ErrorCategory = ErrorSocketClosed
+	case err != nil:
+		stat.ErrorCategory = categorizeError(err)
+	default:
+		stat.IsSuccess = true
+		if s.config.Response != nil {
+			s.stats.recordRoundTrip(stat.TimeTakenInSeconds)
+		}
+	}
+	return stat
+}
+
+func (s *socketClient) Prepare(ctx context.Context) error {
+	return nil
+}
+
+func (s *socketClient) Execute(ctx context.Context, vu int, record func(*RequestStat)) {
+	record(s.call(ctx, vu))
+}
+
+func (s *socketClient) Close() error {
+	return nil
+}
+
+func (s *socketClient) AddToReport(r *Report, elapsed time.Duration) {
+	r.Socket = s.stats.report()
+}
+
+// Reads until the response is complete, UDP reads a datagram at a time
+func (s *socketClient) readResponse(conn net.Conn) (int64, error) {
+	var (
+		read   []byte
+		buffer = make([]byte, maxDatagram)
+	)
+	for {
+		n, err := conn.Read(buffer)
+		read = append(read, buffer[:n]...)
+		if s.complete(read) {
+			return int64(len(read)), nil
+		}
+		if err != nil {
+			return int64(len(read)), err
+		}
+	}
+}
+
+func (s *socketClient) complete(read []byte) bool {
+	r := s.config.Response
+	switch {
+	case r.Length > 0:
+		return len(read) >= r.Length
+	case len(s.delimiter) > 0:
+		return bytes.Contains(read, s.delimiter)
+	case s.re != nil:
+		return s.re.Match(read)
+	}
+	return true
+}
+
+type socketStats struct {
+	mu                sync.Mutex
+	connectTimes      []float64
+	failedConnections int32
+	roundTrips        *Histogram
+	roundTripTime     float64
+	roundTripCount    int64
+}
+
+func (s *socketStats) recordConnect(seconds float64, err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err != nil {
+		s.failedConnections++
+		return
+	}
+	s.connectTimes = append(s.connectTimes, seconds)
+}
+
+func (s *socketStats) recordRoundTrip(seconds float64) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.roundTrips == nil {
+		s.roundTrips = NewHistogram()
+	}
+	s.roundTrips.Record(seconds)
+	s.roundTripTime += seconds
+	s.roundTripCount++
+}
+
+func (s *socketStats) report() *SocketReport {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	r := &SocketReport{
+		Connections:        int32(len(s.connectTimes)) + s.failedConnections,
+		FailedConnections:  s.failedConnections,
+		PeakConnectTime:    max(s.connectTimes),
+		RoundTrips:         s.roundTripCount,
+		RoundTripHistogram: s.roundTrips,
+	}
+	if len(s.connectTimes) > 0 {
+		sum := 0.0
+		for _, t := range s.connectTimes {
+			sum += t
+		}
+		r.AverageConnectTime = sum / float64(len(s.connectTimes))
+	}
+	if s.roundTripCount > 0 {
+		r.AverageRoundTrip = s.roundTripTime / float64(s.roundTripCount)
+		r.P50RoundTrip = s.roundTrips.Percentile(50)
+		r.P90RoundTrip = s.roundTrips.Percentile(90)
+		r.P99RoundTrip = s.roundTrips.Percentile(99)
+	}
+	return r
+}
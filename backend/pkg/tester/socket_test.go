@@ -0,0 +1,148 @@
+package tester
+
+import (
+	"bufio"
+	"context"
+	"io"
+	"net"
+	"testing"
+
+	"github.com/google/uuid"
+)
+
+// Serves every accepted connection with handle until the test ends
+func startTCPServer(t *testing.T, handle func(net.Conn)) string {
+	t.Helper()
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("unable to listen: %v", err)
+	}
+	t.Cleanup(func() { listener.Close() })
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer conn.Close()
+				handle(conn)
+			}()
+		}
+	}()
+	return listener.Addr().String()
+}
+
+func TestSocketTCP(t *testing.T) {
+	address := startTCPServer(t, func(conn net.Conn) {
+		line, _ := bufio.NewReader(conn).ReadString('\n')
+		conn.Write([]byte("PONG " + line))
+	})
+
+	d, err := New(nil,
+		WithPeakConfig(2, 0, 2),
+		WithSocket(&SocketConfig{
+			Network:  "tcp",
+			Address:  address,
+			Payload:  "PING {{vu}}\n",
+			Response: &SocketResponse{Delimiter: "\n"},
+		}),
+	)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	d.Run(context.Background(), uuid.New())
+
+	r := d.Report()
+	if r.SucceededRequests != 2 {
+		t.Fatalf("expected 2 round trips, got %+v", r)
+	}
+	if r.Socket == nil || r.Socket.Connections != 2 || r.Socket.RoundTrips != 2 || r.Socket.P99RoundTrip <= 0 {
+		t.Errorf("unexpected socket report %+v", r.Socket)
+	}
+	if r.BytesSent != 2*int64(len("PING 1\n")) || r.BytesReceived != 2*int64(len("PONG PING 1\n")) {
+		t.Errorf("unexpected bytes sent %d and received %d", r.BytesSent, r.BytesReceived)
+	}
+}
+
+func TestSocketResponses(t *testing.T) {
+	// Answers a 2 byte request with 4 bytes split over two writes
+	binary := startTCPServer(t, func(conn net.Conn) {
+		request := make([]byte, 2)
+		io.ReadFull(conn, request)
+		conn.Write([]byte{0xca, 0xfe})
+		conn.Write([]byte{0xba, 0xbe})
+	})
+	closing := startTCPServer(t, func(conn net.Conn) {
+		conn.Read(make([]byte, 1))
+	})
+	silent := startTCPServer(t, func(conn net.Conn) {
+		io.Copy(io.Discard, conn)
+	})
+
+	udp, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("unable to listen: %v", err)
+	}
+	defer udp.Close()
+	go func() {
+		buffer := make([]byte, maxDatagram)
+		for {
+			n, addr, err := udp.ReadFrom(buffer)
+			if err != nil {
+				return
+			}
+			udp.WriteTo(append([]byte("echo:"), buffer[:n]...), addr)
+		}
+	}()
+
+	refused, _ := net.Listen("tcp", "127.0.0.1:0")
+	refusedAddress := refused.Addr().String()
+	refused.Close()
+
+	tests := []struct {
+		name     string
+		config   SocketConfig
+		category string
+	}{
+		{"length", SocketConfig{Network: "tcp", Address: binary, Payload: "0102", Encoding: EncodingHex,
+			Response: &SocketResponse{Length: 4}}, ""},
+		{"udp regex", SocketConfig{Network: "udp", Address: udp.LocalAddr().String(), Payload: "aGk=", Encoding: EncodingBase64,
+			Response: &SocketResponse{Regex: "^echo:hi$"}}, ""},
+		{"fire and forget", SocketConfig{Network: "tcp", Address: silent, Payload: "x"}, ""},
+		{"closed", SocketConfig{Network: "tcp", Address: closing, Payload: "x",
+			Response: &SocketResponse{Delimiter: "\n"}}, ErrorSocketClosed},
+		{"timeout", SocketConfig{Network: "tcp", Address: silent, Payload: "x", TimeoutInMilliseconds: 50,
+			Response: &SocketResponse{Delimiter: "\n"}}, ErrorTimeout},
+		{"refused", SocketConfig{Network: "tcp", Address: refusedAddress, Payload: "x"}, ErrorConnectionRefused},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s, err := newSocketClient(&tt.config, &socketStats{})
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			stat := s.call(context.Background(), 1)
+			if stat.IsSuccess != (tt.category == "") || stat.ErrorCategory != tt.category {
+				t.Errorf("expected error category %q, got %+v", tt.category, stat)
+			}
+		})
+	}
+}
+
+func TestValidateSocket(t *testing.T) {
+	configs := []SocketConfig{
+		{Network: "sctp", Address: "localhost:1"},
+		{Network: "tcp", Address: "localhost"},
+		{Network: "tcp", Address: "localhost:1", Payload: "zz", Encoding: EncodingHex},
+		{Network: "tcp", Address: "localhost:1", Payload: "x", Encoding: "rot13"},
+		{Network: "tcp", Address: "localhost:1", Response: &SocketResponse{}},
+		{Network: "tcp", Address: "localhost:1", Response: &SocketResponse{Length: 2, Delimiter: "\n"}},
+		{Network: "tcp", Address: "localhost:1", Response: &SocketResponse{Regex: "("}},
+	}
+	for _, c := range configs {
+		if err := ValidateSocket(&c); err == nil {
+			t.Errorf("expected an error for %+v", c)
+		}
+	}
+}
@@ -0,0 +1,221 @@
+package tester
+
+import (
+	"bytes"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// Value is a comma separated list of accepted status codes
+	CheckStatus = "status"
+	// Value has to be part of the response body
+	CheckBodyContains = "body_contains"
+	// Header has to be present, and equal to Value when given
+	CheckHeader = "header"
+	// Value is the max response time in milliseconds
+	CheckResponseTime = "response_time"
+)
+
+// Step: a request of the scenario, every virtual user goes through the steps
+// in order on each iteration
+type Step struct {
+	// Name the step is reported under, defaults to METHOD URL
+	Name    string
+	Method  string
+	URL     string
+	Headers http.Header
+	Body    []byte
+	// Falls back to the success status codes of the test
+	SuccessStatusCodes []int
+	Checks             []Check
+	// Values of the response later steps of the iteration can use
+	Extract []Extract
+	// Sends a GraphQL operation, the body is built from it
+	GraphQL *GraphQL
+	// Reads the response as a stream of events
+	Stream *StreamConfig
+
+	// Body with the query of a persisted GraphQL query
+	queryBody []byte
+}
+
+// Check: an assertion on the response of a step, checks don't change
+// whether a request succeeded and are reported on their own
+type Check struct {
+	// Name the check is reported under, defaults to the step and type
+	Name   string `json:"name,omitempty"`
+	Type   string `json:"type"`
+	Value  string `json:"value,omitempty"`
+	Header string `json:"header,omitempty"`
+}
+
+type CheckReport struct {
+	Passes int32 `json:"passes"`
+	Fails  int32 `json:"fails"`
+}
+
+func (s *Step) endpoint() string {
+	if s.Name != "" {
+		return s.Name
+	}
+	return s.method() + " " + s.URL
+}
+
+func (s *Step) method() string {
+	if s.Method == "" {
+		return http.MethodGet
+	}
+	return s.Method
+}
+
+func (s *Step) needsBody() bool {
+	if s.GraphQL != nil {
+		return true
+	}
+	for _, c := range s.Checks {
+		if c.Type == CheckBodyContains {
+			return true
+		}
+	}
+	for _, e := range s.Extract {
+		if e.fromBody() {
+			return true
+		}
+	}
+	return false
+}
+
+func (c *Check) name(s *Step) string {
+	if c.Name != "" {
+		return c.Name
+	}
+	return s.endpoint() + " " + c.Type
+}
+
+// ValidateCheck: reports checks with an unknown type or unusable value
+func ValidateCheck(c Check) error {
+	switch c.Type {
+	case CheckStatus:
+		for _, code := range strings.Split(c.Value, ",") {
+			if _, err := strconv.Atoi(strings.TrimSpace(code)); err != nil {
+				return fmt.Errorf("status check expects comma separated status codes, got %q", c.Value)
+			}
+		}
+	case CheckBodyContains:
+		if c.Value == "" {
+			return fmt.Errorf("body_contains check needs a value")
+		}
+	case CheckHeader:
+		if c.Header == "" {
+			return fmt.Errorf("header check needs a header")
+		}
+	case CheckResponseTime:
+		if ms, err := strconv.Atoi(c.Value); err != nil || ms <= 0 {
+			return fmt.Errorf("response_time check expects milliseconds, got %q", c.Value)
+		}
+	case CheckEventCount:
+		if n, err := strconv.Atoi(c.Value); err != nil || n <= 0 {
+			return fmt.Errorf("event_count check expects a number of events, got %q", c.Value)
+		}
+	case CheckEventContains:
+		if c.Value == "" {
+			return fmt.Errorf("event_contains check needs a value")
+		}
+	case CheckTimeToFirstEvent:
+		if ms, err := strconv.Atoi(c.Value); err != nil || ms <= 0 {
+			return fmt.Errorf("time_to_first_event check expects milliseconds, got %q", c.Value)
+		}
+	default:
+		return fmt.Errorf("unknown check type %q", c.Type)
+	}
+	return nil
+}
+
+func (c *Check) passes(stat *RequestStat, header http.Header, body []byte) bool {
+	switch c.Type {
+	case CheckStatus:
+		for _, code := range strings.Split(c.Value, ",") {
+			if strings.TrimSpace(code) == strconv.Itoa(stat.StatusCode) {
+				return true
+			}
+		}
+		return false
+	case CheckBodyContains:
+		return bytes.Contains(body, []byte(c.Value))
+	case CheckHeader:
+		if header == nil {
+			return false
+		}
+		values, ok := header[http.CanonicalHeaderKey(c.Header)]
+		return ok && (c.Value == "" || strings.Join(values, ",") == c.Value)
+	case CheckResponseTime:
+		ms, _ := strconv.Atoi(c.Value)
+		return stat.TimeTakenInSeconds*1000 <= float64(ms)
+	case CheckEventCount:
+		n, _ := strconv.Atoi(c.Value)
+		return stat.stream != nil && len(stat.stream.events) >= n
+	case CheckEventContains:
+		if stat.stream == nil || len(stat.stream.events) == 0 {
+			return false
+		}
+		for _, e := range stat.stream.events {
+			if !strings.Contains(e.data, c.Value) {
+				return false
+			}
+		}
+		return true
+	case CheckTimeToFirstEvent:
+		if stat.stream == nil {
+			return false
+		}
+		ms, _ := strconv.Atoi(c.Value)
+		first, ok := stat.stream.timeToFirstEvent()
+		return ok && first <= time.Duration(ms)*time.Millisecond
+	}
+	return false
+}
+
+type checkStats struct {
+	mu     sync.Mutex
+	checks map[string]*CheckReport
+}
+
+func (s *checkStats) record(name string, passed bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.checks == nil {
+		s.checks = map[string]*CheckReport{}
+	}
+	c, ok := s.checks[name]
+	if !ok {
+		c = &CheckReport{}
+		s.checks[name] = c
+	}
+	if passed {
+		c.Passes++
+	} else {
+		c.Fails++
+	}
+}
+
+func (s *checkStats) report() map[string]*CheckReport {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if len(s.checks) == 0 {
+		return nil
+	}
+	return s.checks
+}
+
+// Runs the checks of the step against a response, failed requests fail all
+// the checks
+func (s *checkStats) evaluate(step *Step, stat *RequestStat, header http.Header, body []byte) {
+	for _, c := range step.Checks {
+		s.record(c.name(step), stat.ErrorCategory == "" && c.passes(stat, header, body))
+	}
+}
@@ -0,0 +1,120 @@
+package tester
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestStepsRunInOrderWithChecks(t *testing.T) {
+	paths := []string{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		paths = append(paths, r.URL.Path)
+		if r.URL.Path == "/login" && r.Header.Get("X-Step") != "login" {
+			t.Errorf("expected step headers on the login request")
+		}
+		w.Header().Set("X-Trace", "abc")
+		w.Write([]byte(`{"token":"t"}`))
+	}))
+	defer server.Close()
+
+	d, err := New(nil,
+		WithPeakConfig(1, 0, 1),
+		WithRequestConfig(server.URL, nil, http.StatusOK),
+		WithSteps(
+			Step{
+				Name:    "login",
+				Method:  http.MethodPost,
+				URL:     server.URL + "/login",
+				Headers: http.Header{"X-Step": {"login"}},
+				Checks: []Check{
+					{Type: CheckBodyContains, Value: "token"},
+					{Name: "traced", Type: CheckHeader, Header: "x-trace", Value: "abc"},
+				},
+			},
+			Step{
+				URL:                server.URL + "/cart",
+				SuccessStatusCodes: []int{http.StatusCreated},
+				Checks:             []Check{{Type: CheckStatus, Value: "201"}},
+			},
+		),
+	)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	d.doRequestAndReturnStatsDriver(context.Background(), 1)
+
+	if len(paths) != 2 || paths[0] != "/login" || paths[1] != "/cart" {
+		t.Errorf("expected steps in order, got %v", paths)
+	}
+	if d.requestsSucceeded.Load() != 1 || d.requestsFailed.Load() != 1 {
+		t.Errorf("expected the step status codes to decide success, got %d/%d",
+			d.requestsSucceeded.Load(), d.requestsFailed.Load())
+	}
+
+	checks := d.checkStats.report()
+	if c := checks["login body_contains"]; c == nil || c.Passes != 1 {
+		t.Errorf("expected body check to pass, got %+v", c)
+	}
+	if c := checks["traced"]; c == nil || c.Passes != 1 {
+		t.Errorf("expected header check to pass, got %+v", c)
+	}
+	if c := checks["GET "+server.URL+"/cart status"]; c == nil || c.Fails != 1 {
+		t.Errorf("expected status check to fail, got %+v", c)
+	}
+}
+
+func TestInvalidCheckIsRejected(t *testing.T) {
+	_, err := New(nil,
+		WithPeakConfig(1, 0, 1),
+		WithSteps(Step{URL: "http://example.com", Checks: []Check{{Type: "latency"}}}),
+	)
+	if err == nil {
+		t.Errorf("expected an error for an unknown check type")
+	}
+}
+
+func TestExtractedValuesFeedLaterSteps(t *testing.T) {
+	var got []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/login":
+			w.Header().Set("Set-Cookie", "session=s3cr3t; Path=/")
+			w.Write([]byte(`{"data": {"user": {"id": 42}}}`))
+		default:
+			got = append(got, r.URL.Path, r.Header.Get("Cookie"))
+		}
+	}))
+	defer server.Close()
+
+	d, err := New(nil,
+		WithPeakConfig(1, 0, 1),
+		WithSteps(
+			Step{
+				URL: server.URL + "/login",
+				Extract: []Extract{
+					{Name: "user_id", JSONPath: "data.user.id"},
+					{Name: "session", Header: "Set-Cookie", Regex: `session=([^;]+)`},
+				},
+			},
+			Step{
+				URL:     server.URL + "/users/{{user_id}}",
+				Headers: http.Header{"Cookie": {"session={{session}}"}},
+			},
+		),
+	)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	d.doRequestAndReturnStatsDriver(context.Background(), 1)
+
+	if len(got) != 2 || got[0] != "/users/42" || got[1] != "session=s3cr3t" {
+		t.Errorf("expected extracted values in the second request, got %v", got)
+	}
+	if _, ok := d.metrics.endpointReports()["GET "+server.URL+"/users/{{user_id}}"]; !ok {
+		t.Errorf("expected the step to be reported under its template, got %v", d.metrics.endpointReports())
+	}
+}
@@ -0,0 +1,270 @@
+package tester
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	// Server-Sent Events as sent with Content-Type: text/event-stream
+	StreamSSE = "sse"
+	// Every line is an event, e.g NDJSON streams
+	StreamLines = "lines"
+
+	// Value is the minimum number of events of the stream
+	CheckEventCount = "event_count"
+	// Value has to be part of the data of every event
+	CheckEventContains = "event_contains"
+	// Value is the max time to the first event in milliseconds
+	CheckTimeToFirstEvent = "time_to_first_event"
+)
+
+// StreamConfig: holds the response open and reads it as a stream of events,
+// the response time of a streaming request is the time to the first event
+type StreamConfig struct {
+	// sse or lines, defaults to sse
+	Format string `json:"format,omitempty"`
+	// The stream is closed after this many events when set
+	MaxEvents int `json:"max_events,omitempty"`
+	// The stream is closed after this long when set, streams that end this
+	// way still succeed
+	MaxDurationInMilliseconds int `json:"max_duration_in_milliseconds,omitempty"`
+}
+
+type StreamReport struct {
+	Streams         int32   `json:"streams"`
+	Events          int64   `json:"events"`
+	EventsPerSecond float64 `json:"events_per_second"`
+	// Streams that ended without a single event
+	EmptyStreams int32 `json:"empty_streams"`
+
+	AverageTimeToFirstEvent float64 `json:"average_time_to_first_event"`
+	P50TimeToFirstEvent     float64 `json:"p_50_time_to_first_event"`
+	P90TimeToFirstEvent     float64 `json:"p_90_time_to_first_event"`
+	P99TimeToFirstEvent     float64 `json:"p_99_time_to_first_event"`
+
+	// Gaps between consecutive events of a stream
+	AverageInterEventLatency float64 `json:"average_inter_event_latency"`
+	P50InterEventLatency     float64 `json:"p_50_inter_event_latency"`
+	P90InterEventLatency     float64 `json:"p_90_inter_event_latency"`
+	P99InterEventLatency     float64 `json:"p_99_inter_event_latency"`
+	PeakInterEventLatency    float64 `json:"peak_inter_event_latency"`
+
+	AverageStreamDuration float64 `json:"average_stream_duration"`
+	PeakStreamDuration    float64 `json:"peak_stream_duration"`
+
+	// Used to merge reports
+	TimeToFirstEventHistogram  *Histogram `json:"time_to_first_event_histogram,omitempty"`
+	InterEventLatencyHistogram *Histogram `json:"inter_event_latency_histogram,omitempty"`
+}
+
+// ValidateStream: reports unknown formats and negative limits
+func ValidateStream(c *StreamConfig) error {
+	switch c.Format {
+	case "", StreamSSE, StreamLines:
+	default:
+		return fmt.Errorf("unknown stream format %q, expected sse or lines", c.Format)
+	}
+	if c.MaxEvents < 0 || c.MaxDurationInMilliseconds < 0 {
+		return errors.New("stream limits can't be negative")
+	}
+	return nil
+}
+
+// event: an event of the stream with when it arrived
+type event struct {
+	kind string
+	data string
+	at   time.Duration
+}
+
+// streamResult: what was read of a stream
+type streamResult struct {
+	events   []event
+	duration time.Duration
+}
+
+func (r *streamResult) timeToFirstEvent() (time.Duration, bool) {
+	if len(r.events) == 0 {
+		return 0, false
+	}
+	return r.events[0].at, true
+}
+
+// Data of the events one per line, checks and extracts run against it
+func (r *streamResult) data() []byte {
+	var b bytes.Buffer
+	for _, e := range r.events {
+		b.WriteString(e.data)
+		b.WriteByte('\n')
+	}
+	return b.Bytes()
+}
+
+// Reads events off the response until it ends or a limit is hit, cancel
+// stops the request. Times are counted from start
+func readStream(c *StreamConfig, res *http.Response, start time.Time, cancel context.CancelFunc) (*streamResult, int64, int64, error) {
+	var limited atomic.Bool
+	if c.MaxDurationInMilliseconds > 0 {
+		timer := time.AfterFunc(time.Duration(c.MaxDurationInMilliseconds)*time.Millisecond-time.Since(start), func() {
+			limited.Store(true)
+			cancel()
+		})
+		defer timer.Stop()
+	}
+
+	wire := &countingReader{r: res.Body}
+	decoded := &countingReader{r: wire}
+	if res.Header.Get("Content-Encoding") == "gzip" && !res.Uncompressed {
+		gz, err := gzip.NewReader(wire)
+		if err != nil {
+			return &streamResult{}, wire.n, wire.n, err
+		}
+		defer gz.Close()
+		decoded.r = gz
+	}
+
+	result := &streamResult{}
+	reader := bufio.NewReader(decoded)
+	pending := event{}
+	dispatch := func() {
+		pending.at = time.Since(start)
+		result.events = append(result.events, pending)
+		pending = event{}
+	}
+
+	var err error
+	for c.MaxEvents == 0 || len(result.events) < c.MaxEvents {
+		var line string
+		line, err = reader.ReadString('\n')
+		if line == "" && err != nil {
+			break
+		}
+		line = strings.TrimRight(line, "\r\n")
+
+		if c.Format == StreamLines {
+			if line != "" {
+				pending.data = line
+				dispatch()
+			}
+			continue
+		}
+
+		// https://html.spec.whatwg.org/multipage/server-sent-events.html
+		field, value, _ := strings.Cut(line, ":")
+		value = strings.TrimPrefix(value, " ")
+		switch field {
+		case "":
+			if line == "" && (pending.data != "" || pending.kind != "") {
+				pending.data = strings.TrimSuffix(pending.data, "\n")
+				dispatch()
+			}
+		case "data":
+			pending.data += value + "\n"
+		case "event":
+			pending.kind = value
+		}
+	}
+	result.duration = time.Since(start)
+
+	if errors.Is(err, io.EOF) || limited.Load() {
+		err = nil
+	}
+	return result, wire.n, decoded.n, err
+}
+
+type streamStats struct {
+	mu               sync.Mutex
+	streams          int32
+	events           int64
+	empty            int32
+	timeToFirstEvent *Histogram
+	firstEventTime   float64
+	interEvent       *Histogram
+	interEventTime   float64
+	interEventCount  int64
+	peakInterEvent   float64
+	durations        []float64
+}
+
+func (s *streamStats) record(r *streamResult) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.timeToFirstEvent == nil {
+		s.timeToFirstEvent = NewHistogram()
+		s.interEvent = NewHistogram()
+	}
+
+	s.streams++
+	s.events += int64(len(r.events))
+	s.durations = append(s.durations, r.duration.Seconds())
+	first, ok := r.timeToFirstEvent()
+	if !ok {
+		s.empty++
+		return
+	}
+	s.timeToFirstEvent.Record(first.Seconds())
+	s.firstEventTime += first.Seconds()
+	for i := 1; i < len(r.events); i++ {
+		gap := (r.events[i].at - r.events[i-1].at).Seconds()
+		s.interEvent.Record(gap)
+		s.interEventTime += gap
+		s.interEventCount++
+		if gap > s.peakInterEvent {
+			s.peakInterEvent = gap
+		}
+	}
+}
+
+func (s *streamStats) report(elapsed time.Duration) *StreamReport {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.streams == 0 {
+		return nil
+	}
+
+	r := &StreamReport{
+		Streams:                    s.streams,
+		Events:                     s.events,
+		EmptyStreams:               s.empty,
+		PeakInterEventLatency:      s.peakInterEvent,
+		PeakStreamDuration:         max(s.durations),
+		TimeToFirstEventHistogram:  s.timeToFirstEvent,
+		InterEventLatencyHistogram: s.interEvent,
+	}
+	if elapsed > 0 {
+		r.EventsPerSecond = float64(s.events) / elapsed.Seconds()
+	}
+	if withEvents := s.streams - s.empty; withEvents > 0 {
+		r.AverageTimeToFirstEvent = s.firstEventTime / float64(withEvents)
+	}
+	if s.interEventCount > 0 {
+		r.AverageInterEventLatency = s.interEventTime / float64(s.interEventCount)
+	}
+	sum := 0.0
+	for _, d := range s.durations {
+		sum += d
+	}
+	r.AverageStreamDuration = sum / float64(len(s.durations))
+	r.setPercentiles()
+	return r
+}
+
+func (r *StreamReport) setPercentiles() {
+	r.P50TimeToFirstEvent = r.TimeToFirstEventHistogram.Percentile(50)
+	r.P90TimeToFirstEvent = r.TimeToFirstEventHistogram.Percentile(90)
+	r.P99TimeToFirstEvent = r.TimeToFirstEventHistogram.Percentile(99)
+	r.P50InterEventLatency = r.InterEventLatencyHistogram.Percentile(50)
+	r.P90InterEventLatency = r.InterEventLatencyHistogram.Percentile(90)
+	r.P99InterEventLatency = r.InterEventLatencyHistogram.Percentile(99)
+}
@@ -0,0 +1,147 @@
+package tester
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Sends count events 20ms apart, or events until the client leaves when
+// count is 0
+func streamServer(count int, format string) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/event-stream")
+		fmt.Fprint(w, ": connected\n\n")
+		w.(http.Flusher).Flush()
+		for i := 1; count == 0 || i <= count; i++ {
+			select {
+			case <-time.After(20 * time.Millisecond):
+			case <-r.Context().Done():
+				return
+			}
+			if format == StreamLines {
+				fmt.Fprintf(w, "{\"n\": %d}\n", i)
+			} else {
+				fmt.Fprintf(w, "event: tick\ndata: {\"n\": %d}\n\n", i)
+			}
+			w.(http.Flusher).Flush()
+		}
+	}))
+}
+
+func TestStreamingRequests(t *testing.T) {
+	srv := streamServer(3, StreamSSE)
+	defer srv.Close()
+
+	d, err := New(nil,
+		WithPeakConfig(2, 0, 2),
+		WithSteps(Step{
+			Name:   "ticks",
+			URL:    srv.URL,
+			Stream: &StreamConfig{},
+			Checks: []Check{
+				{Type: CheckEventCount, Value: "3"},
+				{Type: CheckEventContains, Value: `"n"`},
+				{Type: CheckTimeToFirstEvent, Value: "1000"},
+				{Type: CheckBodyContains, Value: `{"n": 3}`},
+			},
+			Extract: []Extract{{Name: "last", JSONPath: "n"}},
+		}),
+	)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	d.Run(context.Background(), uuid.New())
+
+	r := d.Report()
+	if r.SucceededRequests != 2 {
+		t.Fatalf("expected 2 successful streams, got %+v", r)
+	}
+	s := r.Stream
+	if s == nil || s.Streams != 2 || s.Events != 6 || s.EmptyStreams != 0 {
+		t.Fatalf("unexpected stream report %+v", s)
+	}
+	if s.AverageInterEventLatency < 0.015 || s.AverageStreamDuration < 0.05 {
+		t.Errorf("expected events about 20ms apart, got %+v", s)
+	}
+	// The response time of a stream is the time to its first event
+	if r.AverageResponseTime >= s.AverageStreamDuration {
+		t.Errorf("expected the response time to be the time to first event, got %f", r.AverageResponseTime)
+	}
+	for name, c := range r.Checks {
+		if c.Fails != 0 {
+			t.Errorf("expected check %s to pass, got %+v", name, c)
+		}
+	}
+}
+
+func TestStreamLimits(t *testing.T) {
+	tests := []struct {
+		name      string
+		config    StreamConfig
+		minEvents int
+		maxEvents int
+	}{
+		{"max events", StreamConfig{MaxEvents: 2}, 2, 2},
+		// Events are 20ms apart give or take the scheduling of the server
+		{"max duration", StreamConfig{Format: StreamLines, MaxDurationInMilliseconds: 200}, 3, 10},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srv := streamServer(0, tt.config.Format)
+			defer srv.Close()
+
+			d, err := New(nil, WithSteps(Step{URL: srv.URL, Stream: &tt.config}))
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			stat := d.attempt(context.Background(), &d.Steps[0], 1)
+			if !stat.IsSuccess || stat.stream == nil {
+				t.Fatalf("expected a successful stream, got %+v", stat)
+			}
+			if got := len(stat.stream.events); got < tt.minEvents || got > tt.maxEvents {
+				t.Errorf("expected %d to %d events, got %d", tt.minEvents, tt.maxEvents, got)
+			}
+			if stat.stream.duration > time.Second {
+				t.Errorf("expected the stream to be cut short, it lasted %s", stat.stream.duration)
+			}
+		})
+	}
+}
+
+func TestStreamsAndTheTotalTimeout(t *testing.T) {
+	srv := streamServer(0, StreamSSE)
+	defer srv.Close()
+	transport := &TransportConfig{TotalTimeoutInMilliseconds: 100}
+
+	// The max duration bounds the stream rather than the total timeout
+	d, err := New(nil, WithTransportConfig(transport), WithSteps(Step{
+		URL:    srv.URL,
+		Stream: &StreamConfig{MaxDurationInMilliseconds: 300},
+	}))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	stat := d.attempt(context.Background(), &d.Steps[0], 1)
+	if !stat.IsSuccess || stat.stream == nil || stat.stream.duration < 250*time.Millisecond {
+		t.Fatalf("expected the stream to outlive the total timeout, got %+v", stat)
+	}
+
+	// Without one the total timeout still applies
+	d, err = New(nil, WithTransportConfig(transport), WithSteps(Step{
+		URL:    srv.URL,
+		Stream: &StreamConfig{},
+	}))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	stat = d.attempt(context.Background(), &d.Steps[0], 1)
+	if stat.IsSuccess || stat.ErrorCategory != ErrorTimeout {
+		t.Fatalf("expected the stream to time out, got %+v", stat)
+	}
+}
@@ -7,21 +7,21 @@ import (
 	"fmt"
 	"log"
 	"net/http"
+	"net/http/httptrace"
 	"slices"
 	"sort"
 	"sync"
 	"sync/atomic"
 	"time"
 
-	"github.com/VarthanV/load-tester/models"
 	"github.com/VarthanV/load-tester/pkg/liveupdate"
 	"github.com/google/uuid"
 	"github.com/sirupsen/logrus"
-	"gorm.io/gorm"
 )
 
-// config: config for the tester to function
-type config struct {
+// Spec: what the tester runs, built by the options or filled in directly
+// when running as a library
+type Spec struct {
 	// The max connections that will be during the peak
 	TargetUsers int
 	// Duration to reach peak connection after the starting
@@ -45,15 +45,45 @@ type config struct {
 	// Accepted http status success codes defaults to 200
 	SuccessStatusCodes []int
 
-	db *gorm.DB
+	// How the requests authenticate against the target if needed
+	Auth *AuthConfig
+
+	// Timeouts, TLS, protocol and proxy settings of the http client
+	Transport *TransportConfig
+
+	// Redirect following, retries and response body handling
+	Redirect     *RedirectConfig
+	Retry        *RetryConfig
+	ResponseBody *ResponseBodyConfig
+
+	// Failing exchanges kept in the report
+	FailureCapture *FailureCaptureConfig
+
+	// Pass/fail criteria evaluated on the report
+	Thresholds []Threshold
+
+	// Requests every virtual user makes in order, when empty the URL,
+	// Method and Body above make up the only step
+	Steps []Step
+
+	// Recorded requests to replay instead of ramping up users
+	Replay        *ReplayConfig
+	ReplayEntries []ReplayEntry
+
+	// Registered protocol to run instead of making HTTP requests, the built
+	// in ones are set by their own options too
+	Protocol *ProtocolConfig
+	executor Protocol
+
+	observers []Observer
 }
 
-type Option func(*config)
+type Option func(*Spec)
 
 // Option fn to configure peak  limit
 func WithPeakConfig(targetUsers int, reachPeakAfter time.Duration,
 	usersToStartWith int) Option {
-	return func(c *config) {
+	return func(c *Spec) {
 		c.ReachPeakAfter = reachPeakAfter
 		c.UsersToStartWith = usersToStartWith
 		c.TargetUsers = targetUsers
@@ -62,7 +92,7 @@ func WithPeakConfig(targetUsers int, reachPeakAfter time.Duration,
 
 // Option fn to configure requests
 func WithRequestConfig(url string, body interface{}, acceptedStatusCodes ...int) Option {
-	return func(c *config) {
+	return func(c *Spec) {
 		c.URL = url
 		c.Body = body
 		c.SuccessStatusCodes = append(c.SuccessStatusCodes, acceptedStatusCodes...)
@@ -70,9 +100,16 @@ func WithRequestConfig(url string, body interface{}, acceptedStatusCodes ...int)
 	}
 }
 
+// Option fn to configure the http method of the request, defaults to GET
+func WithMethod(method string) Option {
+	return func(c *Spec) {
+		c.Method = method
+	}
+}
+
 // Option fn to configure custom headers for the request if needed
 func WithHeaders(headers map[string]string) Option {
-	return func(c *config) {
+	return func(c *Spec) {
 		h := http.Header{}
 		for k, v := range headers {
 			h.Set(k, v)
@@ -81,16 +118,69 @@ func WithHeaders(headers map[string]string) Option {
 	}
 }
 
-func WithDB(db *gorm.DB) Option {
-	return func(c *config) {
-		c.db = db
+// Option fn to configure authentication for the request
+func WithAuth(auth *AuthConfig) Option {
+	return func(c *Spec) {
+		c.Auth = auth
+	}
+}
+
+// Option fn to configure the http transport used to hit the target
+func WithTransportConfig(transport *TransportConfig) Option {
+	return func(c *Spec) {
+		c.Transport = transport
+	}
+}
+
+// Option fn to configure how redirects are handled
+func WithRedirectConfig(redirect *RedirectConfig) Option {
+	return func(c *Spec) {
+		c.Redirect = redirect
+	}
+}
+
+// Option fn to configure retries of failed requests
+func WithRetryConfig(retry *RetryConfig) Option {
+	return func(c *Spec) {
+		c.Retry = retry
+	}
+}
+
+// Option fn to configure what is done with the response body
+func WithResponseBodyConfig(body *ResponseBodyConfig) Option {
+	return func(c *Spec) {
+		c.ResponseBody = body
+	}
+}
+
+// Option fn to configure the thresholds the report is checked against
+func WithThresholds(thresholds ...Threshold) Option {
+	return func(c *Spec) {
+		c.Thresholds = append(c.Thresholds, thresholds...)
+	}
+}
+
+// Option fn to configure a scenario of several requests
+func WithSteps(steps ...Step) Option {
+	return func(c *Spec) {
+		c.Steps = append(c.Steps, steps...)
+	}
+}
+
+// Option fn to configure observers told about the run as it happens
+func WithObservers(observers ...Observer) Option {
+	return func(c *Spec) {
+		c.observers = append(c.observers, observers...)
 	}
 }
 
 type driver struct {
-	config
-	mu                        sync.Mutex
-	httpClient                *http.Client
+	Spec
+	mu         sync.Mutex
+	httpClient *http.Client
+	// Same transport without the client timeout, which would cut streams
+	// off mid read
+	streamClient              *http.Client
 	marshalledBody            []byte
 	usersPerMinute            int
 	totalNumberOfRequestsDone atomic.Int32
@@ -98,17 +188,33 @@ type driver struct {
 	requestsSucceeded         atomic.Int32
 	requestsFailed            atomic.Int32
 	report                    *Report
-	updater                   liveupdate.Updater
 	testID                    uuid.UUID
+	stage                     atomic.Value
+	auth                      authenticator
+	authStats                 authStats
+	resolver                  *resolvingDialer
+	redirects                 atomic.Int32
+	bytesSent                 atomic.Int64
+	bytesReceived             atomic.Int64
+	bytesReceivedUncompressed atomic.Int64
+	metrics                   *metrics
+	errors                    map[string]int32
+	retryStats                retryStats
+	failures                  *failureCapture
+	checkStats                checkStats
+	streamStats               streamStats
+	replay                    *replay
+	grpcStatusCodes           map[string]int32
+	protocol                  Protocol
 }
 
 func New(updater liveupdate.Updater, opts ...Option) (*driver, error) {
-	d := &driver{
-		mu:                    sync.Mutex{},
-		responseTimeInSeconds: make([]float64, 0),
-		updater:               updater,
-	}
-	c := config{
+	return newDriver(updater, NewSpec(opts...))
+}
+
+// NewSpec: a spec out of the options, e.g to Run one loaded with the spec package
+func NewSpec(opts ...Option) Spec {
+	c := Spec{
 		SuccessStatusCodes: []int{http.StatusOK},
 		Headers:            http.Header{},
 	}
@@ -116,21 +222,78 @@ func New(updater liveupdate.Updater, opts ...Option) (*driver, error) {
 	for _, op := range opts {
 		op(&c)
 	}
+	return c
+}
+
+func newDriver(updater liveupdate.Updater, c Spec) (*driver, error) {
+	d := &driver{
+		mu:                    sync.Mutex{},
+		responseTimeInSeconds: make([]float64, 0),
+		errors:                map[string]int32{},
+		grpcStatusCodes:       map[string]int32{},
+		metrics:               newMetrics(),
+	}
+
+	// The live update says the run is done only after the other observers,
+	// like the one storing the report, had the report
+	if updater != nil {
+		c.observers = append(c.observers, NewLiveUpdateObserver(updater))
+	}
+
+	err := ValidateResponseBody(c.ResponseBody)
+	if err != nil {
+		logrus.Error("invalid response body config ", err)
+		return nil, err
+	}
+
+	err = ValidateRetry(c.Retry)
+	if err != nil {
+		logrus.Error("invalid retry config ", err)
+		return nil, err
+	}
 
-	transport := &http.Transport{
-		DisableKeepAlives: false,
-		MaxIdleConns:      c.TargetUsers,
-		MaxConnsPerHost:   c.TargetUsers,
-		IdleConnTimeout:   c.ReachPeakAfter,
+	err = ValidateRedirect(c.Redirect)
+	if err != nil {
+		logrus.Error("invalid redirect config ", err)
+		return nil, err
+	}
+
+	err = ValidateThresholds(c.Thresholds)
+	if err != nil {
+		logrus.Error("invalid thresholds ", err)
+		return nil, err
+	}
+
+	if c.FailureCapture != nil {
+		err = ValidateFailureCapture(c.FailureCapture)
+		if err != nil {
+			logrus.Error("invalid failure capture ", err)
+			return nil, err
+		}
+		d.failures = newFailureCapture(c.FailureCapture)
 	}
 
-	// Create an HTTP client using the custom Transport
-	client := &http.Client{
-		Transport: transport,
-		Timeout:   30 * time.Second, // Timeout for the HTTP client itself
+	client, resolver, err := newHTTPClient(&c)
+	if err != nil {
+		logrus.Error("unable to configure transport ", err)
+		return nil, err
 	}
+	client.CheckRedirect = checkRedirect(c.Redirect, func() {
+		d.redirects.Add(1)
+	})
 
 	d.httpClient = client
+	streamClient := *client
+	streamClient.Timeout = 0
+	d.streamClient = &streamClient
+	d.resolver = resolver
+
+	auth, err := newAuthenticator(c.Auth, client, &d.authStats)
+	if err != nil {
+		logrus.Error("unable to configure auth ", err)
+		return nil, err
+	}
+	d.auth = auth
 
 	if c.ReachPeakAfter.Minutes() > 0 {
 		d.usersPerMinute = (c.TargetUsers - c.UsersToStartWith) / int(c.ReachPeakAfter.Minutes())
@@ -152,66 +315,168 @@ func New(updater liveupdate.Updater, opts ...Option) (*driver, error) {
 		d.marshalledBody = marshalled
 
 	}
-	d.config = c
 
-	return d, nil
-}
+	if c.Replay != nil {
+		d.replay, err = newReplay(c.Replay, c.ReplayEntries)
+		if err != nil {
+			logrus.Error("invalid replay ", err)
+			return nil, err
+		}
+	}
 
-func (d *driver) updateInDB(testID uuid.UUID) {
-	var (
-		marshalledReport []byte
-		err              error
-	)
+	d.protocol, err = c.protocol()
+	if err != nil {
+		logrus.Error("unable to configure protocol ", err)
+		return nil, err
+	}
+	if p, ok := d.protocol.(driverProtocol); ok {
+		p.bind(d)
+	}
 
-	if d.report != nil {
-		marshalledReport, err = json.Marshal(d.report)
+	if len(c.Steps) == 0 {
+		c.Steps = []Step{{
+			Method: c.Method,
+			URL:    c.URL,
+			Body:   d.marshalledBody,
+		}}
+	}
+	for i, step := range c.Steps {
+		for _, check := range step.Checks {
+			err = ValidateCheck(check)
+			if err != nil {
+				logrus.Error("invalid check ", err)
+				return nil, err
+			}
+		}
+		err = c.Steps[i].compile()
 		if err != nil {
-			logrus.Error("unable to marshal report ", err)
+			logrus.Error("invalid step ", err)
+			return nil, err
 		}
 	}
+	d.Spec = c
 
-	t := &models.Test{
+	return d, nil
+}
+
+func (d *driver) Run(ctx context.Context, testID uuid.UUID) {
+	err := d.run(ctx, testID)
+	if err != nil {
+		logrus.Error("unable to run test ", err)
+	}
+}
+
+// Runs the test and computes the report, errors are for tests that couldn't
+// start and still get a report
+func (d *driver) run(ctx context.Context, testID uuid.UUID) error {
+	d.testID = testID
+	d.metrics.start()
+	start := &TestStart{ID: testID, TargetUsers: d.target(), Spec: &d.Spec}
+	for _, o := range d.observers {
+		o.OnTestStart(start)
+	}
+
+	err := d.protocol.Prepare(ctx)
+	if err != nil {
+		d.finish()
+		return fmt.Errorf("unable to prepare protocol: %w", err)
+	}
+
+	stop := d.snapshotEvery(snapshotInterval)
+	if d.replay != nil {
+		d.changeStage(StageReplay)
+		d.runReplay(ctx)
+	} else {
+		d.runUsers(ctx)
+	}
+	stop()
+
+	d.finish()
+	return nil
+}
+
+// Users the run ramps up to, replays are done after their entries
+func (d *driver) target() int32 {
+	if d.replay != nil {
+		return int32(len(d.replay.entries))
+	}
+	return int32(d.TargetUsers)
+}
+
+func (d *driver) changeStage(stage Stage) {
+	d.stage.Store(stage)
+	for _, o := range d.observers {
+		o.OnStageChange(stage)
+	}
+}
+
+func (d *driver) snapshot() *Snapshot {
+	s := &Snapshot{
+		ID:                d.testID,
+		Elapsed:           d.metrics.elapsed(),
 		TotalRequests:     d.totalNumberOfRequestsDone.Load(),
 		SucceededRequests: d.requestsSucceeded.Load(),
 		FailedRequests:    d.requestsFailed.Load(),
-		Report:            marshalledReport,
+		TargetUsers:       d.target(),
+	}
+	s.Stage, _ = d.stage.Load().(Stage)
+	if l, ok := d.protocol.(liveReporter); ok {
+		s.WebSocket = l.liveUpdate()
 	}
+	return s
+}
 
-	err = d.db.Model(&models.Test{}).Where(&models.Test{
-		UUID: testID,
-	}).Updates(t).Error
-	if err != nil {
-		logrus.Error("unable to update ", err)
+// Hands the observers a snapshot on every interval and a last one when
+// stopped
+func (d *driver) snapshotEvery(interval time.Duration) func() {
+	done := make(chan struct{})
+	stopped := make(chan struct{})
+	go func() {
+		defer close(stopped)
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+			case <-done:
+				return
+			}
+			s := d.snapshot()
+			for _, o := range d.observers {
+				o.OnIntervalSnapshot(s)
+			}
+		}
+	}()
+	return func() {
+		close(done)
+		<-stopped
+		s := d.snapshot()
+		for _, o := range d.observers {
+			o.OnIntervalSnapshot(s)
+		}
 	}
 }
 
-func (d *driver) Run(ctx context.Context, testID uuid.UUID) {
+// Ramps up the virtual users, every user runs an iteration
+func (d *driver) runUsers(ctx context.Context) {
 	var (
 		wg      sync.WaitGroup
 		ramupWg sync.WaitGroup
 	)
 
+	d.changeStage(StageRampUp)
 	jobQueue := make(chan struct{}, d.TargetUsers)
-	updateInDbJobQueue := make(chan struct{}, d.TargetUsers/2)
-
-	d.testID = testID
-	wg.Add(1)
-	go func() {
-		defer wg.Done()
-		for range updateInDbJobQueue {
-			d.updateInDB(testID)
-		}
-	}()
 
 	workerCount := d.TargetUsers
 	for i := 0; i < workerCount; i++ {
 		wg.Add(1)
-		go func() {
+		// Every worker acts as a virtual user
+		go func(vu int) {
 			defer wg.Done()
 			for range jobQueue {
-				d.doRequestAndReturnStatsDriver(ctx)
+				d.doRequestAndReturnStatsDriver(ctx, vu)
 			}
-		}()
+		}(i + 1)
 	}
 
 	ramupWg.Add(1)
@@ -226,15 +491,12 @@ func (d *driver) Run(ctx context.Context, testID uuid.UUID) {
 			usersToAddPerSecond += 1
 		}
 
-		updateTicker := time.NewTicker(time.Second * time.Duration(d.usersPerMinute))
-		defer updateTicker.Stop()
-		defer close(updateInDbJobQueue)
-
 		for {
 			select {
 			case <-ticker.C:
 				for i := 0; i < usersToAddPerSecond; i++ {
 					if usersAdded >= (d.TargetUsers - d.UsersToStartWith) {
+						d.changeStage(StagePeak)
 						return
 					}
 					jobQueue <- struct{}{}
@@ -242,10 +504,8 @@ func (d *driver) Run(ctx context.Context, testID uuid.UUID) {
 
 				}
 
-			case <-updateTicker.C:
-				updateInDbJobQueue <- struct{}{}
 			case <-ctx.Done():
-				updateInDbJobQueue <- struct{}{}
+				d.changeStage(StageStopping)
 				return
 
 			}
@@ -260,45 +520,165 @@ func (d *driver) Run(ctx context.Context, testID uuid.UUID) {
 	ramupWg.Wait()
 	close(jobQueue)
 	wg.Wait()
+}
 
+// Computes the report and hands it to the observers
+func (d *driver) finish() {
 	logrus.Info("Total requests:", d.totalNumberOfRequestsDone.Load())
 	d.report = d.computeReport()
-	d.updateInDB(testID)
+	err := d.protocol.Close()
+	if err != nil {
+		logrus.Error("unable to close protocol ", err)
+	}
+	for _, o := range d.observers {
+		o.OnTestEnd(d.report)
+	}
 	logrus.Infof("Report: %+v", d.report)
 }
 
-func (d *driver) doRequestAndReturnStats(ctx context.Context,
-	method string, url string, body []byte) (*RequestStat, error) {
+// Report of the last run, nil until Run returns
+func (d *driver) Report() *Report {
+	return d.report
+}
 
-	log.Printf("Making request %s %s \n ", d.URL, d.Method)
-	d.totalNumberOfRequestsDone.Add(1)
-	stat := RequestStat{}
-	start := time.Now()
+func (d *driver) doRequestAndReturnStats(ctx context.Context, step *Step, vu int) (*RequestStat, error) {
+	method, url, body := step.method(), step.URL, step.Body
+
+	log.Printf("Making request %s %s \n ", url, method)
+	stat := RequestStat{Endpoint: step.endpoint()}
+	// Streams are cut off by cancelling the request once a limit is hit,
+	// those without a max duration are held to the total timeout instead
+	cancel := context.CancelFunc(func() {})
+	client := d.httpClient
+	if step.Stream != nil {
+		client = d.streamClient
+		if step.Stream.MaxDurationInMilliseconds > 0 {
+			ctx, cancel = context.WithCancel(ctx)
+		} else {
+			ctx, cancel = context.WithTimeout(ctx, d.httpClient.Timeout)
+		}
+		defer cancel()
+	}
 	req, err := http.NewRequestWithContext(ctx,
 		method, url,
 		bytes.NewBuffer(body))
 	if err != nil {
 		fmt.Printf("error in creating request %s \n", err.Error())
+		return nil, err
+	}
+	req.Header = d.Headers.Clone()
+	if req.Header == nil {
+		req.Header = http.Header{}
+	}
+	for k, v := range step.Headers {
+		req.Header[k] = v
+	}
+	switch {
+	case d.Transport != nil && d.Transport.AcceptEncoding != "":
+		req.Header.Set("Accept-Encoding", d.Transport.AcceptEncoding)
+	case d.Transport != nil && d.Transport.DisableCompression:
+	case req.Header.Get("Accept-Encoding") == "":
+		// Asked for explicitly so the transport hands over the body as is
+		// and the compressed size can be measured
+		req.Header.Set("Accept-Encoding", "gzip")
+	}
 
+	// Credentials are acquired before the clock starts so token fetches
+	// don't show up in the endpoint latency
+	if d.auth != nil {
+		err = d.auth.apply(ctx, req, body, vu)
+		if err != nil {
+			logrus.Error("error in authenticating request ", err)
+			return nil, err
+		}
 	}
-	res, err := d.httpClient.Do(req)
+
+	// Headers may be written from the transport's own goroutine
+	var headerBytes atomic.Int64
+	trace := &httptrace.ClientTrace{
+		GotConn: func(info httptrace.GotConnInfo) {
+			stat.RemoteAddress = info.Conn.RemoteAddr().String()
+		},
+		WroteHeaderField: func(key string, values []string) {
+			for _, v := range values {
+				headerBytes.Add(int64(len(key) + len(": ") + len(v) + 2))
+			}
+		},
+	}
+	phases := &phaseTracer{}
+	phases.hook(trace)
+	req = req.WithContext(httptrace.WithClientTrace(req.Context(), trace))
+
+	start := time.Now()
+	stat.StartedAt = start
+	res, err := client.Do(req)
 	if err != nil {
 		logrus.Error("error in doing request", err)
+		if d.failures != nil {
+			stat.ErrorCategory, stat.errorMessage = categorizeError(err), err.Error()
+			d.failures.record(req, body, nil, &stat, vu)
+		}
 		return nil, err
 	}
+	stat.Phases = phases.result()
 
 	logrus.Info("Response status code is ", res.StatusCode)
 
 	defer res.Body.Close()
 
-	if slices.Contains(d.SuccessStatusCodes, res.StatusCode) {
+	successStatusCodes := step.SuccessStatusCodes
+	if len(successStatusCodes) == 0 {
+		successStatusCodes = d.SuccessStatusCodes
+	}
+
+	stat.StatusCode = res.StatusCode
+	stat.header = res.Header
+	if slices.Contains(successStatusCodes, res.StatusCode) {
 		stat.IsSuccess = true
 	}
+	if d.Redirect != nil && d.Redirect.DontFollow &&
+		res.StatusCode >= 300 && res.StatusCode < 400 {
+		d.redirects.Add(1)
+	}
+
+	stat.BytesSent = requestLineSize(req) + headerBytes.Load() + int64(len(body))
+	headerSize := responseHeaderSize(res)
+	var wire, decoded int64
+	if step.Stream != nil {
+		stat.stream, wire, decoded, err = readStream(step.Stream, res, start, cancel)
+		if step.needsBody() {
+			stat.body = stat.stream.data()
+		}
+	} else {
+		// Failing responses are kept for the failure capture
+		keep := step.needsBody() || (d.failures != nil && !stat.IsSuccess)
+		wire, decoded, err = readBody(d.ResponseBody, res, &stat.body, keep)
+	}
+	stat.BytesReceived = headerSize + wire
+	stat.BytesReceivedUncompressed = headerSize + decoded
+	if err != nil {
+		logrus.Error("error in reading response body ", err)
+		stat.IsSuccess = false
+		stat.ErrorCategory = categorizeError(err)
+		stat.errorMessage = err.Error()
+	}
+	if step.GraphQL != nil {
+		step.checkGraphQL(&stat)
+	}
 
 	elapsed := time.Since(start)
+	if stat.stream != nil {
+		if first, ok := stat.stream.timeToFirstEvent(); ok {
+			elapsed = first
+		}
+	}
 
 	stat.TimeTakenInSeconds = elapsed.Seconds()
 
+	if d.failures != nil && !stat.IsSuccess {
+		d.failures.record(req, body, res, &stat, vu)
+	}
+
 	return &stat, nil
 }
 
@@ -306,33 +686,131 @@ func (d *driver) doRequestAndReturnStats(ctx context.Context,
 func (d *driver) processStat(s *RequestStat) {
 	d.mu.Lock()
 	d.responseTimeInSeconds = append(d.responseTimeInSeconds, s.TimeTakenInSeconds)
+	if s.ErrorCategory != "" && d.errors != nil {
+		d.errors[s.ErrorCategory]++
+	}
+	if s.stream != nil {
+		d.streamStats.record(s.stream)
+	}
+	if s.GRPCStatus != "" && d.grpcStatusCodes != nil {
+		d.grpcStatusCodes[s.GRPCStatus]++
+	}
 	d.mu.Unlock()
 
+	d.bytesSent.Add(s.BytesSent)
+	d.bytesReceived.Add(s.BytesReceived)
+	d.bytesReceivedUncompressed.Add(s.BytesReceivedUncompressed)
+	if d.metrics != nil {
+		d.metrics.record(s)
+	}
+
+	if d.resolver != nil && s.RemoteAddress != "" {
+		d.resolver.recordRequest(s.RemoteAddress, s)
+	}
+
 	if s.IsSuccess {
 		d.requestsSucceeded.Add(1)
 	} else {
 		d.requestsFailed.Add(1)
 	}
 
-	d.updater.Set(d.testID, &liveupdate.Update{
-		TotalNumberofRequestsDone: d.totalNumberOfRequestsDone.Load(),
-		SucceededRequests:         d.requestsSucceeded.Load(),
-		FailedRequests:            d.requestsFailed.Load(),
-		TargetUsers:               int32(d.TargetUsers),
+	for _, o := range d.observers {
+		o.OnRequestComplete(s)
+	}
+}
+
+// Runs an iteration of the scenario for the virtual user
+func (d *driver) doRequestAndReturnStatsDriver(ctx context.Context, vu int) {
+	d.protocol.Execute(ctx, vu, func(s *RequestStat) {
+		s.VU = vu
+		d.record(s)
 	})
+}
 
+// Counts a request made by the protocol and adds its stat
+func (d *driver) record(s *RequestStat) {
+	s.setStartedAt()
+	d.totalNumberOfRequestsDone.Add(1)
+	d.processStat(s)
 }
 
-func (d *driver) doRequestAndReturnStatsDriver(ctx context.Context) {
-	stat, err := d.doRequestAndReturnStats(ctx, d.Method, d.URL, d.marshalledBody)
+// Hands a retried attempt to the observers, retries stay out of the stats of
+// the first attempts and are counted in the retry report instead
+func (d *driver) recordRetry(s *RequestStat) {
+	s.setStartedAt()
+	d.retryStats.record(s)
+	for _, o := range d.observers {
+		o.OnRequestComplete(s)
+	}
+}
+
+func (d *driver) runStep(ctx context.Context, step *Step, vu int, vars map[string]string, record func(*RequestStat)) {
+	template := step
+	step = step.render(vars)
+	stat := d.attempt(ctx, step, vu)
+	stat.VU = vu
+	record(stat)
+
+	// Checked and extracted from the last attempt, a retry that recovers
+	// passes the checks and still feeds the next steps
+	defer func() {
+		d.checkStats.evaluate(template, stat, stat.header, stat.body)
+		if vars != nil {
+			template.extract(stat, vars)
+		}
+	}()
+
+	if d.Retry == nil || !d.Retry.shouldRetry(stat) {
+		return
+	}
+
+	for retry := 1; retry <= d.Retry.MaxRetries; retry++ {
+		select {
+		case <-time.After(d.Retry.backoff(retry)):
+		case <-ctx.Done():
+			return
+		}
+
+		stat = d.attempt(ctx, step, vu)
+		stat.VU = vu
+		stat.Retry = retry
+		d.recordRetry(stat)
+		if stat.IsSuccess {
+			d.retryStats.recordRecovered()
+			return
+		}
+		if !d.Retry.shouldRetry(stat) {
+			return
+		}
+	}
+}
+
+func (d *driver) attempt(ctx context.Context, step *Step, vu int) *RequestStat {
+	stat, err := d.doRequestAndReturnStats(ctx, step, vu)
+	if err == nil && step.persistedQueryNotFound(stat) {
+		// Sending the query along registers it, both requests count
+		// towards the operation
+		withQuery := *step
+		withQuery.Body, withQuery.queryBody = step.queryBody, nil
+		miss := stat
+		stat, err = d.doRequestAndReturnStats(ctx, &withQuery, vu)
+		if err == nil {
+			stat.TimeTakenInSeconds += miss.TimeTakenInSeconds
+			stat.BytesSent += miss.BytesSent
+			stat.BytesReceived += miss.BytesReceived
+			stat.BytesReceivedUncompressed += miss.BytesReceivedUncompressed
+		}
+	}
 	if err != nil {
 		logrus.Error("error in doing request ", err)
-		d.processStat(&RequestStat{
-			IsSuccess: false,
-		})
-		return
+		return &RequestStat{
+			IsSuccess:     false,
+			ErrorCategory: categorizeError(err),
+			Endpoint:      step.endpoint(),
+			errorMessage:  err.Error(),
+		}
 	}
-	d.processStat(stat)
+	return stat
 }
 
 // Computes report post the load testing is done
@@ -342,6 +820,9 @@ func (d *driver) computeReport() *Report {
 	totalRequests := d.totalNumberOfRequestsDone.Load()
 	if totalRequests == 0 {
 		logrus.Error("No requests made. Cannot compute report.")
+		if len(d.Thresholds) > 0 {
+			r.Thresholds = EvaluateThresholds(&r, d.Thresholds)
+		}
 		return &r
 	}
 
@@ -359,16 +840,56 @@ func (d *driver) computeReport() *Report {
 	r.ErrorRate = float64(d.requestsFailed.Load()) / float64(totalRequests)
 
 	// Compute throughput
-	r.Throughput = float64(d.requestsSucceeded.Load()) / d.ReachPeakAfter.Seconds()
+	if d.ReachPeakAfter > 0 {
+		r.Throughput = float64(d.requestsSucceeded.Load()) / d.ReachPeakAfter.Seconds()
+	}
 
 	// Compute percentiles
 	sort.Float64s(d.responseTimeInSeconds)
 	r.P50Percentile = percentile(d.responseTimeInSeconds, 50)
 	r.P90Percentile = percentile(d.responseTimeInSeconds, 90)
 	r.P99Percentile = percentile(d.responseTimeInSeconds, 99)
+	r.Histogram = NewHistogram()
+	for _, t := range d.responseTimeInSeconds {
+		r.Histogram.Record(t)
+	}
 	r.SucceededRequests = d.requestsSucceeded.Load()
 	r.FailedRequests = d.requestsFailed.Load()
 	r.RequestedDone = d.totalNumberOfRequestsDone.Load()
+	r.Auth = d.authStats.report()
+	r.Redirects = d.redirects.Load()
+	r.BytesSent = d.bytesSent.Load()
+	r.BytesReceived = d.bytesReceived.Load()
+	r.BytesReceivedUncompressed = d.bytesReceivedUncompressed.Load()
+	if d.metrics != nil {
+		if elapsed := d.metrics.elapsed().Seconds(); elapsed > 0 {
+			r.SentMBPerSecond = float64(r.BytesSent) / bytesInMB / elapsed
+			r.ReceivedMBPerSecond = float64(r.BytesReceived) / bytesInMB / elapsed
+		}
+		r.Endpoints = d.metrics.endpointReports()
+		r.TimeSeries = d.metrics.timeSeries()
+	}
+	r.Retries = d.retryStats.report()
+	r.Failures = d.failures.report()
+	if len(d.errors) > 0 {
+		r.Errors = d.errors
+	}
+	if p, ok := d.protocol.(ReportingProtocol); ok && d.metrics != nil {
+		p.AddToReport(&r, d.metrics.elapsed())
+	}
+	if len(d.grpcStatusCodes) > 0 {
+		r.GRPCStatusCodes = d.grpcStatusCodes
+	}
+	if d.resolver != nil {
+		r.Addresses = d.resolver.report()
+	}
+	r.Checks = d.checkStats.report()
+	if d.replay != nil {
+		r.Replay = d.replay.report()
+	}
+	if len(d.Thresholds) > 0 {
+		r.Thresholds = EvaluateThresholds(&r, d.Thresholds)
+	}
 
 	return &r
 }
@@ -81,14 +81,14 @@ func TestDoRequestAndReturnStats(t *testing.T) {
 
 	driver := &driver{
 		httpClient: mockClient,
-		config: config{
+		Spec: Spec{
 			Method:             "GET",
 			URL:                "http://example.com",
 			SuccessStatusCodes: []int{http.StatusOK},
 		},
 	}
 
-	stat, err := driver.doRequestAndReturnStats(context.Background(), "GET", "http://example.com", nil)
+	stat, err := driver.doRequestAndReturnStats(context.Background(), &Step{Method: "GET", URL: "http://example.com"}, 1)
 	if err != nil {
 		t.Fatalf("unexpected error: %v", err)
 	}
@@ -109,14 +109,14 @@ func TestDoRequestFailure(t *testing.T) {
 
 	driver := &driver{
 		httpClient: mockClient,
-		config: config{
+		Spec: Spec{
 			Method:             "GET",
 			URL:                "http://example.com",
 			SuccessStatusCodes: []int{http.StatusOK},
 		},
 	}
 
-	stat, err := driver.doRequestAndReturnStats(context.Background(), "GET", "http://example.com", nil)
+	stat, err := driver.doRequestAndReturnStats(context.Background(), &Step{Method: "GET", URL: "http://example.com"}, 1)
 	if err == nil {
 		t.Fatalf("expected an error, got nil")
 	}
@@ -0,0 +1,97 @@
+package tester
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// Threshold: pass/fail criteria on a metric of the report, a threshold with
+// both bounds fails when the metric is outside either of them
+type Threshold struct {
+	// One of average_response_time, peak_response_time, error_rate,
+	// throughput, p50, p90, p99, requests, failed_requests,
+	// sent_mb_per_second, received_mb_per_second or checks_failed
+	Metric string   `json:"metric"`
+	Max    *float64 `json:"max,omitempty"`
+	Min    *float64 `json:"min,omitempty"`
+}
+
+type ThresholdResult struct {
+	Threshold
+	Value  float64 `json:"value"`
+	Passed bool    `json:"passed"`
+}
+
+var thresholdMetrics = map[string]func(r *Report) float64{
+	"average_response_time":  func(r *Report) float64 { return r.AverageResponseTime },
+	"peak_response_time":     func(r *Report) float64 { return r.PeakResponseTime },
+	"error_rate":             func(r *Report) float64 { return r.ErrorRate },
+	"throughput":             func(r *Report) float64 { return r.Throughput },
+	"p50":                    func(r *Report) float64 { return r.P50Percentile },
+	"p90":                    func(r *Report) float64 { return r.P90Percentile },
+	"p99":                    func(r *Report) float64 { return r.P99Percentile },
+	"requests":               func(r *Report) float64 { return float64(r.RequestedDone) },
+	"failed_requests":        func(r *Report) float64 { return float64(r.FailedRequests) },
+	"sent_mb_per_second":     func(r *Report) float64 { return r.SentMBPerSecond },
+	"received_mb_per_second": func(r *Report) float64 { return r.ReceivedMBPerSecond },
+	"checks_failed":          checksFailed,
+}
+
+func checksFailed(r *Report) float64 {
+	fails := int32(0)
+	for _, c := range r.Checks {
+		fails += c.Fails
+	}
+	return float64(fails)
+}
+
+// ValidateThresholds: reports thresholds on unknown metrics or without bounds
+func ValidateThresholds(thresholds []Threshold) error {
+	for _, t := range thresholds {
+		if _, ok := thresholdMetrics[t.Metric]; !ok {
+			names := []string{}
+			for name := range thresholdMetrics {
+				names = append(names, name)
+			}
+			sort.Strings(names)
+			return fmt.Errorf("unknown threshold metric %q, expected one of %s",
+				t.Metric, strings.Join(names, ", "))
+		}
+		if t.Max == nil && t.Min == nil {
+			return errors.New("threshold on " + t.Metric + " needs a max or a min")
+		}
+	}
+	return nil
+}
+
+// EvaluateThresholds: checks every threshold against the report
+func EvaluateThresholds(r *Report, thresholds []Threshold) []ThresholdResult {
+	results := []ThresholdResult{}
+	for _, t := range thresholds {
+		metric, ok := thresholdMetrics[t.Metric]
+		if !ok {
+			results = append(results, ThresholdResult{Threshold: t})
+			continue
+		}
+
+		value := metric(r)
+		results = append(results, ThresholdResult{
+			Threshold: t,
+			Value:     value,
+			Passed:    (t.Max == nil || value <= *t.Max) && (t.Min == nil || value >= *t.Min),
+		})
+	}
+	return results
+}
+
+// Whether all the thresholds evaluated for the report passed
+func (r *Report) ThresholdsPassed() bool {
+	for _, t := range r.Thresholds {
+		if !t.Passed {
+			return false
+		}
+	}
+	return true
+}
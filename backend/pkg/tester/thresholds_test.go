@@ -0,0 +1,29 @@
+package tester
+
+import "testing"
+
+func TestEvaluateThresholds(t *testing.T) {
+	maxErrorRate, minRequests := 0.05, 100.0
+	r := &Report{ErrorRate: 0.1, RequestedDone: 150}
+
+	results := EvaluateThresholds(r, []Threshold{
+		{Metric: "error_rate", Max: &maxErrorRate},
+		{Metric: "requests", Min: &minRequests},
+	})
+
+	if results[0].Passed || results[0].Value != 0.1 {
+		t.Errorf("expected error rate threshold to fail, got %+v", results[0])
+	}
+	if !results[1].Passed {
+		t.Errorf("expected requests threshold to pass, got %+v", results[1])
+	}
+
+	r.Thresholds = results
+	if r.ThresholdsPassed() {
+		t.Errorf("expected the report to fail its thresholds")
+	}
+
+	if err := ValidateThresholds([]Threshold{{Metric: "p42", Max: &maxErrorRate}}); err == nil {
+		t.Errorf("expected an unknown metric to be rejected")
+	}
+}
@@ -0,0 +1,233 @@
+package tester
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"time"
+
+	"golang.org/x/net/http2"
+)
+
+const (
+	HTTPVersionAuto = ""
+	HTTPVersion1    = "1.1"
+	HTTPVersion2    = "2"
+	// HTTP/2 over cleartext TCP
+	HTTPVersionH2C = "h2c"
+)
+
+// TransportConfig: how the http client talks to the target, zero values
+// fall back to the defaults of the tester
+type TransportConfig struct {
+	// Time allowed to establish the TCP connection and TLS handshake
+	ConnectTimeoutInMilliseconds int `json:"connect_timeout_in_milliseconds,omitempty"`
+	// Time allowed to wait for the response headers once the request is
+	// written. Only over HTTP/1.1 or when HTTP/2 is negotiated
+	ReadTimeoutInMilliseconds int `json:"read_timeout_in_milliseconds,omitempty"`
+	// Time allowed for the whole exchange, defaults to 30 seconds
+	TotalTimeoutInMilliseconds int `json:"total_timeout_in_milliseconds,omitempty"`
+	// How long idle connections are kept around, defaults to 90 seconds
+	IdleConnTimeoutInMilliseconds int `json:"idle_conn_timeout_in_milliseconds,omitempty"`
+
+	// Only over HTTP/1.1, HTTP/2 always reuses its connections
+	DisableKeepAlives bool `json:"disable_keep_alives,omitempty"`
+	// Defaults to the number of target users. Only over HTTP/1.1, HTTP/2
+	// multiplexes the requests over a single connection per host
+	MaxConnsPerHost int `json:"max_conns_per_host,omitempty"`
+
+	// One of "", "1.1", "2" or "h2c"
+	HTTPVersion string `json:"http_version,omitempty"`
+
+	// PEM bundle of CAs trusted in addition to the system pool
+	CABundleFile       string `json:"ca_bundle_file,omitempty"`
+	InsecureSkipVerify bool   `json:"insecure_skip_verify,omitempty"`
+	// Client certificate and key for mTLS
+	ClientCertFile string `json:"client_cert_file,omitempty"`
+	ClientKeyFile  string `json:"client_key_file,omitempty"`
+	// Overrides the server name sent in the TLS handshake
+	ServerName string `json:"server_name,omitempty"`
+
+	// Host to address overrides and how hosts are resolved
+	DNS *DNSConfig `json:"dns,omitempty"`
+
+	// http, https or socks5 proxy URL
+	ProxyURL string `json:"proxy_url,omitempty"`
+
+	// Stops the client from asking for and transparently decoding gzip
+	DisableCompression bool `json:"disable_compression,omitempty"`
+	// Sent as is in the Accept-Encoding header, the response body is then
+	// left encoded
+	AcceptEncoding string `json:"accept_encoding,omitempty"`
+}
+
+func milliseconds(ms int, fallback time.Duration) time.Duration {
+	if ms <= 0 {
+		return fallback
+	}
+	return time.Duration(ms) * time.Millisecond
+}
+
+func (t *TransportConfig) tlsConfig() (*tls.Config, error) {
+	tlsConfig := &tls.Config{
+		InsecureSkipVerify: t.InsecureSkipVerify,
+		ServerName:         t.ServerName,
+	}
+
+	if t.CABundleFile != "" {
+		pem, err := os.ReadFile(t.CABundleFile)
+		if err != nil {
+			return nil, fmt.Errorf("unable to read ca bundle: %w", err)
+		}
+		pool, err := x509.SystemCertPool()
+		if err != nil {
+			pool = x509.NewCertPool()
+		}
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, errors.New("no certificates found in ca bundle")
+		}
+		tlsConfig.RootCAs = pool
+	}
+
+	if t.ClientCertFile != "" || t.ClientKeyFile != "" {
+		cert, err := tls.LoadX509KeyPair(t.ClientCertFile, t.ClientKeyFile)
+		if err != nil {
+			return nil, fmt.Errorf("unable to load client certificate: %w", err)
+		}
+		tlsConfig.Certificates = []tls.Certificate{cert}
+	}
+
+	return tlsConfig, nil
+}
+
+// ValidateTransport: reports options that can't be used together
+func ValidateTransport(t *TransportConfig) error {
+	switch t.HTTPVersion {
+	case HTTPVersion2, HTTPVersionH2C:
+		switch {
+		case t.ProxyURL != "":
+			return errors.New("proxies are only supported over HTTP/1.1")
+		case t.DisableKeepAlives:
+			return errors.New("keep alives can only be disabled over HTTP/1.1")
+		case t.MaxConnsPerHost != 0:
+			return errors.New("max_conns_per_host is only supported over HTTP/1.1")
+		case t.ReadTimeoutInMilliseconds != 0:
+			return errors.New("read_timeout_in_milliseconds isn't supported when HTTP/2 is forced, use total_timeout_in_milliseconds")
+		}
+	case HTTPVersionAuto, HTTPVersion1:
+	default:
+		return fmt.Errorf("unknown http version %q", t.HTTPVersion)
+	}
+	return nil
+}
+
+// Builds the http client used to hit the target as per the transport config,
+// the resolving dialer is returned only when DNS overrides are configured
+func newHTTPClient(c *Spec) (*http.Client, *resolvingDialer, error) {
+	t := TransportConfig{}
+	if c.Transport != nil {
+		t = *c.Transport
+	}
+
+	err := ValidateTransport(&t)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	tlsConfig, err := t.tlsConfig()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	connectTimeout := milliseconds(t.ConnectTimeoutInMilliseconds, 30*time.Second)
+	dialer := &net.Dialer{
+		Timeout:   connectTimeout,
+		KeepAlive: 30 * time.Second,
+	}
+	if t.DisableKeepAlives {
+		dialer.KeepAlive = -1
+	}
+
+	var resolver *resolvingDialer
+	dial := dialer.DialContext
+	if t.DNS != nil {
+		resolver, err = newResolvingDialer(dialer, *t.DNS)
+		if err != nil {
+			return nil, nil, err
+		}
+		dial = resolver.DialContext
+	}
+
+	client := &http.Client{
+		Timeout: milliseconds(t.TotalTimeoutInMilliseconds, 30*time.Second),
+	}
+
+	if t.HTTPVersion == HTTPVersion2 || t.HTTPVersion == HTTPVersionH2C {
+		h2 := &http2.Transport{
+			TLSClientConfig:    tlsConfig,
+			DisableCompression: t.DisableCompression || t.AcceptEncoding != "",
+			IdleConnTimeout:    milliseconds(t.IdleConnTimeoutInMilliseconds, 90*time.Second),
+		}
+		h2.DialTLSContext = func(ctx context.Context, network, addr string,
+			cfg *tls.Config) (net.Conn, error) {
+			conn, err := dial(ctx, network, addr)
+			if err != nil || t.HTTPVersion == HTTPVersionH2C {
+				return conn, err
+			}
+			// Bounded like TLSHandshakeTimeout over HTTP/1.1
+			handshakeCtx, cancel := context.WithTimeout(ctx, connectTimeout)
+			defer cancel()
+			tlsConn := tls.Client(conn, cfg)
+			err = tlsConn.HandshakeContext(handshakeCtx)
+			if err != nil {
+				conn.Close()
+				return nil, err
+			}
+			return tlsConn, nil
+		}
+		h2.AllowHTTP = t.HTTPVersion == HTTPVersionH2C
+		client.Transport = h2
+		return client, resolver, nil
+	}
+
+	maxConns := t.MaxConnsPerHost
+	if maxConns == 0 {
+		maxConns = c.TargetUsers
+	}
+
+	transport := &http.Transport{
+		DialContext:           dial,
+		TLSClientConfig:       tlsConfig,
+		TLSHandshakeTimeout:   connectTimeout,
+		ResponseHeaderTimeout: milliseconds(t.ReadTimeoutInMilliseconds, 0),
+		DisableKeepAlives:     t.DisableKeepAlives,
+		DisableCompression:    t.DisableCompression || t.AcceptEncoding != "",
+		MaxIdleConns:          maxConns,
+		MaxIdleConnsPerHost:   maxConns,
+		MaxConnsPerHost:       maxConns,
+		IdleConnTimeout:       milliseconds(t.IdleConnTimeoutInMilliseconds, 90*time.Second),
+		ForceAttemptHTTP2:     t.HTTPVersion == HTTPVersionAuto,
+	}
+
+	if t.HTTPVersion == HTTPVersion1 {
+		// A non nil empty map stops the transport from upgrading to h2
+		transport.TLSNextProto = map[string]func(string, *tls.Conn) http.RoundTripper{}
+	}
+
+	if t.ProxyURL != "" {
+		proxyURL, err := url.Parse(t.ProxyURL)
+		if err != nil {
+			return nil, nil, fmt.Errorf("invalid proxy url: %w", err)
+		}
+		transport.Proxy = http.ProxyURL(proxyURL)
+	}
+
+	client.Transport = transport
+	return client, resolver, nil
+}
@@ -0,0 +1,148 @@
+package tester
+
+import (
+	"encoding/pem"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"golang.org/x/net/http2"
+	"golang.org/x/net/http2/h2c"
+)
+
+func protoHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(r.Proto))
+	})
+}
+
+func getProto(t *testing.T, client *http.Client, url string) string {
+	res, err := client.Get(url)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	defer res.Body.Close()
+	return res.Proto
+}
+
+func TestNewHTTPClientH2C(t *testing.T) {
+	server := httptest.NewServer(h2c.NewHandler(protoHandler(), &http2.Server{}))
+	defer server.Close()
+
+	client, _, err := newHTTPClient(&Spec{
+		Transport: &TransportConfig{HTTPVersion: HTTPVersionH2C},
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if proto := getProto(t, client, server.URL); proto != "HTTP/2.0" {
+		t.Errorf("expected HTTP/2.0, got %s", proto)
+	}
+}
+
+func TestNewHTTPClientTLSVersions(t *testing.T) {
+	server := httptest.NewUnstartedServer(protoHandler())
+	server.EnableHTTP2 = true
+	server.StartTLS()
+	defer server.Close()
+
+	caFile := filepath.Join(t.TempDir(), "ca.pem")
+	err := os.WriteFile(caFile, pem.EncodeToMemory(&pem.Block{
+		Type:  "CERTIFICATE",
+		Bytes: server.Certificate().Raw,
+	}), 0600)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	cases := map[string]string{
+		HTTPVersionAuto: "HTTP/2.0",
+		HTTPVersion1:    "HTTP/1.1",
+		HTTPVersion2:    "HTTP/2.0",
+	}
+
+	for version, expected := range cases {
+		client, _, err := newHTTPClient(&Spec{
+			TargetUsers: 1,
+			Transport:   &TransportConfig{HTTPVersion: version, CABundleFile: caFile},
+		})
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+
+		if proto := getProto(t, client, server.URL); proto != expected {
+			t.Errorf("http version %q: expected %s, got %s", version, expected, proto)
+		}
+	}
+}
+
+func TestNewHTTPClientRejectsUnknownVersion(t *testing.T) {
+	_, _, err := newHTTPClient(&Spec{Transport: &TransportConfig{HTTPVersion: "3"}})
+	if err == nil {
+		t.Fatalf("expected an error for an unknown http version")
+	}
+}
+
+func TestNewHTTPClientHTTP2Options(t *testing.T) {
+	client, _, err := newHTTPClient(&Spec{Transport: &TransportConfig{
+		HTTPVersion: HTTPVersion2, IdleConnTimeoutInMilliseconds: 1500,
+	}})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if h2 := client.Transport.(*http2.Transport); h2.IdleConnTimeout != 1500*time.Millisecond {
+		t.Errorf("expected the idle timeout to apply over HTTP/2, got %s", h2.IdleConnTimeout)
+	}
+
+	for _, c := range []TransportConfig{
+		{HTTPVersion: HTTPVersionH2C, DisableKeepAlives: true},
+		{HTTPVersion: HTTPVersion2, MaxConnsPerHost: 4},
+		{HTTPVersion: HTTPVersion2, ReadTimeoutInMilliseconds: 500},
+	} {
+		_, _, err := newHTTPClient(&Spec{Transport: &c})
+		if err == nil {
+			t.Errorf("expected %+v to be rejected", c)
+		}
+	}
+}
+
+func TestForcedHTTP2HandshakeTimeout(t *testing.T) {
+	// Accepts connections and never answers the handshake
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	defer l.Close()
+	go func() {
+		var conns []net.Conn
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				break
+			}
+			conns = append(conns, conn)
+		}
+		for _, conn := range conns {
+			conn.Close()
+		}
+	}()
+
+	client, _, err := newHTTPClient(&Spec{Transport: &TransportConfig{
+		HTTPVersion:                  HTTPVersion2,
+		ConnectTimeoutInMilliseconds: 100,
+		TotalTimeoutInMilliseconds:   5000,
+	}})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	start := time.Now()
+	_, err = client.Get("https://" + l.Addr().String())
+	if err == nil || time.Since(start) > 2*time.Second {
+		t.Fatalf("expected the handshake to time out after the connect timeout, got %v after %s", err, time.Since(start))
+	}
+}
@@ -0,0 +1,446 @@
+package tester
+
+import (
+	"context"
+	"crypto/tls"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/VarthanV/load-tester/pkg/liveupdate"
+	"golang.org/x/net/websocket"
+)
+
+const (
+	defaultListenFor = time.Second
+
+	ErrorWebSocketDisconnect = "websocket_disconnect"
+	ErrorWebSocketNoReply    = "websocket_no_reply"
+)
+
+// WebSocketConfig: every virtual user opens a connection, sends the messages
+// on their schedule and listens for what comes back
+type WebSocketConfig struct {
+	// ws:// or wss:// url to connect to
+	URL      string             `json:"url"`
+	Headers  map[string]string  `json:"headers,omitempty"`
+	Messages []WebSocketMessage `json:"messages,omitempty"`
+	// Dotted JSON path of a field the server echoes back in its replies like
+	// id, replies are matched to the sent messages by it for the round trip
+	CorrelationField string `json:"correlation_field,omitempty"`
+	// How long the connection stays open after the last message, defaults
+	// to a second. With a correlation field it closes once every reply is in
+	ListenForInMilliseconds int  `json:"listen_for_in_milliseconds,omitempty"`
+	InsecureSkipVerify      bool `json:"insecure_skip_verify,omitempty"`
+}
+
+// WebSocketMessage: a message sent on the connection, {{vu}} and {{message}},
+// the position of the message, are filled in so messages can be told apart
+type WebSocketMessage struct {
+	// Sent as JSON, text is sent as is
+	Data interface{} `json:"data,omitempty"`
+	Text string      `json:"text,omitempty"`
+	// Wait before sending counted from the previous message or the connect
+	DelayInMilliseconds int `json:"delay_in_milliseconds,omitempty"`
+}
+
+type WebSocketReport struct {
+	Connections        int32   `json:"connections"`
+	FailedConnections  int32   `json:"failed_connections"`
+	AverageConnectTime float64 `json:"average_connect_time"`
+	PeakConnectTime    float64 `json:"peak_connect_time"`
+
+	MessagesSent              int64   `json:"messages_sent"`
+	MessagesReceived          int64   `json:"messages_received"`
+	MessagesSentPerSecond     float64 `json:"messages_sent_per_second"`
+	MessagesReceivedPerSecond float64 `json:"messages_received_per_second"`
+
+	// Replies matched to a sent message by the correlation field
+	RoundTrips         int64      `json:"round_trips"`
+	AverageRoundTrip   float64    `json:"average_round_trip"`
+	P50RoundTrip       float64    `json:"p_50_round_trip"`
+	P90RoundTrip       float64    `json:"p_90_round_trip"`
+	P99RoundTrip       float64    `json:"p_99_round_trip"`
+	RoundTripHistogram *Histogram `json:"round_trip_histogram,omitempty"`
+	// Sent messages that never got a reply before the connection closed
+	MissingReplies int64 `json:"missing_replies"`
+
+	// Connections the server closed or dropped while the user was still on it
+	UnexpectedDisconnects int32 `json:"unexpected_disconnects"`
+}
+
+// Option fn to run a WebSocket scenario instead of making HTTP requests
+func WithWebSocket(c *WebSocketConfig) Option {
+	return withBuiltin(ProtocolWebSocket, c)
+}
+
+type webSocketClient struct {
+	config    *WebSocketConfig
+	header    http.Header
+	listenFor time.Duration
+	stats     *webSocketStats
+}
+
+func newWebSocketClient(c *WebSocketConfig, stats *webSocketStats) (*webSocketClient, error) {
+	u, err := url.Parse(c.URL)
+	if err != nil {
+		return nil, err
+	}
+	if u.Scheme != "ws" && u.Scheme != "wss" {
+		return nil, fmt.Errorf("websocket url %q has to start with ws:// or wss://", c.URL)
+	}
+	for i, m := range c.Messages {
+		if m.Data != nil && m.Text != "" {
+			return nil, fmt.Errorf("websocket message %d takes either data or text", i)
+		}
+		if m.DelayInMilliseconds < 0 {
+			return nil, fmt.Errorf("websocket message %d has a negative delay", i)
+		}
+	}
+	if c.CorrelationField != "" && len(c.Messages) == 0 {
+		return nil, errors.New("websocket correlation field needs messages to correlate")
+	}
+
+	w := &webSocketClient{
+		config:    c,
+		header:    http.Header{},
+		listenFor: defaultListenFor,
+		stats:     stats,
+	}
+	for k, v := range c.Headers {
+		w.header.Set(k, v)
+	}
+	if c.ListenForInMilliseconds > 0 {
+		w.listenFor = time.Duration(c.ListenForInMilliseconds) * time.Millisecond
+	}
+	return w, nil
+}
+
+// Text of the messages for the virtual user
+func (w *webSocketClient) messages(vu int) ([]string, error) {
+	texts := make([]string, 0, len(w.config.Messages))
+	for i, m := range w.config.Messages {
+		text := m.Text
+		if m.Data != nil {
+			marshalled, err := json.Marshal(m.Data)
+			if err != nil {
+				return nil, err
+			}
+			text = string(marshalled)
+		}
+		text = placeholder.ReplaceAllStringFunc(text, func(p string) string {
+			switch placeholder.FindStringSubmatch(p)[1] {
+			case "vu":
+				return strconv.Itoa(vu)
+			case "message":
+				return strconv.Itoa(i + 1)
+			}
+			return p
+		})
+		texts = append(texts, text)
+	}
+	return texts, nil
+}
+
+// Runs a session of the virtual user, the connect time is the time taken of
+// the stat and the session fails on a disconnect or missing reply
+func (w *webSocketClient) call(ctx context.Context, vu int) *RequestStat {
+	stat := &RequestStat{Endpoint: w.config.URL}
+
+	messages, err := w.messages(vu)
+	if err != nil {
+		stat.ErrorCategory = categorizeError(err)
+		return stat
+	}
+
+	cfg, err := websocket.NewConfig(w.config.URL, originOf(w.config.URL))
+	if err != nil {
+		stat.ErrorCategory = categorizeError(err)
+		return stat
+	}
+	cfg.Header = w.header.Clone()
+	cfg.TlsConfig = &tls.Config{InsecureSkipVerify: w.config.InsecureSkipVerify}
+
+	start := time.Now()
+	conn, err := cfg.DialContext(ctx)
+	stat.TimeTakenInSeconds = time.Since(start).Seconds()
+	w.stats.recordConnect(stat.TimeTakenInSeconds, err)
+	if err != nil {
+		stat.ErrorCategory = categorizeError(err)
+		return stat
+	}
+
+	s := &webSocketSession{
+		client:  w,
+		conn:    conn,
+		stat:    stat,
+		pending: map[string]time.Time{},
+		replied: make(chan struct{}),
+		dropped: make(chan struct{}),
+	}
+	s.run(ctx, messages)
+	return stat
+}
+
+func (w *webSocketClient) Prepare(ctx context.Context) error {
+	return nil
+}
+
+func (w *webSocketClient) Execute(ctx context.Context, vu int, record func(*RequestStat)) {
+	record(w.call(ctx, vu))
+}
+
+func (w *webSocketClient) Close() error {
+	return nil
+}
+
+func (w *webSocketClient) AddToReport(r *Report, elapsed time.Duration) {
+	r.WebSocket = w.stats.report(elapsed)
+}
+
+func (w *webSocketClient) liveUpdate() *liveupdate.WebSocketUpdate {
+	return w.stats.update()
+}
+
+type webSocketSession struct {
+	client *webSocketClient
+	conn   *websocket.Conn
+	stat   *RequestStat
+
+	mu      sync.Mutex
+	pending map[string]time.Time
+	sentAll bool
+	replied chan struct{}
+	dropped chan struct{}
+	closing atomic.Bool
+}
+
+func (s *webSocketSession) run(ctx context.Context, messages []string) {
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		s.listen()
+	}()
+
+	disconnected := !s.send(ctx, messages)
+	if !disconnected {
+		listen := time.NewTimer(s.client.listenFor)
+		select {
+		case <-s.replied:
+		case <-s.dropped:
+			disconnected = true
+		case <-listen.C:
+		case <-ctx.Done():
+		}
+		listen.Stop()
+	}
+
+	s.closing.Store(true)
+	s.conn.Close()
+	wg.Wait()
+
+	s.mu.Lock()
+	missing := int64(len(s.pending))
+	s.mu.Unlock()
+	s.client.stats.recordSession(missing, disconnected)
+
+	s.stat.BytesReceivedUncompressed = s.stat.BytesReceived
+	switch {
+	case disconnected:
+		s.stat.ErrorCategory = ErrorWebSocketDisconnect
+	case missing > 0:
+		s.stat.ErrorCategory = ErrorWebSocketNoReply
+	default:
+		s.stat.IsSuccess = true
+	}
+}
+
+// Sends the messages on their schedule, false when the connection dropped
+func (s *webSocketSession) send(ctx context.Context, messages []string) bool {
+	field := s.client.config.CorrelationField
+	for i, text := range messages {
+		if delay := s.client.config.Messages[i].DelayInMilliseconds; delay > 0 {
+			select {
+			case <-time.After(time.Duration(delay) * time.Millisecond):
+			case <-s.dropped:
+				return false
+			case <-ctx.Done():
+				return true
+			}
+		}
+
+		if field != "" {
+			if id, ok := jsonPath([]byte(text), field); ok {
+				s.mu.Lock()
+				s.pending[id] = time.Now()
+				s.mu.Unlock()
+			}
+		}
+		err := websocket.Message.Send(s.conn, text)
+		if err != nil {
+			return false
+		}
+		s.stat.BytesSent += int64(len(text))
+		s.client.stats.recordSent()
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.sentAll = true
+	if field != "" && len(s.pending) == 0 {
+		close(s.replied)
+	}
+	return true
+}
+
+// Reads until the connection closes, replies are matched to the pending
+// messages as they come in
+func (s *webSocketSession) listen() {
+	field := s.client.config.CorrelationField
+	for {
+		var data []byte
+		err := websocket.Message.Receive(s.conn, &data)
+		if err != nil {
+			if !s.closing.Load() {
+				close(s.dropped)
+			}
+			return
+		}
+		s.stat.BytesReceived += int64(len(data))
+		s.client.stats.recordReceived()
+
+		if field == "" {
+			continue
+		}
+		id, ok := jsonPath(data, field)
+		if !ok {
+			continue
+		}
+		s.mu.Lock()
+		sent, ok := s.pending[id]
+		if ok {
+			delete(s.pending, id)
+			s.client.stats.recordRoundTrip(time.Since(sent).Seconds())
+			if s.sentAll && len(s.pending) == 0 {
+				close(s.replied)
+			}
+		}
+		s.mu.Unlock()
+	}
+}
+
+func originOf(raw string) string {
+	u, err := url.Parse(raw)
+	if err != nil {
+		return raw
+	}
+	scheme := "http"
+	if u.Scheme == "wss" {
+		scheme = "https"
+	}
+	return scheme + "://" + u.Host
+}
+
+type webSocketStats struct {
+	mu                    sync.Mutex
+	connectTimes          []float64
+	failedConnections     int32
+	roundTrips            *Histogram
+	roundTripTime         float64
+	roundTripCount        int64
+	missingReplies        int64
+	unexpectedDisconnects int32
+	sent                  atomic.Int64
+	received              atomic.Int64
+}
+
+func (s *webSocketStats) recordConnect(seconds float64, err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err != nil {
+		s.failedConnections++
+		return
+	}
+	s.connectTimes = append(s.connectTimes, seconds)
+}
+
+func (s *webSocketStats) recordSent() {
+	s.sent.Add(1)
+}
+
+func (s *webSocketStats) recordReceived() {
+	s.received.Add(1)
+}
+
+func (s *webSocketStats) recordRoundTrip(seconds float64) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.roundTrips == nil {
+		s.roundTrips = NewHistogram()
+	}
+	s.roundTrips.Record(seconds)
+	s.roundTripTime += seconds
+	s.roundTripCount++
+}
+
+func (s *webSocketStats) recordSession(missingReplies int64, disconnected bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.missingReplies += missingReplies
+	if disconnected {
+		s.unexpectedDisconnects++
+	}
+}
+
+func (s *webSocketStats) update() *liveupdate.WebSocketUpdate {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return &liveupdate.WebSocketUpdate{
+		Connections:           int32(len(s.connectTimes)),
+		MessagesSent:          s.sent.Load(),
+		MessagesReceived:      s.received.Load(),
+		UnexpectedDisconnects: s.unexpectedDisconnects,
+	}
+}
+
+func (s *webSocketStats) report(elapsed time.Duration) *WebSocketReport {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	r := &WebSocketReport{
+		Connections:           int32(len(s.connectTimes)) + s.failedConnections,
+		FailedConnections:     s.failedConnections,
+		PeakConnectTime:       max(s.connectTimes),
+		MessagesSent:          s.sent.Load(),
+		MessagesReceived:      s.received.Load(),
+		RoundTrips:            s.roundTripCount,
+		RoundTripHistogram:    s.roundTrips,
+		MissingReplies:        s.missingReplies,
+		UnexpectedDisconnects: s.unexpectedDisconnects,
+	}
+	if len(s.connectTimes) > 0 {
+		sum := 0.0
+		for _, t := range s.connectTimes {
+			sum += t
+		}
+		r.AverageConnectTime = sum / float64(len(s.connectTimes))
+	}
+	if elapsed > 0 {
+		r.MessagesSentPerSecond = float64(r.MessagesSent) / elapsed.Seconds()
+		r.MessagesReceivedPerSecond = float64(r.MessagesReceived) / elapsed.Seconds()
+	}
+	if s.roundTripCount > 0 {
+		r.AverageRoundTrip = s.roundTripTime / float64(s.roundTripCount)
+		r.P50RoundTrip = s.roundTrips.Percentile(50)
+		r.P90RoundTrip = s.roundTrips.Percentile(90)
+		r.P99RoundTrip = s.roundTrips.Percentile(99)
+	}
+	return r
+}
@@ -0,0 +1,118 @@
+package tester
+
+import (
+	"context"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/google/uuid"
+	"golang.org/x/net/websocket"
+)
+
+func startWebSocketServer(t *testing.T, handler func(*websocket.Conn)) string {
+	t.Helper()
+	srv := httptest.NewServer(websocket.Handler(handler))
+	t.Cleanup(srv.Close)
+	return "ws://" + strings.TrimPrefix(srv.URL, "http://")
+}
+
+func TestWebSocketRoundTrips(t *testing.T) {
+	url := startWebSocketServer(t, func(conn *websocket.Conn) {
+		for {
+			var message string
+			if websocket.Message.Receive(conn, &message) != nil {
+				return
+			}
+			websocket.Message.Send(conn, message)
+		}
+	})
+
+	d, err := New(nil,
+		WithPeakConfig(2, 0, 2),
+		WithWebSocket(&WebSocketConfig{
+			URL: url,
+			Messages: []WebSocketMessage{
+				{Data: map[string]interface{}{"id": "{{vu}}-{{message}}", "text": "hi"}},
+				{Data: map[string]interface{}{"id": "{{vu}}-{{message}}", "text": "there"}, DelayInMilliseconds: 10},
+				{Text: `{"id": "{{vu}}-{{message}}"}`},
+			},
+			CorrelationField: "id",
+		}),
+	)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	d.Run(context.Background(), uuid.New())
+
+	r := d.Report()
+	if r.SucceededRequests != 2 {
+		t.Fatalf("expected 2 successful sessions, got %+v", r)
+	}
+	ws := r.WebSocket
+	if ws == nil {
+		t.Fatal("expected a websocket report")
+	}
+	if ws.Connections != 2 || ws.MessagesSent != 6 || ws.MessagesReceived != 6 || ws.RoundTrips != 6 {
+		t.Errorf("unexpected counts %+v", ws)
+	}
+	if ws.MissingReplies != 0 || ws.UnexpectedDisconnects != 0 || ws.P99RoundTrip <= 0 {
+		t.Errorf("unexpected round trips %+v", ws)
+	}
+}
+
+func TestWebSocketFailures(t *testing.T) {
+	dropping := startWebSocketServer(t, func(conn *websocket.Conn) {
+		var message string
+		websocket.Message.Receive(conn, &message)
+	})
+	silent := startWebSocketServer(t, func(conn *websocket.Conn) {
+		for {
+			var message string
+			if websocket.Message.Receive(conn, &message) != nil {
+				return
+			}
+		}
+	})
+
+	tests := []struct {
+		url      string
+		category string
+	}{
+		{dropping, ErrorWebSocketDisconnect},
+		{silent, ErrorWebSocketNoReply},
+	}
+	for _, tt := range tests {
+		stats := &webSocketStats{}
+		w, err := newWebSocketClient(&WebSocketConfig{
+			URL: tt.url,
+			Messages: []WebSocketMessage{
+				{Data: map[string]interface{}{"id": 1}},
+				{Data: map[string]interface{}{"id": 2}, DelayInMilliseconds: 50},
+			},
+			CorrelationField:        "id",
+			ListenForInMilliseconds: 50,
+		}, stats)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+
+		stat := w.call(context.Background(), 1)
+		if stat.IsSuccess || stat.ErrorCategory != tt.category {
+			t.Errorf("expected %s, got %+v", tt.category, stat)
+		}
+	}
+}
+
+func TestWebSocketConfigErrors(t *testing.T) {
+	configs := []WebSocketConfig{
+		{URL: "http://localhost"},
+		{URL: "ws://localhost", Messages: []WebSocketMessage{{Text: "a", Data: 1}}},
+		{URL: "ws://localhost", CorrelationField: "id"},
+	}
+	for _, c := range configs {
+		if _, err := newWebSocketClient(&c, &webSocketStats{}); err == nil {
+			t.Errorf("expected an error for %+v", c)
+		}
+	}
+}
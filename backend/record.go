@@ -0,0 +1,90 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"os/signal"
+	"regexp"
+	"strconv"
+	"strings"
+	"syscall"
+
+	"github.com/VarthanV/load-tester/pkg/recorder"
+	"github.com/VarthanV/load-tester/pkg/spec"
+)
+
+// Runs a recording proxy until interrupted and writes the recorded session
+// as a test definition
+func runRecord(args []string) {
+	flags := flag.NewFlagSet("record", flag.ExitOnError)
+	host := flags.String("host", "127.0.0.1", "address the proxy listens on, anyone who can reach it can use the proxy")
+	port := flags.Int("port", 8888, "port the proxy listens on")
+	tunnel := flags.String("tunnel", "", "comma separated hosts HTTPS is tunnelled to, CONNECT to others is refused")
+	include := flags.String("include", "", "only record urls matching the regular expression")
+	out := flags.String("out", "", "file to write the definition to, defaults to stdout")
+	output := flags.String("output", spec.FormatYAML, "yaml or json")
+	flags.Parse(args)
+
+	rec := recorder.New()
+	if *tunnel != "" {
+		rec.TunnelHosts = strings.Split(*tunnel, ",")
+	}
+	if *include != "" {
+		re, err := regexp.Compile(*include)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "invalid include:", err)
+			os.Exit(2)
+		}
+		rec.Include = re
+	}
+
+	listener, err := net.Listen("tcp", net.JoinHostPort(*host, strconv.Itoa(*port)))
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "error in starting proxy:", err)
+		os.Exit(2)
+	}
+	server := &http.Server{Handler: rec}
+	go func() {
+		err := server.Serve(listener)
+		if err != nil && !errors.Is(err, http.ErrServerClosed) {
+			fmt.Fprintln(os.Stderr, "proxy stopped:", err)
+		}
+	}()
+
+	fmt.Fprintf(os.Stderr, "recording through http://%s, press Ctrl+C to stop\n", listener.Addr())
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	<-ctx.Done()
+	stop()
+	server.Shutdown(context.Background())
+	rec.Close()
+
+	if len(rec.Exchanges()) == 0 {
+		fmt.Fprintln(os.Stderr, "no requests were recorded")
+		os.Exit(1)
+	}
+
+	result := rec.Definition()
+	for _, w := range result.Warnings {
+		fmt.Fprintln(os.Stderr, "warning:", w)
+	}
+
+	definition, err := spec.Marshal(result.Definition, *output)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "error in writing definition:", err)
+		os.Exit(2)
+	}
+	if *out == "" {
+		os.Stdout.Write(definition)
+		return
+	}
+	err = os.WriteFile(*out, definition, 0644)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "error in writing definition:", err)
+		os.Exit(2)
+	}
+}
@@ -0,0 +1,95 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"os"
+
+	"github.com/VarthanV/load-tester/pkg/liveupdate"
+	"github.com/VarthanV/load-tester/pkg/replay"
+	"github.com/VarthanV/load-tester/pkg/tester"
+	"github.com/sirupsen/logrus"
+)
+
+// Replays an access log against a base url keeping the recorded timing
+func runReplay(args []string) {
+	flags := flag.NewFlagSet("replay", flag.ExitOnError)
+	baseURL := flags.String("base-url", "", "url the logged paths are replayed against")
+	speed := flags.Float64("speed", 1, "speed multiplier, 2 replays twice as fast as recorded")
+	filter := flags.String("filter", "", "only replay paths matching the regular expression")
+	format := flags.String("format", "", "nginx or jsonl, guessed from the file name when empty")
+	concurrency := flags.Int("concurrency", 0, "max requests in flight, defaults to 100")
+	out := flags.String("out", "", "file to write the report to, defaults to stdout")
+	reportFormat := flags.String("report-format", reportJSON, "json, html, csv, jsonl or junit")
+	samples := flags.String("samples", "", "gzipped file to log the requests to, csv when the name has .csv and ndjson otherwise")
+	quiet := flags.Bool("quiet", false, "don't print the progress line")
+	verbose := flags.Bool("verbose", false, "print the logs of every request")
+	flags.Usage = func() {
+		fmt.Fprintln(os.Stderr, "usage: load-tester replay -base-url <url> [flags] <access.log>")
+		flags.PrintDefaults()
+	}
+	flags.Parse(args)
+
+	if flags.NArg() != 1 || *baseURL == "" {
+		flags.Usage()
+		os.Exit(2)
+	}
+
+	if !*verbose {
+		logrus.SetLevel(logrus.FatalLevel)
+		log.SetOutput(io.Discard)
+	}
+
+	output := reportOutput{path: *out, format: *reportFormat, name: "replay"}
+	err := output.validate()
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(2)
+	}
+
+	if *format == "" {
+		*format = replay.DetectFormat(flags.Arg(0))
+	}
+	f, err := os.Open(flags.Arg(0))
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "error in opening log:", err)
+		os.Exit(2)
+	}
+	l, err := replay.Parse(f, *format)
+	f.Close()
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "error in reading log:", err)
+		os.Exit(2)
+	}
+	if l.Skipped > 0 {
+		fmt.Fprintf(os.Stderr, "skipped %d lines that are not requests\n", l.Skipped)
+	}
+
+	opts := []tester.Option{
+		tester.WithPeakConfig(*concurrency, 0, 0),
+		tester.WithReplay(&tester.ReplayConfig{
+			BaseURL:    *baseURL,
+			Speed:      *speed,
+			PathFilter: *filter,
+		}, l.Entries...),
+	}
+	if *samples != "" {
+		logger, err := sampleLogger(*samples, nil)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "error in creating sample log:", err)
+			os.Exit(2)
+		}
+		opts = append(opts, tester.WithObservers(logger))
+	}
+
+	updates := liveupdate.New()
+	driver, err := tester.New(updates, opts...)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "error in creating load tester:", err)
+		os.Exit(2)
+	}
+
+	execute(driver, updates, *quiet, output)
+}
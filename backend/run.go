@@ -0,0 +1,255 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"slices"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/VarthanV/load-tester/pkg/htmlreport"
+	"github.com/VarthanV/load-tester/pkg/liveupdate"
+	"github.com/VarthanV/load-tester/pkg/spec"
+	"github.com/VarthanV/load-tester/pkg/tester"
+	"github.com/google/uuid"
+	"github.com/sirupsen/logrus"
+)
+
+// Runs the test described in a file without the API server, exits with 1
+// when a threshold fails and 2 when the test can't be run
+func runCLI(args []string) {
+	flags := flag.NewFlagSet("run", flag.ExitOnError)
+	out := flags.String("out", "", "file to write the report to, defaults to stdout")
+	reportFormat := flags.String("report-format", reportJSON, "json, html, csv, jsonl or junit")
+	samples := flags.String("samples", "", "gzipped file to log the requests to, csv when the name has .csv and ndjson otherwise")
+	quiet := flags.Bool("quiet", false, "don't print the progress line")
+	verbose := flags.Bool("verbose", false, "print the logs of every request")
+	flags.Usage = func() {
+		fmt.Fprintln(os.Stderr, "usage: load-tester run [flags] <test.yaml|test.json>")
+		flags.PrintDefaults()
+	}
+	flags.Parse(args)
+
+	if flags.NArg() != 1 {
+		flags.Usage()
+		os.Exit(2)
+	}
+
+	// The per request logs would drown the progress line
+	if !*verbose {
+		logrus.SetLevel(logrus.FatalLevel)
+		log.SetOutput(io.Discard)
+	}
+
+	output := reportOutput{path: *out, format: *reportFormat}
+	err := output.validate()
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(2)
+	}
+
+	s, err := spec.Load(flags.Arg(0))
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "error in loading test:", err)
+		os.Exit(2)
+	}
+	output.name = s.Name
+	output.definition = s
+
+	opts := s.Options()
+	if *samples != "" {
+		logger, err := sampleLogger(*samples, s.Samples)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "error in creating sample log:", err)
+			os.Exit(2)
+		}
+		opts = append(opts, tester.WithObservers(logger))
+	}
+
+	updates := liveupdate.New()
+	driver, err := tester.New(updates, opts...)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "error in creating load tester:", err)
+		os.Exit(2)
+	}
+
+	execute(driver, updates, *quiet, output)
+}
+
+// Formats of the report besides the export formats, json as the API returns
+// it and html as a page with charts
+const (
+	reportJSON = "json"
+	reportHTML = "html"
+)
+
+// reportOutput: where and in which format the report of a command goes
+type reportOutput struct {
+	// File to write to, stdout when empty
+	path   string
+	format string
+	// Name of the test, the suite name in JUnit XML
+	name string
+	// Summarized in the HTML report when set
+	definition *spec.Spec
+	started    time.Time
+}
+
+func (o *reportOutput) validate() error {
+	if o.format == reportJSON || o.format == reportHTML || slices.Contains(tester.ExportFormats(), o.format) {
+		return nil
+	}
+	return fmt.Errorf("unknown report format %q, expected json, html or one of %s",
+		o.format, strings.Join(tester.ExportFormats(), ", "))
+}
+
+// Logs the requests to path at the rate of the definition, the format of
+// the definition wins over the one of the name
+func sampleLogger(path string, c *tester.SampleConfig) (tester.Observer, error) {
+	config := tester.SampleConfig{}
+	if c != nil {
+		config = *c
+	}
+	if config.Format == "" && strings.Contains(filepath.Base(path), ".csv") {
+		config.Format = tester.SamplesCSV
+	}
+
+	f, err := os.Create(path)
+	if err != nil {
+		return nil, err
+	}
+	return tester.NewSampleLogger(f, &config), nil
+}
+
+// runner: the tester driver as seen by the commands
+type runner interface {
+	Run(ctx context.Context, testID uuid.UUID)
+	Report() *tester.Report
+}
+
+// Runs the driver until it's done or interrupted, writes the report and
+// exits with 1 when a threshold failed
+func execute(driver runner, updates liveupdate.Updater, quiet bool, out reportOutput) {
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	testID := uuid.New()
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		driver.Run(ctx, testID)
+	}()
+
+	start := time.Now()
+	ticker := time.NewTicker(500 * time.Millisecond)
+	defer ticker.Stop()
+
+wait:
+	for {
+		select {
+		case <-done:
+			break wait
+		case <-ticker.C:
+			if !quiet {
+				printProgress(updates, testID, start)
+			}
+		}
+	}
+	if !quiet {
+		printProgress(updates, testID, start)
+		fmt.Fprintln(os.Stderr)
+	}
+
+	report := driver.Report()
+	out.started = start
+	err := writeReport(report, out)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "error in writing report:", err)
+		os.Exit(2)
+	}
+
+	for _, t := range report.Thresholds {
+		verdict := "PASS"
+		if !t.Passed {
+			verdict = "FAIL"
+		}
+		fmt.Fprintf(os.Stderr, "%s %s = %g\n", verdict, t.Metric, t.Value)
+	}
+	if !report.ThresholdsPassed() {
+		os.Exit(1)
+	}
+}
+
+// Checks definition files without running them, exits with 1 when any of
+// them is invalid
+func runValidate(args []string) {
+	if len(args) == 0 {
+		fmt.Fprintln(os.Stderr, "usage: load-tester validate <test.yaml|test.json>...")
+		os.Exit(2)
+	}
+
+	invalid := false
+	for _, path := range args {
+		_, err := spec.Load(path)
+		if err != nil {
+			invalid = true
+			fmt.Fprintf(os.Stderr, "%s: %v\n", path, err)
+			continue
+		}
+		fmt.Fprintf(os.Stderr, "%s: ok\n", path)
+	}
+	if invalid {
+		os.Exit(1)
+	}
+}
+
+func printProgress(updates liveupdate.Updater, testID uuid.UUID, start time.Time) {
+	u, err := updates.Get(testID)
+	if err != nil {
+		return
+	}
+	fmt.Fprintf(os.Stderr, "\r[%s] requests %d/%d succeeded %d failed %d",
+		time.Since(start).Truncate(time.Second),
+		u.TotalNumberofRequestsDone, u.TargetUsers,
+		u.SucceededRequests, u.FailedRequests)
+}
+
+func writeReport(report *tester.Report, out reportOutput) error {
+	var (
+		marshalled bytes.Buffer
+		err        error
+	)
+	switch out.format {
+	case reportJSON:
+		enc := json.NewEncoder(&marshalled)
+		enc.SetIndent("", "  ")
+		err = enc.Encode(report)
+	case reportHTML:
+		err = htmlreport.Render(&marshalled, &htmlreport.Page{
+			Name:       out.name,
+			StartedAt:  out.started,
+			Report:     report,
+			Definition: out.definition,
+		})
+	default:
+		err = report.Export(&marshalled, out.format, out.name)
+	}
+	if err != nil {
+		return err
+	}
+
+	if out.path == "" {
+		_, err = os.Stdout.Write(marshalled.Bytes())
+		return err
+	}
+	return os.WriteFile(out.path, marshalled.Bytes(), 0644)
+}